@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/VitaminP8/postery/internal/auth"
+)
+
+const keysUsage = `usage: server keys <command> [flags]
+
+commands:
+  rotate  создать новый ключ подписи (прежний остается для проверки выданных токенов)
+  list    показать ключи
+  prune   удалить выведенные ключи, все токены которых уже истекли
+
+flags:
+  -file   файл ключей (по умолчанию JWT_KEYS_FILE)
+  -alg    алгоритм нового ключа для rotate: RS256 или EdDSA (по умолчанию RS256)
+`
+
+// runKeys выполняет подкоманду "keys" и возвращает код выхода
+func runKeys(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, keysUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("keys "+args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	file := fs.String("file", os.Getenv("JWT_KEYS_FILE"), "файл ключей")
+	alg := fs.String("alg", auth.AlgRS256, "алгоритм нового ключа (RS256 или EdDSA)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *file == "" {
+		fmt.Fprintln(stderr, "key file is not set: use -file or JWT_KEYS_FILE")
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "rotate":
+		err = rotateKeys(*file, *alg, stdout)
+	case "list":
+		err = listKeys(*file, stdout)
+	case "prune":
+		err = pruneKeys(*file, stdout)
+	default:
+		fmt.Fprint(stderr, keysUsage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// loadOrCreateKeySet читает файл ключей; отсутствующий файл означает пустой набор (первый запуск)
+func loadOrCreateKeySet(path string) (*auth.KeySet, error) {
+	ks, err := auth.LoadKeySet(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return auth.NewKeySet(), nil
+	}
+	return ks, err
+}
+
+func rotateKeys(path, alg string, out io.Writer) error {
+	ks, err := loadOrCreateKeySet(path)
+	if err != nil {
+		return err
+	}
+
+	key, err := ks.Rotate(alg, time.Now())
+	if err != nil {
+		return err
+	}
+	err = ks.Save(path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "new signing key %s (%s)\n", key.ID, key.Algorithm)
+	return nil
+}
+
+func listKeys(path string, out io.Writer) error {
+	ks, err := auth.LoadKeySet(path)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range ks.Keys() {
+		status := "active"
+		if key.RetiredAt != nil {
+			status = "retired " + key.RetiredAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(out, "%s\t%s\tcreated %s\t%s\n", key.ID, key.Algorithm, key.CreatedAt.Format(time.RFC3339), status)
+	}
+	return nil
+}
+
+func pruneKeys(path string, out io.Writer) error {
+	ks, err := auth.LoadKeySet(path)
+	if err != nil {
+		return err
+	}
+
+	removed := ks.Prune(time.Now(), auth.TokenTTL)
+	if len(removed) == 0 {
+		fmt.Fprintln(out, "nothing to prune")
+		return nil
+	}
+
+	err = ks.Save(path)
+	if err != nil {
+		return err
+	}
+	for _, id := range removed {
+		fmt.Fprintf(out, "removed key %s\n", id)
+	}
+	return nil
+}
+
+// keysReloadInterval - как часто сервер перечитывает файл ключей, чтобы подхватить ротацию без перезапуска
+const keysReloadInterval = time.Minute
+
+func reloadKeys(ks *auth.KeySet, path string) {
+	ticker := time.NewTicker(keysReloadInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := ks.Reload(path); err != nil {
+			log.Printf("failed to reload JWT keys: %v", err)
+		}
+	}
+}
@@ -8,35 +8,113 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
 	"syscall"
+	"time"
 
-	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/VitaminP8/postery/internal/audit"
 	"github.com/VitaminP8/postery/internal/auth"
 	"github.com/VitaminP8/postery/internal/comment"
 	"github.com/VitaminP8/postery/internal/config"
+	"github.com/VitaminP8/postery/internal/export"
+	"github.com/VitaminP8/postery/internal/invite"
+	"github.com/VitaminP8/postery/internal/loginguard"
+	"github.com/VitaminP8/postery/internal/mention"
+	"github.com/VitaminP8/postery/internal/oidc"
+	"github.com/VitaminP8/postery/internal/password"
 	"github.com/VitaminP8/postery/internal/post"
+	"github.com/VitaminP8/postery/internal/presence"
+	"github.com/VitaminP8/postery/internal/relation"
 	"github.com/VitaminP8/postery/internal/subscription"
+	"github.com/VitaminP8/postery/internal/totp"
 	"github.com/VitaminP8/postery/internal/user"
+	"github.com/VitaminP8/postery/internal/webhook"
 
 	"github.com/VitaminP8/postery/graph"
-	"github.com/VitaminP8/postery/graph/generated"
+	"github.com/VitaminP8/postery/graph/model"
 	"github.com/VitaminP8/postery/internal/storage/memory"
 	"github.com/VitaminP8/postery/internal/storage/postgres"
 	"github.com/VitaminP8/postery/models"
 )
 
 func main() {
+	// подкоманда управления ключами подписи JWT: server keys rotate|list|prune
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		config.LoadEnv()
+		os.Exit(runKeys(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	storageType := flag.String("storage", "memory", "Тип хранилища: storage или postgres")
 	flag.Parse()
 
 	// загружаем .env из нашего config.go
 	config.LoadEnv()
 
+	// Параметры argon2id для новых паролей (PASSWORD_ARGON2_*); старые bcrypt хэши пересчитываются при входе
+	passwordParams, err := password.ParamsFromEnv()
+	if err != nil {
+		log.Fatalf("invalid password hashing settings: %v", err)
+	}
+	password.SetDefault(password.NewHasher(passwordParams))
+
+	// Список распространенных паролей из PASSWORD_BLOCKLIST_FILE; встроенный список - только заглушка
+	blocklistSize, err := password.LoadBlocklistFromEnv()
+	if err != nil {
+		log.Fatalf("invalid password blocklist: %v", err)
+	}
+	if os.Getenv("PASSWORD_BLOCKLIST_FILE") == "" {
+		log.Printf("PASSWORD_BLOCKLIST_FILE is not set, using built-in list of %d common passwords", blocklistSize)
+	}
+
+	// Асимметричная подпись токенов: ключи из JWT_KEYS_FILE (создаются командой "server keys rotate"),
+	// без файла токены подписываются HS256 секретом JWT_SECRET
+	var keySet *auth.KeySet
+	if keysFile := os.Getenv("JWT_KEYS_FILE"); keysFile != "" {
+		keySet, err = auth.LoadKeySet(keysFile)
+		if err != nil {
+			log.Fatalf("failed to load JWT keys: %v", err)
+		}
+		auth.SetKeySet(keySet)
+		go reloadKeys(keySet, keysFile)
+	}
+
+	// Режим регистрации (REGISTRATION_MODE): open (по умолчанию), invite-only или closed
+	registrationMode, err := invite.ParseMode(os.Getenv("REGISTRATION_MODE"))
+	if err != nil {
+		log.Fatalf("invalid registration settings: %v", err)
+	}
+
 	var postStore post.PostStorage
 	var commentStore comment.CommentStorage
 	var userStore user.UserStorage
 	var subMngr subscription.Manager
+	var revocationStore auth.RevocationStorage
+	var accessTokenStore auth.AccessTokenStorage
+	var relationStore relation.RelationStorage
+	var sessionStore auth.SessionStorage
+	var mentionStore mention.MentionStorage
+	var inviteStore invite.InviteStorage
+	var accountStore user.AccountStorage
+	var webhookStore webhook.WebhookStorage
+	var notifyMngr *postgres.NotifyManager
+	var webhookDispatcher *webhook.Dispatcher
+
+	// Доставка подписок (SUBSCRIPTION_BACKEND): memory (по умолчанию) - в пределах одного процесса,
+	// postgres - через LISTEN/NOTIFY между всеми экземплярами сервера, только с --storage=postgres
+	subscriptionBackend := config.GetEnvDefault("SUBSCRIPTION_BACKEND", "memory")
+	if subscriptionBackend != "memory" && subscriptionBackend != "postgres" {
+		log.Fatalf("unknown subscription backend: %s", subscriptionBackend)
+	}
+	if subscriptionBackend == "postgres" && *storageType != "postgres" {
+		log.Fatal("SUBSCRIPTION_BACKEND=postgres requires --storage=postgres")
+	}
+	localSubMngr := newSubscriptionManager()
+
+	// Вебхуки: события, опубликованные хранилищами, ставятся в очередь доставки. WEBHOOK_ALLOW_PRIVATE=true
+	// разрешает адреса во внутренней сети (локальная разработка), иначе они отклоняются при соединении
+	allowPrivateWebhooks := os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true"
 
 	switch *storageType {
 	case "postgres":
@@ -45,43 +123,168 @@ func main() {
 			log.Fatalf("failed to connect to the database: %v", err)
 		}
 
-		err = postgres.DB.AutoMigrate(&models.User{}, &models.Post{}, &models.Comment{}).Error
+		err = postgres.DB.AutoMigrate(&models.User{}, &models.Post{}, &models.Comment{}, &models.TokenRevocation{}, &models.UserIdentity{}, &models.AccessToken{}, &models.UserTwoFactor{}, &models.UserRelation{}, &models.Session{}, &models.UsernameChange{}, &models.Mention{}, &models.Invite{}, &models.InviteRedemption{}, &models.SubscriptionEvent{}, &models.SubscriptionTopic{}, &models.Webhook{}, &models.WebhookDelivery{}, &models.WebhookAttempt{}).Error
 		if err != nil {
 			log.Fatalf("failed to migrate database: %v", err)
 		}
+		err = postgres.MigrateUserKeys()
+		if err != nil {
+			log.Fatalf("failed to migrate user keys: %v", err)
+		}
 
 		log.Println("Используется PostgreSQL хранилище")
-		subMngr = subscription.NewSubscriptionManager()
-		postStore = postgres.NewPostPostgresStorage()
+		if subscriptionBackend == "postgres" {
+			notifyMngr, err = postgres.NewNotifyManager(postgres.DSN(), localSubMngr)
+			if err != nil {
+				log.Fatalf("failed to start subscription listener: %v", err)
+			}
+			log.Println("Подписки доставляются через PostgreSQL LISTEN/NOTIFY")
+			subMngr = notifyMngr
+		} else {
+			subMngr = localSubMngr
+		}
+		webhookStore = postgres.NewWebhookPostgresStorage()
+		webhookDispatcher = webhook.NewDispatcher(webhookStore, allowPrivateWebhooks)
+		subMngr = webhookDispatcher.Wrap(subMngr)
+		postgresPosts := postgres.NewPostPostgresStorage(subMngr)
+		postStore = postgresPosts
 		commentStore = postgres.NewCommentPostgresStorage(subMngr)
 		userStore = postgres.NewUserPostgresStorage()
+		revocationStore = postgres.NewRevocationPostgresStorage()
+		accessTokenStore = postgres.NewAccessTokenPostgresStorage()
+		relationStore = postgres.NewRelationPostgresStorage()
+		sessionStore = postgres.NewSessionPostgresStorage()
+		mentionStore = postgres.NewMentionPostgresStorage()
+		inviteStore = postgres.NewInvitePostgresStorage()
+		accountStore = postgres.NewAccountPostgresStorage(postgresPosts)
 
 	case "memory":
 		log.Println("Используется in-memory хранилище")
-		subMngr = subscription.NewSubscriptionManager()
-		postStore = memory.NewPostMemoryStorage()
+		subMngr = localSubMngr
+		webhookStore = memory.NewWebhookMemoryStorage()
+		webhookDispatcher = webhook.NewDispatcher(webhookStore, allowPrivateWebhooks)
+		subMngr = webhookDispatcher.Wrap(subMngr)
+		postStore = memory.NewPostMemoryStorage(subMngr)
 		commentStore = memory.NewCommentMemoryStorage(postStore, subMngr)
 		userStore = memory.NewUserMemoryStorage()
+		revocationStore = memory.NewRevocationMemoryStorage()
+		accessTokenStore = memory.NewAccessTokenMemoryStorage()
+		relationStore = memory.NewRelationMemoryStorage()
+		sessionStore = memory.NewSessionMemoryStorage()
+		mentionStore = memory.NewMentionMemoryStorage()
+		inviteStore = memory.NewInviteMemoryStorage()
+		accountStore = &memory.AccountMemoryStorage{
+			Users:        userStore,
+			Posts:        postStore,
+			Comments:     commentStore,
+			Relations:    relationStore,
+			Mentions:     mentionStore,
+			Webhooks:     webhookStore,
+			Sessions:     sessionStore,
+			AccessTokens: accessTokenStore,
+		}
 
 	default:
 		log.Fatalf("неизвестный тип хранилища: %s", *storageType)
 	}
 
+	// Первый администратор создается при запуске (BOOTSTRAP_ADMIN_USERNAME, _EMAIL, _PASSWORD), а не через API:
+	// иначе любой, кто первым зарегистрирует нужное имя, получил бы права администратора
+	seedAdmin(userStore)
+
+	// Экспорт данных пользователей: архивы пишутся в EXPORT_DIR, ссылки подписываются EXPORT_SIGNING_KEY (или JWT_SECRET,
+	// а без них - случайным ключом процесса)
+	exportManager, err := export.NewManager(
+		config.GetEnvDefault("EXPORT_DIR", filepath.Join(os.TempDir(), "postery-exports")),
+		[]byte(config.GetEnvDefault("EXPORT_SIGNING_KEY", os.Getenv("JWT_SECRET"))),
+		userStore,
+		postStore,
+		commentStore,
+	)
+	if err != nil {
+		log.Fatalf("failed to create export manager: %v", err)
+	}
+
+	// Секреты TOTP шифруются ключом TOTP_ENCRYPTION_KEY (по умолчанию JWT_SECRET); без ключа 2FA выключена
+	var totpCipher *totp.Cipher
+	if key := config.GetEnvDefault("TOTP_ENCRYPTION_KEY", os.Getenv("JWT_SECRET")); key != "" {
+		totpCipher, err = totp.NewCipher([]byte(key))
+		if err != nil {
+			log.Fatalf("invalid TOTP encryption key: %v", err)
+		}
+	} else {
+		log.Println("TOTP_ENCRYPTION_KEY не задан, двухфакторная аутентификация отключена")
+	}
+
 	// Инициализация резолвера
 	resolver := &graph.Resolver{
 		PostStore:           postStore,
 		CommentStore:        commentStore,
 		UserStore:           userStore,
+		Accounts:            accountStore,
 		SubscriptionManager: subMngr,
+		SubscriptionLimiter: newSubscriptionLimiter(),
+		Revocations:         revocationStore,
+		AccessTokenStore:    accessTokenStore,
+		SessionStore:        sessionStore,
+		Relations:           relationStore,
+		Mentions:            mentionStore,
+		Invites:             inviteStore,
+		RegistrationMode:    registrationMode,
+		ExportManager:       exportManager,
+		LoginGuard:          loginguard.New(loginguard.DefaultConfig()),
+		Audit:               audit.NewStdLogger(nil),
+		TotpCipher:          totpCipher,
+		LoginChallenges:     totp.NewChallenges(),
+		Presence:            presence.NewTracker(subMngr),
+		Webhooks:            webhookStore,
+		WebhookDispatcher:   webhookDispatcher,
+	}
+
+	// Authenticator.Middleware - http.Handler, который получает запрос, вытаскивает JWT токен из заголовка, проверяет и валидирует его
+	// (в том числе на отзыв), сохраняет userID в context; также принимает персональные токены доступа
+	// TRUST_PROXY=true - сервер стоит за прокси, IP клиента берется из X-Forwarded-For
+	authenticator := &auth.Authenticator{
+		Revocations:       revocationStore,
+		AccessTokens:      accessTokenStore,
+		Sessions:          sessionStore,
+		Roles:             userStore,
+		TrustForwardedFor: os.Getenv("TRUST_PROXY") == "true",
 	}
 
-	// Создаем новый сервер GraphQL с резолверами
-	srv := handler.NewDefaultServer(generated.NewExecutableSchema(generated.Config{
-		Resolvers: resolver,
-	}))
+	// Создаем новый сервер GraphQL с резолверами; websocket соединения аутентифицируются токеном из connection_init
+	srv := graph.NewServer(resolver, authenticator)
+	http.Handle("/query", authenticator.Middleware(srv))
+	// Подписки через Server-Sent Events для клиентов за прокси, которые не пропускают websocket; авторизация та же
+	http.Handle(graph.SSEPath, authenticator.Middleware(graph.NewSSEServer(resolver, graph.DefaultSSEHeartbeat)))
+	// Скачивание архивов экспорта по подписанной ссылке (подпись заменяет авторизацию)
+	http.Handle(export.DownloadPath, exportManager.DownloadHandler())
+
+	// записи сессий, токены которых истекли, удаляются раз в час
+	go pruneSessions(sessionStore)
 
-	// AuthMiddleware - http.Handler, который получает запрос, вытаскивает JWT токен из заголовка, проверяет и валидирует его, сохраняет userID в context,
-	http.Handle("/query", auth.AuthMiddleware(srv))
+	// отправка доставок вебхуков и повторы; останавливается при завершении
+	webhookCtx, stopWebhooks := context.WithCancel(context.Background())
+	go webhookDispatcher.Run(webhookCtx)
+
+	if keySet != nil {
+		http.Handle(auth.JWKSPath, keySet.JWKSHandler())
+	}
+
+	// Вход через OIDC провайдера включается, если заданы OIDC_ISSUER, OIDC_CLIENT_ID и OIDC_REDIRECT_URL
+	if oidcConfig, ok := oidc.ConfigFromEnv(); ok {
+		// вход через провайдера завершается так же, как вход по паролю: ограничение попыток и 2FA
+		oidcHandler, err := oidc.NewHandler(oidcConfig, userStore, resolver.LoginExternal)
+		if err != nil {
+			log.Fatalf("failed to set up OIDC login: %v", err)
+		}
+		// новые аккаунты через OIDC создаются только при открытой регистрации
+		oidcHandler.DisableSignup = registrationMode != invite.ModeOpen
+		http.Handle(oidc.LoginPath, oidcHandler.LoginHandler())
+		// middleware кладет в context IP и User-Agent для сессии
+		http.Handle(oidc.CallbackPath, authenticator.Middleware(oidcHandler.CallbackHandler()))
+		log.Printf("OIDC login enabled for issuer %s", oidcConfig.Issuer)
+	}
 	// Страница с тестовым интерфейсом Playground
 	http.Handle("/", playground.Handler("GraphQL Playground", "/query"))
 
@@ -114,6 +317,19 @@ func main() {
 
 	log.Println("Завершение...")
 
+	// дожидаемся фоновых задач экспорта
+	exportManager.Wait()
+
+	// неотправленные доставки останутся в очереди до следующего запуска
+	stopWebhooks()
+
+	if notifyMngr != nil {
+		err := notifyMngr.Close()
+		if err != nil {
+			log.Printf("Ошибка при остановке подписок: %v", err)
+		}
+	}
+
 	if *storageType == "postgres" {
 		err := postgres.CloseDB()
 		if err != nil {
@@ -127,3 +343,86 @@ func main() {
 
 	log.Println("Сервер остановлен корректно")
 }
+
+// seedAdmin создает администратора из BOOTSTRAP_ADMIN_*, если аккаунта с таким именем еще нет.
+// Существующий аккаунт не повышается: имя мог занять обычный пользователь. Следующих администраторов
+// назначает мутация setUserRole.
+func seedAdmin(userStore user.UserStorage) {
+	username := os.Getenv("BOOTSTRAP_ADMIN_USERNAME")
+	if username == "" {
+		return
+	}
+
+	existing, err := userStore.GetUserByUsername(username)
+	if err == nil {
+		if existing.Role != model.RoleAdmin {
+			log.Printf("BOOTSTRAP_ADMIN_USERNAME %s belongs to a non-admin account, administrator was not created", username)
+		}
+		return
+	}
+
+	_, err = userStore.CreateAdmin(username, os.Getenv("BOOTSTRAP_ADMIN_EMAIL"), os.Getenv("BOOTSTRAP_ADMIN_PASSWORD"))
+	if err != nil {
+		log.Fatalf("failed to create administrator %s: %v", username, err)
+	}
+	log.Printf("Создан администратор %s", username)
+}
+
+// newSubscriptionLimiter задает ограничения числа одновременных подписок: SUBSCRIPTION_LIMIT_PER_USER,
+// SUBSCRIPTION_LIMIT_PER_IP, SUBSCRIPTION_LIMIT_PER_CONNECTION и SUBSCRIPTION_LIMIT_TOTAL (0 - без ограничения)
+func newSubscriptionLimiter() *subscription.Limiter {
+	limits := subscription.DefaultLimits()
+	for name, limit := range map[string]*int{
+		"SUBSCRIPTION_LIMIT_PER_USER":       &limits.PerUser,
+		"SUBSCRIPTION_LIMIT_PER_IP":         &limits.PerIP,
+		"SUBSCRIPTION_LIMIT_PER_CONNECTION": &limits.PerConnection,
+		"SUBSCRIPTION_LIMIT_TOTAL":          &limits.Total,
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			log.Fatalf("invalid %s: %q", name, value)
+		}
+		*limit = n
+	}
+	return subscription.NewLimiter(limits)
+}
+
+// newSubscriptionManager настраивает доставку событий подписчикам: SUBSCRIPTION_QUEUE_SIZE - на сколько событий
+// подписчик может отстать, SUBSCRIPTION_OVERFLOW - что делать с отставшим (drop-oldest, drop-newest или disconnect)
+func newSubscriptionManager() *subscription.SubscriptionManager {
+	m := subscription.NewSubscriptionManager()
+
+	if size := os.Getenv("SUBSCRIPTION_QUEUE_SIZE"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n < 1 {
+			log.Fatalf("invalid SUBSCRIPTION_QUEUE_SIZE: %q", size)
+		}
+		m.QueueSize = n
+	}
+
+	policy, err := subscription.ParseOverflowPolicy(os.Getenv("SUBSCRIPTION_OVERFLOW"))
+	if err != nil {
+		log.Fatalf("invalid subscription settings: %v", err)
+	}
+	m.Overflow = policy
+	return m
+}
+
+// интервал удаления истекших сессий
+const sessionsPruneInterval = time.Hour
+
+// pruneSessions периодически удаляет сессии, токены которых уже истекли
+func pruneSessions(store auth.SessionStorage) {
+	ticker := time.NewTicker(sessionsPruneInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := store.DeleteSessionsBefore(time.Now().Add(-auth.TokenTTL)); err != nil {
+			log.Printf("failed to prune sessions: %v", err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/auth"
+)
+
+// maxAccessTokenNameLength - ограничение длины названия токена
+const maxAccessTokenNameLength = 100
+
+var errAccessTokensDisabled = errors.New("access tokens are not configured")
+
+// createAccessToken выпускает персональный токен доступа; сам токен возвращается только здесь
+func (r *Resolver) createAccessToken(ctx context.Context, name string, scopes []model.AccessTokenScope, expiresAt *string) (*model.CreatedAccessToken, error) {
+	if r.AccessTokenStore == nil {
+		return nil, errAccessTokensDisabled
+	}
+
+	userID, err := auth.GetUserIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxAccessTokenNameLength {
+		return nil, fmt.Errorf("token name must be 1-%d characters", maxAccessTokenNameLength)
+	}
+	if len(scopes) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+
+	token := &auth.AccessToken{
+		UserID: userID,
+		Name:   name,
+	}
+
+	// дубликаты областей убираем, порядок сохраняем
+	seen := make(map[model.AccessTokenScope]bool)
+	for _, scope := range scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			token.Scopes = append(token.Scopes, scope.String())
+		}
+	}
+
+	if expiresAt != nil {
+		expires, err := time.Parse(time.RFC3339, *expiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expiresAt: %w", err)
+		}
+		if !expires.After(time.Now()) {
+			return nil, errors.New("expiresAt must be in the future")
+		}
+		token.ExpiresAt = &expires
+	}
+
+	secret, hash, err := auth.NewAccessTokenSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := r.AccessTokenStore.CreateAccessToken(token, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.CreatedAccessToken{
+		Token:       secret,
+		AccessToken: toAccessToken(created),
+	}, nil
+}
+
+func toAccessToken(token *auth.AccessToken) *model.AccessToken {
+	result := &model.AccessToken{
+		ID:        token.ID,
+		Name:      token.Name,
+		Scopes:    make([]model.AccessTokenScope, 0, len(token.Scopes)),
+		CreatedAt: token.CreatedAt.Format(time.RFC3339),
+	}
+
+	for _, scope := range token.Scopes {
+		result.Scopes = append(result.Scopes, model.AccessTokenScope(scope))
+	}
+	if token.ExpiresAt != nil {
+		expiresAt := token.ExpiresAt.Format(time.RFC3339)
+		result.ExpiresAt = &expiresAt
+	}
+	if token.LastUsedAt != nil {
+		lastUsedAt := token.LastUsedAt.Format(time.RFC3339)
+		result.LastUsedAt = &lastUsedAt
+	}
+
+	return result
+}
@@ -0,0 +1,60 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/auth"
+)
+
+var errAccountsDisabled = errors.New("account deletion is not configured")
+
+// deleteAccount удаляет аккаунт текущего пользователя: проверяет пароль, отзывает выданные токены, затем одной
+// операцией хранилища удаляет или анонимизирует его контент и удаляет учетные данные, сессии и токены доступа
+func (r *Resolver) deleteAccount(ctx context.Context, password string, mode model.ContentDeletionMode) error {
+	if r.Accounts == nil {
+		return errAccountsDisabled
+	}
+
+	userID, err := auth.GetUserIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	id := fmt.Sprint(userID)
+
+	err = r.UserStore.CheckPassword(id, password)
+	if err != nil {
+		return err
+	}
+
+	var anonymize bool
+	switch mode {
+	case model.ContentDeletionModeDelete:
+	case model.ContentDeletionModeAnonymize:
+		anonymize = true
+	default:
+		return fmt.Errorf("unknown content deletion mode %s", mode)
+	}
+
+	// токены отзываются до удаления данных, чтобы ими нельзя было воспользоваться, пока аккаунт удаляется
+	if r.Revocations != nil {
+		err = r.Revocations.RevokeUserTokens(userID, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	err = r.Accounts.DeleteAccount(userID, anonymize)
+	if err != nil {
+		return err
+	}
+
+	// задачи экспорта хранятся не в базе, а в менеджере
+	if r.ExportManager != nil {
+		r.ExportManager.DeleteUserExports(id)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/VitaminP8/postery/graph/generated"
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/auth"
+)
+
+// Directives возвращает реализации директив схемы (@authenticated, @hasRole)
+func Directives() generated.DirectiveRoot {
+	return generated.DirectiveRoot{
+		Authenticated: Authenticated,
+		HasRole:       HasRole,
+	}
+}
+
+// Authenticated пропускает запрос дальше только при наличии userID в контексте.
+// Запрос по персональному токену должен иметь область scope; без scope операция доступна только с JWT.
+func Authenticated(ctx context.Context, obj any, next graphql.Resolver, scope *model.AccessTokenScope) (any, error) {
+	if _, err := auth.GetUserIDFromContext(ctx); err != nil {
+		return nil, err
+	}
+	if auth.IsAccessTokenRequest(ctx) && (scope == nil || !auth.HasScope(ctx, scope.String())) {
+		return nil, fmt.Errorf("%w: access token does not allow this operation", auth.ErrForbidden)
+	}
+	return next(ctx)
+}
+
+// HasRole пропускает запрос дальше только если роль пользователя не ниже требуемой
+// (персональные токены для административных операций не принимаются)
+func HasRole(ctx context.Context, obj any, next graphql.Resolver, role model.Role) (any, error) {
+	if _, err := auth.GetUserIDFromContext(ctx); err != nil {
+		return nil, err
+	}
+	if auth.IsAccessTokenRequest(ctx) || !auth.HasRole(ctx, role.String()) {
+		return nil, auth.ErrForbidden
+	}
+	return next(ctx)
+}
+
+// authorizePostOwner проверяет, что текущий пользователь - автор поста (или модератор)
+func (r *Resolver) authorizePostOwner(ctx context.Context, postID string) error {
+	userID, err := auth.GetUserIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	post, err := r.PostStore.GetPostById(postID)
+	if err != nil {
+		return err
+	}
+
+	if post.AuthorID != fmt.Sprint(userID) && !auth.HasRole(ctx, auth.RoleModerator) {
+		return fmt.Errorf("%w: you are not the author of this post", auth.ErrForbidden)
+	}
+	return nil
+}
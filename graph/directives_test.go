@@ -0,0 +1,202 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/identity"
+	"github.com/VitaminP8/postery/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// resolverOK - резолвер-заглушка, который вызывается после успешной проверки директивы
+func resolverOK(ctx context.Context) (any, error) {
+	return "ok", nil
+}
+
+func TestDirective_Authenticated(t *testing.T) {
+	t.Run("Pass with user in context", func(t *testing.T) {
+		res, err := Authenticated(createUserContext(1), nil, resolverOK, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "ok", res)
+	})
+
+	t.Run("Error UNAUTHENTICATED without user", func(t *testing.T) {
+		res, err := Authenticated(context.Background(), nil, resolverOK, nil)
+		assert.Nil(t, res)
+		assert.ErrorIs(t, err, auth.ErrUnauthenticated)
+
+		gqlErr := ErrorPresenter(context.Background(), err)
+		assert.Equal(t, CodeUnauthenticated, gqlErr.Extensions["code"])
+	})
+
+	t.Run("Access token with required scope", func(t *testing.T) {
+		ctx := auth.WithScopes(createUserContext(1), []string{auth.ScopeCommentWrite})
+		scope := model.AccessTokenScopeCommentWrite
+
+		res, err := Authenticated(ctx, nil, resolverOK, &scope)
+		require.NoError(t, err)
+		assert.Equal(t, "ok", res)
+	})
+
+	t.Run("Error FORBIDDEN for access token without scope", func(t *testing.T) {
+		ctx := auth.WithScopes(createUserContext(1), []string{auth.ScopeRead})
+		scope := model.AccessTokenScopePostWrite
+
+		_, err := Authenticated(ctx, nil, resolverOK, &scope)
+		assert.ErrorIs(t, err, auth.ErrForbidden)
+	})
+
+	t.Run("Error FORBIDDEN for access token on session-only operation", func(t *testing.T) {
+		ctx := auth.WithScopes(createUserContext(1), []string{auth.ScopeRead, auth.ScopePostWrite, auth.ScopeCommentWrite})
+
+		_, err := Authenticated(ctx, nil, resolverOK, nil)
+		assert.ErrorIs(t, err, auth.ErrForbidden)
+	})
+
+	t.Run("JWT session has every scope", func(t *testing.T) {
+		scope := model.AccessTokenScopePostWrite
+
+		_, err := Authenticated(createUserContext(1), nil, resolverOK, &scope)
+		assert.NoError(t, err)
+	})
+}
+
+func TestDirective_HasRole(t *testing.T) {
+	t.Run("Admin passes ADMIN check", func(t *testing.T) {
+		ctx := auth.WithRole(createUserContext(1), auth.RoleAdmin)
+
+		res, err := HasRole(ctx, nil, resolverOK, model.RoleAdmin)
+		require.NoError(t, err)
+		assert.Equal(t, "ok", res)
+	})
+
+	t.Run("Admin passes MODERATOR check", func(t *testing.T) {
+		ctx := auth.WithRole(createUserContext(1), auth.RoleAdmin)
+
+		_, err := HasRole(ctx, nil, resolverOK, model.RoleModerator)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Error FORBIDDEN for regular user", func(t *testing.T) {
+		res, err := HasRole(createUserContext(1), nil, resolverOK, model.RoleAdmin)
+		assert.Nil(t, res)
+		assert.ErrorIs(t, err, auth.ErrForbidden)
+
+		gqlErr := ErrorPresenter(context.Background(), err)
+		assert.Equal(t, CodeForbidden, gqlErr.Extensions["code"])
+	})
+
+	t.Run("Error UNAUTHENTICATED without user", func(t *testing.T) {
+		_, err := HasRole(context.Background(), nil, resolverOK, model.RoleUser)
+		assert.ErrorIs(t, err, auth.ErrUnauthenticated)
+	})
+
+	t.Run("Error FORBIDDEN for access token", func(t *testing.T) {
+		ctx := auth.WithScopes(auth.WithRole(createUserContext(1), auth.RoleAdmin), []string{auth.ScopeRead})
+
+		_, err := HasRole(ctx, nil, resolverOK, model.RoleUser)
+		assert.ErrorIs(t, err, auth.ErrForbidden)
+	})
+}
+
+func TestErrorPresenter(t *testing.T) {
+	t.Run("No code for regular errors", func(t *testing.T) {
+		gqlErr := ErrorPresenter(context.Background(), fmt.Errorf("post not found"))
+		assert.Equal(t, "post not found", gqlErr.Message)
+		assert.Nil(t, gqlErr.Extensions["code"])
+	})
+
+	t.Run("Code for wrapped errors", func(t *testing.T) {
+		err := fmt.Errorf("%w: you are not the author of this post", auth.ErrForbidden)
+		gqlErr := ErrorPresenter(context.Background(), err)
+		assert.Equal(t, CodeForbidden, gqlErr.Extensions["code"])
+	})
+
+	t.Run("Field errors", func(t *testing.T) {
+		_, _, err := identity.Validate("x", "user@example.com", false)
+		gqlErr := ErrorPresenter(context.Background(), err)
+		assert.Equal(t, CodeInvalidInput, gqlErr.Extensions["code"])
+		assert.Equal(t, []map[string]interface{}{{
+			"field":   identity.FieldUsername,
+			"reason":  identity.ReasonInvalid,
+			"message": "username must be 3 to 32 characters",
+		}}, gqlErr.Extensions["fields"])
+	})
+}
+
+func TestResolver_PostOwnership(t *testing.T) {
+	mockPostStorage := mocks.NewMockPostStorage(nil)
+
+	resolver := &Resolver{
+		PostStore: mockPostStorage,
+	}
+
+	authorCtx := createUserContext(1)
+	post, err := mockPostStorage.CreatePost(authorCtx, "Test Post", "Content")
+	require.NoError(t, err)
+
+	t.Run("Error FORBIDDEN when not author disables comments", func(t *testing.T) {
+		success, err := resolver.Mutation().DisableComment(createUserContext(2), post.ID)
+		assert.ErrorIs(t, err, auth.ErrForbidden)
+		assert.False(t, success)
+
+		savedPost, err := mockPostStorage.GetPostById(post.ID)
+		require.NoError(t, err)
+		assert.False(t, savedPost.CommentsDisabled)
+	})
+
+	t.Run("Error FORBIDDEN when not author deletes post", func(t *testing.T) {
+		success, err := resolver.Mutation().DeletePostByID(createUserContext(2), post.ID)
+		assert.ErrorIs(t, err, auth.ErrForbidden)
+		assert.False(t, success)
+
+		_, err = mockPostStorage.GetPostById(post.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Moderator can manage foreign post", func(t *testing.T) {
+		moderatorCtx := auth.WithRole(createUserContext(3), auth.RoleModerator)
+
+		success, err := resolver.Mutation().EnableComment(moderatorCtx, post.ID)
+		require.NoError(t, err)
+		assert.True(t, success)
+	})
+
+	t.Run("Error UNAUTHENTICATED without user", func(t *testing.T) {
+		success, err := resolver.Mutation().DeletePostByID(context.Background(), post.ID)
+		assert.ErrorIs(t, err, auth.ErrUnauthenticated)
+		assert.False(t, success)
+	})
+}
+
+func TestMutationResolver_SetUserRole(t *testing.T) {
+	mockUserStorage := mocks.NewMockUserStorage()
+
+	resolver := &Resolver{
+		UserStore: mockUserStorage,
+	}
+
+	user, err := mockUserStorage.RegisterUser("moder", "moder@example.com", "password")
+	require.NoError(t, err)
+	assert.Equal(t, model.RoleUser, user.Role)
+
+	t.Run("Successfully change role", func(t *testing.T) {
+		ctx := auth.WithRole(createUserContext(100), auth.RoleAdmin)
+
+		updated, err := resolver.Mutation().SetUserRole(ctx, user.ID, model.RoleModerator)
+		require.NoError(t, err)
+		assert.Equal(t, model.RoleModerator, updated.Role)
+	})
+
+	t.Run("Error when user not found", func(t *testing.T) {
+		ctx := auth.WithRole(createUserContext(100), auth.RoleAdmin)
+
+		_, err := resolver.Mutation().SetUserRole(ctx, "999", model.RoleModerator)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,82 @@
+package graph
+
+import (
+	"context"
+	"errors"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/identity"
+	"github.com/VitaminP8/postery/internal/loginguard"
+	"github.com/VitaminP8/postery/internal/relation"
+	"github.com/VitaminP8/postery/internal/subscription"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// Значения extensions.code в ответах GraphQL
+const (
+	CodeUnauthenticated      = "UNAUTHENTICATED"
+	CodeForbidden            = "FORBIDDEN"
+	CodeTooManyAttempts      = "TOO_MANY_ATTEMPTS"
+	CodeBlocked              = "BLOCKED"
+	CodeInvalidInput         = "INVALID_INPUT"
+	CodeTooManySubscriptions = "TOO_MANY_SUBSCRIPTIONS"
+	CodeHistoryTruncated     = "HISTORY_TRUNCATED"
+)
+
+// ErrorPresenter добавляет extensions.code к ошибкам, чтобы клиент мог отличить
+// "нужно войти" (UNAUTHENTICATED) от "нет прав" (FORBIDDEN), а ошибки полей (INVALID_INPUT) - привязать к форме
+func ErrorPresenter(ctx context.Context, err error) *gqlerror.Error {
+	gqlErr := graphql.DefaultErrorPresenter(ctx, err)
+
+	code := errorCode(err)
+	if code == "" {
+		return gqlErr
+	}
+
+	if gqlErr.Extensions == nil {
+		gqlErr.Extensions = map[string]interface{}{}
+	}
+	gqlErr.Extensions["code"] = code
+
+	// ошибки проверки полей: extensions.fields - [{field, reason, message}] для каждого поля
+	if fields := identity.Fields(err); len(fields) > 0 {
+		list := make([]map[string]interface{}, len(fields))
+		for i, field := range fields {
+			list[i] = map[string]interface{}{
+				"field":   field.Field,
+				"reason":  field.Reason,
+				"message": field.Message,
+			}
+		}
+		gqlErr.Extensions["fields"] = list
+	}
+
+	// превышено ограничение числа подписок: extensions.scope - user, ip, connection или total
+	var limitErr *subscription.LimitError
+	if errors.As(err, &limitErr) {
+		gqlErr.Extensions["scope"] = string(limitErr.Scope)
+		gqlErr.Extensions["limit"] = limitErr.Limit
+	}
+	return gqlErr
+}
+
+func errorCode(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrUnauthenticated):
+		return CodeUnauthenticated
+	case errors.Is(err, auth.ErrForbidden):
+		return CodeForbidden
+	case errors.Is(err, loginguard.ErrTooManyAttempts):
+		return CodeTooManyAttempts
+	case errors.Is(err, relation.ErrBlocked):
+		return CodeBlocked
+	case errors.Is(err, subscription.ErrTooManySubscriptions):
+		return CodeTooManySubscriptions
+	case errors.Is(err, subscription.ErrHistoryTruncated):
+		return CodeHistoryTruncated
+	case identity.Fields(err) != nil:
+		return CodeInvalidInput
+	}
+	return ""
+}
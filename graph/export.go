@@ -0,0 +1,38 @@
+package graph
+
+import (
+	"errors"
+	"time"
+
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/export"
+)
+
+// toDataExport переводит задачу экспорта в GraphQL модель (со свежей подписанной ссылкой)
+func (r *Resolver) toDataExport(job *export.Job) *model.DataExport {
+	result := &model.DataExport{
+		ID:        job.ID,
+		Status:    model.DataExportStatus(job.Status),
+		CreatedAt: job.CreatedAt.Format(time.RFC3339),
+	}
+
+	if job.CompletedAt != nil {
+		completedAt := job.CompletedAt.Format(time.RFC3339)
+		result.CompletedAt = &completedAt
+	}
+	if job.ExpiresAt != nil {
+		expiresAt := job.ExpiresAt.Format(time.RFC3339)
+		result.ExpiresAt = &expiresAt
+	}
+	if job.Error != "" {
+		errMsg := job.Error
+		result.Error = &errMsg
+	}
+	if url := r.ExportManager.DownloadURL(job); url != "" {
+		result.DownloadURL = &url
+	}
+
+	return result
+}
+
+var errExportDisabled = errors.New("data export is not configured")
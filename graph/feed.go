@@ -0,0 +1,191 @@
+package graph
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/relation"
+	"github.com/VitaminP8/postery/internal/subscription"
+)
+
+// Размер страницы ленты
+const (
+	defaultFeedSize = 10
+	maxFeedSize     = 50
+)
+
+const feedCursorPrefix = "post:"
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// homeFeed собирает посты авторов, на которых подписан пользователь, от новых к старым.
+// Курсор - ID последнего поста страницы, следующая страница начинается с более старых постов.
+func (r *Resolver) homeFeed(ctx context.Context, first *int, after *string) (*model.PostConnection, error) {
+	if r.Relations == nil {
+		return nil, errRelationsDisabled
+	}
+
+	userID, err := auth.GetUserIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := defaultFeedSize
+	if first != nil {
+		limit = *first
+	}
+	if limit < 1 || limit > maxFeedSize {
+		return nil, fmt.Errorf("first must be between 1 and %d", maxFeedSize)
+	}
+
+	var beforeID string
+	if after != nil && *after != "" {
+		beforeID, err = decodeFeedCursor(*after)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	following, err := r.Relations.GetTargets(fmt.Sprint(userID), relation.KindFollow)
+	if err != nil {
+		return nil, err
+	}
+
+	// скрытые авторы не попадают в ленту, даже если пользователь на них подписан
+	muted, err := r.mutedAuthors(ctx)
+	if err != nil {
+		return nil, err
+	}
+	authors := make([]string, 0, len(following))
+	for _, id := range following {
+		if !muted[id] {
+			authors = append(authors, id)
+		}
+	}
+
+	// загружаем +1, чтобы узнать hasMore
+	posts, err := r.PostStore.GetPostsByAuthors(authors, beforeID, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	hasMore := len(posts) > limit
+	if hasMore {
+		posts = posts[:limit]
+	}
+
+	conn := &model.PostConnection{Items: posts, HasMore: hasMore}
+	if len(posts) > 0 {
+		cursor := encodeFeedCursor(posts[len(posts)-1].ID)
+		conn.EndCursor = &cursor
+	}
+	return conn, nil
+}
+
+func encodeFeedCursor(postID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(feedCursorPrefix + postID))
+}
+
+func decodeFeedCursor(cursor string) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(raw), feedCursorPrefix) {
+		return "", errInvalidCursor
+	}
+	return strings.TrimPrefix(string(raw), feedCursorPrefix), nil
+}
+
+// followedPosts - подписка на ленту текущего пользователя: новые посты из PostsTopic, отфильтрованные по его подпискам.
+// Пост публикуется один раз хранилищем, а не в тему каждого подписчика автора; followUser и unfollowUser
+// действуют на открытую подписку. Посты скрытых авторов не доставляются.
+func (r *Resolver) followedPosts(ctx context.Context) (<-chan *model.Post, error) {
+	if r.Relations == nil {
+		return nil, errRelationsDisabled
+	}
+
+	userID, err := auth.GetUserIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	following, err := r.watchTargets(ctx, fmt.Sprint(userID), relation.KindFollow)
+	if err != nil {
+		return nil, err
+	}
+
+	posts := subscription.Listen[*model.Post](ctx, r.SubscriptionManager, subscription.PostsTopic, subscription.EventPostCreated)
+	out := make(chan *model.Post, 1)
+	go func() {
+		defer close(out)
+		for p := range posts {
+			if !following()[p.AuthorID] {
+				continue
+			}
+			select {
+			case out <- p:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return r.filterMutedPosts(ctx, out)
+}
+
+// userConnection - страница подписчиков (KindFollow к userID) или подписок (KindFollow от userID)
+func (r *Resolver) userConnection(ctx context.Context, userID string, followers bool, limit, offset *int) (*model.UserConnection, error) {
+	if r.Relations == nil {
+		return nil, errRelationsDisabled
+	}
+
+	lim := 10
+	off := 0
+	if limit != nil {
+		lim = *limit
+	}
+	if offset != nil {
+		off = *offset
+	}
+	if lim < 0 || off < 0 {
+		return nil, errors.New("limit and offset must not be negative")
+	}
+
+	var ids []string
+	var err error
+	if followers {
+		ids, err = r.Relations.GetSources(userID, relation.KindFollow)
+	} else {
+		ids, err = r.Relations.GetTargets(userID, relation.KindFollow)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	end := off + lim
+	if end > len(ids) {
+		end = len(ids)
+	}
+	page := []string{}
+	if off < len(ids) {
+		page = ids[off:end]
+	}
+
+	items := make([]*model.User, 0, len(page))
+	for _, id := range page {
+		u, err := r.UserStore.GetUserByID(id)
+		if err != nil {
+			// аккаунт удален, а отношение еще не убрано - пропускаем
+			continue
+		}
+
+		items = append(items, publicUser(ctx, u))
+	}
+
+	return &model.UserConnection{
+		Items:      items,
+		HasMore:    end < len(ids),
+		NextOffset: end,
+	}, nil
+}
@@ -0,0 +1,220 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/audit"
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/identity"
+	"github.com/VitaminP8/postery/internal/invite"
+)
+
+const (
+	// defaultInviteTTL - срок действия приглашения, если expiresAt не указан
+	defaultInviteTTL = 7 * 24 * time.Hour
+	// maxInviteUses - ограничение на число регистраций по одному приглашению
+	maxInviteUses = 1000
+)
+
+var (
+	errInvitesDisabled    = errors.New("invites are not configured")
+	errRegistrationClosed = fmt.Errorf("%w: registration is closed", auth.ErrForbidden)
+)
+
+// registrationMode - текущий режим регистрации; незаданный режим считается открытым
+func (r *Resolver) registrationMode() invite.Mode {
+	if r.RegistrationMode == "" {
+		return invite.ModeOpen
+	}
+	return r.RegistrationMode
+}
+
+// registerUser создает аккаунт с учетом режима регистрации. Использование приглашения засчитывается
+// до создания аккаунта (чтобы два запроса не израсходовали одно место) и возвращается, если регистрация не удалась.
+// В открытом режиме код необязателен, но если он передан, то проверяется и засчитывается.
+// Режим действует для всех имен: первый администратор создается при запуске сервера (BOOTSTRAP_ADMIN_*).
+func (r *Resolver) registerUser(username, email, password string, inviteCode *string) (*model.User, error) {
+	code := ""
+	if inviteCode != nil {
+		code = *inviteCode
+	}
+
+	mode := r.registrationMode()
+	if mode == invite.ModeClosed {
+		return nil, errRegistrationClosed
+	}
+	if code == "" {
+		if mode == invite.ModeInviteOnly {
+			return nil, invite.ErrInviteRequired
+		}
+		return r.UserStore.RegisterUser(username, email, password)
+	}
+
+	if r.Invites == nil {
+		return nil, errInvitesDisabled
+	}
+
+	inv, err := r.Invites.RedeemInvite(invite.HashCode(code), email, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := r.UserStore.RegisterUser(username, email, password)
+	if err != nil {
+		releaseErr := r.Invites.ReleaseInvite(inv.ID)
+		if releaseErr != nil {
+			log.Printf("could not release invite %s: %v", inv.ID, releaseErr)
+		}
+		return nil, err
+	}
+
+	// аккаунт уже создан - неудачная запись связи не отменяет регистрацию
+	err = r.Invites.AddInvitee(inv.ID, u.ID)
+	if err != nil {
+		log.Printf("could not record invitee %s of invite %s: %v", u.ID, inv.ID, err)
+	}
+	return u, nil
+}
+
+// createInvite создает приглашение; код возвращается только здесь
+func (r *Resolver) createInvite(ctx context.Context, maxUses *int, expiresAt, email *string) (*model.CreatedInvite, error) {
+	if r.Invites == nil {
+		return nil, errInvitesDisabled
+	}
+
+	adminID, err := auth.GetUserIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := &invite.Invite{
+		CreatedBy: fmt.Sprint(adminID),
+		MaxUses:   1,
+		ExpiresAt: time.Now().Add(defaultInviteTTL),
+	}
+
+	if maxUses != nil {
+		if *maxUses < 1 || *maxUses > maxInviteUses {
+			return nil, fmt.Errorf("maxUses must be between 1 and %d", maxInviteUses)
+		}
+		inv.MaxUses = *maxUses
+	}
+
+	if expiresAt != nil {
+		expires, err := time.Parse(time.RFC3339, *expiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expiresAt: %w", err)
+		}
+		if !expires.After(time.Now()) {
+			return nil, errors.New("expiresAt must be in the future")
+		}
+		inv.ExpiresAt = expires
+	}
+
+	if email != nil && *email != "" {
+		inv.Email, err = identity.ValidateEmail(*email)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	code, hash, err := invite.NewCode()
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := r.Invites.CreateInvite(inv, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	r.recordAudit(audit.Entry{
+		Action:  audit.ActionInviteCreate,
+		IP:      auth.GetClientIP(ctx),
+		ActorID: inv.CreatedBy,
+		Reason:  "invite " + created.ID,
+	})
+
+	return &model.CreatedInvite{
+		Code:   code,
+		Invite: toInvite(created),
+	}, nil
+}
+
+// revokeInvite отзывает приглашение; зарегистрированные по нему аккаунты остаются
+func (r *Resolver) revokeInvite(ctx context.Context, id string) error {
+	if r.Invites == nil {
+		return errInvitesDisabled
+	}
+
+	adminID, err := auth.GetUserIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = r.Invites.RevokeInvite(id)
+	if err != nil {
+		return err
+	}
+
+	r.recordAudit(audit.Entry{
+		Action:  audit.ActionInviteRevoke,
+		IP:      auth.GetClientIP(ctx),
+		ActorID: fmt.Sprint(adminID),
+		Reason:  "invite " + id,
+	})
+	return nil
+}
+
+func (r *Resolver) invites() ([]*model.Invite, error) {
+	if r.Invites == nil {
+		return nil, errInvitesDisabled
+	}
+
+	invites, err := r.Invites.GetInvites()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.Invite, 0, len(invites))
+	for _, inv := range invites {
+		result = append(result, toInvite(inv))
+	}
+	return result, nil
+}
+
+func toInvite(inv *invite.Invite) *model.Invite {
+	result := &model.Invite{
+		ID:        inv.ID,
+		CreatedBy: inv.CreatedBy,
+		MaxUses:   inv.MaxUses,
+		Uses:      inv.Uses,
+		CreatedAt: inv.CreatedAt.Format(time.RFC3339),
+		ExpiresAt: inv.ExpiresAt.Format(time.RFC3339),
+		Revoked:   inv.Revoked,
+		Invitees:  inv.Invitees,
+	}
+	if inv.Email != "" {
+		email := inv.Email
+		result.Email = &email
+	}
+	if result.Invitees == nil {
+		result.Invitees = []string{}
+	}
+	return result
+}
+
+func toRegistrationMode(mode invite.Mode) model.RegistrationMode {
+	switch mode {
+	case invite.ModeInviteOnly:
+		return model.RegistrationModeInviteOnly
+	case invite.ModeClosed:
+		return model.RegistrationModeClosed
+	}
+	return model.RegistrationModeOpen
+}
@@ -0,0 +1,121 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/audit"
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/identity"
+	"github.com/VitaminP8/postery/internal/user"
+)
+
+// loginUser проверяет пароль с учетом ограничения попыток. Любая неудача, кроме блокировки,
+// возвращается клиенту как user.ErrInvalidCredentials, подробности пишутся только в журнал.
+// Если у пользователя включена 2FA, вместо токена возвращается challenge для completeLogin,
+// а счетчик неудачных попыток сбрасывается только после верного кода.
+func (r *Resolver) loginUser(ctx context.Context, username, password string) (*model.LoginResult, error) {
+	ip := auth.GetClientIP(ctx)
+	// попытки "Alice" и "alice" считаются попытками входа в один аккаунт
+	guardKey := identity.UsernameKey(username)
+
+	if r.LoginGuard != nil {
+		err := r.LoginGuard.Check(guardKey, ip)
+		if err != nil {
+			r.recordAudit(audit.Entry{Action: audit.ActionLoginFailed, Username: username, IP: ip, Reason: "throttled"})
+			return nil, err
+		}
+	}
+
+	u, err := r.UserStore.VerifyCredentials(username, password)
+	if err != nil {
+		// ошибки хранилища (например, недоступна БД) не считаются попыткой подбора
+		if !errors.Is(err, user.ErrInvalidCredentials) {
+			return nil, err
+		}
+
+		r.recordAudit(audit.Entry{Action: audit.ActionLoginFailed, Username: username, IP: ip, Reason: "invalid credentials"})
+		if r.LoginGuard != nil && r.LoginGuard.Failure(guardKey, ip) {
+			r.recordAudit(audit.Entry{Action: audit.ActionLoginLocked, Username: username, IP: ip})
+		}
+		return nil, user.ErrInvalidCredentials
+	}
+
+	return r.finishLogin(ctx, u, guardKey)
+}
+
+// LoginExternal завершает вход пользователя, личность которого подтвердил внешний провайдер (OIDC), тем же путем,
+// что и вход по паролю: заблокированный аккаунт не входит, а при включенной 2FA вместо токена выдается challenge
+func (r *Resolver) LoginExternal(ctx context.Context, u *model.User) (*model.LoginResult, error) {
+	ip := auth.GetClientIP(ctx)
+	guardKey := identity.UsernameKey(u.Username)
+	if r.LoginGuard != nil {
+		err := r.LoginGuard.Check(guardKey, ip)
+		if err != nil {
+			r.recordAudit(audit.Entry{Action: audit.ActionLoginFailed, Username: u.Username, IP: ip, Reason: "throttled"})
+			return nil, err
+		}
+	}
+	return r.finishLogin(ctx, u, guardKey)
+}
+
+// finishLogin выдает токен пользователю, подтвердившему первый фактор, или challenge для completeLogin,
+// если у него включена 2FA; счетчик неудачных попыток сбрасывается только вместе с выдачей токена
+func (r *Resolver) finishLogin(ctx context.Context, u *model.User, guardKey string) (*model.LoginResult, error) {
+	state, err := r.UserStore.GetTwoFactor(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if state != nil && state.Enabled {
+		if r.LoginChallenges == nil {
+			return nil, errTwoFactorDisabled
+		}
+		challenge, err := r.LoginChallenges.Create(u.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &model.LoginResult{Challenge: &challenge}, nil
+	}
+
+	if r.LoginGuard != nil {
+		r.LoginGuard.Success(guardKey)
+	}
+
+	token, err := r.issueToken(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	return &model.LoginResult{Token: &token}, nil
+}
+
+// unlockAccount снимает блокировку входа с аккаунта
+func (r *Resolver) unlockAccount(ctx context.Context, username string) error {
+	if r.LoginGuard == nil {
+		return errors.New("login throttling is not configured")
+	}
+
+	adminID, err := auth.GetUserIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.LoginGuard.Unlock(identity.UsernameKey(username))
+	r.recordAudit(audit.Entry{
+		Action:   audit.ActionAccountUnlock,
+		Username: username,
+		IP:       auth.GetClientIP(ctx),
+		ActorID:  fmt.Sprint(adminID),
+	})
+	return nil
+}
+
+func (r *Resolver) recordAudit(entry audit.Entry) {
+	if r.Audit == nil {
+		return
+	}
+	entry.Time = time.Now()
+	r.Audit.Record(entry)
+}
@@ -2,6 +2,21 @@
 
 package model
 
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+type AccessToken struct {
+	ID         string             `json:"id"`
+	Name       string             `json:"name"`
+	Scopes     []AccessTokenScope `json:"scopes"`
+	CreatedAt  string             `json:"createdAt"`
+	ExpiresAt  *string            `json:"expiresAt,omitempty"`
+	LastUsedAt *string            `json:"lastUsedAt,omitempty"`
+}
+
 type Comment struct {
 	ID         string     `json:"id"`
 	PostID     string     `json:"postID"`
@@ -11,6 +26,8 @@ type Comment struct {
 	CreatedAt  string     `json:"createdAt"`
 	HasReplies bool       `json:"hasReplies"`
 	Children   []*Comment `json:"children"`
+	Mentions   []*User    `json:"mentions"`
+	Cursor     *string    `json:"cursor,omitempty"`
 }
 
 type CommentConnection struct {
@@ -19,6 +36,53 @@ type CommentConnection struct {
 	NextOffset int        `json:"nextOffset"`
 }
 
+type CreatedAccessToken struct {
+	Token       string       `json:"token"`
+	AccessToken *AccessToken `json:"accessToken"`
+}
+
+type CreatedInvite struct {
+	Code   string  `json:"code"`
+	Invite *Invite `json:"invite"`
+}
+
+type CreatedWebhook struct {
+	Secret  string   `json:"secret"`
+	Webhook *Webhook `json:"webhook"`
+}
+
+type DataExport struct {
+	ID          string           `json:"id"`
+	Status      DataExportStatus `json:"status"`
+	CreatedAt   string           `json:"createdAt"`
+	CompletedAt *string          `json:"completedAt,omitempty"`
+	DownloadURL *string          `json:"downloadURL,omitempty"`
+	ExpiresAt   *string          `json:"expiresAt,omitempty"`
+	Error       *string          `json:"error,omitempty"`
+}
+
+type IPSubscriptionCount struct {
+	IP    string `json:"ip"`
+	Count int    `json:"count"`
+}
+
+type Invite struct {
+	ID        string   `json:"id"`
+	CreatedBy string   `json:"createdBy"`
+	Email     *string  `json:"email,omitempty"`
+	MaxUses   int      `json:"maxUses"`
+	Uses      int      `json:"uses"`
+	CreatedAt string   `json:"createdAt"`
+	ExpiresAt string   `json:"expiresAt"`
+	Revoked   bool     `json:"revoked"`
+	Invitees  []string `json:"invitees"`
+}
+
+type LoginResult struct {
+	Token     *string `json:"token,omitempty"`
+	Challenge *string `json:"challenge,omitempty"`
+}
+
 type Mutation struct {
 }
 
@@ -29,16 +93,413 @@ type Post struct {
 	CommentsDisabled bool               `json:"commentsDisabled"`
 	AuthorID         string             `json:"authorID"`
 	Comments         *CommentConnection `json:"comments"`
+	Mentions         []*User            `json:"mentions"`
+}
+
+type PostConnection struct {
+	Items     []*Post `json:"items"`
+	HasMore   bool    `json:"hasMore"`
+	EndCursor *string `json:"endCursor,omitempty"`
+}
+
+type PostPresence struct {
+	PostID      string             `json:"postID"`
+	ViewerCount int                `json:"viewerCount"`
+	Viewers     []*User            `json:"viewers"`
+	Typing      []*TypingIndicator `json:"typing"`
 }
 
 type Query struct {
 }
 
+type Session struct {
+	ID         string `json:"id"`
+	UserAgent  string `json:"userAgent"`
+	IP         string `json:"ip"`
+	CreatedAt  string `json:"createdAt"`
+	LastSeenAt string `json:"lastSeenAt"`
+	Current    bool   `json:"current"`
+}
+
 type Subscription struct {
 }
 
+type SubscriptionLimits struct {
+	PerUser       int `json:"perUser"`
+	PerIP         int `json:"perIP"`
+	PerConnection int `json:"perConnection"`
+	Total         int `json:"total"`
+}
+
+type SubscriptionStats struct {
+	Total       int                      `json:"total"`
+	Connections int                      `json:"connections"`
+	ByUser      []*UserSubscriptionCount `json:"byUser"`
+	ByIP        []*IPSubscriptionCount   `json:"byIP"`
+	Limits      *SubscriptionLimits      `json:"limits"`
+}
+
+type TotpSetup struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningURI"`
+}
+
+type TypingIndicator struct {
+	User     *User   `json:"user"`
+	ParentID *string `json:"parentID,omitempty"`
+}
+
 type User struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
+	ID        string          `json:"id"`
+	Username  string          `json:"username"`
+	Email     string          `json:"email"`
+	Role      Role            `json:"role"`
+	Followers *UserConnection `json:"followers"`
+	Following *UserConnection `json:"following"`
+}
+
+type UserConnection struct {
+	Items      []*User `json:"items"`
+	HasMore    bool    `json:"hasMore"`
+	NextOffset int     `json:"nextOffset"`
+}
+
+type UserSubscriptionCount struct {
+	User  *User `json:"user"`
+	Count int   `json:"count"`
+}
+
+type UsernameChange struct {
+	Username  string `json:"username"`
+	ChangedAt string `json:"changedAt"`
+}
+
+type Webhook struct {
+	ID        string         `json:"id"`
+	OwnerID   string         `json:"ownerID"`
+	URL       string         `json:"url"`
+	Events    []WebhookEvent `json:"events"`
+	CreatedAt string         `json:"createdAt"`
+}
+
+type WebhookAttempt struct {
+	At         string  `json:"at"`
+	StatusCode *int    `json:"statusCode,omitempty"`
+	Error      *string `json:"error,omitempty"`
+	DurationMs int     `json:"durationMs"`
+}
+
+type WebhookDelivery struct {
+	ID            string                `json:"id"`
+	WebhookID     string                `json:"webhookID"`
+	Event         WebhookEvent          `json:"event"`
+	Status        WebhookDeliveryStatus `json:"status"`
+	Attempts      []*WebhookAttempt     `json:"attempts"`
+	NextAttemptAt *string               `json:"nextAttemptAt,omitempty"`
+	CreatedAt     string                `json:"createdAt"`
+}
+
+type AccessTokenScope string
+
+const (
+	AccessTokenScopeRead         AccessTokenScope = "READ"
+	AccessTokenScopePostWrite    AccessTokenScope = "POST_WRITE"
+	AccessTokenScopeCommentWrite AccessTokenScope = "COMMENT_WRITE"
+)
+
+var AllAccessTokenScope = []AccessTokenScope{
+	AccessTokenScopeRead,
+	AccessTokenScopePostWrite,
+	AccessTokenScopeCommentWrite,
+}
+
+func (e AccessTokenScope) IsValid() bool {
+	switch e {
+	case AccessTokenScopeRead, AccessTokenScopePostWrite, AccessTokenScopeCommentWrite:
+		return true
+	}
+	return false
+}
+
+func (e AccessTokenScope) String() string {
+	return string(e)
+}
+
+func (e *AccessTokenScope) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = AccessTokenScope(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid AccessTokenScope", str)
+	}
+	return nil
+}
+
+func (e AccessTokenScope) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ContentDeletionMode string
+
+const (
+	ContentDeletionModeDelete    ContentDeletionMode = "DELETE"
+	ContentDeletionModeAnonymize ContentDeletionMode = "ANONYMIZE"
+)
+
+var AllContentDeletionMode = []ContentDeletionMode{
+	ContentDeletionModeDelete,
+	ContentDeletionModeAnonymize,
+}
+
+func (e ContentDeletionMode) IsValid() bool {
+	switch e {
+	case ContentDeletionModeDelete, ContentDeletionModeAnonymize:
+		return true
+	}
+	return false
+}
+
+func (e ContentDeletionMode) String() string {
+	return string(e)
+}
+
+func (e *ContentDeletionMode) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ContentDeletionMode(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ContentDeletionMode", str)
+	}
+	return nil
+}
+
+func (e ContentDeletionMode) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type DataExportStatus string
+
+const (
+	DataExportStatusPending DataExportStatus = "PENDING"
+	DataExportStatusRunning DataExportStatus = "RUNNING"
+	DataExportStatusReady   DataExportStatus = "READY"
+	DataExportStatusFailed  DataExportStatus = "FAILED"
+)
+
+var AllDataExportStatus = []DataExportStatus{
+	DataExportStatusPending,
+	DataExportStatusRunning,
+	DataExportStatusReady,
+	DataExportStatusFailed,
+}
+
+func (e DataExportStatus) IsValid() bool {
+	switch e {
+	case DataExportStatusPending, DataExportStatusRunning, DataExportStatusReady, DataExportStatusFailed:
+		return true
+	}
+	return false
+}
+
+func (e DataExportStatus) String() string {
+	return string(e)
+}
+
+func (e *DataExportStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = DataExportStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid DataExportStatus", str)
+	}
+	return nil
+}
+
+func (e DataExportStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type RegistrationMode string
+
+const (
+	RegistrationModeOpen       RegistrationMode = "OPEN"
+	RegistrationModeInviteOnly RegistrationMode = "INVITE_ONLY"
+	RegistrationModeClosed     RegistrationMode = "CLOSED"
+)
+
+var AllRegistrationMode = []RegistrationMode{
+	RegistrationModeOpen,
+	RegistrationModeInviteOnly,
+	RegistrationModeClosed,
+}
+
+func (e RegistrationMode) IsValid() bool {
+	switch e {
+	case RegistrationModeOpen, RegistrationModeInviteOnly, RegistrationModeClosed:
+		return true
+	}
+	return false
+}
+
+func (e RegistrationMode) String() string {
+	return string(e)
+}
+
+func (e *RegistrationMode) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = RegistrationMode(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid RegistrationMode", str)
+	}
+	return nil
+}
+
+func (e RegistrationMode) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type Role string
+
+const (
+	RoleUser      Role = "USER"
+	RoleModerator Role = "MODERATOR"
+	RoleAdmin     Role = "ADMIN"
+)
+
+var AllRole = []Role{
+	RoleUser,
+	RoleModerator,
+	RoleAdmin,
+}
+
+func (e Role) IsValid() bool {
+	switch e {
+	case RoleUser, RoleModerator, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+func (e Role) String() string {
+	return string(e)
+}
+
+func (e *Role) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Role(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Role", str)
+	}
+	return nil
+}
+
+func (e Role) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryStatusPending   WebhookDeliveryStatus = "PENDING"
+	WebhookDeliveryStatusSucceeded WebhookDeliveryStatus = "SUCCEEDED"
+	WebhookDeliveryStatusFailed    WebhookDeliveryStatus = "FAILED"
+)
+
+var AllWebhookDeliveryStatus = []WebhookDeliveryStatus{
+	WebhookDeliveryStatusPending,
+	WebhookDeliveryStatusSucceeded,
+	WebhookDeliveryStatusFailed,
+}
+
+func (e WebhookDeliveryStatus) IsValid() bool {
+	switch e {
+	case WebhookDeliveryStatusPending, WebhookDeliveryStatusSucceeded, WebhookDeliveryStatusFailed:
+		return true
+	}
+	return false
+}
+
+func (e WebhookDeliveryStatus) String() string {
+	return string(e)
+}
+
+func (e *WebhookDeliveryStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = WebhookDeliveryStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid WebhookDeliveryStatus", str)
+	}
+	return nil
+}
+
+func (e WebhookDeliveryStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type WebhookEvent string
+
+const (
+	WebhookEventCommentCreated      WebhookEvent = "COMMENT_CREATED"
+	WebhookEventPostPublished       WebhookEvent = "POST_PUBLISHED"
+	WebhookEventPostUpdated         WebhookEvent = "POST_UPDATED"
+	WebhookEventPostDeleted         WebhookEvent = "POST_DELETED"
+	WebhookEventPostCommentsToggled WebhookEvent = "POST_COMMENTS_TOGGLED"
+)
+
+var AllWebhookEvent = []WebhookEvent{
+	WebhookEventCommentCreated,
+	WebhookEventPostPublished,
+	WebhookEventPostUpdated,
+	WebhookEventPostDeleted,
+	WebhookEventPostCommentsToggled,
+}
+
+func (e WebhookEvent) IsValid() bool {
+	switch e {
+	case WebhookEventCommentCreated, WebhookEventPostPublished, WebhookEventPostUpdated, WebhookEventPostDeleted, WebhookEventPostCommentsToggled:
+		return true
+	}
+	return false
+}
+
+func (e WebhookEvent) String() string {
+	return string(e)
+}
+
+func (e *WebhookEvent) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = WebhookEvent(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid WebhookEvent", str)
+	}
+	return nil
+}
+
+func (e WebhookEvent) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
 }
@@ -0,0 +1,122 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/subscription"
+)
+
+var errInvalidSince = errors.New("invalid since cursor")
+
+// commentAdded - новые комментарии поста, кроме комментариев скрытых подписчиком авторов. С since сначала
+// отдаются пропущенные комментарии из истории менеджера подписок. Каждый комментарий получает cursor - номер события.
+// SSE клиент при переподключении передает cursor в Last-Event-ID - он заменяет since.
+func (r *Resolver) commentAdded(ctx context.Context, postID string, since *string) (<-chan *model.Comment, error) {
+	err := r.checkSubscribable(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+
+	if since == nil {
+		since = lastEventID(ctx)
+	}
+
+	topic := subscription.CommentsTopic(postID)
+	var events <-chan subscription.Event
+	if since == nil {
+		events = subscription.ListenEvents(ctx, r.SubscriptionManager, topic, subscription.EventCommentAdded)
+	} else {
+		cursor, err := strconv.ParseUint(*since, 10, 64)
+		if err != nil {
+			return nil, errInvalidSince
+		}
+		events, err = subscription.ListenSince(ctx, r.SubscriptionManager, topic, cursor, subscription.EventCommentAdded)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	comments := make(chan *model.Comment, 1)
+	go func() {
+		defer close(comments)
+		for event := range events {
+			comment, ok := event.Payload.(*model.Comment)
+			if !ok {
+				continue
+			}
+			// событие общее для всех подписчиков - курсор ставим копии
+			withCursor := *comment
+			seq := strconv.FormatUint(event.Seq, 10)
+			withCursor.Cursor = &seq
+
+			select {
+			case comments <- &withCursor:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return r.filterMutedComments(ctx, comments)
+}
+
+// replyAdded - новые ответы в ветке комментария. Хранилище публикует ответ в тему каждого предка,
+// поэтому подписчик получает только события своей ветки; прямые ответы отбираются по ParentID.
+func (r *Resolver) replyAdded(ctx context.Context, commentID string, includeDescendants bool) (<-chan *model.Comment, error) {
+	comment, err := r.CommentStore.GetCommentByID(commentID)
+	if err != nil {
+		return nil, err
+	}
+	err = r.checkSubscribable(ctx, comment.PostID)
+	if err != nil {
+		return nil, err
+	}
+
+	replies := subscription.Listen[*model.Comment](ctx, r.SubscriptionManager, subscription.RepliesTopic(commentID), subscription.EventReplyAdded)
+	if !includeDescendants {
+		replies = directReplies(ctx, replies, commentID)
+	}
+	return r.filterMutedComments(ctx, replies)
+}
+
+func directReplies(ctx context.Context, in <-chan *model.Comment, parentID string) <-chan *model.Comment {
+	out := make(chan *model.Comment, 1)
+	go func() {
+		defer close(out)
+		for c := range in {
+			if c.ParentID == nil || *c.ParentID != parentID {
+				continue
+			}
+			select {
+			case out <- c:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out
+}
+
+// postCreated - новые посты всех авторов, кроме скрытых подписчиком
+func (r *Resolver) postCreated(ctx context.Context) (<-chan *model.Post, error) {
+	posts := subscription.Listen[*model.Post](ctx, r.SubscriptionManager, subscription.PostsTopic, subscription.EventPostCreated)
+	return r.filterMutedPosts(ctx, posts)
+}
+
+// checkSubscribable отклоняет подписку на события поста, который подписчику недоступен. Черновиков и приватных
+// постов пока нет, поэтому проверяется только существование поста: подписка на несуществующий пост ничего бы
+// не получила - сообщаем об ошибке сразу.
+func (r *Resolver) checkSubscribable(ctx context.Context, postID string) error {
+	_, err := r.PostStore.GetPostById(postID)
+	return err
+}
+
+// postEvents подписывает на события типа eventType существующего поста
+func postEvents[T any](ctx context.Context, r *Resolver, id string, eventType subscription.EventType) (<-chan T, error) {
+	err := r.checkSubscribable(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return subscription.Listen[T](ctx, r.SubscriptionManager, subscription.PostTopic(id), eventType), nil
+}
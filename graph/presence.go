@@ -0,0 +1,139 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/presence"
+)
+
+var (
+	errPresenceDisabled = errors.New("presence is not configured")
+	errCommentsDisabled = errors.New("comments are disabled for this post")
+	errParentNotInPost  = errors.New("parent comment belongs to another post")
+)
+
+// viewersOnPost регистрирует подписчика зрителем поста и отдает присутствие с пользователями вместо ID.
+// Скрытые подписчиком пользователи учитываются в viewerCount, но не показываются в списках.
+func (r *Resolver) viewersOnPost(ctx context.Context, postID string) (<-chan *model.PostPresence, error) {
+	if r.Presence == nil {
+		return nil, errPresenceDisabled
+	}
+	err := r.checkSubscribable(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+	// muteUser и unmuteUser действуют на открытую подписку
+	muted, err := r.watchMuted(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var viewerID string
+	if userID, err := auth.GetUserIDFromContext(ctx); err == nil {
+		viewerID = fmt.Sprint(userID)
+	}
+	snapshots := r.Presence.Watch(ctx, postID, viewerID)
+
+	out := make(chan *model.PostPresence, 1)
+	go func() {
+		defer close(out)
+		for snapshot := range snapshots {
+			select {
+			case out <- r.postPresence(ctx, snapshot, muted()):
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out, nil
+}
+
+// postPresence читает пользователей снимка из хранилища заново для каждого снимка, чтобы после changeUsername
+// зрители видели новое имя; внутри снимка пользователь (зритель, который еще и пишет) читается один раз
+func (r *Resolver) postPresence(ctx context.Context, snapshot presence.Snapshot, muted map[string]bool) *model.PostPresence {
+	// копия для показа подписчику (email скрыт), а не запись хранилища
+	users := make(map[string]*model.User)
+	user := func(id string) *model.User {
+		if muted[id] {
+			return nil
+		}
+		u, ok := users[id]
+		if !ok {
+			// удаленный аккаунт запоминается как nil и пропускается
+			stored, err := r.UserStore.GetUserByID(id)
+			if err == nil {
+				u = publicUser(ctx, stored)
+			}
+			users[id] = u
+		}
+		return u
+	}
+
+	result := &model.PostPresence{
+		PostID:      snapshot.PostID,
+		ViewerCount: snapshot.ViewerCount,
+		Viewers:     []*model.User{},
+		Typing:      []*model.TypingIndicator{},
+	}
+	for _, id := range snapshot.UserIDs {
+		if u := user(id); u != nil {
+			result.Viewers = append(result.Viewers, u)
+		}
+	}
+	for _, typist := range snapshot.Typing {
+		u := user(typist.UserID)
+		if u == nil {
+			continue
+		}
+		indicator := &model.TypingIndicator{User: u}
+		if typist.ParentID != "" {
+			parentID := typist.ParentID
+			indicator.ParentID = &parentID
+		}
+		result.Typing = append(result.Typing, indicator)
+	}
+	return result
+}
+
+// setTyping показывает зрителям поста, что текущий пользователь пишет комментарий или ответ на parentID.
+// Проверки те же, что при создании комментария: иначе индикатор обещал бы ответ, который нельзя отправить.
+func (r *Resolver) setTyping(ctx context.Context, postID string, parentID *string) (bool, error) {
+	if r.Presence == nil {
+		return false, errPresenceDisabled
+	}
+	userID, err := auth.GetUserIDFromContext(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	post, err := r.PostStore.GetPostById(postID)
+	if err != nil {
+		return false, err
+	}
+	if post.CommentsDisabled {
+		return false, errCommentsDisabled
+	}
+
+	var parent string
+	if parentID != nil {
+		comment, err := r.CommentStore.GetCommentByID(*parentID)
+		if err != nil {
+			return false, err
+		}
+		if comment.PostID != postID {
+			return false, errParentNotInPost
+		}
+		parent = *parentID
+	}
+
+	err = r.checkNotBlocked(ctx, postID, parent)
+	if err != nil {
+		return false, err
+	}
+
+	r.Presence.SetTyping(postID, parent, fmt.Sprint(userID))
+	return true, nil
+}
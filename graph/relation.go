@@ -0,0 +1,282 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/relation"
+	"github.com/VitaminP8/postery/internal/subscription"
+)
+
+var errRelationsDisabled = errors.New("blocking and muting are not configured")
+
+// setRelation добавляет или удаляет отношение текущего пользователя к targetID
+func (r *Resolver) setRelation(ctx context.Context, targetID string, kind relation.Kind, enabled bool) error {
+	if r.Relations == nil {
+		return errRelationsDisabled
+	}
+
+	userID, err := auth.GetUserIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	id := fmt.Sprint(userID)
+
+	if !enabled {
+		err = r.Relations.RemoveRelation(id, targetID, kind)
+		if err != nil {
+			return err
+		}
+		r.publishRelationChange(id, kind)
+		return nil
+	}
+
+	if targetID == id {
+		return fmt.Errorf("you cannot %s yourself", kind)
+	}
+	_, err = r.UserStore.GetUserByID(targetID)
+	if err != nil {
+		return err
+	}
+
+	// нельзя подписаться на пользователя, который заблокировал текущего
+	if kind == relation.KindFollow {
+		blocked, err := r.Relations.HasRelation(targetID, id, relation.KindBlock)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return relation.ErrBlocked
+		}
+	}
+
+	err = r.Relations.AddRelation(id, targetID, kind)
+	if err != nil {
+		return err
+	}
+	r.publishRelationChange(id, kind)
+	return nil
+}
+
+// publishRelationChange сообщает открытым подпискам пользователя, что его отношения вида kind изменились
+func (r *Resolver) publishRelationChange(userID string, kind relation.Kind) {
+	if r.SubscriptionManager == nil {
+		return
+	}
+	r.SubscriptionManager.Publish(subscription.RelationsTopic(userID), subscription.Event{
+		Type:    subscription.EventRelationChanged,
+		Payload: &subscription.RelationChange{UserID: userID, Kind: string(kind)},
+	})
+}
+
+// watchTargets загружает ID пользователей, к которым у userID есть отношение kind, и перечитывает их после каждого
+// изменения этих отношений (EventRelationChanged), пока не завершится ctx. Возвращает функцию, отдающую текущий набор:
+// подписка проверяет события по нему, не обращаясь к хранилищу на каждое событие.
+func (r *Resolver) watchTargets(ctx context.Context, userID string, kind relation.Kind) (func() map[string]bool, error) {
+	load := func() (map[string]bool, error) {
+		targets, err := r.Relations.GetTargets(userID, kind)
+		if err != nil {
+			return nil, err
+		}
+		set := make(map[string]bool, len(targets))
+		for _, target := range targets {
+			set[target] = true
+		}
+		return set, nil
+	}
+
+	// подписываемся до загрузки, чтобы не пропустить изменение между ними
+	changes := subscription.Listen[*subscription.RelationChange](ctx, r.SubscriptionManager, subscription.RelationsTopic(userID), subscription.EventRelationChanged)
+	set, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	go func() {
+		for change := range changes {
+			if change.Kind != string(kind) {
+				continue
+			}
+			updated, err := load()
+			if err != nil {
+				// остаемся с прежним набором до следующего изменения
+				log.Printf("could not reload %s relations of user %s: %v", kind, userID, err)
+				continue
+			}
+			mu.Lock()
+			set = updated
+			mu.Unlock()
+		}
+	}()
+
+	return func() map[string]bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return set
+	}, nil
+}
+
+// checkNotBlocked запрещает отвечать на пост или комментарий автора, который заблокировал текущего пользователя
+func (r *Resolver) checkNotBlocked(ctx context.Context, postID, parentID string) error {
+	if r.Relations == nil {
+		return nil
+	}
+
+	userID, err := auth.GetUserIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	id := fmt.Sprint(userID)
+
+	// несуществующий пост или родитель - ошибку вернет хранилище при создании комментария
+	authors := make([]string, 0, 2)
+	if p, err := r.PostStore.GetPostById(postID); err == nil {
+		authors = append(authors, p.AuthorID)
+	}
+	if parentID != "" {
+		if c, err := r.CommentStore.GetCommentByID(parentID); err == nil {
+			authors = append(authors, c.AuthorID)
+		}
+	}
+
+	for _, author := range authors {
+		blocked, err := r.Relations.HasRelation(author, id, relation.KindBlock)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return relation.ErrBlocked
+		}
+	}
+	return nil
+}
+
+// mutedAuthors возвращает ID авторов, скрытых текущим пользователем (nil для анонимного запроса)
+func (r *Resolver) mutedAuthors(ctx context.Context) (map[string]bool, error) {
+	if r.Relations == nil {
+		return nil, nil
+	}
+
+	userID, err := auth.GetUserIDFromContext(ctx)
+	if err != nil {
+		return nil, nil
+	}
+
+	targets, err := r.Relations.GetTargets(fmt.Sprint(userID), relation.KindMute)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, nil
+	}
+
+	muted := make(map[string]bool, len(targets))
+	for _, target := range targets {
+		muted[target] = true
+	}
+	return muted, nil
+}
+
+func (r *Resolver) visiblePosts(ctx context.Context, posts []*model.Post) ([]*model.Post, error) {
+	muted, err := r.mutedAuthors(ctx)
+	if err != nil || muted == nil {
+		return posts, err
+	}
+
+	visible := make([]*model.Post, 0, len(posts))
+	for _, p := range posts {
+		if !muted[p.AuthorID] {
+			visible = append(visible, p)
+		}
+	}
+	return visible, nil
+}
+
+// visibleComments убирает комментарии скрытых авторов из страницы и из вложенных children; hasMore и nextOffset
+// считаются по всем комментариям, поэтому страница может оказаться короче limit
+func (r *Resolver) visibleComments(ctx context.Context, conn *model.CommentConnection) (*model.CommentConnection, error) {
+	muted, err := r.mutedAuthors(ctx)
+	if err != nil || muted == nil {
+		return conn, err
+	}
+
+	return &model.CommentConnection{
+		Items:      withoutMuted(conn.Items, muted),
+		HasMore:    conn.HasMore,
+		NextOffset: conn.NextOffset,
+	}, nil
+}
+
+// withoutMuted возвращает копии комментариев без скрытых авторов, рекурсивно фильтруя children.
+// Комментарии копируются: хранилище в памяти отдает свои объекты, менять их нельзя.
+func withoutMuted(comments []*model.Comment, muted map[string]bool) []*model.Comment {
+	visible := make([]*model.Comment, 0, len(comments))
+	for _, c := range comments {
+		if muted[c.AuthorID] {
+			continue
+		}
+		comment := *c
+		comment.Children = withoutMuted(c.Children, muted)
+		visible = append(visible, &comment)
+	}
+	return visible
+}
+
+// watchMuted - авторы, скрытые подписчиком, для открытой подписки: набор загружается один раз при подписке
+// и перечитывается после muteUser и unmuteUser. Для анонимного подписчика набор пустой.
+func (r *Resolver) watchMuted(ctx context.Context) (func() map[string]bool, error) {
+	if r.Relations == nil {
+		return func() map[string]bool { return nil }, nil
+	}
+	userID, err := auth.GetUserIDFromContext(ctx)
+	if err != nil {
+		return func() map[string]bool { return nil }, nil
+	}
+	return r.watchTargets(ctx, fmt.Sprint(userID), relation.KindMute)
+}
+
+// filterMuted не доставляет подписчику события скрытых им авторов; author возвращает автора события
+func filterMuted[T any](ctx context.Context, r *Resolver, in <-chan T, author func(T) string) (<-chan T, error) {
+	if r.Relations == nil {
+		return in, nil
+	}
+	if _, err := auth.GetUserIDFromContext(ctx); err != nil {
+		return in, nil
+	}
+
+	muted, err := r.watchMuted(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan T, 1)
+	go func() {
+		defer close(out)
+		for event := range in {
+			if muted()[author(event)] {
+				continue
+			}
+			select {
+			case out <- event:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out, nil
+}
+
+// filterMutedComments - filterMuted для подписок на комментарии
+func (r *Resolver) filterMutedComments(ctx context.Context, in <-chan *model.Comment) (<-chan *model.Comment, error) {
+	return filterMuted(ctx, r, in, func(c *model.Comment) string { return c.AuthorID })
+}
+
+// filterMutedPosts - filterMuted для подписок на посты
+func (r *Resolver) filterMutedPosts(ctx context.Context, in <-chan *model.Post) (<-chan *model.Post, error) {
+	return filterMuted(ctx, r, in, func(p *model.Post) string { return p.AuthorID })
+}
@@ -1,10 +1,20 @@
 package graph
 
 import (
+	"github.com/VitaminP8/postery/internal/audit"
+	"github.com/VitaminP8/postery/internal/auth"
 	"github.com/VitaminP8/postery/internal/comment"
+	"github.com/VitaminP8/postery/internal/export"
+	"github.com/VitaminP8/postery/internal/invite"
+	"github.com/VitaminP8/postery/internal/loginguard"
+	"github.com/VitaminP8/postery/internal/mention"
 	"github.com/VitaminP8/postery/internal/post"
+	"github.com/VitaminP8/postery/internal/presence"
+	"github.com/VitaminP8/postery/internal/relation"
 	"github.com/VitaminP8/postery/internal/subscription"
+	"github.com/VitaminP8/postery/internal/totp"
 	"github.com/VitaminP8/postery/internal/user"
+	"github.com/VitaminP8/postery/internal/webhook"
 )
 
 // Resolver служит корневой точкой для всех резолверов.
@@ -13,5 +23,24 @@ type Resolver struct {
 	PostStore           post.PostStorage
 	CommentStore        comment.CommentStorage
 	UserStore           user.UserStorage
+	Accounts            user.AccountStorage
 	SubscriptionManager subscription.Manager
+	// SubscriptionLimiter - ограничения числа открытых подписок; nil - без ограничений
+	SubscriptionLimiter *subscription.Limiter
+	Revocations         auth.RevocationStorage
+	AccessTokenStore    auth.AccessTokenStorage
+	SessionStore        auth.SessionStorage
+	ExportManager       *export.Manager
+	LoginGuard          *loginguard.Guard
+	Audit               audit.Logger
+	Relations           relation.RelationStorage
+	Mentions            mention.MentionStorage
+	TotpCipher          *totp.Cipher
+	LoginChallenges     *totp.Challenges
+	Invites             invite.InviteStorage
+	Presence            *presence.Tracker
+	Webhooks            webhook.WebhookStorage
+	WebhookDispatcher   *webhook.Dispatcher
+	// RegistrationMode - кто может регистрироваться; пустое значение - invite.ModeOpen
+	RegistrationMode invite.Mode
 }
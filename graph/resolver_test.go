@@ -2,12 +2,30 @@ package graph
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/audit"
 	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/export"
+	"github.com/VitaminP8/postery/internal/identity"
+	"github.com/VitaminP8/postery/internal/invite"
+	"github.com/VitaminP8/postery/internal/loginguard"
 	"github.com/VitaminP8/postery/internal/mocks"
+	"github.com/VitaminP8/postery/internal/presence"
+	"github.com/VitaminP8/postery/internal/relation"
+	"github.com/VitaminP8/postery/internal/storage/memory"
+	"github.com/VitaminP8/postery/internal/subscription"
+	"github.com/VitaminP8/postery/internal/totp"
+	"github.com/VitaminP8/postery/internal/user"
+	"github.com/VitaminP8/postery/internal/webhook"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -18,7 +36,7 @@ func createUserContext(userID uint) context.Context {
 }
 
 func TestMutationResolver_CreatePost(t *testing.T) {
-	mockPostStorage := mocks.NewMockPostStorage()
+	mockPostStorage := mocks.NewMockPostStorage(nil)
 
 	resolver := &Resolver{
 		PostStore: mockPostStorage,
@@ -53,7 +71,7 @@ func TestMutationResolver_CreatePost(t *testing.T) {
 }
 
 func TestMutationResolver_DeletePostById(t *testing.T) {
-	mockPostStorage := mocks.NewMockPostStorage()
+	mockPostStorage := mocks.NewMockPostStorage(nil)
 
 	resolver := &Resolver{
 		PostStore: mockPostStorage,
@@ -81,7 +99,7 @@ func TestMutationResolver_DeletePostById(t *testing.T) {
 }
 
 func TestMutationResolver_DisableEnableComment(t *testing.T) {
-	mockPostStorage := mocks.NewMockPostStorage()
+	mockPostStorage := mocks.NewMockPostStorage(nil)
 
 	resolver := &Resolver{
 		PostStore: mockPostStorage,
@@ -120,7 +138,7 @@ func TestMutationResolver_DisableEnableComment(t *testing.T) {
 }
 
 func TestQueryResolver_Posts(t *testing.T) {
-	mockPostStorage := mocks.NewMockPostStorage()
+	mockPostStorage := mocks.NewMockPostStorage(nil)
 
 	resolver := &Resolver{
 		PostStore: mockPostStorage,
@@ -151,7 +169,7 @@ func TestQueryResolver_Posts(t *testing.T) {
 }
 
 func TestQueryResolver_Post(t *testing.T) {
-	mockPostStorage := mocks.NewMockPostStorage()
+	mockPostStorage := mocks.NewMockPostStorage(nil)
 
 	resolver := &Resolver{
 		PostStore: mockPostStorage,
@@ -179,6 +197,7 @@ func TestQueryResolver_Post(t *testing.T) {
 }
 
 func TestMutationResolver_RegisterAndLoginUser(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test_secret_key_for_jwt")
 	mockUserStorage := mocks.NewMockUserStorage()
 
 	resolver := &Resolver{
@@ -192,7 +211,7 @@ func TestMutationResolver_RegisterAndLoginUser(t *testing.T) {
 		email := "test@example.com"
 		password := "password123"
 
-		user, err := resolver.Mutation().RegisterUser(ctx, username, email, password)
+		user, err := resolver.Mutation().RegisterUser(ctx, username, email, password, nil)
 
 		require.NoError(t, err)
 		assert.Equal(t, username, user.Username)
@@ -203,10 +222,11 @@ func TestMutationResolver_RegisterAndLoginUser(t *testing.T) {
 		username := "testuser"
 		password := "password123"
 
-		tokenPtr, err := resolver.Mutation().LoginUser(ctx, username, password)
+		result, err := resolver.Mutation().LoginUser(ctx, username, password)
 		require.NoError(t, err)
-		require.NotNil(t, tokenPtr)
-		assert.Contains(t, *tokenPtr, "jwt-token-for-user-")
+		require.NotNil(t, result.Token)
+		assert.Nil(t, result.Challenge)
+		assert.Len(t, strings.Split(*result.Token, "."), 3)
 	})
 
 	t.Run("Error when registering existing user", func(t *testing.T) {
@@ -214,7 +234,7 @@ func TestMutationResolver_RegisterAndLoginUser(t *testing.T) {
 		email := "another@example.com"
 		password := "password456"
 
-		user, err := resolver.Mutation().RegisterUser(ctx, username, email, password)
+		user, err := resolver.Mutation().RegisterUser(ctx, username, email, password, nil)
 		assert.Error(t, err)
 		assert.Nil(t, user)
 	})
@@ -223,14 +243,74 @@ func TestMutationResolver_RegisterAndLoginUser(t *testing.T) {
 		username := "testuser"
 		password := "wrongpassword"
 
-		tokenPtr, err := resolver.Mutation().LoginUser(ctx, username, password)
+		result, err := resolver.Mutation().LoginUser(ctx, username, password)
 		assert.Error(t, err)
-		assert.Nil(t, tokenPtr)
+		assert.Nil(t, result)
+	})
+}
+
+func TestMutationResolver_Sessions(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test_secret_key_for_jwt")
+	resolver := &Resolver{
+		UserStore:    mocks.NewMockUserStorage(),
+		SessionStore: memory.NewSessionMemoryStorage(),
+	}
+
+	registered, err := resolver.Mutation().RegisterUser(context.Background(), "testuser", "test@example.com", "password123", nil)
+	require.NoError(t, err)
+	userID, err := strconv.ParseUint(registered.ID, 10, 64)
+	require.NoError(t, err)
+
+	login := func(userAgent string) {
+		ctx := auth.WithUserAgent(auth.WithClientIP(context.Background(), "192.0.2.1"), userAgent)
+		_, err := resolver.Mutation().LoginUser(ctx, "testuser", "password123")
+		require.NoError(t, err)
+	}
+	login("laptop")
+	login("phone")
+
+	stored, err := resolver.SessionStore.GetSessions(uint(userID))
+	require.NoError(t, err)
+	require.Len(t, stored, 2)
+	current := stored[0]
+	ctx := auth.WithSessionID(createUserContext(uint(userID)), current.ID)
+
+	t.Run("List sessions", func(t *testing.T) {
+		sessions, err := resolver.Query().Sessions(ctx)
+		require.NoError(t, err)
+		require.Len(t, sessions, 2)
+
+		for _, session := range sessions {
+			assert.Equal(t, session.ID == current.ID, session.Current)
+			assert.Equal(t, "192.0.2.1", session.IP)
+		}
+	})
+
+	t.Run("Error when revoking another user's session", func(t *testing.T) {
+		_, err := resolver.Mutation().RevokeSession(createUserContext(uint(userID)+1), current.ID)
+		assert.ErrorIs(t, err, auth.ErrSessionNotFound)
+	})
+
+	t.Run("Revoke session", func(t *testing.T) {
+		success, err := resolver.Mutation().RevokeSession(ctx, current.ID)
+		require.NoError(t, err)
+		assert.True(t, success)
+
+		sessions, err := resolver.Query().Sessions(ctx)
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+		assert.NotEqual(t, current.ID, sessions[0].ID)
+		assert.False(t, sessions[0].Current)
+	})
+
+	t.Run("Error when not configured", func(t *testing.T) {
+		_, err := (&Resolver{}).Query().Sessions(ctx)
+		assert.ErrorIs(t, err, errSessionsDisabled)
 	})
 }
 
 func TestMutationResolver_CreateComment(t *testing.T) {
-	mockPostStorage := mocks.NewMockPostStorage()
+	mockPostStorage := mocks.NewMockPostStorage(nil)
 	subscriptionManager := mocks.NewMockSubscriptionManager()
 	mockCommentStorage := mocks.NewMockCommentStorage(subscriptionManager)
 
@@ -290,18 +370,22 @@ func TestMutationResolver_CreateComment(t *testing.T) {
 
 func TestSubscriptionResolver_CommentAdded(t *testing.T) {
 	subscriptionManager := mocks.NewMockSubscriptionManager()
+	postStore := mocks.NewMockPostStorage(nil)
 
 	resolver := &Resolver{
+		PostStore:           postStore,
 		SubscriptionManager: subscriptionManager,
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	postID := "test-post-1"
+	post, err := postStore.CreatePost(createUserContext(1), "Title", "Content")
+	require.NoError(t, err)
+	postID := post.ID
 
 	t.Run("Successfully subscribe to comments", func(t *testing.T) {
-		commentChan, err := resolver.Subscription().CommentAdded(ctx, postID)
+		commentChan, err := resolver.Subscription().CommentAdded(ctx, postID, nil)
 		require.NoError(t, err)
 		assert.NotNil(t, commentChan)
 
@@ -313,7 +397,7 @@ func TestSubscriptionResolver_CommentAdded(t *testing.T) {
 			CreatedAt: time.Now().Format(time.RFC3339),
 		}
 
-		subscriptionManager.Publish(postID, comment)
+		subscriptionManager.Publish(subscription.CommentsTopic(postID), subscription.Event{Type: subscription.EventCommentAdded, Payload: comment})
 
 		select {
 		case receivedComment := <-commentChan:
@@ -327,4 +411,1517 @@ func TestSubscriptionResolver_CommentAdded(t *testing.T) {
 		assert.Len(t, notifications, 1)
 		assert.Equal(t, comment.ID, notifications[0].ID)
 	})
+
+	t.Run("Replays comments missed after cursor", func(t *testing.T) {
+		manager := subscription.NewSubscriptionManager()
+		resolver := &Resolver{PostStore: postStore, SubscriptionManager: manager}
+		topic := subscription.CommentsTopic(postID)
+
+		first, err := resolver.Subscription().CommentAdded(ctx, postID, nil)
+		require.NoError(t, err)
+		manager.Publish(topic, subscription.Event{Type: subscription.EventCommentAdded, Payload: &model.Comment{ID: "1", PostID: postID}})
+
+		var cursor *string
+		select {
+		case c := <-first:
+			require.NotNil(t, c.Cursor)
+			cursor = c.Cursor
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for comment")
+		}
+
+		// клиент отключился и пропустил два комментария
+		manager.Publish(topic, subscription.Event{Type: subscription.EventCommentAdded, Payload: &model.Comment{ID: "2", PostID: postID}})
+		manager.Publish(topic, subscription.Event{Type: subscription.EventCommentAdded, Payload: &model.Comment{ID: "3", PostID: postID}})
+
+		resumed, err := resolver.Subscription().CommentAdded(ctx, postID, cursor)
+		require.NoError(t, err)
+		manager.Publish(topic, subscription.Event{Type: subscription.EventCommentAdded, Payload: &model.Comment{ID: "4", PostID: postID}})
+
+		var ids []string
+		for len(ids) < 3 {
+			select {
+			case c := <-resumed:
+				ids = append(ids, c.ID)
+			case <-time.After(time.Second):
+				t.Fatal("Timeout waiting for comments")
+			}
+		}
+		assert.Equal(t, []string{"2", "3", "4"}, ids)
+	})
+
+	t.Run("Truncated history is reported", func(t *testing.T) {
+		manager := subscription.NewSubscriptionManager()
+		manager.HistorySize = 1
+		resolver := &Resolver{PostStore: postStore, SubscriptionManager: manager}
+		topic := subscription.CommentsTopic(postID)
+		for i := 1; i <= 3; i++ {
+			manager.Publish(topic, subscription.Event{Type: subscription.EventCommentAdded, Payload: &model.Comment{ID: strconv.Itoa(i), PostID: postID}})
+		}
+
+		since := "1"
+		_, err := resolver.Subscription().CommentAdded(ctx, postID, &since)
+		assert.ErrorIs(t, err, subscription.ErrHistoryTruncated)
+		assert.Equal(t, CodeHistoryTruncated, ErrorPresenter(ctx, err).Extensions["code"])
+	})
+
+	t.Run("Invalid cursor", func(t *testing.T) {
+		since := "abc"
+		_, err := resolver.Subscription().CommentAdded(ctx, postID, &since)
+		assert.Error(t, err)
+	})
+
+	t.Run("Unknown post is rejected", func(t *testing.T) {
+		_, err := resolver.Subscription().CommentAdded(ctx, "999", nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestSubscriptionResolver_PostEvents(t *testing.T) {
+	manager := subscription.NewSubscriptionManager()
+	resolver := &Resolver{
+		PostStore:           mocks.NewMockPostStorage(manager),
+		SubscriptionManager: manager,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	authorCtx := createUserContext(1)
+
+	created, err := resolver.Subscription().PostCreated(ctx)
+	require.NoError(t, err)
+
+	post, err := resolver.Mutation().CreatePost(authorCtx, "Title", "Content")
+	require.NoError(t, err)
+
+	t.Run("Post created", func(t *testing.T) {
+		select {
+		case p := <-created:
+			assert.Equal(t, post.ID, p.ID)
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for post")
+		}
+	})
+
+	t.Run("Unknown post", func(t *testing.T) {
+		_, err := resolver.Subscription().PostUpdated(ctx, "404")
+		assert.Error(t, err)
+	})
+
+	t.Run("Comments toggled", func(t *testing.T) {
+		toggled, err := resolver.Subscription().CommentsToggled(ctx, post.ID)
+		require.NoError(t, err)
+		updated, err := resolver.Subscription().PostUpdated(ctx, post.ID)
+		require.NoError(t, err)
+
+		_, err = resolver.Mutation().DisableComment(authorCtx, post.ID)
+		require.NoError(t, err)
+
+		for _, ch := range []<-chan *model.Post{toggled, updated} {
+			select {
+			case p := <-ch:
+				assert.True(t, p.CommentsDisabled)
+			case <-time.After(time.Second):
+				t.Fatal("Timeout waiting for post")
+			}
+		}
+	})
+
+	t.Run("Post deleted", func(t *testing.T) {
+		deleted, err := resolver.Subscription().PostDeleted(ctx, post.ID)
+		require.NoError(t, err)
+
+		_, err = resolver.Mutation().DeletePostByID(authorCtx, post.ID)
+		require.NoError(t, err)
+
+		select {
+		case id := <-deleted:
+			assert.Equal(t, post.ID, id)
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for deletion")
+		}
+	})
+}
+
+func TestSubscriptionResolver_ReplyAdded(t *testing.T) {
+	manager := subscription.NewSubscriptionManager()
+	postStorage := mocks.NewMockPostStorage(nil)
+	resolver := &Resolver{
+		PostStore:           postStorage,
+		CommentStore:        memory.NewCommentMemoryStorage(postStorage, manager),
+		SubscriptionManager: manager,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	userCtx := createUserContext(1)
+
+	post, err := resolver.Mutation().CreatePost(userCtx, "Title", "Content")
+	require.NoError(t, err)
+	root, err := resolver.Mutation().CreateComment(userCtx, post.ID, nil, "Root")
+	require.NoError(t, err)
+
+	direct, err := resolver.Subscription().ReplyAdded(ctx, root.ID, nil)
+	require.NoError(t, err)
+	includeDescendants := true
+	thread, err := resolver.Subscription().ReplyAdded(ctx, root.ID, &includeDescendants)
+	require.NoError(t, err)
+
+	receive := func(t *testing.T, ch <-chan *model.Comment) *model.Comment {
+		select {
+		case c := <-ch:
+			return c
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for reply")
+			return nil
+		}
+	}
+
+	t.Run("Unknown comment", func(t *testing.T) {
+		_, err := resolver.Subscription().ReplyAdded(ctx, "404", nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("Direct reply reaches both subscriptions", func(t *testing.T) {
+		child, err := resolver.Mutation().CreateComment(userCtx, post.ID, &root.ID, "Child")
+		require.NoError(t, err)
+
+		assert.Equal(t, child.ID, receive(t, direct).ID)
+		assert.Equal(t, child.ID, receive(t, thread).ID)
+
+		// ответ на ответ получает только подписка на всю ветку
+		grandchild, err := resolver.Mutation().CreateComment(userCtx, post.ID, &child.ID, "Grandchild")
+		require.NoError(t, err)
+		assert.Equal(t, grandchild.ID, receive(t, thread).ID)
+
+		select {
+		case c := <-direct:
+			t.Fatalf("Unexpected reply %s", c.ID)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("Other threads are not delivered", func(t *testing.T) {
+		other, err := resolver.Mutation().CreateComment(userCtx, post.ID, nil, "Other root")
+		require.NoError(t, err)
+		_, err = resolver.Mutation().CreateComment(userCtx, post.ID, &other.ID, "Other reply")
+		require.NoError(t, err)
+
+		select {
+		case c := <-thread:
+			t.Fatalf("Unexpected reply %s", c.ID)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
+
+func TestMutationResolver_DeleteAccount(t *testing.T) {
+	setup := func(t *testing.T) (*Resolver, context.Context, *model.Post) {
+		mockUserStorage := mocks.NewMockUserStorage()
+		mockPostStorage := mocks.NewMockPostStorage(nil)
+		mockCommentStorage := mocks.NewMockCommentStorage(nil)
+
+		sessions := memory.NewSessionMemoryStorage()
+		accessTokens := memory.NewAccessTokenMemoryStorage()
+		exportManager, err := export.NewManager(t.TempDir(), []byte("test-signing-key"), mockUserStorage, mockPostStorage, mockCommentStorage)
+		require.NoError(t, err)
+		resolver := &Resolver{
+			UserStore:        mockUserStorage,
+			PostStore:        mockPostStorage,
+			CommentStore:     mockCommentStorage,
+			SessionStore:     sessions,
+			AccessTokenStore: accessTokens,
+			Revocations:      memory.NewRevocationMemoryStorage(),
+			ExportManager:    exportManager,
+			Accounts: &memory.AccountMemoryStorage{
+				Users:        mockUserStorage,
+				Posts:        mockPostStorage,
+				Comments:     mockCommentStorage,
+				Sessions:     sessions,
+				AccessTokens: accessTokens,
+			},
+		}
+
+		user, err := mockUserStorage.RegisterUser("testuser", "test@example.com", "password123")
+		require.NoError(t, err)
+		userID, err := strconv.Atoi(user.ID)
+		require.NoError(t, err)
+
+		ctx := createUserContext(uint(userID))
+		post, err := mockPostStorage.CreatePost(ctx, "Test Post", "Content")
+		require.NoError(t, err)
+		_, err = mockCommentStorage.CreateComment(ctx, post.ID, "", "Comment")
+		require.NoError(t, err)
+
+		return resolver, ctx, post
+	}
+
+	t.Run("Error with wrong password", func(t *testing.T) {
+		resolver, ctx, post := setup(t)
+
+		success, err := resolver.Mutation().DeleteAccount(ctx, "wrongpassword", model.ContentDeletionModeDelete)
+		assert.Error(t, err)
+		assert.False(t, success)
+
+		// контент и аккаунт не тронуты
+		_, err = resolver.PostStore.GetPostById(post.ID)
+		assert.NoError(t, err)
+		_, err = resolver.UserStore.VerifyCredentials("testuser", "password123")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Delete account with content", func(t *testing.T) {
+		resolver, ctx, post := setup(t)
+
+		success, err := resolver.Mutation().DeleteAccount(ctx, "password123", model.ContentDeletionModeDelete)
+		require.NoError(t, err)
+		assert.True(t, success)
+
+		_, err = resolver.PostStore.GetPostById(post.ID)
+		assert.Error(t, err)
+
+		comments, err := resolver.CommentStore.GetComments(post.ID, 10, 0)
+		require.NoError(t, err)
+		assert.Empty(t, comments.Items)
+
+		_, err = resolver.UserStore.VerifyCredentials("testuser", "password123")
+		assert.Error(t, err)
+	})
+
+	t.Run("Sessions, access tokens and exports are removed", func(t *testing.T) {
+		resolver, ctx, _ := setup(t)
+		userID, err := auth.GetUserIDFromContext(ctx)
+		require.NoError(t, err)
+
+		require.NoError(t, resolver.SessionStore.CreateSession(&auth.Session{ID: "laptop", UserID: userID, CreatedAt: time.Now()}))
+		created, err := resolver.Mutation().CreateAccessToken(ctx, "ci", []model.AccessTokenScope{model.AccessTokenScopeCommentWrite}, nil)
+		require.NoError(t, err)
+		exportJob, err := resolver.Mutation().RequestDataExport(ctx)
+		require.NoError(t, err)
+		resolver.ExportManager.Wait()
+
+		_, err = resolver.Mutation().DeleteAccount(ctx, "password123", model.ContentDeletionModeDelete)
+		require.NoError(t, err)
+
+		sessions, err := resolver.SessionStore.GetSessions(userID)
+		require.NoError(t, err)
+		assert.Empty(t, sessions)
+
+		_, err = resolver.AccessTokenStore.UseAccessToken(auth.HashAccessToken(created.Token), time.Now())
+		assert.ErrorIs(t, err, auth.ErrAccessTokenNotFound)
+
+		_, err = resolver.ExportManager.Get(exportJob.ID, fmt.Sprint(userID))
+		assert.ErrorIs(t, err, export.ErrJobNotFound)
+
+		// выданные до удаления JWT отозваны
+		revoked, err := resolver.Revocations.IsRevoked(userID, time.Now().Add(-time.Minute))
+		require.NoError(t, err)
+		assert.True(t, revoked)
+	})
+
+	t.Run("Delete account and anonymize content", func(t *testing.T) {
+		resolver, ctx, post := setup(t)
+
+		success, err := resolver.Mutation().DeleteAccount(ctx, "password123", model.ContentDeletionModeAnonymize)
+		require.NoError(t, err)
+		assert.True(t, success)
+
+		savedPost, err := resolver.PostStore.GetPostById(post.ID)
+		require.NoError(t, err)
+		assert.Equal(t, user.DeletedUserID, savedPost.AuthorID)
+
+		comments, err := resolver.CommentStore.GetComments(post.ID, 10, 0)
+		require.NoError(t, err)
+		require.Len(t, comments.Items, 1)
+		assert.Equal(t, user.DeletedUserID, comments.Items[0].AuthorID)
+	})
+}
+
+func TestMutationResolver_AccessTokens(t *testing.T) {
+	resolver := &Resolver{
+		AccessTokenStore: memory.NewAccessTokenMemoryStorage(),
+	}
+	ctx := createUserContext(1)
+
+	t.Run("Create token", func(t *testing.T) {
+		expiresAt := time.Now().Add(24 * time.Hour).Format(time.RFC3339)
+		scopes := []model.AccessTokenScope{model.AccessTokenScopeCommentWrite, model.AccessTokenScopeCommentWrite}
+
+		created, err := resolver.Mutation().CreateAccessToken(ctx, " ci bot ", scopes, &expiresAt)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(created.Token, auth.AccessTokenPrefix))
+		assert.Equal(t, "ci bot", created.AccessToken.Name)
+		assert.Equal(t, []model.AccessTokenScope{model.AccessTokenScopeCommentWrite}, created.AccessToken.Scopes)
+		assert.Equal(t, expiresAt, *created.AccessToken.ExpiresAt)
+
+		// сохранен только хэш - токен находится по нему
+		token, err := resolver.AccessTokenStore.UseAccessToken(auth.HashAccessToken(created.Token), time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, uint(1), token.UserID)
+	})
+
+	t.Run("Validation errors", func(t *testing.T) {
+		scopes := []model.AccessTokenScope{model.AccessTokenScopeRead}
+		past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+		invalid := "tomorrow"
+
+		_, err := resolver.Mutation().CreateAccessToken(ctx, "  ", scopes, nil)
+		assert.Error(t, err)
+		_, err = resolver.Mutation().CreateAccessToken(ctx, "bot", nil, nil)
+		assert.Error(t, err)
+		_, err = resolver.Mutation().CreateAccessToken(ctx, "bot", scopes, &past)
+		assert.Error(t, err)
+		_, err = resolver.Mutation().CreateAccessToken(ctx, "bot", scopes, &invalid)
+		assert.Error(t, err)
+	})
+
+	t.Run("List and revoke", func(t *testing.T) {
+		tokens, err := resolver.Query().AccessTokens(ctx)
+		require.NoError(t, err)
+		require.Len(t, tokens, 1)
+
+		// чужой токен отозвать нельзя
+		_, err = resolver.Mutation().RevokeAccessToken(createUserContext(2), tokens[0].ID)
+		assert.ErrorIs(t, err, auth.ErrAccessTokenNotFound)
+
+		success, err := resolver.Mutation().RevokeAccessToken(ctx, tokens[0].ID)
+		require.NoError(t, err)
+		assert.True(t, success)
+
+		tokens, err = resolver.Query().AccessTokens(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, tokens)
+	})
+
+	t.Run("Error when not configured", func(t *testing.T) {
+		_, err := (&Resolver{}).Query().AccessTokens(ctx)
+		assert.ErrorIs(t, err, errAccessTokensDisabled)
+	})
+}
+
+func TestMutationResolver_LoginUser_Throttling(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test_secret_key_for_jwt")
+	mockUserStorage := mocks.NewMockUserStorage()
+	auditLog := audit.NewMemoryLogger()
+
+	resolver := &Resolver{
+		UserStore:  mockUserStorage,
+		LoginGuard: loginguard.New(loginguard.DefaultConfig()),
+		Audit:      auditLog,
+	}
+
+	u, err := mockUserStorage.RegisterUser("testuser", "test@example.com", "password123")
+	require.NoError(t, err)
+
+	ctx := auth.WithClientIP(context.Background(), "10.0.0.1")
+
+	t.Run("Same error for unknown user and wrong password", func(t *testing.T) {
+		_, errUnknown := resolver.Mutation().LoginUser(ctx, "nobody", "password123")
+		_, errWrong := resolver.Mutation().LoginUser(ctx, "testuser", "wrongpassword")
+
+		assert.ErrorIs(t, errUnknown, user.ErrInvalidCredentials)
+		assert.Equal(t, errUnknown.Error(), errWrong.Error())
+	})
+
+	t.Run("Audit entry for each failure", func(t *testing.T) {
+		entries := auditLog.Entries()
+		require.Len(t, entries, 2)
+		assert.Equal(t, audit.ActionLoginFailed, entries[1].Action)
+		assert.Equal(t, "testuser", entries[1].Username)
+		assert.Equal(t, "10.0.0.1", entries[1].IP)
+	})
+
+	t.Run("Throttled after repeated failures", func(t *testing.T) {
+		// 3 ошибки допускаются без паузы, 4-я включает паузу
+		for i := 0; i < 3; i++ {
+			_, err := resolver.Mutation().LoginUser(ctx, "testuser", "wrongpassword")
+			assert.ErrorIs(t, err, user.ErrInvalidCredentials)
+		}
+
+		// даже верный пароль не принимается, пока действует пауза
+		_, err := resolver.Mutation().LoginUser(ctx, "testuser", "password123")
+		assert.ErrorIs(t, err, loginguard.ErrTooManyAttempts)
+
+		gqlErr := ErrorPresenter(ctx, err)
+		assert.Equal(t, CodeTooManyAttempts, gqlErr.Extensions["code"])
+
+		// вход через внешнего провайдера не обходит блокировку
+		_, err = resolver.LoginExternal(ctx, u)
+		assert.ErrorIs(t, err, loginguard.ErrTooManyAttempts)
+	})
+
+	t.Run("Admin unlock", func(t *testing.T) {
+		adminCtx := auth.WithRole(createUserContext(99), auth.RoleAdmin)
+
+		success, err := resolver.Mutation().UnlockAccount(adminCtx, "testuser")
+		require.NoError(t, err)
+		assert.True(t, success)
+
+		token, err := resolver.Mutation().LoginUser(ctx, "testuser", "password123")
+		require.NoError(t, err)
+		assert.NotNil(t, token)
+
+		entries := auditLog.Entries()
+		var unlock *audit.Entry
+		for i := range entries {
+			if entries[i].Action == audit.ActionAccountUnlock {
+				unlock = &entries[i]
+			}
+		}
+		require.NotNil(t, unlock)
+		assert.Equal(t, "99", unlock.ActorID)
+	})
+}
+
+func TestMutationResolver_TwoFactor(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test_secret_key_for_jwt")
+
+	mockUserStorage := mocks.NewMockUserStorage()
+	cipher, err := totp.NewCipher([]byte("test_totp_key"))
+	require.NoError(t, err)
+
+	resolver := &Resolver{
+		UserStore:       mockUserStorage,
+		LoginGuard:      loginguard.New(loginguard.DefaultConfig()),
+		TotpCipher:      cipher,
+		LoginChallenges: totp.NewChallenges(),
+	}
+
+	u, err := mockUserStorage.RegisterUser("testuser", "test@example.com", "password123")
+	require.NoError(t, err)
+	ctx := createUserContext(1)
+
+	var secret string
+	var recoveryCodes []string
+
+	// код для следующего интервала: текущий мог быть уже использован в предыдущем шаге
+	nextCode := func(t *testing.T) string {
+		state, err := mockUserStorage.GetTwoFactor(u.ID)
+		require.NoError(t, err)
+		step := totp.Step(time.Now())
+		if state != nil && state.LastStep >= step {
+			step = state.LastStep + 1
+		}
+		code, err := totp.Code(secret, step)
+		require.NoError(t, err)
+		return code
+	}
+
+	t.Run("Enable returns provisioning URI", func(t *testing.T) {
+		setup, err := resolver.Mutation().EnableTotp(ctx)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(setup.ProvisioningURI, "otpauth://totp/Postery:testuser?"))
+		secret = setup.Secret
+
+		// секрет хранится зашифрованным
+		state, err := mockUserStorage.GetTwoFactor(u.ID)
+		require.NoError(t, err)
+		assert.NotContains(t, state.Secret, secret)
+		assert.False(t, state.Enabled)
+	})
+
+	t.Run("Login without challenge until confirmed", func(t *testing.T) {
+		result, err := resolver.Mutation().LoginUser(ctx, "testuser", "password123")
+		require.NoError(t, err)
+		assert.NotNil(t, result.Token)
+	})
+
+	t.Run("Confirm with wrong code", func(t *testing.T) {
+		_, err := resolver.Mutation().ConfirmTotp(ctx, "000000")
+		assert.ErrorIs(t, err, errInvalidTwoFactorCode)
+	})
+
+	t.Run("Confirm returns recovery codes", func(t *testing.T) {
+		recoveryCodes, err = resolver.Mutation().ConfirmTotp(ctx, nextCode(t))
+		require.NoError(t, err)
+		assert.Len(t, recoveryCodes, totp.RecoveryCodeCount)
+
+		_, err = resolver.Mutation().EnableTotp(ctx)
+		assert.ErrorIs(t, err, errTotpAlreadyEnabled)
+	})
+
+	login := func(t *testing.T) string {
+		result, err := resolver.Mutation().LoginUser(ctx, "testuser", "password123")
+		require.NoError(t, err)
+		assert.Nil(t, result.Token)
+		require.NotNil(t, result.Challenge)
+		return *result.Challenge
+	}
+
+	t.Run("Login returns challenge", func(t *testing.T) {
+		challenge := login(t)
+
+		_, err := resolver.Mutation().CompleteLogin(ctx, challenge, "000000")
+		assert.ErrorIs(t, err, errInvalidTwoFactorCode)
+
+		token, err := resolver.Mutation().CompleteLogin(ctx, challenge, nextCode(t))
+		require.NoError(t, err)
+		assert.NotEmpty(t, token)
+
+		// challenge одноразовый
+		_, err = resolver.Mutation().CompleteLogin(ctx, challenge, nextCode(t))
+		assert.ErrorIs(t, err, totp.ErrInvalidChallenge)
+	})
+
+	t.Run("External login returns challenge", func(t *testing.T) {
+		result, err := resolver.LoginExternal(ctx, u)
+		require.NoError(t, err)
+		assert.Nil(t, result.Token)
+		require.NotNil(t, result.Challenge)
+
+		// текущий код уже использован - завершаем кодом восстановления
+		token, err := resolver.Mutation().CompleteLogin(ctx, *result.Challenge, recoveryCodes[2])
+		require.NoError(t, err)
+		assert.NotEmpty(t, token)
+	})
+
+	t.Run("Code cannot be reused", func(t *testing.T) {
+		state, err := mockUserStorage.GetTwoFactor(u.ID)
+		require.NoError(t, err)
+		used, err := totp.Code(secret, state.LastStep)
+		require.NoError(t, err)
+
+		_, err = resolver.Mutation().CompleteLogin(ctx, login(t), used)
+		assert.ErrorIs(t, err, errInvalidTwoFactorCode)
+	})
+
+	t.Run("Recovery code works once", func(t *testing.T) {
+		token, err := resolver.Mutation().CompleteLogin(ctx, login(t), strings.ToUpper(recoveryCodes[0]))
+		require.NoError(t, err)
+		assert.NotEmpty(t, token)
+
+		_, err = resolver.Mutation().CompleteLogin(ctx, login(t), recoveryCodes[0])
+		assert.ErrorIs(t, err, errInvalidTwoFactorCode)
+	})
+
+	t.Run("Disable requires password and counts failures", func(t *testing.T) {
+		_, err := resolver.Mutation().DisableTotp(ctx, "wrong-password", recoveryCodes[1])
+		assert.Error(t, err)
+		_, err = resolver.Mutation().DisableTotp(ctx, "password123", "000000")
+		assert.ErrorIs(t, err, errInvalidTwoFactorCode)
+		for i := 0; i < 3; i++ {
+			_, err = resolver.Mutation().DisableTotp(ctx, "password123", "000000")
+			assert.Error(t, err)
+		}
+
+		// после ошибок сверх бесплатных попыток нужна пауза даже с верным кодом
+		_, err = resolver.Mutation().DisableTotp(ctx, "password123", recoveryCodes[1])
+		assert.ErrorIs(t, err, loginguard.ErrTooManyAttempts)
+
+		state, err := mockUserStorage.GetTwoFactor(u.ID)
+		require.NoError(t, err)
+		assert.True(t, state.Enabled)
+		resolver.LoginGuard.Unlock("testuser")
+	})
+
+	t.Run("Disable", func(t *testing.T) {
+		success, err := resolver.Mutation().DisableTotp(ctx, "password123", recoveryCodes[1])
+		require.NoError(t, err)
+		assert.True(t, success)
+
+		result, err := resolver.Mutation().LoginUser(ctx, "testuser", "password123")
+		require.NoError(t, err)
+		assert.NotNil(t, result.Token)
+	})
+
+	t.Run("Error when not configured", func(t *testing.T) {
+		_, err := (&Resolver{UserStore: mockUserStorage}).Mutation().EnableTotp(ctx)
+		assert.ErrorIs(t, err, errTwoFactorDisabled)
+	})
+}
+
+func TestMutationResolver_BlockAndMute(t *testing.T) {
+	mockUserStorage := mocks.NewMockUserStorage()
+	mockPostStorage := mocks.NewMockPostStorage(nil)
+	manager := subscription.NewSubscriptionManager()
+
+	resolver := &Resolver{
+		UserStore:           mockUserStorage,
+		PostStore:           mockPostStorage,
+		CommentStore:        mocks.NewMockCommentStorage(manager),
+		SubscriptionManager: manager,
+		Relations:           memory.NewRelationMemoryStorage(),
+	}
+
+	// 1 - автор, 2 - заблокированный им пользователь, 3 - скрывший автора
+	for _, name := range []string{"author", "blocked", "viewer"} {
+		_, err := mockUserStorage.RegisterUser(name, name+"@example.com", "password123")
+		require.NoError(t, err)
+	}
+	authorCtx := createUserContext(1)
+	blockedCtx := createUserContext(2)
+	viewerCtx := createUserContext(3)
+
+	post, err := resolver.Mutation().CreatePost(authorCtx, "Post", "Content")
+	require.NoError(t, err)
+	otherPost, err := resolver.Mutation().CreatePost(blockedCtx, "Other", "Content")
+	require.NoError(t, err)
+
+	t.Run("Cannot block yourself or unknown user", func(t *testing.T) {
+		_, err := resolver.Mutation().BlockUser(authorCtx, "1")
+		assert.Error(t, err)
+		_, err = resolver.Mutation().BlockUser(authorCtx, "404")
+		assert.Error(t, err)
+	})
+
+	t.Run("Blocked user cannot reply", func(t *testing.T) {
+		// комментарий автора в чужом посте
+		authorComment, err := resolver.Mutation().CreateComment(authorCtx, otherPost.ID, nil, "Comment")
+		require.NoError(t, err)
+
+		success, err := resolver.Mutation().BlockUser(authorCtx, "2")
+		require.NoError(t, err)
+		assert.True(t, success)
+
+		_, err = resolver.Mutation().CreateComment(blockedCtx, post.ID, nil, "Reply")
+		assert.ErrorIs(t, err, relation.ErrBlocked)
+		assert.Equal(t, CodeBlocked, ErrorPresenter(blockedCtx, err).Extensions["code"])
+
+		// ответ на комментарий автора в своем посте тоже запрещен
+		_, err = resolver.Mutation().CreateComment(blockedCtx, otherPost.ID, &authorComment.ID, "Reply")
+		assert.ErrorIs(t, err, relation.ErrBlocked)
+
+		// остальные пользователи отвечают как обычно
+		_, err = resolver.Mutation().CreateComment(viewerCtx, post.ID, nil, "Reply")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Unblock", func(t *testing.T) {
+		_, err := resolver.Mutation().UnblockUser(authorCtx, "2")
+		require.NoError(t, err)
+
+		_, err = resolver.Mutation().CreateComment(blockedCtx, post.ID, nil, "Reply")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Muted author is hidden from viewer", func(t *testing.T) {
+		_, err := resolver.Mutation().MuteUser(viewerCtx, "2")
+		require.NoError(t, err)
+
+		posts, err := resolver.Query().Posts(viewerCtx)
+		require.NoError(t, err)
+		for _, p := range posts {
+			assert.NotEqual(t, "2", p.AuthorID)
+		}
+
+		comments, err := resolver.Query().Comments(viewerCtx, post.ID, nil, nil)
+		require.NoError(t, err)
+		for _, c := range comments.Items {
+			assert.NotEqual(t, "2", c.AuthorID)
+		}
+
+		// другие пользователи видят все
+		comments, err = resolver.Query().Comments(authorCtx, post.ID, nil, nil)
+		require.NoError(t, err)
+		assert.Len(t, comments.Items, 2)
+		posts, err = resolver.Query().Posts(context.Background())
+		require.NoError(t, err)
+		assert.Len(t, posts, 2)
+	})
+
+	t.Run("Muted author's replies are hidden in children", func(t *testing.T) {
+		// хранилище в памяти отдает ответы во вложенных children
+		store := memory.NewCommentMemoryStorage(mockPostStorage, manager)
+		treeResolver := &Resolver{CommentStore: store, Relations: resolver.Relations}
+
+		root, err := store.CreateComment(authorCtx, post.ID, "", "Root")
+		require.NoError(t, err)
+		reply, err := store.CreateComment(blockedCtx, post.ID, root.ID, "Muted reply")
+		require.NoError(t, err)
+		_, err = store.CreateComment(authorCtx, post.ID, reply.ID, "Nested reply")
+		require.NoError(t, err)
+		visible, err := store.CreateComment(authorCtx, post.ID, root.ID, "Visible reply")
+		require.NoError(t, err)
+
+		comments, err := treeResolver.Query().Comments(viewerCtx, post.ID, nil, nil)
+		require.NoError(t, err)
+		require.Len(t, comments.Items, 1)
+		require.Len(t, comments.Items[0].Children, 1)
+		assert.Equal(t, visible.ID, comments.Items[0].Children[0].ID)
+
+		// хранимое дерево не меняется
+		comments, err = treeResolver.Query().Comments(authorCtx, post.ID, nil, nil)
+		require.NoError(t, err)
+		require.Len(t, comments.Items, 1)
+		assert.Len(t, comments.Items[0].Children, 2)
+	})
+
+	t.Run("Muted author's comments are not delivered to subscription", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(viewerCtx)
+		defer cancel()
+
+		ch, err := resolver.Subscription().CommentAdded(ctx, post.ID, nil)
+		require.NoError(t, err)
+
+		_, err = resolver.Mutation().CreateComment(blockedCtx, post.ID, nil, "Muted")
+		require.NoError(t, err)
+		visible, err := resolver.Mutation().CreateComment(authorCtx, post.ID, nil, "Visible")
+		require.NoError(t, err)
+
+		select {
+		case c := <-ch:
+			assert.Equal(t, visible.ID, c.ID)
+		case <-time.After(time.Second):
+			t.Fatal("comment was not delivered")
+		}
+	})
+
+	t.Run("Unmute", func(t *testing.T) {
+		_, err := resolver.Mutation().UnmuteUser(viewerCtx, "2")
+		require.NoError(t, err)
+
+		posts, err := resolver.Query().Posts(viewerCtx)
+		require.NoError(t, err)
+		assert.Len(t, posts, 2)
+	})
+
+	t.Run("Open subscription reads muted authors once and follows muteUser", func(t *testing.T) {
+		relations := &countingRelations{RelationStorage: resolver.Relations}
+		resolver.Relations = relations
+		defer func() { resolver.Relations = relations.RelationStorage }()
+
+		ctx, cancel := context.WithCancel(viewerCtx)
+		defer cancel()
+		ch, err := resolver.Subscription().CommentAdded(ctx, post.ID, nil)
+		require.NoError(t, err)
+
+		// firstDelivered публикует комментарий пользователя 2 и следом комментарий автора
+		// и возвращает автора первого доставленного комментария
+		firstDelivered := func() string {
+			_, err := resolver.Mutation().CreateComment(blockedCtx, post.ID, nil, "Maybe muted")
+			if err != nil {
+				return ""
+			}
+			_, err = resolver.Mutation().CreateComment(authorCtx, post.ID, nil, "Visible")
+			if err != nil {
+				return ""
+			}
+
+			var authors []string
+			for len(authors) == 0 || authors[len(authors)-1] != "1" {
+				select {
+				case c := <-ch:
+					authors = append(authors, c.AuthorID)
+				case <-time.After(time.Second):
+					return ""
+				}
+			}
+			return authors[0]
+		}
+
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, "2", firstDelivered())
+		}
+		// список скрытых загружен при подписке, а не для каждого комментария
+		assert.Equal(t, int32(1), relations.getTargets.Load())
+
+		// список перечитывается асинхронно после события об изменении отношений
+		_, err = resolver.Mutation().MuteUser(viewerCtx, "2")
+		require.NoError(t, err)
+		require.Eventually(t, func() bool { return firstDelivered() == "1" }, 2*time.Second, 10*time.Millisecond)
+
+		_, err = resolver.Mutation().UnmuteUser(viewerCtx, "2")
+		require.NoError(t, err)
+		require.Eventually(t, func() bool { return firstDelivered() == "2" }, 2*time.Second, 10*time.Millisecond)
+	})
+}
+
+// countingRelations считает чтения списков отношений
+type countingRelations struct {
+	relation.RelationStorage
+	getTargets atomic.Int32
+}
+
+func (c *countingRelations) GetTargets(userID string, kind relation.Kind) ([]string, error) {
+	c.getTargets.Add(1)
+	return c.RelationStorage.GetTargets(userID, kind)
+}
+
+func TestResolver_FollowAndHomeFeed(t *testing.T) {
+	mockUserStorage := mocks.NewMockUserStorage()
+	manager := mocks.NewMockSubscriptionManager()
+
+	resolver := &Resolver{
+		UserStore:           mockUserStorage,
+		PostStore:           mocks.NewMockPostStorage(manager),
+		SubscriptionManager: manager,
+		Relations:           memory.NewRelationMemoryStorage(),
+	}
+
+	// 1 - читатель, 2 и 3 - авторы, 4 - автор, на которого читатель не подписан
+	for _, name := range []string{"reader", "author1", "author2", "stranger"} {
+		_, err := mockUserStorage.RegisterUser(name, name+"@example.com", "password123")
+		require.NoError(t, err)
+	}
+	readerCtx := createUserContext(1)
+
+	for _, id := range []string{"2", "3"} {
+		success, err := resolver.Mutation().FollowUser(readerCtx, id)
+		require.NoError(t, err)
+		assert.True(t, success)
+	}
+
+	var expected []string
+	for i, authorID := range []uint{2, 4, 3, 2, 4, 3} {
+		post, err := resolver.Mutation().CreatePost(createUserContext(authorID), fmt.Sprintf("Post %d", i), "Content")
+		require.NoError(t, err)
+		if authorID != 4 {
+			expected = append([]string{post.ID}, expected...)
+		}
+	}
+
+	t.Run("Feed pages in reverse chronological order", func(t *testing.T) {
+		first := 3
+		page, err := resolver.Query().HomeFeed(readerCtx, &first, nil)
+		require.NoError(t, err)
+		require.Len(t, page.Items, 3)
+		assert.True(t, page.HasMore)
+		require.NotNil(t, page.EndCursor)
+
+		next, err := resolver.Query().HomeFeed(readerCtx, &first, page.EndCursor)
+		require.NoError(t, err)
+		require.Len(t, next.Items, 1)
+		assert.False(t, next.HasMore)
+
+		var ids []string
+		for _, p := range append(page.Items, next.Items...) {
+			ids = append(ids, p.ID)
+		}
+		assert.Equal(t, expected, ids)
+	})
+
+	t.Run("Invalid cursor and page size", func(t *testing.T) {
+		bad := "not-a-cursor"
+		_, err := resolver.Query().HomeFeed(readerCtx, nil, &bad)
+		assert.ErrorIs(t, err, errInvalidCursor)
+
+		zero := 0
+		_, err = resolver.Query().HomeFeed(readerCtx, &zero, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("New post is published once regardless of followers", func(t *testing.T) {
+		before := len(manager.GetPublishedForTopic(subscription.PostsTopic))
+		post, err := resolver.Mutation().CreatePost(createUserContext(2), "New", "Content")
+		require.NoError(t, err)
+
+		published := manager.GetPublishedForTopic(subscription.PostsTopic)
+		require.Len(t, published, before+1)
+		assert.Equal(t, post.ID, published[len(published)-1].(*model.Post).ID)
+	})
+
+	t.Run("Subscription delivers followed authors' posts", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(readerCtx)
+		defer cancel()
+
+		ch, err := resolver.Subscription().PostPublishedByFollowed(ctx)
+		require.NoError(t, err)
+
+		// пост автора, на которого читатель не подписан, не доставляется
+		_, err = resolver.Mutation().CreatePost(createUserContext(4), "Stranger", "Content")
+		require.NoError(t, err)
+		post, err := resolver.Mutation().CreatePost(createUserContext(3), "Live", "Content")
+		require.NoError(t, err)
+
+		select {
+		case received := <-ch:
+			assert.Equal(t, post.ID, received.ID)
+		case <-time.After(time.Second):
+			t.Fatal("post was not delivered")
+		}
+	})
+
+	t.Run("Open subscription follows followUser and unfollowUser", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(readerCtx)
+		defer cancel()
+
+		ch, err := resolver.Subscription().PostPublishedByFollowed(ctx)
+		require.NoError(t, err)
+
+		// firstDelivered публикует пост пользователя 4 и следом пост автора 2, на которого читатель подписан
+		// все время, и возвращает автора первого доставленного поста; второй доставленный пост отбрасывается
+		firstDelivered := func() string {
+			_, err := resolver.Mutation().CreatePost(createUserContext(4), "Stranger", "Content")
+			if err != nil {
+				return ""
+			}
+			_, err = resolver.Mutation().CreatePost(createUserContext(2), "Author", "Content")
+			if err != nil {
+				return ""
+			}
+
+			var authors []string
+			for len(authors) == 0 || authors[len(authors)-1] != "2" {
+				select {
+				case p := <-ch:
+					authors = append(authors, p.AuthorID)
+				case <-time.After(time.Second):
+					return ""
+				}
+			}
+			return authors[0]
+		}
+
+		// список подписок перечитывается асинхронно после события об изменении отношений
+		_, err = resolver.Mutation().FollowUser(readerCtx, "4")
+		require.NoError(t, err)
+		require.Eventually(t, func() bool { return firstDelivered() == "4" }, 2*time.Second, 10*time.Millisecond)
+
+		_, err = resolver.Mutation().UnfollowUser(readerCtx, "4")
+		require.NoError(t, err)
+		require.Eventually(t, func() bool { return firstDelivered() == "2" }, 2*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Followers and following", func(t *testing.T) {
+		me, err := resolver.Query().Me(readerCtx)
+		require.NoError(t, err)
+
+		following, err := resolver.User().Following(readerCtx, me, nil, nil)
+		require.NoError(t, err)
+		require.Len(t, following.Items, 2)
+		assert.Equal(t, "author1", following.Items[0].Username)
+		// email других пользователей не раскрывается
+		assert.Empty(t, following.Items[0].Email)
+
+		author, err := mockUserStorage.GetUserByID("2")
+		require.NoError(t, err)
+		followers, err := resolver.User().Followers(readerCtx, author, nil, nil)
+		require.NoError(t, err)
+		require.Len(t, followers.Items, 1)
+		assert.Equal(t, "reader@example.com", followers.Items[0].Email)
+		// исходный пользователь в хранилище не изменен
+		assert.Equal(t, "author1@example.com", author.Email)
+	})
+
+	t.Run("Unfollow", func(t *testing.T) {
+		_, err := resolver.Mutation().UnfollowUser(readerCtx, "3")
+		require.NoError(t, err)
+
+		page, err := resolver.Query().HomeFeed(readerCtx, nil, nil)
+		require.NoError(t, err)
+		for _, p := range page.Items {
+			assert.Equal(t, "2", p.AuthorID)
+		}
+	})
+
+	t.Run("Cannot follow user who blocked you", func(t *testing.T) {
+		_, err := resolver.Mutation().BlockUser(createUserContext(4), "1")
+		require.NoError(t, err)
+
+		_, err = resolver.Mutation().FollowUser(readerCtx, "4")
+		assert.ErrorIs(t, err, relation.ErrBlocked)
+	})
+}
+
+func TestMutationResolver_ChangeUsername(t *testing.T) {
+	manager := subscription.NewSubscriptionManager()
+	resolver := &Resolver{
+		UserStore:           memory.NewUserMemoryStorage(),
+		PostStore:           mocks.NewMockPostStorage(nil),
+		CommentStore:        mocks.NewMockCommentStorage(manager),
+		SubscriptionManager: manager,
+		Mentions:            memory.NewMentionMemoryStorage(),
+	}
+
+	// 1 - alice, 2 - bob
+	for _, name := range []string{"alice", "bob"} {
+		_, err := resolver.UserStore.RegisterUser(name, name+"@example.com", "s3cure-passw0rd")
+		require.NoError(t, err)
+	}
+	aliceCtx := createUserContext(1)
+	bobCtx := createUserContext(2)
+
+	post, err := resolver.Mutation().CreatePost(bobCtx, "Post", "Спасибо, @Alice и @nobody!")
+	require.NoError(t, err)
+
+	t.Run("Mentions are recorded", func(t *testing.T) {
+		mentioned, err := resolver.Post().Mentions(bobCtx, post)
+		require.NoError(t, err)
+		require.Len(t, mentioned, 1)
+		assert.Equal(t, "1", mentioned[0].ID)
+		// email другого пользователя не раскрывается
+		assert.Empty(t, mentioned[0].Email)
+	})
+
+	t.Run("Change username", func(t *testing.T) {
+		u, err := resolver.Mutation().ChangeUsername(aliceCtx, "alicia")
+		require.NoError(t, err)
+		assert.Equal(t, "alicia", u.Username)
+
+		history, err := resolver.Query().UsernameHistory(aliceCtx)
+		require.NoError(t, err)
+		require.Len(t, history, 1)
+		assert.Equal(t, "alice", history[0].Username)
+
+		_, err = resolver.Mutation().ChangeUsername(aliceCtx, "alicia2")
+		assert.ErrorIs(t, err, user.ErrUsernameChangeTooSoon)
+	})
+
+	t.Run("Old handle resolves to renamed account", func(t *testing.T) {
+		u, err := resolver.Query().User(bobCtx, "alice")
+		require.NoError(t, err)
+		require.NotNil(t, u)
+		assert.Equal(t, "alicia", u.Username)
+
+		u, err = resolver.Query().User(bobCtx, "nobody")
+		require.NoError(t, err)
+		assert.Nil(t, u)
+	})
+
+	t.Run("Mentions follow the account", func(t *testing.T) {
+		mentioned, err := resolver.Post().Mentions(bobCtx, post)
+		require.NoError(t, err)
+		require.Len(t, mentioned, 1)
+		assert.Equal(t, "alicia", mentioned[0].Username)
+
+		// упоминание по прежнему имени ведет на тот же аккаунт
+		comment, err := resolver.Mutation().CreateComment(bobCtx, post.ID, nil, "@alice, ответь")
+		require.NoError(t, err)
+		mentioned, err = resolver.Comment().Mentions(bobCtx, comment)
+		require.NoError(t, err)
+		require.Len(t, mentioned, 1)
+		assert.Equal(t, "1", mentioned[0].ID)
+	})
+
+	t.Run("Released handle is held for previous owner", func(t *testing.T) {
+		_, err := resolver.Mutation().ChangeUsername(bobCtx, "Alice")
+		assert.ErrorIs(t, err, identity.ErrUsernameTaken)
+	})
+}
+
+func TestMutationResolver_Invites(t *testing.T) {
+	resolver := &Resolver{
+		UserStore:        memory.NewUserMemoryStorage(),
+		Invites:          memory.NewInviteMemoryStorage(),
+		RegistrationMode: invite.ModeInviteOnly,
+	}
+	adminCtx := createUserContext(1)
+
+	t.Run("Registration mode", func(t *testing.T) {
+		mode, err := resolver.Query().RegistrationMode(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, model.RegistrationModeInviteOnly, mode)
+	})
+
+	t.Run("Invite code is required", func(t *testing.T) {
+		_, err := resolver.Mutation().RegisterUser(context.Background(), "alice", "alice@example.com", "s3cure-passw0rd", nil)
+		assert.ErrorIs(t, err, invite.ErrInviteRequired)
+	})
+
+	t.Run("Admin username does not bypass registration mode", func(t *testing.T) {
+		_, err := resolver.Mutation().RegisterUser(context.Background(), "root", "root@example.com", "s3cure-passw0rd", nil)
+		assert.ErrorIs(t, err, invite.ErrInviteRequired)
+
+		// администратор создается при начальной настройке сервера, а не через API
+		u, err := resolver.UserStore.CreateAdmin("root", "root@example.com", "s3cure-passw0rd")
+		require.NoError(t, err)
+		assert.Equal(t, model.RoleAdmin, u.Role)
+	})
+
+	t.Run("Single-use invite", func(t *testing.T) {
+		created, err := resolver.Mutation().CreateInvite(adminCtx, nil, nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 1, created.Invite.MaxUses)
+		assert.Equal(t, "1", created.Invite.CreatedBy)
+
+		// неудачная регистрация не расходует приглашение
+		_, err = resolver.Mutation().RegisterUser(context.Background(), "alice", "not-an-email", "s3cure-passw0rd", &created.Code)
+		assert.Error(t, err)
+
+		u, err := resolver.Mutation().RegisterUser(context.Background(), "alice", "alice@example.com", "s3cure-passw0rd", &created.Code)
+		require.NoError(t, err)
+
+		_, err = resolver.Mutation().RegisterUser(context.Background(), "bob", "bob@example.com", "s3cure-passw0rd", &created.Code)
+		assert.ErrorIs(t, err, invite.ErrInviteInvalid)
+
+		invites, err := resolver.Query().Invites(adminCtx)
+		require.NoError(t, err)
+		require.Len(t, invites, 1)
+		assert.Equal(t, 1, invites[0].Uses)
+		assert.Equal(t, []string{u.ID}, invites[0].Invitees)
+	})
+
+	t.Run("Invite bound to email", func(t *testing.T) {
+		email := "Carol@Example.com"
+		maxUses := 5
+		created, err := resolver.Mutation().CreateInvite(adminCtx, &maxUses, nil, &email)
+		require.NoError(t, err)
+		require.NotNil(t, created.Invite.Email)
+
+		_, err = resolver.Mutation().RegisterUser(context.Background(), "mallory", "mallory@example.com", "s3cure-passw0rd", &created.Code)
+		assert.ErrorIs(t, err, invite.ErrInviteInvalid)
+
+		_, err = resolver.Mutation().RegisterUser(context.Background(), "carol", "carol@example.com", "s3cure-passw0rd", &created.Code)
+		require.NoError(t, err)
+	})
+
+	t.Run("Invalid invite settings", func(t *testing.T) {
+		zero := 0
+		_, err := resolver.Mutation().CreateInvite(adminCtx, &zero, nil, nil)
+		assert.Error(t, err)
+
+		past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+		_, err = resolver.Mutation().CreateInvite(adminCtx, nil, &past, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("Revoked invite", func(t *testing.T) {
+		created, err := resolver.Mutation().CreateInvite(adminCtx, nil, nil, nil)
+		require.NoError(t, err)
+
+		ok, err := resolver.Mutation().RevokeInvite(adminCtx, created.Invite.ID)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		_, err = resolver.Mutation().RegisterUser(context.Background(), "dave", "dave@example.com", "s3cure-passw0rd", &created.Code)
+		assert.ErrorIs(t, err, invite.ErrInviteInvalid)
+	})
+
+	t.Run("Closed registration", func(t *testing.T) {
+		created, err := resolver.Mutation().CreateInvite(adminCtx, nil, nil, nil)
+		require.NoError(t, err)
+
+		resolver.RegistrationMode = invite.ModeClosed
+		defer func() { resolver.RegistrationMode = invite.ModeInviteOnly }()
+
+		_, err = resolver.Mutation().RegisterUser(context.Background(), "erin", "erin@example.com", "s3cure-passw0rd", &created.Code)
+		assert.ErrorIs(t, err, auth.ErrForbidden)
+	})
+}
+
+func TestResolver_Presence(t *testing.T) {
+	mockUserStorage := mocks.NewMockUserStorage()
+	mockPostStorage := mocks.NewMockPostStorage(nil)
+	manager := subscription.NewSubscriptionManager()
+
+	resolver := &Resolver{
+		UserStore:           mockUserStorage,
+		PostStore:           mockPostStorage,
+		CommentStore:        mocks.NewMockCommentStorage(manager),
+		SubscriptionManager: manager,
+		Relations:           memory.NewRelationMemoryStorage(),
+		Presence:            presence.NewTracker(manager),
+	}
+
+	// 1 - автор, 2 - читатель, 3 - скрывший читателя
+	for _, name := range []string{"author", "reader", "muter"} {
+		_, err := mockUserStorage.RegisterUser(name, name+"@example.com", "password123")
+		require.NoError(t, err)
+	}
+	authorCtx := createUserContext(1)
+	readerCtx := createUserContext(2)
+
+	post, err := resolver.Mutation().CreatePost(authorCtx, "Post", "Content")
+	require.NoError(t, err)
+	otherPost, err := resolver.Mutation().CreatePost(authorCtx, "Other", "Content")
+	require.NoError(t, err)
+	comment, err := resolver.Mutation().CreateComment(authorCtx, post.ID, nil, "Comment")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// receiveUntil читает присутствие, пока очередное не удовлетворит условию
+	receiveUntil := func(t *testing.T, ch <-chan *model.PostPresence, cond func(*model.PostPresence) bool) *model.PostPresence {
+		timeout := time.After(2 * time.Second)
+		for {
+			select {
+			case p := <-ch:
+				if cond(p) {
+					return p
+				}
+			case <-timeout:
+				t.Fatal("Timeout waiting for presence")
+				return nil
+			}
+		}
+	}
+
+	t.Run("Unknown post", func(t *testing.T) {
+		_, err := resolver.Subscription().ViewersOnPost(ctx, "404")
+		assert.Error(t, err)
+	})
+
+	t.Run("Viewers are streamed with users", func(t *testing.T) {
+		anonymous, err := resolver.Subscription().ViewersOnPost(ctx, post.ID)
+		require.NoError(t, err)
+		p := receiveUntil(t, anonymous, func(p *model.PostPresence) bool { return true })
+		assert.Equal(t, 1, p.ViewerCount)
+		assert.Empty(t, p.Viewers)
+
+		readerViewCtx, leave := context.WithCancel(readerCtx)
+		_, err = resolver.Subscription().ViewersOnPost(readerViewCtx, post.ID)
+		require.NoError(t, err)
+
+		p = receiveUntil(t, anonymous, func(p *model.PostPresence) bool { return p.ViewerCount == 2 })
+		require.Len(t, p.Viewers, 1)
+		assert.Equal(t, "reader", p.Viewers[0].Username)
+		// анонимный зритель не видит email вошедших
+		assert.Empty(t, p.Viewers[0].Email)
+
+		leave()
+		receiveUntil(t, anonymous, func(p *model.PostPresence) bool { return p.ViewerCount == 1 })
+	})
+
+	t.Run("Typing indicator reaches viewers", func(t *testing.T) {
+		viewer, err := resolver.Subscription().ViewersOnPost(ctx, post.ID)
+		require.NoError(t, err)
+
+		ok, err := resolver.Mutation().SetTyping(readerCtx, post.ID, &comment.ID)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		p := receiveUntil(t, viewer, func(p *model.PostPresence) bool { return len(p.Typing) > 0 })
+		assert.Equal(t, "reader", p.Typing[0].User.Username)
+		require.NotNil(t, p.Typing[0].ParentID)
+		assert.Equal(t, comment.ID, *p.Typing[0].ParentID)
+	})
+
+	t.Run("Renamed user is shown with new name", func(t *testing.T) {
+		// на otherPost нет зрителей предыдущих проверок
+		viewerCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		viewer, err := resolver.Subscription().ViewersOnPost(viewerCtx, otherPost.ID)
+		require.NoError(t, err)
+		readerViewCtx, leave := context.WithCancel(readerCtx)
+		defer leave()
+		_, err = resolver.Subscription().ViewersOnPost(readerViewCtx, otherPost.ID)
+		require.NoError(t, err)
+
+		p := receiveUntil(t, viewer, func(p *model.PostPresence) bool { return p.ViewerCount == 2 })
+		require.Len(t, p.Viewers, 1)
+		assert.Equal(t, "reader", p.Viewers[0].Username)
+
+		_, err = mockUserStorage.ChangeUsername("2", "renamed")
+		require.NoError(t, err)
+		defer mockUserStorage.ChangeUsername("2", "reader")
+
+		// следующий снимок (пришел еще один зритель) показывает новое имя
+		authorViewCtx, authorLeave := context.WithCancel(authorCtx)
+		defer authorLeave()
+		_, err = resolver.Subscription().ViewersOnPost(authorViewCtx, otherPost.ID)
+		require.NoError(t, err)
+
+		p = receiveUntil(t, viewer, func(p *model.PostPresence) bool { return p.ViewerCount == 3 })
+		var names []string
+		for _, u := range p.Viewers {
+			names = append(names, u.Username)
+		}
+		assert.ElementsMatch(t, []string{"renamed", "author"}, names)
+
+		leave()
+		authorLeave()
+		receiveUntil(t, viewer, func(p *model.PostPresence) bool { return p.ViewerCount == 1 })
+	})
+
+	t.Run("Muted users are hidden from lists", func(t *testing.T) {
+		_, err := resolver.Mutation().MuteUser(createUserContext(3), "2")
+		require.NoError(t, err)
+
+		muterCtx, stop := context.WithCancel(createUserContext(3))
+		defer stop()
+		// на otherPost нет зрителей предыдущих проверок
+		viewer, err := resolver.Subscription().ViewersOnPost(muterCtx, otherPost.ID)
+		require.NoError(t, err)
+
+		readerViewCtx, leave := context.WithCancel(readerCtx)
+		defer leave()
+		_, err = resolver.Subscription().ViewersOnPost(readerViewCtx, otherPost.ID)
+		require.NoError(t, err)
+		_, err = resolver.Mutation().SetTyping(readerCtx, otherPost.ID, nil)
+		require.NoError(t, err)
+
+		p := receiveUntil(t, viewer, func(p *model.PostPresence) bool { return p.ViewerCount == 2 })
+		for _, u := range p.Viewers {
+			assert.NotEqual(t, "reader", u.Username)
+		}
+		for _, typing := range p.Typing {
+			assert.NotEqual(t, "reader", typing.User.Username)
+		}
+	})
+
+	t.Run("Typing is checked like a comment", func(t *testing.T) {
+		_, err := resolver.Mutation().SetTyping(context.Background(), post.ID, nil)
+		assert.ErrorIs(t, err, auth.ErrUnauthenticated)
+
+		_, err = resolver.Mutation().SetTyping(readerCtx, otherPost.ID, &comment.ID)
+		assert.ErrorIs(t, err, errParentNotInPost)
+
+		_, err = resolver.Mutation().BlockUser(authorCtx, "2")
+		require.NoError(t, err)
+		_, err = resolver.Mutation().SetTyping(readerCtx, post.ID, nil)
+		assert.ErrorIs(t, err, relation.ErrBlocked)
+
+		_, err = resolver.Mutation().DisableComment(authorCtx, otherPost.ID)
+		require.NoError(t, err)
+		_, err = resolver.Mutation().SetTyping(authorCtx, otherPost.ID, nil)
+		assert.ErrorIs(t, err, errCommentsDisabled)
+	})
+
+	t.Run("Disabled presence", func(t *testing.T) {
+		disabled := &Resolver{PostStore: mockPostStorage}
+		_, err := disabled.Subscription().ViewersOnPost(ctx, post.ID)
+		assert.ErrorIs(t, err, errPresenceDisabled)
+	})
+}
+
+func TestQueryResolver_SubscriptionStats(t *testing.T) {
+	mockUserStorage := mocks.NewMockUserStorage()
+	_, err := mockUserStorage.RegisterUser("reader", "reader@example.com", "password123")
+	require.NoError(t, err)
+
+	limiter := subscription.NewLimiter(subscription.Limits{PerUser: 5})
+	resolver := &Resolver{UserStore: mockUserStorage, SubscriptionLimiter: limiter}
+	for _, c := range []subscription.Client{
+		{UserID: "1", IP: "10.0.0.1", Connection: "c1"},
+		{UserID: "1", IP: "10.0.0.1", Connection: "c1"},
+		{UserID: "404", IP: "10.0.0.2", Connection: "c2"},
+	} {
+		_, err := limiter.Acquire(c)
+		require.NoError(t, err)
+	}
+
+	t.Run("Counts and limits", func(t *testing.T) {
+		stats, err := resolver.Query().SubscriptionStats(context.Background(), nil)
+		require.NoError(t, err)
+
+		assert.Equal(t, 3, stats.Total)
+		assert.Equal(t, 2, stats.Connections)
+		assert.Equal(t, 5, stats.Limits.PerUser)
+		assert.Equal(t, 0, stats.Limits.Total)
+		require.Len(t, stats.ByUser, 2)
+		assert.Equal(t, "reader", stats.ByUser[0].User.Username)
+		assert.Equal(t, 2, stats.ByUser[0].Count)
+		// аккаунт удален, пока подписка открыта
+		assert.Equal(t, user.DeletedUsername, stats.ByUser[1].User.Username)
+		require.Len(t, stats.ByIP, 2)
+		assert.Equal(t, "10.0.0.1", stats.ByIP[0].IP)
+	})
+
+	t.Run("Top limits user and IP lists", func(t *testing.T) {
+		top := 1
+		stats, err := resolver.Query().SubscriptionStats(context.Background(), &top)
+		require.NoError(t, err)
+		assert.Len(t, stats.ByUser, 1)
+		assert.Len(t, stats.ByIP, 1)
+
+		top = -1
+		_, err = resolver.Query().SubscriptionStats(context.Background(), &top)
+		assert.Error(t, err)
+	})
+
+	t.Run("Limit error has code and scope", func(t *testing.T) {
+		var err error = &subscription.LimitError{Scope: subscription.ScopeUser, Limit: 5}
+		gqlErr := ErrorPresenter(context.Background(), err)
+		assert.Equal(t, CodeTooManySubscriptions, gqlErr.Extensions["code"])
+		assert.Equal(t, "user", gqlErr.Extensions["scope"])
+		assert.Equal(t, 5, gqlErr.Extensions["limit"])
+	})
+
+	t.Run("Disabled limits", func(t *testing.T) {
+		_, err := (&Resolver{}).Query().SubscriptionStats(context.Background(), nil)
+		assert.ErrorIs(t, err, errSubscriptionLimitsDisabled)
+	})
+}
+
+func TestResolver_Webhooks(t *testing.T) {
+	received := make(chan *http.Request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r
+	}))
+	defer server.Close()
+
+	store := memory.NewWebhookMemoryStorage()
+	dispatcher := webhook.NewDispatcher(store, true)
+	dispatcher.PollInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Run(ctx)
+
+	manager := dispatcher.Wrap(subscription.NewSubscriptionManager())
+	resolver := &Resolver{
+		PostStore:           mocks.NewMockPostStorage(manager),
+		SubscriptionManager: manager,
+		Webhooks:            store,
+		WebhookDispatcher:   dispatcher,
+	}
+	ownerCtx := createUserContext(1)
+	otherCtx := createUserContext(2)
+	adminCtx := auth.WithRole(createUserContext(3), auth.RoleAdmin)
+
+	var created *model.CreatedWebhook
+
+	t.Run("Create webhook", func(t *testing.T) {
+		_, err := resolver.Mutation().CreateWebhook(ownerCtx, "ftp://example.com", []model.WebhookEvent{model.WebhookEventPostPublished})
+		assert.Error(t, err)
+		_, err = resolver.Mutation().CreateWebhook(ownerCtx, server.URL, nil)
+		assert.Error(t, err)
+
+		created, err = resolver.Mutation().CreateWebhook(ownerCtx, server.URL, []model.WebhookEvent{model.WebhookEventPostPublished, model.WebhookEventPostPublished})
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(created.Secret, "whsec_"))
+		assert.Equal(t, "1", created.Webhook.OwnerID)
+		assert.Equal(t, []model.WebhookEvent{model.WebhookEventPostPublished}, created.Webhook.Events)
+	})
+
+	t.Run("Published post is delivered", func(t *testing.T) {
+		_, err := resolver.Mutation().CreatePost(otherCtx, "Hello", "Content")
+		require.NoError(t, err)
+
+		select {
+		case req := <-received:
+			assert.Equal(t, string(webhook.EventPostPublished), req.Header.Get(webhook.HeaderEvent))
+		case <-time.After(5 * time.Second):
+			t.Fatal("webhook was not delivered")
+		}
+
+		require.Eventually(t, func() bool {
+			deliveries, err := resolver.Query().WebhookDeliveries(ownerCtx, created.Webhook.ID, nil)
+			require.NoError(t, err)
+			return len(deliveries) == 1 && deliveries[0].Status == model.WebhookDeliveryStatusSucceeded
+		}, 5*time.Second, 10*time.Millisecond)
+
+		deliveries, err := resolver.Query().WebhookDeliveries(ownerCtx, created.Webhook.ID, nil)
+		require.NoError(t, err)
+		assert.Equal(t, model.WebhookEventPostPublished, deliveries[0].Event)
+		require.Len(t, deliveries[0].Attempts, 1)
+		assert.Equal(t, http.StatusOK, *deliveries[0].Attempts[0].StatusCode)
+		assert.Nil(t, deliveries[0].NextAttemptAt)
+
+		_, err = resolver.Mutation().Redeliver(ownerCtx, deliveries[0].ID)
+		assert.ErrorIs(t, err, webhook.ErrNotFailed)
+	})
+
+	t.Run("Only owner and admin see webhook", func(t *testing.T) {
+		hooks, err := resolver.Query().Webhooks(otherCtx)
+		require.NoError(t, err)
+		assert.Empty(t, hooks)
+
+		hooks, err = resolver.Query().Webhooks(adminCtx)
+		require.NoError(t, err)
+		assert.Len(t, hooks, 1)
+
+		_, err = resolver.Query().WebhookDeliveries(otherCtx, created.Webhook.ID, nil)
+		assert.ErrorIs(t, err, auth.ErrForbidden)
+		_, err = resolver.Mutation().DeleteWebhook(otherCtx, created.Webhook.ID)
+		assert.ErrorIs(t, err, auth.ErrForbidden)
+
+		_, err = resolver.Query().WebhookDeliveries(adminCtx, created.Webhook.ID, nil)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Delete webhook", func(t *testing.T) {
+		ok, err := resolver.Mutation().DeleteWebhook(ownerCtx, created.Webhook.ID)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		hooks, err := resolver.Query().Webhooks(ownerCtx)
+		require.NoError(t, err)
+		assert.Empty(t, hooks)
+	})
+
+	t.Run("Disabled webhooks", func(t *testing.T) {
+		_, err := (&Resolver{}).Query().Webhooks(ownerCtx)
+		assert.ErrorIs(t, err, errWebhooksDisabled)
+	})
 }
@@ -6,14 +6,30 @@ package graph
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/VitaminP8/postery/graph/generated"
 	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/mention"
+	"github.com/VitaminP8/postery/internal/relation"
+	"github.com/VitaminP8/postery/internal/subscription"
 )
 
+// Mentions is the resolver for the mentions field.
+func (r *commentResolver) Mentions(ctx context.Context, obj *model.Comment) ([]*model.User, error) {
+	return r.mentions(ctx, mention.KindComment, obj.ID)
+}
+
 // CreatePost is the resolver for the createPost field.
 func (r *mutationResolver) CreatePost(ctx context.Context, title string, content string) (*model.Post, error) {
-	return r.PostStore.CreatePost(ctx, title, content)
+	post, err := r.PostStore.CreatePost(ctx, title, content)
+	if err != nil {
+		return nil, err
+	}
+
+	r.recordMentions(mention.KindPost, post.ID, content)
+	return post, nil
 }
 
 // CreateComment is the resolver for the createComment field.
@@ -22,26 +38,45 @@ func (r *mutationResolver) CreateComment(ctx context.Context, postID string, par
 	if parentID != nil {
 		parentIDValue = *parentID
 	}
-	return r.CommentStore.CreateComment(ctx, postID, parentIDValue, content)
+	if err := r.checkNotBlocked(ctx, postID, parentIDValue); err != nil {
+		return nil, err
+	}
+	comment, err := r.CommentStore.CreateComment(ctx, postID, parentIDValue, content)
+	if err != nil {
+		return nil, err
+	}
+
+	r.recordMentions(mention.KindComment, comment.ID, content)
+	return comment, nil
 	//return r.CommentStore.CreateComment(ctx, postID, *parentID, content)
 }
 
 // RegisterUser is the resolver for the registerUser field.
-func (r *mutationResolver) RegisterUser(ctx context.Context, username string, email string, password string) (*model.User, error) {
-	return r.UserStore.RegisterUser(username, email, password)
+func (r *mutationResolver) RegisterUser(ctx context.Context, username string, email string, password string, inviteCode *string) (*model.User, error) {
+	return r.registerUser(username, email, password, inviteCode)
 }
 
 // LoginUser is the resolver for the loginUser field.
-func (r *mutationResolver) LoginUser(ctx context.Context, username string, password string) (*string, error) {
-	token, err := r.UserStore.LoginUser(username, password)
-	if err != nil {
-		return nil, err
-	}
-	return &token, nil
+func (r *mutationResolver) LoginUser(ctx context.Context, username string, password string) (*model.LoginResult, error) {
+	return r.loginUser(ctx, username, password)
+}
+
+// ChangeUsername is the resolver for the changeUsername field.
+func (r *mutationResolver) ChangeUsername(ctx context.Context, username string) (*model.User, error) {
+	return r.changeUsername(ctx, username)
+}
+
+// CompleteLogin is the resolver for the completeLogin field.
+func (r *mutationResolver) CompleteLogin(ctx context.Context, challenge string, code string) (string, error) {
+	return r.completeLogin(ctx, challenge, code)
 }
 
 // DisableComment is the resolver for the disableComment field.
 func (r *mutationResolver) DisableComment(ctx context.Context, id string) (bool, error) {
+	if err := r.authorizePostOwner(ctx, id); err != nil {
+		return false, err
+	}
+
 	err := r.PostStore.DisableComment(ctx, id)
 	if err != nil {
 		return false, err
@@ -51,6 +86,10 @@ func (r *mutationResolver) DisableComment(ctx context.Context, id string) (bool,
 
 // EnableComment is the resolver for the enableComment field.
 func (r *mutationResolver) EnableComment(ctx context.Context, id string) (bool, error) {
+	if err := r.authorizePostOwner(ctx, id); err != nil {
+		return false, err
+	}
+
 	err := r.PostStore.EnableComment(ctx, id)
 	if err != nil {
 		return false, err
@@ -60,6 +99,10 @@ func (r *mutationResolver) EnableComment(ctx context.Context, id string) (bool,
 
 // DeletePostByID is the resolver for the deletePostById field.
 func (r *mutationResolver) DeletePostByID(ctx context.Context, id string) (bool, error) {
+	if err := r.authorizePostOwner(ctx, id); err != nil {
+		return false, err
+	}
+
 	err := r.PostStore.DeletePostById(ctx, id)
 	if err != nil {
 		return false, err
@@ -67,6 +110,190 @@ func (r *mutationResolver) DeletePostByID(ctx context.Context, id string) (bool,
 	return true, nil
 }
 
+// SetUserRole is the resolver for the setUserRole field.
+func (r *mutationResolver) SetUserRole(ctx context.Context, userID string, role model.Role) (*model.User, error) {
+	return r.UserStore.SetUserRole(userID, role)
+}
+
+// UnlockAccount is the resolver for the unlockAccount field.
+func (r *mutationResolver) UnlockAccount(ctx context.Context, username string) (bool, error) {
+	err := r.unlockAccount(ctx, username)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CreateInvite is the resolver for the createInvite field.
+func (r *mutationResolver) CreateInvite(ctx context.Context, maxUses *int, expiresAt *string, email *string) (*model.CreatedInvite, error) {
+	return r.createInvite(ctx, maxUses, expiresAt, email)
+}
+
+// RevokeInvite is the resolver for the revokeInvite field.
+func (r *mutationResolver) RevokeInvite(ctx context.Context, id string) (bool, error) {
+	err := r.revokeInvite(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteAccount is the resolver for the deleteAccount field.
+func (r *mutationResolver) DeleteAccount(ctx context.Context, password string, content model.ContentDeletionMode) (bool, error) {
+	err := r.deleteAccount(ctx, password, content)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RequestDataExport is the resolver for the requestDataExport field.
+func (r *mutationResolver) RequestDataExport(ctx context.Context) (*model.DataExport, error) {
+	if r.ExportManager == nil {
+		return nil, errExportDisabled
+	}
+
+	userID, err := auth.GetUserIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := r.ExportManager.Request(fmt.Sprint(userID))
+	if err != nil {
+		return nil, err
+	}
+	return r.toDataExport(job), nil
+}
+
+// CreateAccessToken is the resolver for the createAccessToken field.
+func (r *mutationResolver) CreateAccessToken(ctx context.Context, name string, scopes []model.AccessTokenScope, expiresAt *string) (*model.CreatedAccessToken, error) {
+	return r.createAccessToken(ctx, name, scopes, expiresAt)
+}
+
+// RevokeAccessToken is the resolver for the revokeAccessToken field.
+func (r *mutationResolver) RevokeAccessToken(ctx context.Context, id string) (bool, error) {
+	if r.AccessTokenStore == nil {
+		return false, errAccessTokensDisabled
+	}
+
+	userID, err := auth.GetUserIDFromContext(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	err = r.AccessTokenStore.RevokeAccessToken(userID, id)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// BlockUser is the resolver for the blockUser field.
+func (r *mutationResolver) BlockUser(ctx context.Context, userID string) (bool, error) {
+	err := r.setRelation(ctx, userID, relation.KindBlock, true)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// UnblockUser is the resolver for the unblockUser field.
+func (r *mutationResolver) UnblockUser(ctx context.Context, userID string) (bool, error) {
+	err := r.setRelation(ctx, userID, relation.KindBlock, false)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// FollowUser is the resolver for the followUser field.
+func (r *mutationResolver) FollowUser(ctx context.Context, userID string) (bool, error) {
+	err := r.setRelation(ctx, userID, relation.KindFollow, true)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// UnfollowUser is the resolver for the unfollowUser field.
+func (r *mutationResolver) UnfollowUser(ctx context.Context, userID string) (bool, error) {
+	err := r.setRelation(ctx, userID, relation.KindFollow, false)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// MuteUser is the resolver for the muteUser field.
+func (r *mutationResolver) MuteUser(ctx context.Context, userID string) (bool, error) {
+	err := r.setRelation(ctx, userID, relation.KindMute, true)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// UnmuteUser is the resolver for the unmuteUser field.
+func (r *mutationResolver) UnmuteUser(ctx context.Context, userID string) (bool, error) {
+	err := r.setRelation(ctx, userID, relation.KindMute, false)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RevokeSession is the resolver for the revokeSession field.
+func (r *mutationResolver) RevokeSession(ctx context.Context, id string) (bool, error) {
+	err := r.revokeSession(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// EnableTotp is the resolver for the enableTotp field.
+func (r *mutationResolver) EnableTotp(ctx context.Context) (*model.TotpSetup, error) {
+	return r.enableTotp(ctx)
+}
+
+// ConfirmTotp is the resolver for the confirmTotp field.
+func (r *mutationResolver) ConfirmTotp(ctx context.Context, code string) ([]string, error) {
+	return r.confirmTotp(ctx, code)
+}
+
+// DisableTotp is the resolver for the disableTotp field.
+func (r *mutationResolver) DisableTotp(ctx context.Context, password string, code string) (bool, error) {
+	err := r.disableTotp(ctx, password, code)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetTyping is the resolver for the setTyping field.
+func (r *mutationResolver) SetTyping(ctx context.Context, postID string, parentID *string) (bool, error) {
+	return r.setTyping(ctx, postID, parentID)
+}
+
+// CreateWebhook is the resolver for the createWebhook field.
+func (r *mutationResolver) CreateWebhook(ctx context.Context, url string, events []model.WebhookEvent) (*model.CreatedWebhook, error) {
+	return r.createWebhook(ctx, url, events)
+}
+
+// DeleteWebhook is the resolver for the deleteWebhook field.
+func (r *mutationResolver) DeleteWebhook(ctx context.Context, id string) (bool, error) {
+	err := r.deleteWebhook(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Redeliver is the resolver for the redeliver field.
+func (r *mutationResolver) Redeliver(ctx context.Context, deliveryID string) (*model.WebhookDelivery, error) {
+	return r.redeliver(ctx, deliveryID)
+}
+
 // Comments is the resolver for the comments field. (подтягивает комментарии для поста)
 func (r *postResolver) Comments(ctx context.Context, obj *model.Post, limit *int, offset *int) (*model.CommentConnection, error) {
 	lim := 10
@@ -78,12 +305,25 @@ func (r *postResolver) Comments(ctx context.Context, obj *model.Post, limit *int
 		off = *offset
 	}
 
-	return r.CommentStore.GetComments(obj.ID, lim, off)
+	conn, err := r.CommentStore.GetComments(obj.ID, lim, off)
+	if err != nil {
+		return nil, err
+	}
+	return r.visibleComments(ctx, conn)
+}
+
+// Mentions is the resolver for the mentions field.
+func (r *postResolver) Mentions(ctx context.Context, obj *model.Post) ([]*model.User, error) {
+	return r.mentions(ctx, mention.KindPost, obj.ID)
 }
 
 // Posts is the resolver for the posts field.
 func (r *queryResolver) Posts(ctx context.Context) ([]*model.Post, error) {
-	return r.PostStore.GetAllPosts()
+	posts, err := r.PostStore.GetAllPosts()
+	if err != nil {
+		return nil, err
+	}
+	return r.visiblePosts(ctx, posts)
 }
 
 // Post is the resolver for the post field.
@@ -101,7 +341,11 @@ func (r *queryResolver) Comments(ctx context.Context, postID string, limit *int,
 	if offset != nil {
 		off = *offset
 	}
-	return r.CommentStore.GetComments(postID, lim, off)
+	conn, err := r.CommentStore.GetComments(postID, lim, off)
+	if err != nil {
+		return nil, err
+	}
+	return r.visibleComments(ctx, conn)
 }
 
 // Replies is the resolver for the replies field.
@@ -114,22 +358,157 @@ func (r *queryResolver) Replies(ctx context.Context, parentID string, limit *int
 	if offset != nil {
 		off = *offset
 	}
-	return r.CommentStore.GetReplies(parentID, lim, off)
+	conn, err := r.CommentStore.GetReplies(parentID, lim, off)
+	if err != nil {
+		return nil, err
+	}
+	return r.visibleComments(ctx, conn)
+}
+
+// DataExport is the resolver for the dataExport field.
+func (r *queryResolver) DataExport(ctx context.Context, id string) (*model.DataExport, error) {
+	if r.ExportManager == nil {
+		return nil, errExportDisabled
+	}
+
+	userID, err := auth.GetUserIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := r.ExportManager.Get(id, fmt.Sprint(userID))
+	if err != nil {
+		return nil, err
+	}
+	return r.toDataExport(job), nil
+}
+
+// AccessTokens is the resolver for the accessTokens field.
+func (r *queryResolver) AccessTokens(ctx context.Context) ([]*model.AccessToken, error) {
+	if r.AccessTokenStore == nil {
+		return nil, errAccessTokensDisabled
+	}
+
+	userID, err := auth.GetUserIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := r.AccessTokenStore.GetAccessTokens(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.AccessToken, 0, len(tokens))
+	for _, token := range tokens {
+		result = append(result, toAccessToken(token))
+	}
+	return result, nil
+}
+
+// Sessions is the resolver for the sessions field.
+func (r *queryResolver) Sessions(ctx context.Context) ([]*model.Session, error) {
+	return r.sessions(ctx)
+}
+
+// Me is the resolver for the me field.
+func (r *queryResolver) Me(ctx context.Context) (*model.User, error) {
+	return r.currentUser(ctx)
+}
+
+// User is the resolver for the user field.
+func (r *queryResolver) User(ctx context.Context, username string) (*model.User, error) {
+	return r.userByUsername(ctx, username)
+}
+
+// UsernameHistory is the resolver for the usernameHistory field.
+func (r *queryResolver) UsernameHistory(ctx context.Context) ([]*model.UsernameChange, error) {
+	return r.usernameHistory(ctx)
+}
+
+// HomeFeed is the resolver for the homeFeed field.
+func (r *queryResolver) HomeFeed(ctx context.Context, first *int, after *string) (*model.PostConnection, error) {
+	return r.homeFeed(ctx, first, after)
+}
+
+// RegistrationMode is the resolver for the registrationMode field.
+func (r *queryResolver) RegistrationMode(ctx context.Context) (model.RegistrationMode, error) {
+	return toRegistrationMode(r.registrationMode()), nil
+}
+
+// Invites is the resolver for the invites field.
+func (r *queryResolver) Invites(ctx context.Context) ([]*model.Invite, error) {
+	return r.invites()
+}
+
+// SubscriptionStats is the resolver for the subscriptionStats field.
+func (r *queryResolver) SubscriptionStats(ctx context.Context, top *int) (*model.SubscriptionStats, error) {
+	return r.subscriptionStats(top)
+}
+
+// Webhooks is the resolver for the webhooks field.
+func (r *queryResolver) Webhooks(ctx context.Context) ([]*model.Webhook, error) {
+	return r.webhooks(ctx)
+}
+
+// WebhookDeliveries is the resolver for the webhookDeliveries field.
+func (r *queryResolver) WebhookDeliveries(ctx context.Context, webhookID string, limit *int) ([]*model.WebhookDelivery, error) {
+	return r.webhookDeliveries(ctx, webhookID, limit)
 }
 
 // CommentAdded is the resolver for the commentAdded field.
-func (r *subscriptionResolver) CommentAdded(ctx context.Context, postID string) (<-chan *model.Comment, error) {
-	ch, cancel := r.SubscriptionManager.Subscribe(postID)
+func (r *subscriptionResolver) CommentAdded(ctx context.Context, postID string, since *string) (<-chan *model.Comment, error) {
+	return r.commentAdded(ctx, postID, since)
+}
+
+// ReplyAdded is the resolver for the replyAdded field.
+func (r *subscriptionResolver) ReplyAdded(ctx context.Context, commentID string, includeDescendants *bool) (<-chan *model.Comment, error) {
+	return r.replyAdded(ctx, commentID, includeDescendants != nil && *includeDescendants)
+}
+
+// PostCreated is the resolver for the postCreated field.
+func (r *subscriptionResolver) PostCreated(ctx context.Context) (<-chan *model.Post, error) {
+	return r.postCreated(ctx)
+}
 
-	// Обработка отмены (например, клиент закрыл соединение)
-	go func() {
-		<-ctx.Done()
-		cancel()
-	}()
+// PostUpdated is the resolver for the postUpdated field.
+func (r *subscriptionResolver) PostUpdated(ctx context.Context, id string) (<-chan *model.Post, error) {
+	return postEvents[*model.Post](ctx, r.Resolver, id, subscription.EventPostUpdated)
+}
+
+// PostDeleted is the resolver for the postDeleted field.
+func (r *subscriptionResolver) PostDeleted(ctx context.Context, id string) (<-chan string, error) {
+	return postEvents[string](ctx, r.Resolver, id, subscription.EventPostDeleted)
+}
+
+// CommentsToggled is the resolver for the commentsToggled field.
+func (r *subscriptionResolver) CommentsToggled(ctx context.Context, id string) (<-chan *model.Post, error) {
+	return postEvents[*model.Post](ctx, r.Resolver, id, subscription.EventCommentsToggled)
+}
+
+// PostPublishedByFollowed is the resolver for the postPublishedByFollowed field.
+func (r *subscriptionResolver) PostPublishedByFollowed(ctx context.Context) (<-chan *model.Post, error) {
+	return r.followedPosts(ctx)
+}
 
-	return ch, nil
+// ViewersOnPost is the resolver for the viewersOnPost field.
+func (r *subscriptionResolver) ViewersOnPost(ctx context.Context, postID string) (<-chan *model.PostPresence, error) {
+	return r.viewersOnPost(ctx, postID)
 }
 
+// Followers is the resolver for the followers field.
+func (r *userResolver) Followers(ctx context.Context, obj *model.User, limit *int, offset *int) (*model.UserConnection, error) {
+	return r.userConnection(ctx, obj.ID, true, limit, offset)
+}
+
+// Following is the resolver for the following field.
+func (r *userResolver) Following(ctx context.Context, obj *model.User, limit *int, offset *int) (*model.UserConnection, error) {
+	return r.userConnection(ctx, obj.ID, false, limit, offset)
+}
+
+// Comment returns generated.CommentResolver implementation.
+func (r *Resolver) Comment() generated.CommentResolver { return &commentResolver{r} }
+
 // Mutation returns generated.MutationResolver implementation.
 func (r *Resolver) Mutation() generated.MutationResolver { return &mutationResolver{r} }
 
@@ -142,7 +521,12 @@ func (r *Resolver) Query() generated.QueryResolver { return &queryResolver{r} }
 // Subscription returns generated.SubscriptionResolver implementation.
 func (r *Resolver) Subscription() generated.SubscriptionResolver { return &subscriptionResolver{r} }
 
+// User returns generated.UserResolver implementation.
+func (r *Resolver) User() generated.UserResolver { return &userResolver{r} }
+
+type commentResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
 type postResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
 type subscriptionResolver struct{ *Resolver }
+type userResolver struct{ *Resolver }
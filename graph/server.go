@@ -0,0 +1,105 @@
+package graph
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/VitaminP8/postery/graph/generated"
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// closeReasonTokenExpired - причина закрытия websocket соединения, которую получит клиент
+const closeReasonTokenExpired = "token expired"
+
+// connectionCancelKey - ключ контекста для отмены контекста соединения с таймером истечения токена
+type connectionCancelKey struct{}
+
+// NewServer создает GraphQL сервер с теми же транспортами и расширениями, что handler.NewDefaultServer,
+// но websocket соединения аутентифицируются через WebsocketInit
+func NewServer(resolver *Resolver, authenticator *auth.Authenticator) *handler.Server {
+	return newServer(resolver,
+		transport.Websocket{
+			KeepAlivePingInterval: 10 * time.Second,
+			InitFunc:              WebsocketInit(authenticator),
+			CloseFunc:             WebsocketClose,
+		},
+		transport.Options{},
+		transport.GET{},
+		transport.POST{},
+		transport.MultipartForm{},
+	)
+}
+
+// NewSSEServer создает GraphQL сервер для SSEPath: подписки через Server-Sent Events
+func NewSSEServer(resolver *Resolver, heartbeat time.Duration) *handler.Server {
+	return newServer(resolver, SSE{HeartbeatInterval: heartbeat}, transport.Options{})
+}
+
+func newServer(resolver *Resolver, transports ...graphql.Transport) *handler.Server {
+	srv := handler.New(generated.NewExecutableSchema(generated.Config{
+		Resolvers:  resolver,
+		Directives: Directives(),
+	}))
+	for _, t := range transports {
+		srv.AddTransport(t)
+	}
+
+	srv.SetQueryCache(lru.New[*ast.QueryDocument](1000))
+
+	srv.Use(extension.Introspection{})
+	srv.Use(extension.AutomaticPersistedQuery{
+		Cache: lru.New[string](100),
+	})
+
+	if resolver.SubscriptionLimiter != nil {
+		srv.Use(SubscriptionLimit{Limiter: resolver.SubscriptionLimiter})
+	}
+
+	// ErrorPresenter добавляет extensions.code (UNAUTHENTICATED/FORBIDDEN) к ошибкам
+	srv.SetErrorPresenter(ErrorPresenter)
+	return srv
+}
+
+// WebsocketInit проверяет токен из сообщения connection_init. Браузер не может передать заголовок Authorization
+// при открытии websocket, поэтому клиент кладет его в payload: {"Authorization": "Bearer <token>"}.
+// Токен проверяется так же, как в auth.Authenticator.Middleware, но неверный токен закрывает соединение,
+// а не оставляет его анонимным. Соединение закрывается, когда истекает срок действия токена; таймер освобождает
+// WebsocketClose. Подписки соединения получают общий ID для ограничения SubscriptionLimits.PerConnection.
+func WebsocketInit(authenticator *auth.Authenticator) transport.WebsocketInitFunc {
+	return func(ctx context.Context, payload transport.InitPayload) (context.Context, *transport.InitPayload, error) {
+		ctx = withConnectionID(ctx)
+
+		token := strings.TrimPrefix(payload.Authorization(), "Bearer ")
+		if token != "" {
+			var err error
+			ctx, err = authenticator.Authenticate(ctx, token)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
+		// срок действия есть и у токена из заголовка запроса на открытие соединения
+		expiresAt, ok := auth.TokenExpiry(ctx)
+		if !ok {
+			return ctx, nil, nil
+		}
+
+		ctx, cancel := context.WithDeadline(transport.AppendCloseReason(ctx, closeReasonTokenExpired), expiresAt)
+		return context.WithValue(ctx, connectionCancelKey{}, cancel), nil, nil
+	}
+}
+
+// WebsocketClose отменяет контекст, созданный WebsocketInit, когда соединение закрывается: иначе таймер
+// истечения токена живет до срока действия токена.
+func WebsocketClose(ctx context.Context, _ int) {
+	if cancel, ok := ctx.Value(connectionCancelKey{}).(context.CancelFunc); ok {
+		cancel()
+	}
+}
@@ -0,0 +1,233 @@
+package graph
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/mocks"
+	"github.com/VitaminP8/postery/internal/relation"
+	"github.com/VitaminP8/postery/internal/storage/memory"
+	"github.com/VitaminP8/postery/internal/subscription"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wsMessage - сообщение протокола graphql-transport-ws
+type wsMessage struct {
+	ID      string                 `json:"id,omitempty"`
+	Type    string                 `json:"type"`
+	Payload map[string]interface{} `json:"payload,omitempty"`
+}
+
+// dialWebsocket открывает соединение и отправляет connection_init с payload
+func dialWebsocket(t *testing.T, url string, payload map[string]interface{}) *websocket.Conn {
+	dialer := websocket.Dialer{Subprotocols: []string{"graphql-transport-ws"}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(url, "http"), nil)
+	require.NoError(t, err)
+
+	require.NoError(t, conn.WriteJSON(wsMessage{Type: "connection_init", Payload: payload}))
+	return conn
+}
+
+// readMessage читает следующее сообщение; ошибка - соединение закрыто
+func readMessage(conn *websocket.Conn, timeout time.Duration) (wsMessage, error) {
+	var msg wsMessage
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	err := conn.ReadJSON(&msg)
+	return msg, err
+}
+
+func signTestToken(t *testing.T, userID uint, expiresAt time.Time) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": userID,
+		"role":    auth.RoleUser,
+		"iat":     time.Now().Unix(),
+		"exp":     expiresAt.Unix(),
+	})
+	signed, err := token.SignedString([]byte("test_jwt_secret"))
+	require.NoError(t, err)
+	return signed
+}
+
+func TestServer_WebsocketAuth(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test_jwt_secret")
+
+	manager := subscription.NewSubscriptionManager()
+	// пользователь 7 подписан на автора 3
+	relations := memory.NewRelationMemoryStorage()
+	require.NoError(t, relations.AddRelation("7", "3", relation.KindFollow))
+
+	authenticator := &auth.Authenticator{}
+	server := httptest.NewServer(authenticator.Middleware(NewServer(&Resolver{SubscriptionManager: manager, Relations: relations}, authenticator)))
+	defer server.Close()
+
+	subscribeFeed := func(conn *websocket.Conn) {
+		require.NoError(t, conn.WriteJSON(wsMessage{
+			ID:      "1",
+			Type:    "subscribe",
+			Payload: map[string]interface{}{"query": "subscription { postPublishedByFollowed { id } }"},
+		}))
+	}
+
+	t.Run("Token from init payload authenticates subscription", func(t *testing.T) {
+		conn := dialWebsocket(t, server.URL, map[string]interface{}{
+			"Authorization": "Bearer " + signTestToken(t, 7, time.Now().Add(time.Hour)),
+		})
+		defer conn.Close()
+
+		msg, err := readMessage(conn, time.Second)
+		require.NoError(t, err)
+		require.Equal(t, "connection_ack", msg.Type)
+
+		subscribeFeed(conn)
+		// подписка оформляется асинхронно - публикуем, пока событие не прочитано
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			for {
+				manager.Publish(subscription.PostsTopic, subscription.Event{Type: subscription.EventPostCreated, Payload: &model.Post{ID: "42", AuthorID: "3"}})
+				select {
+				case <-done:
+					return
+				case <-time.After(20 * time.Millisecond):
+				}
+			}
+		}()
+
+		msg, err = readMessage(conn, time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, "next", msg.Type)
+		assert.Contains(t, msg.Payload["data"], "postPublishedByFollowed")
+	})
+
+	t.Run("Anonymous connection cannot subscribe to feed", func(t *testing.T) {
+		conn := dialWebsocket(t, server.URL, nil)
+		defer conn.Close()
+
+		msg, err := readMessage(conn, time.Second)
+		require.NoError(t, err)
+		require.Equal(t, "connection_ack", msg.Type)
+
+		subscribeFeed(conn)
+		msg, err = readMessage(conn, time.Second)
+		require.NoError(t, err)
+		assert.Contains(t, []string{"next", "error"}, msg.Type)
+		assert.NotEmpty(t, msg.Payload["errors"])
+	})
+
+	t.Run("Invalid token closes connection", func(t *testing.T) {
+		conn := dialWebsocket(t, server.URL, map[string]interface{}{"Authorization": "Bearer invalid"})
+		defer conn.Close()
+
+		for {
+			msg, err := readMessage(conn, time.Second)
+			if err != nil {
+				break
+			}
+			assert.NotEqual(t, "connection_ack", msg.Type)
+		}
+	})
+
+	t.Run("Connection is closed when token expires", func(t *testing.T) {
+		conn := dialWebsocket(t, server.URL, map[string]interface{}{
+			"Authorization": "Bearer " + signTestToken(t, 7, time.Now().Add(time.Second)),
+		})
+		defer conn.Close()
+
+		msg, err := readMessage(conn, time.Second)
+		require.NoError(t, err)
+		require.Equal(t, "connection_ack", msg.Type)
+
+		start := time.Now()
+		for {
+			_, err = readMessage(conn, 3*time.Second)
+			if err != nil {
+				break
+			}
+		}
+		var closeErr *websocket.CloseError
+		assert.ErrorAs(t, err, &closeErr)
+		assert.Less(t, time.Since(start), 3*time.Second)
+	})
+
+	t.Run("Closed connection releases token timer", func(t *testing.T) {
+		payload := transport.InitPayload{"Authorization": "Bearer " + signTestToken(t, 7, time.Now().Add(time.Hour))}
+		ctx, _, err := WebsocketInit(authenticator)(context.Background(), payload)
+		require.NoError(t, err)
+		require.NoError(t, ctx.Err())
+
+		WebsocketClose(ctx, websocket.CloseNormalClosure)
+		assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	})
+}
+
+func TestServer_SubscriptionLimits(t *testing.T) {
+	postStore := mocks.NewMockPostStorage(nil)
+	post, err := postStore.CreatePost(createUserContext(1), "Title", "Content")
+	require.NoError(t, err)
+
+	limiter := subscription.NewLimiter(subscription.Limits{PerConnection: 1})
+	resolver := &Resolver{PostStore: postStore, SubscriptionManager: subscription.NewSubscriptionManager(), SubscriptionLimiter: limiter}
+	authenticator := &auth.Authenticator{}
+	server := httptest.NewServer(authenticator.Middleware(NewServer(resolver, authenticator)))
+	defer server.Close()
+
+	subscribe := func(t *testing.T, conn *websocket.Conn, id string) {
+		require.NoError(t, conn.WriteJSON(wsMessage{
+			ID:      id,
+			Type:    "subscribe",
+			Payload: map[string]interface{}{"query": `subscription { commentAdded(postID: "` + post.ID + `") { id } }`},
+		}))
+	}
+	waitTotal := func(t *testing.T, total int) {
+		assert.Eventually(t, func() bool { return limiter.Stats(0).Total == total }, time.Second, 10*time.Millisecond)
+	}
+
+	conn := dialWebsocket(t, server.URL, nil)
+	defer conn.Close()
+	msg, err := readMessage(conn, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, "connection_ack", msg.Type)
+
+	t.Run("Subscription over the limit gets an error with code", func(t *testing.T) {
+		subscribe(t, conn, "1")
+		waitTotal(t, 1)
+
+		subscribe(t, conn, "2")
+		// ошибка приходит как next с errors или как error с массивом ошибок - читаем без разбора payload
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, data, err := conn.ReadMessage()
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"id":"2"`)
+		assert.Contains(t, string(data), CodeTooManySubscriptions)
+		assert.Contains(t, string(data), `"scope":"connection"`)
+	})
+
+	t.Run("Other connections have their own limit", func(t *testing.T) {
+		other := dialWebsocket(t, server.URL, nil)
+		defer other.Close()
+		msg, err := readMessage(other, time.Second)
+		require.NoError(t, err)
+		require.Equal(t, "connection_ack", msg.Type)
+
+		subscribe(t, other, "1")
+		waitTotal(t, 2)
+	})
+
+	t.Run("Completed subscription frees the slot", func(t *testing.T) {
+		waitTotal(t, 1)
+		require.NoError(t, conn.WriteJSON(wsMessage{ID: "1", Type: "complete"}))
+		waitTotal(t, 0)
+
+		subscribe(t, conn, "3")
+		waitTotal(t, 1)
+	})
+}
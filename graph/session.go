@@ -0,0 +1,62 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/auth"
+)
+
+var errSessionsDisabled = errors.New("sessions are not configured")
+
+// sessions возвращает действующие сессии текущего пользователя, последние активные - первыми
+func (r *Resolver) sessions(ctx context.Context) ([]*model.Session, error) {
+	if r.SessionStore == nil {
+		return nil, errSessionsDisabled
+	}
+
+	userID, err := auth.GetUserIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := r.SessionStore.GetSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	current := auth.GetSessionID(ctx)
+	result := make([]*model.Session, 0, len(sessions))
+	for _, session := range sessions {
+		// токены сессии истекли, но фоновая очистка еще не удалила запись
+		if session.Expired(now) {
+			continue
+		}
+		result = append(result, &model.Session{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt.Format(time.RFC3339),
+			LastSeenAt: session.LastSeenAt.Format(time.RFC3339),
+			Current:    session.ID == current,
+		})
+	}
+	return result, nil
+}
+
+// revokeSession завершает сессию текущего пользователя, ее токен перестает приниматься
+func (r *Resolver) revokeSession(ctx context.Context, id string) error {
+	if r.SessionStore == nil {
+		return errSessionsDisabled
+	}
+
+	userID, err := auth.GetUserIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	return r.SessionStore.RevokeSession(userID, id)
+}
@@ -0,0 +1,210 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+const (
+	// SSEPath - эндпоинт подписок через Server-Sent Events для клиентов, у которых не работает websocket
+	SSEPath = "/query/sse"
+	// DefaultSSEHeartbeat - как часто отправляется комментарий-пинг, чтобы прокси не закрывали тихое соединение
+	DefaultSSEHeartbeat = 15 * time.Second
+)
+
+type lastEventIDKey struct{}
+
+// withLastEventID сохраняет заголовок Last-Event-ID переподключившегося SSE клиента
+func withLastEventID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, lastEventIDKey{}, id)
+}
+
+// lastEventID возвращает Last-Event-ID запроса (nil, если клиент подключается впервые)
+func lastEventID(ctx context.Context) *string {
+	id, ok := ctx.Value(lastEventIDKey{}).(string)
+	if !ok || id == "" {
+		return nil
+	}
+	return &id
+}
+
+// SSE - транспорт GraphQL подписок через Server-Sent Events: каждое событие подписки отправляется как "event: next",
+// после завершения - "event: complete". Запрос принимается как GET (EventSource: query, variables и
+// operationName в строке запроса) или как POST с JSON телом; запросы и мутации отклоняются. Если в ответе есть
+// поле cursor (commentAdded), оно становится id события, и при переподключении браузер вернет его в Last-Event-ID -
+// подписка продолжится с пропущенных событий. Аутентификация - та же, что у /query (auth.Authenticator.Middleware);
+// поток закрывается, когда истекает срок действия токена.
+type SSE struct {
+	// HeartbeatInterval - интервал пингов; 0 отключает их
+	HeartbeatInterval time.Duration
+}
+
+var _ graphql.Transport = SSE{}
+
+func (t SSE) Supports(r *http.Request) bool {
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		return false
+	}
+	return r.Method == http.MethodGet || r.Method == http.MethodPost
+}
+
+func (t SSE) Do(w http.ResponseWriter, r *http.Request, exec graphql.GraphExecutor) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		transport.SendErrorf(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+
+	params, err := sseParams(r)
+	if err != nil {
+		transport.SendErrorf(w, http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+
+	// поток - отдельное соединение для ограничения числа подписок
+	ctx := withConnectionID(r.Context())
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		ctx = withLastEventID(ctx, id)
+	}
+	if expiresAt, ok := auth.TokenExpiry(ctx); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, expiresAt)
+		defer cancel()
+	}
+
+	params.ReadTime.End = graphql.Now()
+	rc, opErr := exec.CreateOperationContext(ctx, params)
+	// запросы и мутации выполняются через /query: GET не должен менять данные, а поток нужен только подпискам
+	if opErr == nil && rc.Operation.Operation != ast.Subscription {
+		transport.SendErrorf(w, http.StatusBadRequest, "only subscriptions are accepted on %s", SSEPath)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// nginx не должен буферизовать поток
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	s := &sseStream{w: w, f: flusher}
+	s.write(":\n\n")
+
+	if t.HeartbeatInterval > 0 {
+		heartbeatCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		go s.heartbeat(heartbeatCtx, t.HeartbeatInterval)
+	}
+
+	if opErr != nil {
+		s.send(exec.DispatchError(graphql.WithOperationContext(ctx, rc), opErr))
+	} else {
+		ctx = graphql.WithOperationContext(ctx, rc)
+		responses, ctx := exec.DispatchOperation(ctx, rc)
+		for {
+			response := responses(ctx)
+			if response == nil {
+				break
+			}
+			s.send(response)
+		}
+	}
+
+	s.write("event: complete\ndata:\n\n")
+}
+
+// sseParams читает параметры запроса: из строки запроса для GET, из JSON тела для POST
+func sseParams(r *http.Request) (*graphql.RawParams, error) {
+	params := &graphql.RawParams{Headers: r.Header}
+	params.ReadTime.Start = graphql.Now()
+
+	if r.Method == http.MethodPost {
+		err := json.NewDecoder(r.Body).Decode(params)
+		if err != nil {
+			return nil, fmt.Errorf("json request body could not be decoded: %w", err)
+		}
+		params.Headers = r.Header
+		return params, nil
+	}
+
+	query := r.URL.Query()
+	params.Query = query.Get("query")
+	params.OperationName = query.Get("operationName")
+	if variables := query.Get("variables"); variables != "" {
+		err := json.Unmarshal([]byte(variables), &params.Variables)
+		if err != nil {
+			return nil, fmt.Errorf("variables could not be decoded: %w", err)
+		}
+	}
+	return params, nil
+}
+
+// sseStream сериализует запись в поток: события и пинги пишутся из разных горутин
+type sseStream struct {
+	mu sync.Mutex
+	w  io.Writer
+	f  http.Flusher
+}
+
+func (s *sseStream) write(data string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, _ = io.WriteString(s.w, data)
+	s.f.Flush()
+}
+
+func (s *sseStream) send(response *graphql.Response) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		data, _ = json.Marshal(&graphql.Response{Errors: response.Errors})
+	}
+
+	event := "event: next\n"
+	if cursor := responseCursor(response); cursor != "" {
+		event += "id: " + cursor + "\n"
+	}
+	s.write(event + "data: " + string(data) + "\n\n")
+}
+
+func (s *sseStream) heartbeat(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.write(": ping\n\n")
+		}
+	}
+}
+
+// responseCursor возвращает поле cursor единственного поля ответа (например, commentAdded { cursor })
+func responseCursor(response *graphql.Response) string {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(response.Data, &fields) != nil || len(fields) != 1 {
+		return ""
+	}
+
+	for _, field := range fields {
+		var value struct {
+			Cursor string `json:"cursor"`
+		}
+		if json.Unmarshal(field, &value) == nil {
+			return value.Cursor
+		}
+	}
+	return ""
+}
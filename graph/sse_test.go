@@ -0,0 +1,225 @@
+package graph
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/mocks"
+	"github.com/VitaminP8/postery/internal/relation"
+	"github.com/VitaminP8/postery/internal/storage/memory"
+	"github.com/VitaminP8/postery/internal/subscription"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sseEvent - одно сообщение потока: поля event/id/data или комментарий (пинг)
+type sseEvent struct {
+	Event   string
+	ID      string
+	Data    string
+	Comment string
+}
+
+// openSSE подписывается через SSE; headers - дополнительные заголовки (Authorization, Last-Event-ID)
+func openSSE(t *testing.T, ctx context.Context, serverURL, query string, headers map[string]string) *bufio.Reader {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, serverURL+SSEPath+"?query="+url.QueryEscape(query), nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "text/event-stream")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	return bufio.NewReader(resp.Body)
+}
+
+// nextSSEEvent читает сообщения до первого, для которого keep вернет true
+func nextSSEEvent(t *testing.T, r *bufio.Reader, keep func(sseEvent) bool) sseEvent {
+	for {
+		var event sseEvent
+		for {
+			line, err := r.ReadString('\n')
+			require.NoError(t, err)
+			line = strings.TrimRight(line, "\n")
+			if line == "" {
+				break
+			}
+			switch {
+			case strings.HasPrefix(line, ":"):
+				event.Comment = strings.TrimSpace(strings.TrimPrefix(line, ":"))
+			case strings.HasPrefix(line, "event: "):
+				event.Event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "id: "):
+				event.ID = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				event.Data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+		if keep(event) {
+			return event
+		}
+	}
+}
+
+func isNext(event sseEvent) bool { return event.Event == "next" }
+
+func TestSSE(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test_jwt_secret")
+
+	manager := subscription.NewSubscriptionManager()
+	postStore := mocks.NewMockPostStorage(nil)
+	post, err := postStore.CreatePost(createUserContext(1), "Title", "Content")
+	require.NoError(t, err)
+
+	// пользователь 7 подписан на автора 3
+	relations := memory.NewRelationMemoryStorage()
+	require.NoError(t, relations.AddRelation("7", "3", relation.KindFollow))
+
+	resolver := &Resolver{PostStore: postStore, SubscriptionManager: manager, Relations: relations}
+	authenticator := &auth.Authenticator{}
+	mux := http.NewServeMux()
+	mux.Handle(SSEPath, authenticator.Middleware(NewSSEServer(resolver, 20*time.Millisecond)))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	topic := subscription.CommentsTopic(post.ID)
+	publish := func(id string) {
+		manager.Publish(topic, subscription.Event{Type: subscription.EventCommentAdded, Payload: &model.Comment{ID: id, PostID: post.ID}})
+	}
+	query := `subscription { commentAdded(postID: "` + post.ID + `") { id cursor } }`
+
+	// publishUntilSubscribed публикует комментарий, пока подписка (она оформляется асинхронно) его не получит
+	publishUntilSubscribed := func(t *testing.T, r *bufio.Reader, id string) sseEvent {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			for {
+				publish(id)
+				select {
+				case <-done:
+					return
+				case <-time.After(20 * time.Millisecond):
+				}
+			}
+		}()
+		return nextSSEEvent(t, r, isNext)
+	}
+
+	var lastID string
+	t.Run("Comments are sent as events with cursor id", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		r := openSSE(t, ctx, server.URL, query, nil)
+		event := publishUntilSubscribed(t, r, "1")
+		assert.Contains(t, event.Data, `"commentAdded"`)
+		assert.NotEmpty(t, event.ID)
+		assert.Contains(t, event.Data, `"cursor":"`+event.ID+`"`)
+		lastID = event.ID
+	})
+
+	t.Run("Heartbeat keeps connection alive", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		r := openSSE(t, ctx, server.URL, query, nil)
+		event := nextSSEEvent(t, r, func(e sseEvent) bool { return e.Comment == "ping" })
+		assert.Equal(t, "ping", event.Comment)
+	})
+
+	t.Run("Last-Event-ID resumes after missed comments", func(t *testing.T) {
+		require.NotEmpty(t, lastID)
+		publish("missed")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		r := openSSE(t, ctx, server.URL, query, map[string]string{"Last-Event-ID": lastID})
+		event := nextSSEEvent(t, r, func(e sseEvent) bool {
+			return isNext(e) && strings.Contains(e.Data, `"id":"missed"`)
+		})
+		assert.NotEqual(t, lastID, event.ID)
+	})
+
+	t.Run("Same auth as query endpoint", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		feed := `subscription { postPublishedByFollowed { id } }`
+		r := openSSE(t, ctx, server.URL, feed, nil)
+		event := nextSSEEvent(t, r, isNext)
+		assert.Contains(t, event.Data, `"errors"`)
+
+		r = openSSE(t, ctx, server.URL, feed, map[string]string{
+			"Authorization": "Bearer " + signTestToken(t, 7, time.Now().Add(time.Hour)),
+		})
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			for {
+				manager.Publish(subscription.PostsTopic, subscription.Event{Type: subscription.EventPostCreated, Payload: &model.Post{ID: "42", AuthorID: "3"}})
+				select {
+				case <-done:
+					return
+				case <-time.After(20 * time.Millisecond):
+				}
+			}
+		}()
+		event = nextSSEEvent(t, r, isNext)
+		assert.Contains(t, event.Data, `"postPublishedByFollowed":{"id":"42"}`)
+	})
+
+	t.Run("Queries and mutations are rejected", func(t *testing.T) {
+		token := "Bearer " + signTestToken(t, 7, time.Now().Add(time.Hour))
+		mutation := `mutation { createPost(title: "Title", content: "Content") { id } }`
+
+		send := func(method, query string) *http.Response {
+			target := server.URL + SSEPath
+			var body io.Reader
+			if method == http.MethodGet {
+				target += "?query=" + url.QueryEscape(query)
+			} else {
+				data, err := json.Marshal(map[string]string{"query": query})
+				require.NoError(t, err)
+				body = bytes.NewReader(data)
+			}
+			req, err := http.NewRequest(method, target, body)
+			require.NoError(t, err)
+			req.Header.Set("Accept", "text/event-stream")
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", token)
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			return resp
+		}
+
+		before, err := postStore.GetAllPosts()
+		require.NoError(t, err)
+
+		for _, method := range []string{http.MethodGet, http.MethodPost} {
+			assert.Equal(t, http.StatusBadRequest, send(method, mutation).StatusCode, method)
+			assert.Equal(t, http.StatusBadRequest, send(method, `query { posts { id } }`).StatusCode, method)
+		}
+
+		after, err := postStore.GetAllPosts()
+		require.NoError(t, err)
+		assert.Len(t, after, len(before))
+	})
+}
@@ -0,0 +1,122 @@
+package graph
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/subscription"
+	"github.com/VitaminP8/postery/internal/user"
+)
+
+// defaultStatsTop - сколько пользователей и IP показывает subscriptionStats без аргумента top
+const defaultStatsTop = 20
+
+var errSubscriptionLimitsDisabled = errors.New("subscription limits are not configured")
+
+type connectionIDKey struct{}
+
+// withConnectionID помечает контекст websocket соединения или SSE потока: все подписки соединения
+// получают один ID и считаются вместе
+func withConnectionID(ctx context.Context) context.Context {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return context.WithValue(ctx, connectionIDKey{}, hex.EncodeToString(b))
+}
+
+func connectionID(ctx context.Context) string {
+	id, _ := ctx.Value(connectionIDKey{}).(string)
+	return id
+}
+
+// SubscriptionLimit - расширение сервера, которое занимает место в Limiter для каждой подписки и освобождает его,
+// когда подписка завершается. Превышение ограничения возвращается как ошибка поля с кодом TOO_MANY_SUBSCRIPTIONS.
+type SubscriptionLimit struct {
+	Limiter *subscription.Limiter
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.FieldInterceptor
+} = SubscriptionLimit{}
+
+func (SubscriptionLimit) ExtensionName() string {
+	return "SubscriptionLimit"
+}
+
+func (SubscriptionLimit) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (e SubscriptionLimit) InterceptField(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil || fc.Object != "Subscription" {
+		return next(ctx)
+	}
+
+	client := subscription.Client{IP: auth.GetClientIP(ctx), Connection: connectionID(ctx)}
+	if userID, err := auth.GetUserIDFromContext(ctx); err == nil {
+		client.UserID = fmt.Sprint(userID)
+	}
+	release, err := e.Limiter.Acquire(client)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := next(ctx)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	// контекст подписки отменяется, когда она завершается или закрывается соединение
+	context.AfterFunc(ctx, release)
+	return res, nil
+}
+
+// subscriptionStats возвращает открытые подписки этого экземпляра сервера
+func (r *Resolver) subscriptionStats(top *int) (*model.SubscriptionStats, error) {
+	if r.SubscriptionLimiter == nil {
+		return nil, errSubscriptionLimitsDisabled
+	}
+
+	n := defaultStatsTop
+	if top != nil {
+		n = *top
+	}
+	if n < 0 {
+		return nil, errors.New("top must not be negative")
+	}
+
+	stats := r.SubscriptionLimiter.Stats(n)
+	limits := r.SubscriptionLimiter.Limits()
+	result := &model.SubscriptionStats{
+		Total:       stats.Total,
+		Connections: stats.Connections,
+		ByUser:      make([]*model.UserSubscriptionCount, 0, len(stats.Users)),
+		ByIP:        make([]*model.IPSubscriptionCount, 0, len(stats.IPs)),
+		Limits: &model.SubscriptionLimits{
+			PerUser:       limits.PerUser,
+			PerIP:         limits.PerIP,
+			PerConnection: limits.PerConnection,
+			Total:         limits.Total,
+		},
+	}
+
+	for _, count := range stats.Users {
+		u, err := r.UserStore.GetUserByID(count.Key)
+		if err != nil {
+			// аккаунт удален, пока подписки еще открыты
+			u = &model.User{ID: count.Key, Username: user.DeletedUsername, Role: model.RoleUser}
+		}
+		result.ByUser = append(result.ByUser, &model.UserSubscriptionCount{User: u, Count: count.Count})
+	}
+	for _, count := range stats.IPs {
+		result.ByIP = append(result.ByIP, &model.IPSubscriptionCount{IP: count.Key, Count: count.Count})
+	}
+	return result, nil
+}
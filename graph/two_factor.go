@@ -0,0 +1,272 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/audit"
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/identity"
+	"github.com/VitaminP8/postery/internal/totp"
+	"github.com/VitaminP8/postery/internal/user"
+)
+
+// totpIssuer - название сервиса в приложении-аутентификаторе
+const totpIssuer = "Postery"
+
+var (
+	errTwoFactorDisabled     = errors.New("two-factor authentication is not configured")
+	errTotpAlreadyEnabled    = errors.New("two-factor authentication is already enabled")
+	errTotpNotEnabled        = errors.New("two-factor authentication is not enabled")
+	errTotpSetupNotStarted   = errors.New("call enableTotp first")
+	errInvalidTwoFactorCode  = errors.New("invalid two-factor code")
+	errTwoFactorStateCorrupt = errors.New("could not read two-factor settings")
+)
+
+// enableTotp создает новый секрет; до confirmTotp 2FA не действует и enableTotp можно вызвать повторно
+func (r *Resolver) enableTotp(ctx context.Context) (*model.TotpSetup, error) {
+	if r.TotpCipher == nil {
+		return nil, errTwoFactorDisabled
+	}
+
+	u, err := r.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := r.UserStore.GetTwoFactor(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if state != nil && state.Enabled {
+		return nil, errTotpAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := r.TotpCipher.Encrypt(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.UserStore.SaveTwoFactor(u.ID, &user.TwoFactor{Secret: encrypted})
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.TotpSetup{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(totpIssuer, u.Username, secret),
+	}, nil
+}
+
+// confirmTotp включает 2FA после проверки первого кода и выдает коды восстановления (показываются один раз)
+func (r *Resolver) confirmTotp(ctx context.Context, code string) ([]string, error) {
+	if r.TotpCipher == nil {
+		return nil, errTwoFactorDisabled
+	}
+
+	u, err := r.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := r.UserStore.GetTwoFactor(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, errTotpSetupNotStarted
+	}
+	if state.Enabled {
+		return nil, errTotpAlreadyEnabled
+	}
+
+	secret, err := r.TotpCipher.Decrypt(state.Secret)
+	if err != nil {
+		return nil, errTwoFactorStateCorrupt
+	}
+
+	step, ok := totp.Verify(secret, code, time.Now())
+	if !ok {
+		return nil, errInvalidTwoFactorCode
+	}
+
+	codes, err := totp.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, 0, len(codes))
+	for _, c := range codes {
+		hashes = append(hashes, totp.HashRecoveryCode(c))
+	}
+
+	state.Enabled = true
+	state.LastStep = step
+	state.RecoveryCodes = hashes
+	err = r.UserStore.SaveTwoFactor(u.ID, state)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// disableTotp выключает 2FA; нужны текущий пароль и действующий код или код восстановления.
+// Неверные пароли и коды учитываются в ограничении попыток входа, как в completeLogin: иначе украденная сессия
+// позволила бы подбирать код без ограничений.
+func (r *Resolver) disableTotp(ctx context.Context, password, code string) error {
+	if r.TotpCipher == nil {
+		return errTwoFactorDisabled
+	}
+
+	u, err := r.currentUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	ip := auth.GetClientIP(ctx)
+	guardKey := identity.UsernameKey(u.Username)
+	if r.LoginGuard != nil {
+		err := r.LoginGuard.Check(guardKey, ip)
+		if err != nil {
+			return err
+		}
+	}
+
+	state, err := r.UserStore.GetTwoFactor(u.ID)
+	if err != nil {
+		return err
+	}
+	if state == nil || !state.Enabled {
+		return errTotpNotEnabled
+	}
+
+	err = r.UserStore.CheckPassword(u.ID, password)
+	if err != nil {
+		r.secondFactorFailure(u.Username, guardKey, ip)
+		return err
+	}
+
+	err = r.verifySecondFactor(u.ID, state, code)
+	if err != nil {
+		if errors.Is(err, errInvalidTwoFactorCode) {
+			r.secondFactorFailure(u.Username, guardKey, ip)
+		}
+		return err
+	}
+
+	if r.LoginGuard != nil {
+		r.LoginGuard.Success(guardKey)
+	}
+	return r.UserStore.DeleteTwoFactor(u.ID)
+}
+
+// secondFactorFailure учитывает неудачную попытку выключить 2FA в ограничении попыток входа
+func (r *Resolver) secondFactorFailure(username, guardKey, ip string) {
+	if r.LoginGuard != nil && r.LoginGuard.Failure(guardKey, ip) {
+		r.recordAudit(audit.Entry{Action: audit.ActionLoginLocked, Username: username, IP: ip})
+	}
+}
+
+// completeLogin проверяет второй фактор по challenge из loginUser и выдает JWT.
+// Неверные коды учитываются в ограничении попыток так же, как неверные пароли.
+func (r *Resolver) completeLogin(ctx context.Context, challenge, code string) (string, error) {
+	if r.TotpCipher == nil || r.LoginChallenges == nil {
+		return "", errTwoFactorDisabled
+	}
+
+	userID, err := r.LoginChallenges.Attempt(challenge)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := r.UserStore.GetUserByID(userID)
+	if err != nil {
+		return "", totp.ErrInvalidChallenge
+	}
+
+	ip := auth.GetClientIP(ctx)
+	guardKey := identity.UsernameKey(u.Username)
+	if r.LoginGuard != nil {
+		err := r.LoginGuard.Check(guardKey, ip)
+		if err != nil {
+			r.recordAudit(audit.Entry{Action: audit.ActionLoginFailed, Username: u.Username, IP: ip, Reason: "throttled"})
+			return "", err
+		}
+	}
+
+	state, err := r.UserStore.GetTwoFactor(u.ID)
+	if err != nil {
+		return "", err
+	}
+	if state == nil || !state.Enabled {
+		// 2FA выключили, пока шел вход
+		return "", totp.ErrInvalidChallenge
+	}
+
+	err = r.verifySecondFactor(u.ID, state, code)
+	if err != nil {
+		if !errors.Is(err, errInvalidTwoFactorCode) {
+			return "", err
+		}
+
+		r.recordAudit(audit.Entry{Action: audit.ActionLoginFailed, Username: u.Username, IP: ip, Reason: "invalid two-factor code"})
+		if r.LoginGuard != nil && r.LoginGuard.Failure(guardKey, ip) {
+			r.recordAudit(audit.Entry{Action: audit.ActionLoginLocked, Username: u.Username, IP: ip})
+		}
+		return "", errInvalidTwoFactorCode
+	}
+
+	r.LoginChallenges.Complete(challenge)
+	if r.LoginGuard != nil {
+		r.LoginGuard.Success(guardKey)
+	}
+	return r.issueToken(ctx, u)
+}
+
+// verifySecondFactor принимает код из приложения (каждый не более одного раза) или код восстановления
+func (r *Resolver) verifySecondFactor(userID string, state *user.TwoFactor, code string) error {
+	secret, err := r.TotpCipher.Decrypt(state.Secret)
+	if err != nil {
+		return errTwoFactorStateCorrupt
+	}
+
+	step, ok := totp.Verify(secret, code, time.Now())
+	if ok {
+		err = r.UserStore.UseTotpStep(userID, step)
+		if errors.Is(err, user.ErrTotpCodeReused) {
+			return errInvalidTwoFactorCode
+		}
+		return err
+	}
+
+	err = r.UserStore.UseRecoveryCode(userID, totp.HashRecoveryCode(code))
+	if errors.Is(err, user.ErrRecoveryCodeInvalid) {
+		return errInvalidTwoFactorCode
+	}
+	return err
+}
+
+func (r *Resolver) currentUser(ctx context.Context) (*model.User, error) {
+	userID, err := auth.GetUserIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.UserStore.GetUserByID(fmt.Sprint(userID))
+}
+
+// issueToken завершает вход: создает сессию устройства и выдает JWT
+func (r *Resolver) issueToken(ctx context.Context, u *model.User) (string, error) {
+	userID, err := strconv.ParseUint(u.ID, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid user ID: %w", err)
+	}
+	return auth.StartSession(ctx, r.SessionStore, uint(userID), u.Username, u.Role.String())
+}
@@ -0,0 +1,126 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/audit"
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/mention"
+)
+
+// changeUsername меняет имя текущего пользователя (правила, интервал и занятость проверяет хранилище)
+func (r *Resolver) changeUsername(ctx context.Context, username string) (*model.User, error) {
+	current, err := r.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := r.UserStore.ChangeUsername(current.ID, username)
+	if err != nil {
+		return nil, err
+	}
+
+	r.recordAudit(audit.Entry{
+		Action:   audit.ActionUsernameChange,
+		Username: u.Username,
+		IP:       auth.GetClientIP(ctx),
+		ActorID:  u.ID,
+		Reason:   "previous username " + current.Username,
+	})
+	return u, nil
+}
+
+// userByUsername находит пользователя по текущему или прежнему имени; nil, если такого нет
+func (r *Resolver) userByUsername(ctx context.Context, username string) (*model.User, error) {
+	u, err := r.UserStore.GetUserByUsername(username)
+	if err != nil {
+		return nil, nil
+	}
+	return publicUser(ctx, u), nil
+}
+
+// usernameHistory возвращает прежние имена текущего пользователя
+func (r *Resolver) usernameHistory(ctx context.Context) ([]*model.UsernameChange, error) {
+	userID, err := auth.GetUserIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := r.UserStore.GetUsernameHistory(fmt.Sprint(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.UsernameChange, 0, len(history))
+	for _, change := range history {
+		result = append(result, &model.UsernameChange{
+			Username:  change.Username,
+			ChangedAt: change.ChangedAt.Format(time.RFC3339),
+		})
+	}
+	return result, nil
+}
+
+// recordMentions сохраняет пользователей, упомянутых в тексте. Имена разрешаются в момент публикации
+// (прежние имена ведут на переименованные аккаунты); несуществующие имена пропускаются.
+// Ошибка только пишется в журнал - пост или комментарий уже создан.
+func (r *Resolver) recordMentions(kind mention.Kind, contentID, content string) {
+	if r.Mentions == nil {
+		return
+	}
+
+	var userIDs []string
+	for _, name := range mention.Parse(content) {
+		u, err := r.UserStore.GetUserByUsername(name)
+		if err != nil {
+			continue
+		}
+		userIDs = append(userIDs, u.ID)
+	}
+	if len(userIDs) == 0 {
+		return
+	}
+
+	err := r.Mentions.AddMentions(kind, contentID, userIDs)
+	if err != nil {
+		log.Printf("could not save mentions of %s %s: %v", kind, contentID, err)
+	}
+}
+
+// mentions возвращает упомянутых пользователей с их текущими именами
+func (r *Resolver) mentions(ctx context.Context, kind mention.Kind, contentID string) ([]*model.User, error) {
+	result := []*model.User{}
+	if r.Mentions == nil {
+		return result, nil
+	}
+
+	userIDs, err := r.Mentions.GetMentions(kind, contentID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range userIDs {
+		u, err := r.UserStore.GetUserByID(id)
+		if err != nil {
+			// аккаунт удален - упоминание больше никуда не ведет
+			continue
+		}
+		result = append(result, publicUser(ctx, u))
+	}
+	return result, nil
+}
+
+// publicUser возвращает копию пользователя для показа другим: email виден только самому пользователю и администраторам
+func publicUser(ctx context.Context, u *model.User) *model.User {
+	item := *u
+	viewerID, err := auth.GetUserIDFromContext(ctx)
+	isSelf := err == nil && item.ID == fmt.Sprint(viewerID)
+	if !isSelf && !auth.HasRole(ctx, auth.RoleAdmin) {
+		item.Email = ""
+	}
+	return &item
+}
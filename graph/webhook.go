@@ -0,0 +1,249 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/webhook"
+)
+
+const (
+	// defaultWebhookDeliveries и maxWebhookDeliveries - размер журнала доставок в ответе webhookDeliveries
+	defaultWebhookDeliveries = 20
+	maxWebhookDeliveries     = 100
+)
+
+var errWebhooksDisabled = errors.New("webhooks are not configured")
+
+// webhookEvents сопоставляет значения WebhookEvent событиям вебхуков
+var webhookEvents = map[model.WebhookEvent]webhook.Event{
+	model.WebhookEventCommentCreated:      webhook.EventCommentCreated,
+	model.WebhookEventPostPublished:       webhook.EventPostPublished,
+	model.WebhookEventPostUpdated:         webhook.EventPostUpdated,
+	model.WebhookEventPostDeleted:         webhook.EventPostDeleted,
+	model.WebhookEventPostCommentsToggled: webhook.EventCommentsToggled,
+}
+
+// createWebhook регистрирует вебхук текущего пользователя; секрет подписи возвращается только здесь
+func (r *Resolver) createWebhook(ctx context.Context, rawURL string, events []model.WebhookEvent) (*model.CreatedWebhook, error) {
+	if r.Webhooks == nil {
+		return nil, errWebhooksDisabled
+	}
+
+	userID, err := auth.GetUserIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := webhook.ValidateURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, errors.New("at least one event is required")
+	}
+
+	hook := &webhook.Webhook{
+		OwnerID: fmt.Sprint(userID),
+		URL:     url,
+	}
+
+	// дубликаты событий убираем, порядок сохраняем
+	seen := make(map[model.WebhookEvent]bool)
+	for _, event := range events {
+		if !seen[event] {
+			seen[event] = true
+			hook.Events = append(hook.Events, webhookEvents[event])
+		}
+	}
+
+	hook.Secret, err = webhook.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := r.Webhooks.CreateWebhook(hook)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.CreatedWebhook{
+		Secret:  created.Secret,
+		Webhook: toWebhook(created),
+	}, nil
+}
+
+// deleteWebhook удаляет вебхук вместе с журналом доставок
+func (r *Resolver) deleteWebhook(ctx context.Context, id string) error {
+	if r.Webhooks == nil {
+		return errWebhooksDisabled
+	}
+
+	_, err := r.ownWebhook(ctx, id)
+	if err != nil {
+		return err
+	}
+	return r.Webhooks.DeleteWebhook(id)
+}
+
+func (r *Resolver) webhooks(ctx context.Context) ([]*model.Webhook, error) {
+	if r.Webhooks == nil {
+		return nil, errWebhooksDisabled
+	}
+
+	userID, err := auth.GetUserIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ownerID := fmt.Sprint(userID)
+	if auth.HasRole(ctx, auth.RoleAdmin) {
+		ownerID = ""
+	}
+
+	hooks, err := r.Webhooks.GetWebhooks(ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.Webhook, 0, len(hooks))
+	for _, hook := range hooks {
+		result = append(result, toWebhook(hook))
+	}
+	return result, nil
+}
+
+func (r *Resolver) webhookDeliveries(ctx context.Context, webhookID string, limit *int) ([]*model.WebhookDelivery, error) {
+	if r.Webhooks == nil {
+		return nil, errWebhooksDisabled
+	}
+
+	n := defaultWebhookDeliveries
+	if limit != nil {
+		if *limit < 1 || *limit > maxWebhookDeliveries {
+			return nil, fmt.Errorf("limit must be between 1 and %d", maxWebhookDeliveries)
+		}
+		n = *limit
+	}
+
+	_, err := r.ownWebhook(ctx, webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := r.Webhooks.GetDeliveries(webhookID, n)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.WebhookDelivery, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		result = append(result, toWebhookDelivery(delivery))
+	}
+	return result, nil
+}
+
+// redeliver возвращает неудавшуюся доставку в очередь отправителя
+func (r *Resolver) redeliver(ctx context.Context, deliveryID string) (*model.WebhookDelivery, error) {
+	if r.Webhooks == nil || r.WebhookDispatcher == nil {
+		return nil, errWebhooksDisabled
+	}
+
+	delivery, err := r.Webhooks.GetDelivery(deliveryID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = r.ownWebhook(ctx, delivery.WebhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery, err = r.WebhookDispatcher.Redeliver(deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	return toWebhookDelivery(delivery), nil
+}
+
+// ownWebhook возвращает вебхук, если он принадлежит текущему пользователю или пользователь - администратор
+func (r *Resolver) ownWebhook(ctx context.Context, id string) (*webhook.Webhook, error) {
+	userID, err := auth.GetUserIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	hook, err := r.Webhooks.GetWebhook(id)
+	if err != nil {
+		return nil, err
+	}
+	if hook.OwnerID != fmt.Sprint(userID) && !auth.HasRole(ctx, auth.RoleAdmin) {
+		return nil, auth.ErrForbidden
+	}
+	return hook, nil
+}
+
+func toWebhook(hook *webhook.Webhook) *model.Webhook {
+	result := &model.Webhook{
+		ID:        hook.ID,
+		OwnerID:   hook.OwnerID,
+		URL:       hook.URL,
+		Events:    []model.WebhookEvent{},
+		CreatedAt: hook.CreatedAt.Format(time.RFC3339),
+	}
+	for _, event := range hook.Events {
+		result.Events = append(result.Events, toWebhookEvent(event))
+	}
+	return result
+}
+
+func toWebhookDelivery(delivery *webhook.Delivery) *model.WebhookDelivery {
+	result := &model.WebhookDelivery{
+		ID:        delivery.ID,
+		WebhookID: delivery.WebhookID,
+		Event:     toWebhookEvent(delivery.Event),
+		Attempts:  []*model.WebhookAttempt{},
+		CreatedAt: delivery.CreatedAt.Format(time.RFC3339),
+	}
+
+	switch delivery.Status {
+	case webhook.StatusSucceeded:
+		result.Status = model.WebhookDeliveryStatusSucceeded
+	case webhook.StatusFailed:
+		result.Status = model.WebhookDeliveryStatusFailed
+	default:
+		result.Status = model.WebhookDeliveryStatusPending
+		next := delivery.NextAttemptAt.Format(time.RFC3339)
+		result.NextAttemptAt = &next
+	}
+
+	for _, attempt := range delivery.Log {
+		item := &model.WebhookAttempt{
+			At:         attempt.At.Format(time.RFC3339),
+			DurationMs: int(attempt.Duration.Milliseconds()),
+		}
+		if attempt.StatusCode != 0 {
+			statusCode := attempt.StatusCode
+			item.StatusCode = &statusCode
+		}
+		if attempt.Error != "" {
+			errorText := attempt.Error
+			item.Error = &errorText
+		}
+		result.Attempts = append(result.Attempts, item)
+	}
+	return result
+}
+
+func toWebhookEvent(event webhook.Event) model.WebhookEvent {
+	for key, value := range webhookEvents {
+		if value == event {
+			return key
+		}
+	}
+	return model.WebhookEvent(event)
+}
@@ -0,0 +1,87 @@
+// Package audit - журнал событий безопасности (неудачные входы, разблокировки и т.п.)
+package audit
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// Действия в журнале
+const (
+	ActionLoginFailed    = "login.failed"
+	ActionLoginLocked    = "login.locked"
+	ActionAccountUnlock  = "account.unlock"
+	ActionUsernameChange = "username.change"
+	ActionInviteCreate   = "invite.create"
+	ActionInviteRevoke   = "invite.revoke"
+)
+
+// Entry - запись журнала. Пароли и токены в журнал не попадают.
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	Username string    `json:"username,omitempty"`
+	IP       string    `json:"ip,omitempty"`
+	ActorID  string    `json:"actorId,omitempty"` // кто выполнил действие (для административных операций)
+	Reason   string    `json:"reason,omitempty"`
+}
+
+// Logger записывает события журнала
+type Logger interface {
+	Record(entry Entry)
+}
+
+// StdLogger пишет записи строками JSON в стандартный логгер
+type StdLogger struct {
+	logger *log.Logger
+}
+
+func NewStdLogger(logger *log.Logger) *StdLogger {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &StdLogger{logger: logger}
+}
+
+func (l *StdLogger) Record(entry Entry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		l.logger.Printf("audit: could not encode entry: %v", err)
+		return
+	}
+	l.logger.Printf("audit: %s", data)
+}
+
+// MemoryLogger хранит записи в памяти (для тестов)
+type MemoryLogger struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+func NewMemoryLogger() *MemoryLogger {
+	return &MemoryLogger{}
+}
+
+func (l *MemoryLogger) Record(entry Entry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	l.entries = append(l.entries, entry)
+}
+
+// Entries возвращает копию записанных событий
+func (l *MemoryLogger) Entries() []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]Entry(nil), l.entries...)
+}
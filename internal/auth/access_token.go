@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AccessTokenPrefix отличает персональные токены доступа от JWT в заголовке Authorization
+const AccessTokenPrefix = "pst_"
+
+// Области действия персональных токенов (совпадают со значениями enum AccessTokenScope в схеме)
+const (
+	ScopeRead         = "READ"
+	ScopePostWrite    = "POST_WRITE"
+	ScopeCommentWrite = "COMMENT_WRITE"
+)
+
+// ErrAccessTokenNotFound - токен не существует, отозван или принадлежит другому пользователю
+var ErrAccessTokenNotFound = errors.New("access token not found")
+
+// AccessToken - персональный токен доступа (сам токен не хранится, только его хэш)
+type AccessToken struct {
+	ID         string
+	UserID     uint
+	Name       string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+}
+
+// Expired сообщает, истек ли срок действия токена к моменту now
+func (t *AccessToken) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// AccessTokenStorage хранит персональные токены доступа
+type AccessTokenStorage interface {
+	CreateAccessToken(token *AccessToken, hash string) (*AccessToken, error)
+	GetAccessTokens(userID uint) ([]*AccessToken, error)
+	// RevokeAccessToken удаляет токен пользователя, для чужого токена возвращает ErrAccessTokenNotFound
+	RevokeAccessToken(userID uint, id string) error
+	// DeleteUserAccessTokens удаляет все токены пользователя (при удалении аккаунта)
+	DeleteUserAccessTokens(userID uint) error
+	// UseAccessToken ищет токен по хэшу и отмечает время использования
+	UseAccessToken(hash string, now time.Time) (*AccessToken, error)
+}
+
+// NewAccessTokenSecret генерирует токен для выдачи пользователю и хэш для хранения
+func NewAccessTokenSecret() (token, hash string, err error) {
+	b := make([]byte, 32)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", "", fmt.Errorf("could not generate access token: %w", err)
+	}
+
+	token = AccessTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, HashAccessToken(token), nil
+}
+
+// HashAccessToken - SHA-256 токена; у токена 256 бит случайности, медленный хэш не нужен
+func HashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func isAccessToken(tokenStr string) bool {
+	return strings.HasPrefix(tokenStr, AccessTokenPrefix)
+}
+
+// IsValidScope проверяет, что область действия существует
+func IsValidScope(scope string) bool {
+	switch scope {
+	case ScopeRead, ScopePostWrite, ScopeCommentWrite:
+		return true
+	}
+	return false
+}
+
+const scopesKey = contextKey("scopes")
+
+// WithScopes помечает запрос как выполненный по персональному токену с указанными областями
+func WithScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, scopesKey, scopes)
+}
+
+// IsAccessTokenRequest сообщает, что запрос аутентифицирован персональным токеном, а не JWT
+func IsAccessTokenRequest(ctx context.Context) bool {
+	_, ok := ctx.Value(scopesKey).([]string)
+	return ok
+}
+
+// HasScope проверяет область действия токена; запросам с JWT доступно все
+func HasScope(ctx context.Context, scope string) bool {
+	scopes, ok := ctx.Value(scopesKey).([]string)
+	if !ok {
+		return true
+	}
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
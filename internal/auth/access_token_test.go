@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// accessTokenStub - хранилище токенов для тестов middleware (хэш -> токен)
+type accessTokenStub struct {
+	tokens map[string]*AccessToken
+}
+
+func (s *accessTokenStub) CreateAccessToken(token *AccessToken, hash string) (*AccessToken, error) {
+	s.tokens[hash] = token
+	return token, nil
+}
+
+func (s *accessTokenStub) GetAccessTokens(userID uint) ([]*AccessToken, error) {
+	return nil, nil
+}
+
+func (s *accessTokenStub) RevokeAccessToken(userID uint, id string) error {
+	return nil
+}
+
+func (s *accessTokenStub) DeleteUserAccessTokens(userID uint) error {
+	return nil
+}
+
+func (s *accessTokenStub) UseAccessToken(hash string, now time.Time) (*AccessToken, error) {
+	token, ok := s.tokens[hash]
+	if !ok {
+		return nil, ErrAccessTokenNotFound
+	}
+	return token, nil
+}
+
+func TestNewAccessTokenSecret(t *testing.T) {
+	token, hash, err := NewAccessTokenSecret()
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(token, AccessTokenPrefix))
+	assert.Equal(t, HashAccessToken(token), hash)
+	assert.NotContains(t, hash, token)
+
+	other, _, err := NewAccessTokenSecret()
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func TestHasScope(t *testing.T) {
+	t.Run("JWT session has every scope", func(t *testing.T) {
+		ctx := context.Background()
+		assert.False(t, IsAccessTokenRequest(ctx))
+		assert.True(t, HasScope(ctx, ScopePostWrite))
+	})
+
+	t.Run("Access token has only its scopes", func(t *testing.T) {
+		ctx := WithScopes(context.Background(), []string{ScopeRead})
+		assert.True(t, IsAccessTokenRequest(ctx))
+		assert.True(t, HasScope(ctx, ScopeRead))
+		assert.False(t, HasScope(ctx, ScopeCommentWrite))
+	})
+}
+
+func TestAuthenticator_AccessTokens(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test_jwt_secret")
+
+	tokens := &accessTokenStub{tokens: make(map[string]*AccessToken)}
+	revocations := &revocationStub{revoked: make(map[uint]time.Time)}
+	authenticator := &Authenticator{Revocations: revocations, AccessTokens: tokens}
+
+	handler := authenticator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := GetUserIDFromContext(r.Context())
+		if err != nil {
+			fmt.Fprint(w, "No user ID in context")
+			return
+		}
+		fmt.Fprintf(w, "User ID: %d, role: %s, comment:write: %t",
+			userID, GetRoleFromContext(r.Context()), HasScope(r.Context(), ScopeCommentWrite))
+	}))
+
+	serve := func(token string) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	issue := func(userID uint, scopes []string, expiresAt *time.Time) string {
+		secret, hash, err := NewAccessTokenSecret()
+		require.NoError(t, err)
+		_, err = tokens.CreateAccessToken(&AccessToken{
+			UserID:    userID,
+			Scopes:    scopes,
+			CreatedAt: time.Now(),
+			ExpiresAt: expiresAt,
+		}, hash)
+		require.NoError(t, err)
+		return secret
+	}
+
+	t.Run("Valid access token", func(t *testing.T) {
+		token := issue(3, []string{ScopeCommentWrite}, nil)
+		assert.Equal(t, "User ID: 3, role: USER, comment:write: true", serve(token))
+	})
+
+	t.Run("Scopes are limited", func(t *testing.T) {
+		token := issue(3, []string{ScopeRead}, nil)
+		assert.Equal(t, "User ID: 3, role: USER, comment:write: false", serve(token))
+	})
+
+	t.Run("Unknown access token", func(t *testing.T) {
+		assert.Equal(t, "No user ID in context", serve(AccessTokenPrefix+"unknown"))
+	})
+
+	t.Run("Expired access token", func(t *testing.T) {
+		expired := time.Now().Add(-time.Minute)
+		token := issue(3, []string{ScopeRead}, &expired)
+		assert.Equal(t, "No user ID in context", serve(token))
+	})
+
+	t.Run("Revoked user tokens", func(t *testing.T) {
+		token := issue(4, []string{ScopeRead}, nil)
+		require.NoError(t, revocations.RevokeUserTokens(4, time.Now()))
+		assert.Equal(t, "No user ID in context", serve(token))
+	})
+
+	t.Run("Access tokens not configured", func(t *testing.T) {
+		token := issue(3, []string{ScopeRead}, nil)
+		plain := AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, err := GetUserIDFromContext(r.Context())
+			assert.Error(t, err)
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		plain.ServeHTTP(httptest.NewRecorder(), req)
+	})
+}
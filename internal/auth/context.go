@@ -8,13 +8,17 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 )
 
 type contextKey string
 
-const userIDKey = contextKey("userID")
+const (
+	userIDKey      = contextKey("userID")
+	tokenExpiryKey = contextKey("tokenExpiry")
+)
 
 // Сохраняет userID в контексте
 func WithUserID(ctx context.Context, userID uint) context.Context {
@@ -26,55 +30,201 @@ func GetUserIDFromContext(ctx context.Context) (uint, error) {
 	val := ctx.Value(userIDKey)
 	id, ok := val.(uint)
 	if !ok {
-		return 0, errors.New("user ID not found in context")
+		return 0, fmt.Errorf("%w: user ID not found in context", ErrUnauthenticated)
 	}
 	return id, nil
 }
 
-// Для извлечения userID из JWT и помещения в context
+// TokenExpiry возвращает срок действия токена, которым аутентифицирован запрос (false - токен бессрочный или его нет)
+func TokenExpiry(ctx context.Context) (time.Time, bool) {
+	expiresAt, ok := ctx.Value(tokenExpiryKey).(time.Time)
+	return expiresAt, ok
+}
+
+func withTokenExpiry(ctx context.Context, expiresAt time.Time) context.Context {
+	return context.WithValue(ctx, tokenExpiryKey, expiresAt)
+}
+
+// Authenticator проверяет токены из запросов и кладет пользователя в context.
+// Зависимости необязательны: без Revocations отзыв токенов не проверяется,
+// без AccessTokens персональные токены не принимаются, без Sessions не проверяются сессии,
+// без Roles все запросы получают роль USER.
+type Authenticator struct {
+	Revocations  RevocationStorage
+	AccessTokens AccessTokenStorage
+	Sessions     SessionStorage
+	Roles        RoleStorage
+	// TrustForwardedFor - брать IP клиента из X-Forwarded-For (только за доверенным прокси)
+	TrustForwardedFor bool
+}
+
+var errSecretNotSet = errors.New("JWT secret not set")
+
+// Для извлечения userID из JWT и помещения в context (без проверки отзыва токенов)
 func AuthMiddleware(next http.Handler) http.Handler {
+	return (&Authenticator{}).Middleware(next)
+}
+
+// Middleware извлекает userID из JWT и помещает его в context
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// IP нужен и анонимным запросам (ограничение попыток входа), User-Agent - для сессии при входе
+		ctx := WithClientIP(r.Context(), clientIP(r, a.TrustForwardedFor))
+		r = r.WithContext(WithUserAgent(ctx, r.UserAgent()))
+
 		tokenStr := extractTokenFromHeader(r.Header.Get("Authorization"))
 		if tokenStr == "" {
 			next.ServeHTTP(w, r) // неавторизованный доступ — пропускаем
 			return
 		}
 
-		secret := os.Getenv("JWT_SECRET")
-		if secret == "" {
-			http.Error(w, "JWT secret not set", http.StatusInternalServerError)
+		ctx, err := a.Authenticate(r.Context(), tokenStr)
+		if errors.Is(err, errSecretNotSet) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(secret), nil
-		})
-		if err != nil || !token.Valid {
+		if err != nil {
 			next.ServeHTTP(w, r) // если невалидный токен — пропускаем
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			next.ServeHTTP(w, r)
-			return
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Authenticate проверяет токен (JWT или персональный токен доступа) и возвращает context с данными пользователя.
+// Кроме Middleware используется транспортами, которые передают токен не в заголовке (websocket).
+func (a *Authenticator) Authenticate(ctx context.Context, tokenStr string) (context.Context, error) {
+	if isAccessToken(tokenStr) {
+		return a.authenticateAccessToken(ctx, tokenStr)
+	}
+
+	ks := currentKeySet()
+	secret := os.Getenv("JWT_SECRET")
+	if ks == nil && secret == "" {
+		return nil, errSecretNotSet
+	}
+
+	// токены с kid проверяются ключами набора; HS256 токены - секретом JWT_SECRET, пока он задан
+	// (это позволяет перейти на асимметричную подпись, не разлогинивая пользователей)
+	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodHMAC:
+			if secret == "" {
+				return nil, errors.New("HMAC tokens are not accepted")
+			}
+			return []byte(secret), nil
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodEd25519:
+			if ks == nil {
+				return nil, errors.New("asymmetric tokens are not accepted")
+			}
+			return ks.verificationKey(token)
 		}
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	})
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("%w: invalid token", ErrUnauthenticated)
+	}
 
-		idFloat, ok := claims["user_id"].(float64)
-		if !ok {
-			next.ServeHTTP(w, r)
-			return
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid token claims", ErrUnauthenticated)
+	}
+
+	idFloat, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("%w: user_id claim not found", ErrUnauthenticated)
+	}
+	userID := uint(idFloat)
+
+	// токены без "iat" считаем выданными в начале эпохи - они отзываются любой записью
+	var issuedAt time.Time
+	if iat, ok := claims["iat"].(float64); ok {
+		issuedAt = time.Unix(int64(iat), 0)
+	}
+	err = a.checkRevoked(userID, issuedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	// токены, выданные до появления сессий, не содержат claim "sid" и проверяются только по отзыву
+	if sessionID, ok := claims["sid"].(string); ok && sessionID != "" {
+		err = a.checkSession(ctx, userID, sessionID)
+		if err != nil {
+			return nil, err
 		}
+		ctx = WithSessionID(ctx, sessionID)
+	}
+
+	ctx = WithUserID(ctx, userID)
+	if exp, ok := claims["exp"].(float64); ok {
+		ctx = withTokenExpiry(ctx, time.Unix(int64(exp), 0))
+	}
 
-		userID := uint(idFloat)
-		ctx := WithUserID(r.Context(), userID)
-		r = r.WithContext(ctx)
+	// claim "role" не используется: роль могла измениться после выдачи токена
+	role, err := a.currentRole(userID)
+	if err != nil {
+		return nil, err
+	}
+	return WithRole(ctx, role), nil
+}
 
-		next.ServeHTTP(w, r)
-	})
+// currentRole возвращает роль пользователя из хранилища; удаленный пользователь не аутентифицируется
+func (a *Authenticator) currentRole(userID uint) (string, error) {
+	if a.Roles == nil {
+		return RoleUser, nil
+	}
+
+	role, err := a.Roles.GetUserRole(userID)
+	if err != nil {
+		return "", fmt.Errorf("%w: user not found", ErrUnauthenticated)
+	}
+	return role, nil
+}
+
+// authenticateAccessToken проверяет персональный токен доступа.
+// Такие запросы получают роль USER и только области действия токена.
+func (a *Authenticator) authenticateAccessToken(ctx context.Context, tokenStr string) (context.Context, error) {
+	if a.AccessTokens == nil {
+		return nil, fmt.Errorf("%w: access tokens are not supported", ErrUnauthenticated)
+	}
+
+	now := time.Now()
+	token, err := a.AccessTokens.UseAccessToken(HashAccessToken(tokenStr), now)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid access token", ErrUnauthenticated)
+	}
+	if token.Expired(now) {
+		return nil, fmt.Errorf("%w: access token expired", ErrUnauthenticated)
+	}
+
+	// отзыв всех токенов пользователя (например, при удалении аккаунта) действует и на персональные
+	err = a.checkRevoked(token.UserID, token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = WithUserID(ctx, token.UserID)
+	if token.ExpiresAt != nil {
+		ctx = withTokenExpiry(ctx, *token.ExpiresAt)
+	}
+	ctx = WithRole(ctx, RoleUser)
+	return WithScopes(ctx, token.Scopes), nil
+}
+
+func (a *Authenticator) checkRevoked(userID uint, issuedAt time.Time) error {
+	if a.Revocations == nil {
+		return nil
+	}
+
+	revoked, err := a.Revocations.IsRevoked(userID, issuedAt)
+	if err != nil {
+		return fmt.Errorf("could not check token revocation: %w", err)
+	}
+	if revoked {
+		return fmt.Errorf("%w: token revoked", ErrUnauthenticated)
+	}
+	return nil
 }
 
 func extractTokenFromHeader(header string) string {
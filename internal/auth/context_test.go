@@ -2,6 +2,7 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -201,3 +202,321 @@ func TestAuthMiddleware(t *testing.T) {
 		assert.Contains(t, w.Body.String(), "JWT secret not set")
 	})
 }
+
+func TestRoles(t *testing.T) {
+	t.Run("Default role is USER", func(t *testing.T) {
+		ctx := context.Background()
+		assert.Equal(t, RoleUser, GetRoleFromContext(ctx))
+		assert.True(t, HasRole(ctx, RoleUser))
+		assert.False(t, HasRole(ctx, RoleModerator))
+	})
+
+	t.Run("Role hierarchy", func(t *testing.T) {
+		ctx := WithRole(context.Background(), RoleAdmin)
+		assert.True(t, HasRole(ctx, RoleUser))
+		assert.True(t, HasRole(ctx, RoleModerator))
+		assert.True(t, HasRole(ctx, RoleAdmin))
+
+		ctx = WithRole(context.Background(), RoleModerator)
+		assert.True(t, HasRole(ctx, RoleModerator))
+		assert.False(t, HasRole(ctx, RoleAdmin))
+	})
+}
+
+// roleStub - роли пользователей по ID
+type roleStub map[uint]string
+
+func (s roleStub) GetUserRole(userID uint) (string, error) {
+	role, ok := s[userID]
+	if !ok {
+		return "", errors.New("user not found")
+	}
+	return role, nil
+}
+
+func TestAuthMiddleware_Role(t *testing.T) {
+	originalSecret := os.Getenv("JWT_SECRET")
+	os.Setenv("JWT_SECRET", "test_jwt_secret")
+	defer os.Setenv("JWT_SECRET", originalSecret)
+
+	roles := roleStub{1: RoleAdmin, 2: RoleUser}
+	serve := func(authenticator *Authenticator, tokenString string) string {
+		handler := authenticator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := GetUserIDFromContext(r.Context()); err != nil {
+				fmt.Fprint(w, "anonymous")
+				return
+			}
+			fmt.Fprint(w, GetRoleFromContext(r.Context()))
+		}))
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	t.Run("Role from storage", func(t *testing.T) {
+		tokenString, err := GenerateToken(1, "admin", RoleAdmin)
+		require.NoError(t, err)
+		assert.Equal(t, RoleAdmin, serve(&Authenticator{Roles: roles}, tokenString))
+	})
+
+	t.Run("Role claim is not trusted", func(t *testing.T) {
+		tokenString, err := GenerateToken(2, "user", RoleAdmin)
+		require.NoError(t, err)
+		assert.Equal(t, RoleUser, serve(&Authenticator{Roles: roles}, tokenString))
+
+		// без хранилища ролей - только USER
+		assert.Equal(t, RoleUser, serve(&Authenticator{}, tokenString))
+	})
+
+	t.Run("Role change applies to issued tokens", func(t *testing.T) {
+		tokenString, err := GenerateToken(1, "admin", RoleAdmin)
+		require.NoError(t, err)
+
+		roles[1] = RoleUser
+		defer func() { roles[1] = RoleAdmin }()
+		assert.Equal(t, RoleUser, serve(&Authenticator{Roles: roles}, tokenString))
+	})
+
+	t.Run("Deleted user is not authenticated", func(t *testing.T) {
+		tokenString, err := GenerateToken(404, "ghost", RoleUser)
+		require.NoError(t, err)
+		assert.Equal(t, "anonymous", serve(&Authenticator{Roles: roles}, tokenString))
+	})
+}
+
+// revocationStub - простое хранилище отзывов для тестов middleware
+type revocationStub struct {
+	revoked map[uint]time.Time
+}
+
+func (s *revocationStub) RevokeUserTokens(userID uint, before time.Time) error {
+	s.revoked[userID] = before
+	return nil
+}
+
+func (s *revocationStub) IsRevoked(userID uint, issuedAt time.Time) (bool, error) {
+	before, ok := s.revoked[userID]
+	return ok && issuedAt.Unix() <= before.Unix(), nil
+}
+
+func TestAuthenticator_Revocations(t *testing.T) {
+	originalSecret := os.Getenv("JWT_SECRET")
+	os.Setenv("JWT_SECRET", "test_jwt_secret")
+	defer os.Setenv("JWT_SECRET", originalSecret)
+
+	revocations := &revocationStub{revoked: make(map[uint]time.Time)}
+	authenticator := &Authenticator{Revocations: revocations}
+
+	handler := authenticator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := GetUserIDFromContext(r.Context())
+		if err == nil {
+			fmt.Fprintf(w, "User ID: %d", userID)
+		} else {
+			fmt.Fprint(w, "No user ID in context")
+		}
+	}))
+
+	tokenString, err := GenerateToken(7, "user", RoleUser)
+	require.NoError(t, err)
+
+	serve := func() string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	t.Run("Valid token before revocation", func(t *testing.T) {
+		assert.Equal(t, "User ID: 7", serve())
+	})
+
+	t.Run("Revoked token", func(t *testing.T) {
+		require.NoError(t, revocations.RevokeUserTokens(7, time.Now()))
+		assert.Equal(t, "No user ID in context", serve())
+	})
+}
+
+func TestAuthenticator_Authenticate(t *testing.T) {
+	originalSecret := os.Getenv("JWT_SECRET")
+	os.Setenv("JWT_SECRET", "test_jwt_secret")
+	defer os.Setenv("JWT_SECRET", originalSecret)
+
+	authenticator := &Authenticator{}
+
+	t.Run("Valid token carries user and expiry", func(t *testing.T) {
+		tokenString, err := GenerateToken(7, "user", RoleUser)
+		require.NoError(t, err)
+
+		ctx, err := authenticator.Authenticate(context.Background(), tokenString)
+		require.NoError(t, err)
+
+		userID, err := GetUserIDFromContext(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, uint(7), userID)
+
+		expiresAt, ok := TokenExpiry(ctx)
+		require.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(TokenTTL), expiresAt, time.Minute)
+	})
+
+	t.Run("Invalid token", func(t *testing.T) {
+		_, err := authenticator.Authenticate(context.Background(), "invalid")
+		assert.ErrorIs(t, err, ErrUnauthenticated)
+	})
+
+	t.Run("No token - no expiry", func(t *testing.T) {
+		_, ok := TokenExpiry(context.Background())
+		assert.False(t, ok)
+	})
+}
+
+func TestAuthenticator_ClientIP(t *testing.T) {
+	serve := func(a *Authenticator, forwardedFor string) string {
+		var ip string
+		handler := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip = GetClientIP(r.Context())
+		}))
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		return ip
+	}
+
+	t.Run("Remote address by default", func(t *testing.T) {
+		assert.Equal(t, "192.0.2.1", serve(&Authenticator{}, "203.0.113.5"))
+	})
+
+	t.Run("X-Forwarded-For behind trusted proxy", func(t *testing.T) {
+		assert.Equal(t, "203.0.113.5", serve(&Authenticator{TrustForwardedFor: true}, "203.0.113.5, 10.0.0.1"))
+		assert.Equal(t, "192.0.2.1", serve(&Authenticator{TrustForwardedFor: true}, ""))
+	})
+}
+
+// sessionStub - хранилище сессий в памяти для тестов (memory-хранилище импортирует auth)
+type sessionStub struct {
+	sessions map[string]*Session
+}
+
+func (s *sessionStub) CreateSession(session *Session) error {
+	stored := *session
+	s.sessions[session.ID] = &stored
+	return nil
+}
+
+func (s *sessionStub) GetSession(id string) (*Session, error) {
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	result := *session
+	return &result, nil
+}
+
+func (s *sessionStub) GetSessions(userID uint) ([]*Session, error) {
+	var result []*Session
+	for _, session := range s.sessions {
+		if session.UserID == userID {
+			result = append(result, session)
+		}
+	}
+	return result, nil
+}
+
+func (s *sessionStub) TouchSession(id string, seenAt time.Time, ip string) error {
+	session, ok := s.sessions[id]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	session.LastSeenAt = seenAt
+	session.IP = ip
+	return nil
+}
+
+func (s *sessionStub) RevokeSession(userID uint, id string) error {
+	session, ok := s.sessions[id]
+	if !ok || session.UserID != userID {
+		return ErrSessionNotFound
+	}
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *sessionStub) DeleteUserSessions(userID uint) error {
+	return nil
+}
+
+func (s *sessionStub) DeleteSessionsBefore(createdBefore time.Time) error {
+	return nil
+}
+
+func TestAuthenticator_Sessions(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test_jwt_secret")
+
+	sessions := &sessionStub{sessions: make(map[string]*Session)}
+	authenticator := &Authenticator{Sessions: sessions}
+
+	var sessionID string
+	handler := authenticator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessionID = GetSessionID(r.Context())
+		userID, err := GetUserIDFromContext(r.Context())
+		if err == nil {
+			fmt.Fprintf(w, "User ID: %d", userID)
+		} else {
+			fmt.Fprint(w, "No user ID in context")
+		}
+	}))
+
+	ctx := WithUserAgent(WithClientIP(context.Background(), "192.0.2.1"), "test-agent")
+	tokenString, err := StartSession(ctx, sessions, 7, "user", RoleUser)
+	require.NoError(t, err)
+	require.Len(t, sessions.sessions, 1)
+
+	var created *Session
+	for _, session := range sessions.sessions {
+		created = session
+	}
+	assert.Equal(t, uint(7), created.UserID)
+	assert.Equal(t, "test-agent", created.UserAgent)
+	assert.Equal(t, "192.0.2.1", created.IP)
+
+	serve := func(remoteAddr string) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	t.Run("Active session", func(t *testing.T) {
+		assert.Equal(t, "User ID: 7", serve("192.0.2.1:1234"))
+		assert.Equal(t, created.ID, sessionID)
+	})
+
+	t.Run("Activity is recorded", func(t *testing.T) {
+		created.LastSeenAt = created.LastSeenAt.Add(-time.Hour)
+		serve("198.51.100.7:1234")
+
+		assert.WithinDuration(t, time.Now(), created.LastSeenAt, time.Minute)
+		assert.Equal(t, "198.51.100.7", created.IP)
+	})
+
+	t.Run("Revoked session", func(t *testing.T) {
+		require.NoError(t, sessions.RevokeSession(7, created.ID))
+		assert.Equal(t, "No user ID in context", serve("192.0.2.1:1234"))
+	})
+
+	t.Run("Token without session is still accepted", func(t *testing.T) {
+		tokenString, err = GenerateToken(7, "user", RoleUser)
+		require.NoError(t, err)
+		assert.Equal(t, "User ID: 7", serve("192.0.2.1:1234"))
+	})
+}
@@ -0,0 +1,10 @@
+package auth
+
+import "errors"
+
+var (
+	// ErrUnauthenticated - запрос выполняется без валидного токена
+	ErrUnauthenticated = errors.New("unauthenticated")
+	// ErrForbidden - пользователь аутентифицирован, но не имеет прав на операцию
+	ErrForbidden = errors.New("forbidden")
+)
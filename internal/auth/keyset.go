@@ -0,0 +1,376 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// JWKSPath - публичные ключи для проверки токенов другими сервисами
+const JWKSPath = "/.well-known/jwks.json"
+
+// Алгоритмы подписи токенов
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// rsaKeyBits - размер новых RSA ключей
+const rsaKeyBits = 2048
+
+var errNoSigningKey = errors.New("key set has no active signing key")
+
+// SigningKey - ключ подписи. Новые токены подписываются самым новым ключом без RetiredAt,
+// выведенные ключи остаются для проверки, пока не истекут подписанные ими токены.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	CreatedAt time.Time
+	RetiredAt *time.Time
+	private   crypto.Signer
+}
+
+func (k *SigningKey) publicKey() crypto.PublicKey {
+	return k.private.Public()
+}
+
+func (k *SigningKey) method() jwt.SigningMethod {
+	if k.Algorithm == AlgEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// KeySet - набор ключей подписи JWT
+type KeySet struct {
+	mu   sync.RWMutex
+	keys []*SigningKey
+}
+
+func NewKeySet() *KeySet {
+	return &KeySet{}
+}
+
+// Rotate создает новый ключ и делает его ключом подписи; прежний ключ выводится, но остается для проверки
+func (ks *KeySet) Rotate(alg string, now time.Time) (*SigningKey, error) {
+	key, err := generateSigningKey(alg, now)
+	if err != nil {
+		return nil, err
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	for _, k := range ks.keys {
+		if k.RetiredAt == nil {
+			retiredAt := now
+			k.RetiredAt = &retiredAt
+		}
+	}
+	ks.keys = append(ks.keys, key)
+	return key, nil
+}
+
+// Prune удаляет выведенные ключи, которыми подписаны только уже истекшие токены (ttl - время жизни токена)
+func (ks *KeySet) Prune(now time.Time, ttl time.Duration) []string {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	var removed []string
+	kept := ks.keys[:0]
+	for _, k := range ks.keys {
+		if k.RetiredAt != nil && now.Sub(*k.RetiredAt) > ttl {
+			removed = append(removed, k.ID)
+			continue
+		}
+		kept = append(kept, k)
+	}
+	ks.keys = kept
+	return removed
+}
+
+// Keys возвращает ключи в порядке создания
+func (ks *KeySet) Keys() []*SigningKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	return append([]*SigningKey(nil), ks.keys...)
+}
+
+// active - ключ подписи (вызывается под мьютексом)
+func (ks *KeySet) active() *SigningKey {
+	for i := len(ks.keys) - 1; i >= 0; i-- {
+		if ks.keys[i].RetiredAt == nil {
+			return ks.keys[i]
+		}
+	}
+	return nil
+}
+
+// Sign подписывает claims активным ключом, kid ключа записывается в заголовок токена
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	ks.mu.RLock()
+	key := ks.active()
+	ks.mu.RUnlock()
+
+	if key == nil {
+		return "", errNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.private)
+}
+
+// verificationKey возвращает публичный ключ по kid, если алгоритм токена совпадает с алгоритмом ключа
+func (ks *KeySet) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	for _, k := range ks.keys {
+		if k.ID != kid {
+			continue
+		}
+		if token.Method.Alg() != k.method().Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s for key %s", token.Method.Alg(), kid)
+		}
+		return k.publicKey(), nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func generateSigningKey(alg string, now time.Time) (*SigningKey, error) {
+	var private crypto.Signer
+	var err error
+
+	switch alg {
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not generate key: %w", err)
+	}
+
+	suffix := make([]byte, 4)
+	_, err = rand.Read(suffix)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate key id: %w", err)
+	}
+
+	return &SigningKey{
+		ID:        fmt.Sprintf("%s-%x", now.UTC().Format("20060102T150405"), suffix),
+		Algorithm: alg,
+		CreatedAt: now,
+		private:   private,
+	}, nil
+}
+
+// keyFile - формат файла ключей (JWT_KEYS_FILE); приватные ключи хранятся в PEM PKCS#8
+type keyFile struct {
+	Keys []keyFileEntry `json:"keys"`
+}
+
+type keyFileEntry struct {
+	ID         string     `json:"kid"`
+	Algorithm  string     `json:"alg"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	RetiredAt  *time.Time `json:"retiredAt,omitempty"`
+	PrivateKey string     `json:"privateKey"`
+}
+
+// LoadKeySet читает набор ключей из файла
+func LoadKeySet(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read key file: %w", err)
+	}
+
+	var file keyFile
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse key file: %w", err)
+	}
+
+	ks := NewKeySet()
+	for _, entry := range file.Keys {
+		block, _ := pem.Decode([]byte(entry.PrivateKey))
+		if block == nil {
+			return nil, fmt.Errorf("key %s: invalid PEM", entry.ID)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", entry.ID, err)
+		}
+
+		var private crypto.Signer
+		switch k := parsed.(type) {
+		case *rsa.PrivateKey:
+			if entry.Algorithm != AlgRS256 {
+				return nil, fmt.Errorf("key %s: RSA key with algorithm %s", entry.ID, entry.Algorithm)
+			}
+			private = k
+		case ed25519.PrivateKey:
+			if entry.Algorithm != AlgEdDSA {
+				return nil, fmt.Errorf("key %s: Ed25519 key with algorithm %s", entry.ID, entry.Algorithm)
+			}
+			private = k
+		default:
+			return nil, fmt.Errorf("key %s: unsupported key type %T", entry.ID, parsed)
+		}
+
+		ks.keys = append(ks.keys, &SigningKey{
+			ID:        entry.ID,
+			Algorithm: entry.Algorithm,
+			CreatedAt: entry.CreatedAt,
+			RetiredAt: entry.RetiredAt,
+			private:   private,
+		})
+	}
+
+	sort.SliceStable(ks.keys, func(i, j int) bool {
+		return ks.keys[i].CreatedAt.Before(ks.keys[j].CreatedAt)
+	})
+	return ks, nil
+}
+
+// Save атомарно записывает набор ключей в файл с правами 0600
+func (ks *KeySet) Save(path string) error {
+	ks.mu.RLock()
+	var file keyFile
+	for _, k := range ks.keys {
+		der, err := x509.MarshalPKCS8PrivateKey(k.private)
+		if err != nil {
+			ks.mu.RUnlock()
+			return fmt.Errorf("key %s: %w", k.ID, err)
+		}
+		file.Keys = append(file.Keys, keyFileEntry{
+			ID:         k.ID,
+			Algorithm:  k.Algorithm,
+			CreatedAt:  k.CreatedAt,
+			RetiredAt:  k.RetiredAt,
+			PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		})
+	}
+	ks.mu.RUnlock()
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".jwt-keys-*")
+	if err != nil {
+		return fmt.Errorf("could not write key file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("could not write key file: %w", err)
+	}
+	err = os.Chmod(tmp.Name(), 0o600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// jwk - публичный ключ в формате JWK (RFC 7517, RFC 8037)
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS возвращает публичные ключи всех ключей набора (включая выведенные - ими подписаны еще действующие токены)
+func (ks *KeySet) JWKS() map[string][]jwk {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	keys := []jwk{}
+	for _, k := range ks.keys {
+		entry := jwk{Kid: k.ID, Use: "sig", Alg: k.Algorithm}
+		switch pub := k.publicKey().(type) {
+		case *rsa.PublicKey:
+			entry.Kty = "RSA"
+			entry.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			entry.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			entry.Kty = "OKP"
+			entry.Crv = "Ed25519"
+			entry.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		keys = append(keys, entry)
+	}
+	return map[string][]jwk{"keys": keys}
+}
+
+// JWKSHandler отдает JWKS по JWKSPath
+func (ks *KeySet) JWKSHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		_ = json.NewEncoder(w).Encode(ks.JWKS())
+	})
+}
+
+// Reload перечитывает ключи из файла (после ротации командой "keys rotate")
+func (ks *KeySet) Reload(path string) error {
+	loaded, err := LoadKeySet(path)
+	if err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys = loaded.keys
+	return nil
+}
+
+var (
+	keySetMu      sync.RWMutex
+	defaultKeySet *KeySet
+)
+
+// SetKeySet включает асимметричную подпись токенов; nil возвращает подпись HS256 секретом JWT_SECRET
+func SetKeySet(ks *KeySet) {
+	keySetMu.Lock()
+	defer keySetMu.Unlock()
+	defaultKeySet = ks
+}
+
+func currentKeySet() *KeySet {
+	keySetMu.RLock()
+	defer keySetMu.RUnlock()
+	return defaultKeySet
+}
@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useKeySet включает набор ключей на время теста
+func useKeySet(t *testing.T, ks *KeySet) {
+	SetKeySet(ks)
+	t.Cleanup(func() { SetKeySet(nil) })
+}
+
+// userFromToken прогоняет токен через middleware и возвращает ответ обработчика
+func userFromToken(token string) string {
+	handler := AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := GetUserIDFromContext(r.Context())
+		if err != nil {
+			fmt.Fprint(w, "anonymous")
+			return
+		}
+		fmt.Fprintf(w, "user %d", userID)
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w.Body.String()
+}
+
+func TestKeySet_SignAndVerify(t *testing.T) {
+	t.Setenv("JWT_SECRET", "")
+
+	for _, alg := range []string{AlgRS256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			ks := NewKeySet()
+			key, err := ks.Rotate(alg, time.Now())
+			require.NoError(t, err)
+			useKeySet(t, ks)
+
+			token, err := GenerateToken(5, "user", RoleUser)
+			require.NoError(t, err)
+
+			parsed, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+			require.NoError(t, err)
+			assert.Equal(t, key.ID, parsed.Header["kid"])
+			assert.Equal(t, alg, parsed.Header["alg"])
+
+			assert.Equal(t, "user 5", userFromToken(token))
+		})
+	}
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	t.Setenv("JWT_SECRET", "")
+
+	ks := NewKeySet()
+	now := time.Now()
+	first, err := ks.Rotate(AlgRS256, now)
+	require.NoError(t, err)
+	useKeySet(t, ks)
+
+	oldToken, err := GenerateToken(1, "user", RoleUser)
+	require.NoError(t, err)
+
+	second, err := ks.Rotate(AlgEdDSA, now.Add(time.Hour))
+	require.NoError(t, err)
+
+	t.Run("New tokens use new key", func(t *testing.T) {
+		token, err := GenerateToken(2, "user", RoleUser)
+		require.NoError(t, err)
+
+		parsed, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+		require.NoError(t, err)
+		assert.Equal(t, second.ID, parsed.Header["kid"])
+		assert.Equal(t, "user 2", userFromToken(token))
+	})
+
+	t.Run("Tokens signed with retired key stay valid", func(t *testing.T) {
+		assert.Equal(t, "user 1", userFromToken(oldToken))
+	})
+
+	t.Run("Prune keeps key while its tokens may be valid", func(t *testing.T) {
+		assert.Empty(t, ks.Prune(now.Add(TokenTTL), TokenTTL))
+		assert.Equal(t, []string{first.ID}, ks.Prune(now.Add(TokenTTL+2*time.Hour), TokenTTL))
+		assert.Equal(t, "anonymous", userFromToken(oldToken))
+	})
+}
+
+func TestKeySet_RejectsForgedTokens(t *testing.T) {
+	t.Setenv("JWT_SECRET", "")
+
+	ks := NewKeySet()
+	key, err := ks.Rotate(AlgRS256, time.Now())
+	require.NoError(t, err)
+	useKeySet(t, ks)
+
+	claims := jwt.MapClaims{"user_id": 1, "exp": time.Now().Add(time.Hour).Unix()}
+
+	t.Run("HS256 token without JWT_SECRET", func(t *testing.T) {
+		// подмена алгоритма: HMAC с публичным ключом в качестве секрета
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		token.Header["kid"] = key.ID
+		signed, err := token.SignedString([]byte(fmt.Sprint(key.publicKey())))
+		require.NoError(t, err)
+
+		assert.Equal(t, "anonymous", userFromToken(signed))
+	})
+
+	t.Run("Unknown kid", func(t *testing.T) {
+		other := NewKeySet()
+		_, err := other.Rotate(AlgRS256, time.Now())
+		require.NoError(t, err)
+
+		signed, err := other.Sign(claims)
+		require.NoError(t, err)
+		assert.Equal(t, "anonymous", userFromToken(signed))
+	})
+
+	t.Run("Legacy HS256 tokens while JWT_SECRET is set", func(t *testing.T) {
+		t.Setenv("JWT_SECRET", "legacy_secret")
+
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("legacy_secret"))
+		require.NoError(t, err)
+		assert.Equal(t, "user 1", userFromToken(signed))
+	})
+}
+
+func TestKeySet_SaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+
+	ks := NewKeySet()
+	_, err := ks.Rotate(AlgRS256, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	_, err = ks.Rotate(AlgEdDSA, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, ks.Save(path))
+
+	loaded, err := LoadKeySet(path)
+	require.NoError(t, err)
+	require.Len(t, loaded.Keys(), 2)
+	assert.NotNil(t, loaded.Keys()[0].RetiredAt)
+	assert.Nil(t, loaded.Keys()[1].RetiredAt)
+
+	// токен, подписанный исходным набором, проверяется загруженным
+	signed, err := ks.Sign(jwt.MapClaims{"user_id": 3})
+	require.NoError(t, err)
+	token, err := jwt.Parse(signed, loaded.verificationKey)
+	require.NoError(t, err)
+	assert.True(t, token.Valid)
+
+	t.Run("Reload picks up rotation", func(t *testing.T) {
+		_, err := ks.Rotate(AlgRS256, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		require.NoError(t, ks.Save(path))
+
+		require.NoError(t, loaded.Reload(path))
+		assert.Len(t, loaded.Keys(), 3)
+	})
+}
+
+func TestKeySet_JWKS(t *testing.T) {
+	ks := NewKeySet()
+	rsaKey, err := ks.Rotate(AlgRS256, time.Now())
+	require.NoError(t, err)
+	edKey, err := ks.Rotate(AlgEdDSA, time.Now())
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	ks.JWKSHandler().ServeHTTP(w, httptest.NewRequest("GET", JWKSPath, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var body struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Len(t, body.Keys, 2)
+
+	assert.Equal(t, rsaKey.ID, body.Keys[0]["kid"])
+	assert.Equal(t, "RSA", body.Keys[0]["kty"])
+	assert.NotEmpty(t, body.Keys[0]["n"])
+	assert.NotContains(t, body.Keys[0], "d", "приватная часть не публикуется")
+
+	assert.Equal(t, edKey.ID, body.Keys[1]["kid"])
+	assert.Equal(t, "OKP", body.Keys[1]["kty"])
+	assert.Equal(t, "Ed25519", body.Keys[1]["crv"])
+}
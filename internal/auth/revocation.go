@@ -0,0 +1,10 @@
+package auth
+
+import "time"
+
+// RevocationStorage хранит отзывы токенов пользователей.
+// Отзыв действует на все токены, выданные не позже момента отзыва.
+type RevocationStorage interface {
+	RevokeUserTokens(userID uint, before time.Time) error
+	IsRevoked(userID uint, issuedAt time.Time) (bool, error)
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+)
+
+// Роли совпадают со значениями enum Role из GraphQL схемы
+const (
+	RoleUser      = "USER"
+	RoleModerator = "MODERATOR"
+	RoleAdmin     = "ADMIN"
+)
+
+const roleKey = contextKey("role")
+
+// ранг роли (каждая следующая роль включает права предыдущих)
+var roleRank = map[string]int{
+	RoleUser:      1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+// Сохраняет роль пользователя в контексте
+func WithRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, roleKey, role)
+}
+
+// Достает роль из контекста (по умолчанию - USER)
+func GetRoleFromContext(ctx context.Context) string {
+	role, ok := ctx.Value(roleKey).(string)
+	if !ok || role == "" {
+		return RoleUser
+	}
+	return role
+}
+
+// HasRole проверяет, что роль пользователя из контекста не ниже требуемой
+func HasRole(ctx context.Context, required string) bool {
+	return roleRank[GetRoleFromContext(ctx)] >= roleRank[required]
+}
+
+// IsValidRole проверяет, что роль известна
+func IsValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// RoleStorage возвращает текущую роль пользователя; ошибка, если пользователя нет.
+// Роль читается при каждом запросе, поэтому setUserRole действует сразу, а не после истечения токена.
+type RoleStorage interface {
+	GetUserRole(userID uint) (string, error)
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SessionTouchInterval - как часто обновляется время последней активности сессии
+// (не на каждый запрос, чтобы не писать в хранилище постоянно)
+const SessionTouchInterval = time.Minute
+
+// ErrSessionNotFound - сессия не существует, завершена или принадлежит другому пользователю
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session - вход пользователя с конкретного устройства; ID сессии записывается в JWT (claim "sid")
+type Session struct {
+	ID         string
+	UserID     uint
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+}
+
+// Expired сообщает, истекли ли к моменту now токены сессии
+func (s *Session) Expired(now time.Time) bool {
+	return !now.Before(s.CreatedAt.Add(TokenTTL))
+}
+
+// SessionStorage хранит сессии пользователей
+type SessionStorage interface {
+	CreateSession(session *Session) error
+	// GetSession возвращает ErrSessionNotFound, если сессии нет
+	GetSession(id string) (*Session, error)
+	GetSessions(userID uint) ([]*Session, error)
+	// TouchSession обновляет время последней активности и IP
+	TouchSession(id string, seenAt time.Time, ip string) error
+	// RevokeSession удаляет сессию пользователя, для чужой сессии возвращает ErrSessionNotFound
+	RevokeSession(userID uint, id string) error
+	// DeleteUserSessions удаляет все сессии пользователя (при удалении аккаунта)
+	DeleteUserSessions(userID uint) error
+	// DeleteSessionsBefore удаляет сессии, созданные раньше createdBefore (их токены уже истекли)
+	DeleteSessionsBefore(createdBefore time.Time) error
+}
+
+// StartSession создает сессию для входа с устройства из ctx (User-Agent и IP кладет Authenticator)
+// и выдает JWT, привязанный к ней. Без хранилища выдается обычный токен без сессии.
+func StartSession(ctx context.Context, store SessionStorage, userID uint, username, role string) (string, error) {
+	if store == nil {
+		return GenerateToken(userID, username, role)
+	}
+
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("could not generate session ID: %w", err)
+	}
+
+	now := time.Now()
+	session := &Session{
+		ID:         hex.EncodeToString(b),
+		UserID:     userID,
+		UserAgent:  GetUserAgent(ctx),
+		IP:         GetClientIP(ctx),
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}
+	err = store.CreateSession(session)
+	if err != nil {
+		return "", err
+	}
+
+	return generateToken(userID, username, role, session.ID)
+}
+
+const (
+	userAgentKey = contextKey("userAgent")
+	sessionIDKey = contextKey("sessionID")
+)
+
+// WithUserAgent сохраняет User-Agent клиента в контексте
+func WithUserAgent(ctx context.Context, userAgent string) context.Context {
+	return context.WithValue(ctx, userAgentKey, userAgent)
+}
+
+// GetUserAgent возвращает User-Agent клиента или пустую строку
+func GetUserAgent(ctx context.Context) string {
+	userAgent, _ := ctx.Value(userAgentKey).(string)
+	return userAgent
+}
+
+// WithSessionID сохраняет ID сессии текущего токена в контексте
+func WithSessionID(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionIDKey, sessionID)
+}
+
+// GetSessionID возвращает ID сессии текущего токена или пустую строку (токен без сессии)
+func GetSessionID(ctx context.Context) string {
+	sessionID, _ := ctx.Value(sessionIDKey).(string)
+	return sessionID
+}
+
+// checkSession проверяет, что сессия токена не завершена, и отмечает активность
+func (a *Authenticator) checkSession(ctx context.Context, userID uint, sessionID string) error {
+	if a.Sessions == nil {
+		return nil
+	}
+
+	session, err := a.Sessions.GetSession(sessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return fmt.Errorf("%w: session revoked", ErrUnauthenticated)
+	}
+	if err != nil {
+		return fmt.Errorf("could not check session: %w", err)
+	}
+	if session.UserID != userID {
+		return fmt.Errorf("%w: session revoked", ErrUnauthenticated)
+	}
+
+	now := time.Now()
+	ip := GetClientIP(ctx)
+	if now.Sub(session.LastSeenAt) >= SessionTouchInterval || session.IP != ip {
+		// ошибка обновления активности не мешает запросу
+		_ = a.Sessions.TouchSession(sessionID, now, ip)
+	}
+	return nil
+}
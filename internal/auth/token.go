@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// время жизни JWT токена
+const TokenTTL = 72 * time.Hour
+
+// GenerateToken подписывает JWT токен для пользователя активным ключом набора (см. SetKeySet),
+// а если набор не настроен - секретом JWT_SECRET (HS256)
+func GenerateToken(userID uint, username, role string) (string, error) {
+	return generateToken(userID, username, role, "")
+}
+
+// generateToken подписывает токен; непустой sessionID записывается в claim "sid" (см. StartSession)
+func generateToken(userID uint, username, role, sessionID string) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"user_id":  userID,
+		"username": username,
+		"role":     role,
+		"iat":      now.Unix(),
+		"exp":      now.Add(TokenTTL).Unix(),
+	}
+	if sessionID != "" {
+		claims["sid"] = sessionID
+	}
+
+	if ks := currentKeySet(); ks != nil {
+		tokenString, err := ks.Sign(claims)
+		if err != nil {
+			return "", fmt.Errorf("failed to sign token: %w", err)
+		}
+		return tokenString, nil
+	}
+
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		return "", errors.New("JWT_SECRET is not set in environment")
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString([]byte(jwtSecret))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	return tokenString, nil
+}
@@ -6,8 +6,15 @@ import (
 	"github.com/VitaminP8/postery/graph/model"
 )
 
+// Текст комментария, который удален, но оставлен в дереве, чтобы не терять ответы на него
+const DeletedContent = "[deleted]"
+
 type CommentStorage interface {
 	CreateComment(ctx context.Context, postID, parentID, content string) (*model.Comment, error)
 	GetComments(postID string, limit, offset int) (*model.CommentConnection, error)
 	GetReplies(postID string, limit, offset int) (*model.CommentConnection, error)
+	GetCommentByID(id string) (*model.Comment, error)
+	GetCommentsByAuthor(authorID string) ([]*model.Comment, error)
+	DeleteCommentsByAuthor(authorID string) error
+	AnonymizeCommentsByAuthor(authorID string) error
 }
@@ -21,3 +21,12 @@ func GetEnv(key string) string {
 	}
 	return value
 }
+
+// GetEnvDefault возвращает значение переменной окружения или значение по умолчанию
+func GetEnvDefault(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,122 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/VitaminP8/postery/graph/model"
+)
+
+// Записи архива - только данные, созданные пользователем, без связей GraphQL модели
+
+type profileRecord struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+}
+
+type postRecord struct {
+	ID               string `json:"id"`
+	Title            string `json:"title"`
+	Content          string `json:"content"`
+	CommentsDisabled bool   `json:"commentsDisabled"`
+}
+
+type commentRecord struct {
+	ID        string  `json:"id"`
+	PostID    string  `json:"postID"`
+	ParentID  *string `json:"parentID"`
+	Content   string  `json:"content"`
+	CreatedAt string  `json:"createdAt"`
+}
+
+type manifest struct {
+	UserID      string   `json:"userID"`
+	GeneratedAt string   `json:"generatedAt"`
+	Files       []string `json:"files"`
+}
+
+// writeArchive записывает ZIP архив с JSON файлами (по одному на тип данных)
+func writeArchive(w io.Writer, profile *model.User, posts []*model.Post, comments []*model.Comment, generatedAt time.Time) error {
+	postRecords := make([]postRecord, 0, len(posts))
+	for _, p := range posts {
+		postRecords = append(postRecords, postRecord{
+			ID:               p.ID,
+			Title:            p.Title,
+			Content:          p.Content,
+			CommentsDisabled: p.CommentsDisabled,
+		})
+	}
+
+	commentRecords := make([]commentRecord, 0, len(comments))
+	for _, c := range comments {
+		commentRecords = append(commentRecords, commentRecord{
+			ID:        c.ID,
+			PostID:    c.PostID,
+			ParentID:  c.ParentID,
+			Content:   c.Content,
+			CreatedAt: c.CreatedAt,
+		})
+	}
+
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"profile.json", profileRecord{
+			ID:       profile.ID,
+			Username: profile.Username,
+			Email:    profile.Email,
+			Role:     profile.Role.String(),
+		}},
+		{"posts.json", postRecords},
+		{"comments.json", commentRecords},
+	}
+
+	m := manifest{
+		UserID:      profile.ID,
+		GeneratedAt: generatedAt.Format(time.RFC3339),
+	}
+	for _, f := range files {
+		m.Files = append(m.Files, f.name)
+	}
+
+	zw := zip.NewWriter(w)
+
+	err := writeJSON(zw, "manifest.json", m)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		err = writeJSON(zw, f.name, f.content)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return fmt.Errorf("could not finish archive: %w", err)
+	}
+	return nil
+}
+
+func writeJSON(zw *zip.Writer, name string, v interface{}) error {
+	fw, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("could not create %s: %w", name, err)
+	}
+
+	enc := json.NewEncoder(fw)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(v)
+	if err != nil {
+		return fmt.Errorf("could not write %s: %w", name, err)
+	}
+	return nil
+}
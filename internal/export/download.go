@@ -0,0 +1,81 @@
+package export
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DownloadURL возвращает подписанную ссылку на готовый архив.
+// Ссылка действует linkTTL, но не дольше, чем хранится сам архив.
+func (m *Manager) DownloadURL(job *Job) string {
+	if job.Status != StatusReady || job.ExpiresAt == nil {
+		return ""
+	}
+
+	expires := time.Now().Add(m.linkTTL)
+	if job.ExpiresAt.Before(expires) {
+		expires = *job.ExpiresAt
+	}
+
+	params := url.Values{}
+	params.Set("id", job.ID)
+	params.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	params.Set("signature", m.sign(job.ID, expires.Unix()))
+
+	return DownloadPath + "?" + params.Encode()
+}
+
+// DownloadHandler отдает архив по подписанной ссылке
+func (m *Manager) DownloadHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		id := query.Get("id")
+
+		expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+		if err != nil || id == "" {
+			http.Error(w, "invalid download link", http.StatusBadRequest)
+			return
+		}
+
+		expected := m.sign(id, expires)
+		if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+			http.Error(w, "invalid download link signature", http.StatusForbidden)
+			return
+		}
+
+		if time.Now().Unix() > expires {
+			http.Error(w, "download link expired", http.StatusGone)
+			return
+		}
+
+		m.mu.Lock()
+		m.removeExpired(time.Now())
+		job, ok := m.jobs[id]
+		var path string
+		if ok && job.Status == StatusReady {
+			path = job.path
+		}
+		m.mu.Unlock()
+
+		if path == "" {
+			http.Error(w, "export not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"postery-export-%s.zip\"", id))
+		http.ServeFile(w, r, path)
+	})
+}
+
+func (m *Manager) sign(id string, expires int64) string {
+	mac := hmac.New(sha256.New, m.signingKey)
+	fmt.Fprintf(mac, "%s:%d", id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
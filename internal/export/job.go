@@ -0,0 +1,23 @@
+package export
+
+import "time"
+
+// Статусы задачи экспорта совпадают со значениями enum DataExportStatus из GraphQL схемы
+const (
+	StatusPending = "PENDING"
+	StatusRunning = "RUNNING"
+	StatusReady   = "READY"
+	StatusFailed  = "FAILED"
+)
+
+// Job - задача на формирование архива с данными пользователя
+type Job struct {
+	ID          string
+	UserID      string
+	Status      string
+	Error       string
+	CreatedAt   time.Time
+	CompletedAt *time.Time
+	ExpiresAt   *time.Time // после этого момента архив удаляется
+	path        string     // путь к готовому архиву
+}
@@ -0,0 +1,240 @@
+package export
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/VitaminP8/postery/internal/comment"
+	"github.com/VitaminP8/postery/internal/post"
+	"github.com/VitaminP8/postery/internal/user"
+)
+
+// DownloadPath - HTTP маршрут для скачивания готовых архивов
+const DownloadPath = "/export/download"
+
+var (
+	ErrJobNotFound = errors.New("export job not found")
+	// ErrExportInProgress - у пользователя уже есть задача в очереди или в работе
+	ErrExportInProgress = errors.New("data export is already in progress")
+)
+
+// Manager формирует архивы с данными пользователей в фоне и выдает подписанные ссылки на скачивание.
+// Задачи хранятся в памяти процесса и теряются при перезапуске, поэтому экспорт рассчитан на один экземпляр
+// сервера: запрос статуса и скачивание должны попадать на тот же экземпляр, что и requestDataExport.
+type Manager struct {
+	mu         sync.Mutex
+	jobs       map[string]*Job
+	dir        string        // каталог для готовых архивов
+	signingKey []byte        // ключ HMAC для подписи ссылок
+	archiveTTL time.Duration // сколько хранится готовый архив
+	linkTTL    time.Duration // сколько действует ссылка на скачивание
+
+	users    user.UserStorage
+	posts    post.PostStorage
+	comments comment.CommentStorage
+
+	wg sync.WaitGroup // фоновые задачи (для тестов и корректного завершения)
+}
+
+// NewManager создает менеджер. Без signingKey ссылки подписываются случайным ключом процесса: задачи и так
+// живут только в нем, а пустой ключ позволил бы подделать ссылку на чужой архив.
+func NewManager(dir string, signingKey []byte, users user.UserStorage, posts post.PostStorage, comments comment.CommentStorage) (*Manager, error) {
+	if len(signingKey) == 0 {
+		signingKey = make([]byte, 32)
+		_, err := rand.Read(signingKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not generate export signing key: %w", err)
+		}
+	}
+
+	return &Manager{
+		jobs:       make(map[string]*Job),
+		dir:        dir,
+		signingKey: signingKey,
+		archiveTTL: 24 * time.Hour,
+		linkTTL:    15 * time.Minute,
+		users:      users,
+		posts:      posts,
+		comments:   comments,
+	}, nil
+}
+
+// Request создает задачу экспорта и запускает ее в фоне. Пока предыдущая задача пользователя в очереди
+// или в работе, возвращает ErrExportInProgress.
+func (m *Manager) Request(userID string) (*Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.removeExpired(time.Now())
+	for _, job := range m.jobs {
+		if job.UserID == userID && (job.Status == StatusPending || job.Status == StatusRunning) {
+			m.mu.Unlock()
+			return nil, ErrExportInProgress
+		}
+	}
+	job := &Job{
+		ID:        id,
+		UserID:    userID,
+		Status:    StatusPending,
+		CreatedAt: time.Now(),
+	}
+	m.jobs[id] = job
+	snapshot := *job
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go m.run(id)
+
+	return &snapshot, nil
+}
+
+// Get возвращает задачу пользователя (чужие задачи не видны)
+func (m *Manager) Get(id, userID string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.removeExpired(time.Now())
+
+	job, ok := m.jobs[id]
+	if !ok || job.UserID != userID {
+		return nil, ErrJobNotFound
+	}
+
+	snapshot := *job
+	return &snapshot, nil
+}
+
+// DeleteUserExports удаляет задачи пользователя и их архивы (при удалении аккаунта).
+// Архив задачи, которая еще выполняется, удаляется по ее завершении.
+func (m *Manager) DeleteUserExports(userID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, job := range m.jobs {
+		if job.UserID == userID {
+			if job.path != "" {
+				os.Remove(job.path)
+			}
+			delete(m.jobs, id)
+		}
+	}
+}
+
+// Wait ждет завершения всех запущенных задач
+func (m *Manager) Wait() {
+	m.wg.Wait()
+}
+
+func (m *Manager) run(id string) {
+	defer m.wg.Done()
+
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	if !ok {
+		// задачу удалили вместе с аккаунтом до запуска
+		m.mu.Unlock()
+		return
+	}
+	job.Status = StatusRunning
+	userID := job.UserID
+	m.mu.Unlock()
+
+	path, err := m.build(id, userID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// задачу удалили вместе с аккаунтом, пока архив собирался
+	if m.jobs[id] != job {
+		if err == nil {
+			os.Remove(path)
+		}
+		return
+	}
+
+	now := time.Now()
+	job.CompletedAt = &now
+	if err != nil {
+		log.Printf("export %s failed: %v", id, err)
+		job.Status = StatusFailed
+		job.Error = err.Error()
+		return
+	}
+
+	expiresAt := now.Add(m.archiveTTL)
+	job.Status = StatusReady
+	job.ExpiresAt = &expiresAt
+	job.path = path
+}
+
+// build собирает данные пользователя и записывает архив на диск
+func (m *Manager) build(id, userID string) (string, error) {
+	profile, err := m.users.GetUserByID(userID)
+	if err != nil {
+		return "", fmt.Errorf("could not get profile: %w", err)
+	}
+
+	posts, err := m.posts.GetPostsByAuthor(userID)
+	if err != nil {
+		return "", fmt.Errorf("could not get posts: %w", err)
+	}
+
+	comments, err := m.comments.GetCommentsByAuthor(userID)
+	if err != nil {
+		return "", fmt.Errorf("could not get comments: %w", err)
+	}
+
+	err = os.MkdirAll(m.dir, 0o700)
+	if err != nil {
+		return "", fmt.Errorf("could not create export directory: %w", err)
+	}
+
+	path := filepath.Join(m.dir, id+".zip")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return "", fmt.Errorf("could not create archive: %w", err)
+	}
+
+	err = writeArchive(f, profile, posts, comments, time.Now())
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+
+	return path, nil
+}
+
+// removeExpired удаляет задачи с истекшими архивами (вызывается под мьютексом)
+func (m *Manager) removeExpired(now time.Time) {
+	for id, job := range m.jobs {
+		if job.ExpiresAt != nil && now.After(*job.ExpiresAt) {
+			if job.path != "" {
+				os.Remove(job.path)
+			}
+			delete(m.jobs, id)
+		}
+	}
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("could not generate export ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,235 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/mocks"
+	"github.com/VitaminP8/postery/internal/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestManager создает менеджер с пользователем, постом и комментарием
+func newTestManager(t *testing.T) (*Manager, string) {
+	users := mocks.NewMockUserStorage()
+	posts := mocks.NewMockPostStorage(nil)
+	comments := mocks.NewMockCommentStorage(nil)
+
+	user, err := users.RegisterUser("exporter", "exporter@example.com", "s3cure-passw0rd")
+	require.NoError(t, err)
+
+	ctx := auth.WithUserID(context.Background(), 1)
+	post, err := posts.CreatePost(ctx, "My post", "My content")
+	require.NoError(t, err)
+	_, err = comments.CreateComment(ctx, post.ID, "", "My comment")
+	require.NoError(t, err)
+
+	m, err := NewManager(t.TempDir(), []byte("test-signing-key"), users, posts, comments)
+	require.NoError(t, err)
+	return m, user.ID
+}
+
+// download выполняет запрос к обработчику скачивания
+func download(m *Manager, link string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", link, nil)
+	w := httptest.NewRecorder()
+	m.DownloadHandler().ServeHTTP(w, req)
+	return w
+}
+
+func TestManager_Export(t *testing.T) {
+	m, userID := newTestManager(t)
+
+	job, err := m.Request(userID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusPending, job.Status)
+	assert.Empty(t, m.DownloadURL(job))
+
+	m.Wait()
+
+	job, err = m.Get(job.ID, userID)
+	require.NoError(t, err)
+	require.Equal(t, StatusReady, job.Status, job.Error)
+	require.NotNil(t, job.CompletedAt)
+	require.NotNil(t, job.ExpiresAt)
+
+	link := m.DownloadURL(job)
+	require.NotEmpty(t, link)
+
+	t.Run("Download archive with JSON files", func(t *testing.T) {
+		w := download(m, link)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+
+		body := w.Body.Bytes()
+		zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		require.NoError(t, err)
+
+		files := map[string][]byte{}
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			require.NoError(t, err)
+			data, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			rc.Close()
+			files[f.Name] = data
+		}
+
+		require.Contains(t, files, "manifest.json")
+		require.Contains(t, files, "profile.json")
+		require.Contains(t, files, "posts.json")
+		require.Contains(t, files, "comments.json")
+
+		var profile map[string]interface{}
+		require.NoError(t, json.Unmarshal(files["profile.json"], &profile))
+		assert.Equal(t, "exporter", profile["username"])
+		assert.Equal(t, "exporter@example.com", profile["email"])
+
+		var posts []map[string]interface{}
+		require.NoError(t, json.Unmarshal(files["posts.json"], &posts))
+		require.Len(t, posts, 1)
+		assert.Equal(t, "My post", posts[0]["title"])
+
+		var comments []map[string]interface{}
+		require.NoError(t, json.Unmarshal(files["comments.json"], &comments))
+		require.Len(t, comments, 1)
+		assert.Equal(t, "My comment", comments[0]["content"])
+	})
+
+	t.Run("Error with tampered signature", func(t *testing.T) {
+		u, err := url.Parse(link)
+		require.NoError(t, err)
+		q := u.Query()
+		q.Set("signature", "0000")
+		u.RawQuery = q.Encode()
+
+		w := download(m, u.String())
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Error with expired link", func(t *testing.T) {
+		expires := time.Now().Add(-time.Minute).Unix()
+		q := url.Values{}
+		q.Set("id", job.ID)
+		q.Set("expires", strconv.FormatInt(expires, 10))
+		q.Set("signature", m.sign(job.ID, expires))
+
+		w := download(m, DownloadPath+"?"+q.Encode())
+		assert.Equal(t, http.StatusGone, w.Code)
+	})
+
+	t.Run("Other user cannot see the job", func(t *testing.T) {
+		_, err := m.Get(job.ID, "999")
+		assert.ErrorIs(t, err, ErrJobNotFound)
+	})
+}
+
+func TestManager_FailedExport(t *testing.T) {
+	m, _ := newTestManager(t)
+
+	// пользователя не существует - задача завершается с ошибкой
+	job, err := m.Request("999")
+	require.NoError(t, err)
+
+	m.Wait()
+
+	job, err = m.Get(job.ID, "999")
+	require.NoError(t, err)
+	assert.Equal(t, StatusFailed, job.Status)
+	assert.NotEmpty(t, job.Error)
+	assert.Empty(t, m.DownloadURL(job))
+}
+
+func TestManager_ExpiredArchive(t *testing.T) {
+	m, userID := newTestManager(t)
+	m.archiveTTL = -time.Second // архив истекает сразу после создания
+
+	job, err := m.Request(userID)
+	require.NoError(t, err)
+	m.Wait()
+
+	_, err = m.Get(job.ID, userID)
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
+
+func TestManager_DeleteUserExports(t *testing.T) {
+	m, userID := newTestManager(t)
+
+	ready, err := m.Request(userID)
+	require.NoError(t, err)
+	m.Wait()
+	ready, err = m.Get(ready.ID, userID)
+	require.NoError(t, err)
+	require.Equal(t, StatusReady, ready.Status, ready.Error)
+
+	// задача может еще выполняться: ее архив удаляется по завершении
+	pending, err := m.Request(userID)
+	require.NoError(t, err)
+
+	m.DeleteUserExports(userID)
+	m.Wait()
+
+	for _, id := range []string{ready.ID, pending.ID} {
+		_, err = m.Get(id, userID)
+		assert.ErrorIs(t, err, ErrJobNotFound)
+	}
+	entries, err := os.ReadDir(m.dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+// blockingUsers задерживает сборку архива, пока тест не закроет release
+type blockingUsers struct {
+	user.UserStorage
+	release chan struct{}
+}
+
+func (u *blockingUsers) GetUserByID(id string) (*model.User, error) {
+	<-u.release
+	return u.UserStorage.GetUserByID(id)
+}
+
+func TestManager_OneExportAtATime(t *testing.T) {
+	m, userID := newTestManager(t)
+	users := &blockingUsers{UserStorage: m.users, release: make(chan struct{})}
+	m.users = users
+
+	_, err := m.Request(userID)
+	require.NoError(t, err)
+
+	// пока задача в очереди или в работе, вторую создать нельзя; другим пользователям это не мешает
+	_, err = m.Request(userID)
+	assert.ErrorIs(t, err, ErrExportInProgress)
+	_, err = m.Request("999")
+	assert.NoError(t, err)
+
+	close(users.release)
+	m.Wait()
+
+	_, err = m.Request(userID)
+	assert.NoError(t, err)
+	m.Wait()
+}
+
+func TestNewManager_GeneratesSigningKey(t *testing.T) {
+	m, err := NewManager(t.TempDir(), nil, mocks.NewMockUserStorage(), mocks.NewMockPostStorage(nil), mocks.NewMockCommentStorage(nil))
+	require.NoError(t, err)
+	assert.Len(t, m.signingKey, 32)
+
+	other, err := NewManager(t.TempDir(), nil, mocks.NewMockUserStorage(), mocks.NewMockPostStorage(nil), mocks.NewMockCommentStorage(nil))
+	require.NoError(t, err)
+	assert.NotEqual(t, m.signingKey, other.signingKey)
+}
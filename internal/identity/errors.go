@@ -0,0 +1,92 @@
+package identity
+
+import (
+	"errors"
+	"strings"
+)
+
+// Поля, к которым относятся ошибки
+const (
+	FieldUsername = "username"
+	FieldEmail    = "email"
+)
+
+// Причины ошибок (extensions.fields[].reason в ответе GraphQL)
+const (
+	ReasonRequired = "REQUIRED"
+	ReasonInvalid  = "INVALID"
+	ReasonReserved = "RESERVED"
+	ReasonTaken    = "TAKEN"
+)
+
+// Ошибки занятости для errors.Is: сравниваются поле и причина, текст не важен
+var (
+	ErrUsernameTaken = &FieldError{Field: FieldUsername, Reason: ReasonTaken, Message: "username is already taken"}
+	ErrEmailTaken    = &FieldError{Field: FieldEmail, Reason: ReasonTaken, Message: "email is already registered"}
+)
+
+// FieldError - нарушение правил для одного поля
+type FieldError struct {
+	Field   string
+	Reason  string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// Is считает ошибки одинаковыми, если совпадают поле и причина
+func (e *FieldError) Is(target error) bool {
+	t, ok := target.(*FieldError)
+	return ok && t.Field == e.Field && t.Reason == e.Reason
+}
+
+// FieldErrors - нарушения в нескольких полях сразу
+type FieldErrors []*FieldError
+
+func (e FieldErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e FieldErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Fields извлекает ошибки полей из err (одиночную FieldError или FieldErrors); nil, если их нет
+func Fields(err error) []*FieldError {
+	var list FieldErrors
+	if errors.As(err, &list) {
+		return list
+	}
+	var single *FieldError
+	if errors.As(err, &single) {
+		return []*FieldError{single}
+	}
+	return nil
+}
+
+// join собирает ошибки полей в одну ошибку (nil, если нарушений нет)
+func join(errs ...*FieldError) error {
+	var list FieldErrors
+	for _, err := range errs {
+		if err != nil {
+			list = append(list, err)
+		}
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	if len(list) == 1 {
+		return list[0]
+	}
+	return list
+}
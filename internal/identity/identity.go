@@ -0,0 +1,198 @@
+// Package identity - общие правила для имен пользователей и email: нормализация Unicode,
+// сравнение без учета регистра, зарезервированные имена и проверка синтаксиса.
+// Оба хранилища проверяют уникальность по ключам UsernameKey и EmailKey.
+package identity
+
+import (
+	_ "embed"
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Ограничения длины имени (в символах) и email (RFC 5321)
+const (
+	MinUsernameLength = 3
+	MaxUsernameLength = 32
+	MaxEmailLength    = 254
+)
+
+//go:embed reserved_usernames.txt
+var reservedFile string
+
+var reserved = parseReserved(reservedFile)
+
+func parseReserved(data string) map[string]struct{} {
+	list := make(map[string]struct{})
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		list[UsernameKey(line)] = struct{}{}
+	}
+	return list
+}
+
+var folder = cases.Fold()
+
+// NormalizeUsername приводит имя к NFKC и убирает пробелы по краям; регистр сохраняется для отображения
+func NormalizeUsername(username string) string {
+	return strings.TrimSpace(norm.NFKC.String(username))
+}
+
+// UsernameKey возвращает ключ имени для сравнения и уникальности: "Admin", "ADMIN" и "ａｄｍｉｎ" совпадают
+func UsernameKey(username string) string {
+	return fold(NormalizeUsername(username))
+}
+
+// fold выполняет case folding и повторно нормализует результат (folding может нарушить NFKC)
+func fold(s string) string {
+	return norm.NFKC.String(folder.String(s))
+}
+
+// IsReserved сообщает, зарезервировано ли имя
+func IsReserved(username string) bool {
+	_, ok := reserved[UsernameKey(username)]
+	return ok
+}
+
+// ValidateUsername проверяет имя и возвращает его нормализованную форму.
+// Допустимы буквы, цифры и символы "_", ".", "-"; первый символ - буква или цифра.
+func ValidateUsername(username string) (string, error) {
+	name, fieldErr := validateUsername(username, false)
+	if fieldErr != nil {
+		return "", fieldErr
+	}
+	return name, nil
+}
+
+func validateUsername(username string, allowReserved bool) (string, *FieldError) {
+	name := NormalizeUsername(username)
+	if name == "" {
+		return "", &FieldError{Field: FieldUsername, Reason: ReasonRequired, Message: "username is required"}
+	}
+
+	length := utf8.RuneCountInString(name)
+	if length < MinUsernameLength || length > MaxUsernameLength {
+		return "", &FieldError{
+			Field:   FieldUsername,
+			Reason:  ReasonInvalid,
+			Message: fmt.Sprintf("username must be %d to %d characters", MinUsernameLength, MaxUsernameLength),
+		}
+	}
+
+	for i, r := range name {
+		if isUsernameLetter(r) {
+			continue
+		}
+		if i > 0 && strings.ContainsRune("_.-", r) {
+			continue
+		}
+		return "", &FieldError{
+			Field:   FieldUsername,
+			Reason:  ReasonInvalid,
+			Message: "username may contain only letters, digits, \"_\", \".\" and \"-\" and must start with a letter or digit",
+		}
+	}
+
+	if !allowReserved && IsReserved(name) {
+		return "", &FieldError{Field: FieldUsername, Reason: ReasonReserved, Message: "username is reserved"}
+	}
+
+	return name, nil
+}
+
+func isUsernameLetter(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// SuggestUsername превращает произвольную строку (например, имя от OIDC провайдера) в допустимое имя:
+// лишние символы удаляются, слишком короткое или зарезервированное имя заменяется на "user".
+// Длина оставляет место для числового суффикса, которым хранилище разрешает конфликты.
+func SuggestUsername(raw string) string {
+	var b strings.Builder
+	count := 0
+	for _, r := range NormalizeUsername(raw) {
+		if count == MaxUsernameLength-4 {
+			break
+		}
+		if isUsernameLetter(r) || (count > 0 && strings.ContainsRune("_.-", r)) {
+			b.WriteRune(r)
+			count++
+		}
+	}
+
+	name, err := ValidateUsername(b.String())
+	if err != nil {
+		return "user"
+	}
+	return name
+}
+
+// NormalizeEmail убирает пробелы по краям и приводит домен к нижнему регистру
+func NormalizeEmail(email string) string {
+	email = strings.TrimSpace(norm.NFC.String(email))
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email
+	}
+	return email[:at] + "@" + strings.ToLower(email[at+1:])
+}
+
+// EmailKey возвращает ключ email для уникальности; адреса сравниваются целиком без учета регистра
+func EmailKey(email string) string {
+	return fold(NormalizeEmail(email))
+}
+
+// ValidateEmail проверяет синтаксис адреса (без отображаемого имени) и возвращает нормализованную форму
+func ValidateEmail(email string) (string, error) {
+	address, fieldErr := validateEmail(email)
+	if fieldErr != nil {
+		return "", fieldErr
+	}
+	return address, nil
+}
+
+func validateEmail(email string) (string, *FieldError) {
+	address := NormalizeEmail(email)
+	if address == "" {
+		return "", &FieldError{Field: FieldEmail, Reason: ReasonRequired, Message: "email is required"}
+	}
+
+	invalid := &FieldError{Field: FieldEmail, Reason: ReasonInvalid, Message: "email address is invalid"}
+	if len(address) > MaxEmailLength {
+		return "", invalid
+	}
+
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Name != "" || parsed.Address != address {
+		return "", invalid
+	}
+
+	// адрес без точки в домене (user@localhost) технически допустим, но почта на него не дойдет
+	_, domain, _ := strings.Cut(address, "@")
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", invalid
+	}
+
+	return address, nil
+}
+
+// Validate проверяет имя и email при регистрации и возвращает их нормализованные формы.
+// Нарушения в обоих полях возвращаются вместе (FieldErrors). allowReserved разрешает служебное имя
+// (например, администратору, явно указанному в настройках).
+func Validate(username, email string, allowReserved bool) (string, string, error) {
+	name, nameErr := validateUsername(username, allowReserved)
+	address, emailErr := validateEmail(email)
+	err := join(nameErr, emailErr)
+	if err != nil {
+		return "", "", err
+	}
+	return name, address, nil
+}
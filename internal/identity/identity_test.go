@@ -0,0 +1,109 @@
+package identity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsernameKey(t *testing.T) {
+	t.Run("Case and width are ignored", func(t *testing.T) {
+		assert.Equal(t, UsernameKey("admin"), UsernameKey("Admin"))
+		assert.Equal(t, UsernameKey("admin"), UsernameKey("ＡＤＭＩＮ"))
+		assert.Equal(t, UsernameKey("strasse"), UsernameKey("STRAßE"))
+	})
+
+	t.Run("Composed and decomposed forms match", func(t *testing.T) {
+		assert.Equal(t, UsernameKey("jos\u00e9"), UsernameKey("Jose\u0301"))
+	})
+
+	t.Run("Different names differ", func(t *testing.T) {
+		assert.NotEqual(t, UsernameKey("alice"), UsernameKey("alice2"))
+	})
+}
+
+func TestValidateUsername(t *testing.T) {
+	t.Run("Valid names are normalized", func(t *testing.T) {
+		name, err := ValidateUsername("  Alice_01 ")
+		require.NoError(t, err)
+		assert.Equal(t, "Alice_01", name)
+
+		name, err = ValidateUsername("ｊｏｈｎ.ｄｏｅ")
+		require.NoError(t, err)
+		assert.Equal(t, "john.doe", name)
+
+		_, err = ValidateUsername("Иван-Петров")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Invalid names", func(t *testing.T) {
+		tests := map[string]string{
+			"":                                   ReasonRequired,
+			"ab":                                 ReasonInvalid,
+			"a234567890123456789012345678901234": ReasonInvalid,
+			"john doe":                           ReasonInvalid,
+			"_john":                              ReasonInvalid,
+			"john@doe":                           ReasonInvalid,
+			"ADMIN":                              ReasonReserved,
+			"Ｒｏｏｔ":                               ReasonReserved,
+		}
+		for name, reason := range tests {
+			_, err := ValidateUsername(name)
+			var fieldErr *FieldError
+			require.ErrorAs(t, err, &fieldErr, name)
+			assert.Equal(t, FieldUsername, fieldErr.Field, name)
+			assert.Equal(t, reason, fieldErr.Reason, name)
+		}
+	})
+}
+
+func TestSuggestUsername(t *testing.T) {
+	assert.Equal(t, "john.doe", SuggestUsername("john.doe"))
+	assert.Equal(t, "johndoe", SuggestUsername("john doe!"))
+	assert.Equal(t, "user", SuggestUsername("admin"))
+	assert.Equal(t, "user", SuggestUsername("!!"))
+	assert.Len(t, []rune(SuggestUsername("abcdefghijklmnopqrstuvwxyz0123456789")), MaxUsernameLength-4)
+}
+
+func TestValidateEmail(t *testing.T) {
+	t.Run("Domain is lowercased, local part is kept", func(t *testing.T) {
+		email, err := ValidateEmail(" John.Doe@Example.COM ")
+		require.NoError(t, err)
+		assert.Equal(t, "John.Doe@example.com", email)
+		assert.Equal(t, EmailKey("john.doe@example.com"), EmailKey(email))
+	})
+
+	t.Run("Invalid addresses", func(t *testing.T) {
+		for _, email := range []string{"plain", "a@b", "John <john@example.com>", "john@@example.com", "john@example.", "two words@example.com"} {
+			_, err := ValidateEmail(email)
+			assert.ErrorIs(t, err, &FieldError{Field: FieldEmail, Reason: ReasonInvalid}, email)
+		}
+
+		_, err := ValidateEmail("  ")
+		assert.ErrorIs(t, err, &FieldError{Field: FieldEmail, Reason: ReasonRequired})
+	})
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("Errors for both fields are returned together", func(t *testing.T) {
+		_, _, err := Validate("x", "not-an-email", false)
+		fields := Fields(err)
+		require.Len(t, fields, 2)
+		assert.Equal(t, FieldUsername, fields[0].Field)
+		assert.Equal(t, FieldEmail, fields[1].Field)
+	})
+
+	t.Run("Reserved name is allowed on request", func(t *testing.T) {
+		name, email, err := Validate("Admin", "Admin@Example.com", true)
+		require.NoError(t, err)
+		assert.Equal(t, "Admin", name)
+		assert.Equal(t, "Admin@example.com", email)
+	})
+
+	t.Run("Taken errors match by field and reason", func(t *testing.T) {
+		err := FieldErrors{ErrUsernameTaken, ErrEmailTaken}
+		assert.ErrorIs(t, err, ErrEmailTaken)
+		assert.ErrorIs(t, &FieldError{Field: FieldUsername, Reason: ReasonTaken, Message: "other text"}, ErrUsernameTaken)
+	})
+}
@@ -0,0 +1,108 @@
+// Package invite - режим регистрации и приглашения для регистрации по коду
+package invite
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VitaminP8/postery/internal/identity"
+)
+
+// Mode - режим регистрации (REGISTRATION_MODE)
+type Mode string
+
+const (
+	// ModeOpen - регистрироваться может любой, код приглашения необязателен
+	ModeOpen Mode = "open"
+	// ModeInviteOnly - регистрация только по коду приглашения
+	ModeInviteOnly Mode = "invite-only"
+	// ModeClosed - регистрация новых аккаунтов выключена
+	ModeClosed Mode = "closed"
+)
+
+// ParseMode разбирает значение REGISTRATION_MODE; пустое значение - ModeOpen
+func ParseMode(value string) (Mode, error) {
+	switch mode := Mode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return ModeOpen, nil
+	case ModeOpen, ModeInviteOnly, ModeClosed:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown registration mode %q (expected open, invite-only or closed)", value)
+}
+
+// FieldInviteCode - поле registerUser, к которому относятся ошибки приглашения
+const FieldInviteCode = "inviteCode"
+
+var (
+	// ErrInviteRequired - в режиме ModeInviteOnly регистрация без кода невозможна
+	ErrInviteRequired = &identity.FieldError{Field: FieldInviteCode, Reason: identity.ReasonRequired, Message: "an invite code is required"}
+	// ErrInviteInvalid - код не существует, отозван, истек, исчерпан или выдан на другой email
+	ErrInviteInvalid = &identity.FieldError{Field: FieldInviteCode, Reason: identity.ReasonInvalid, Message: "invite code is invalid or expired"}
+	// ErrInviteNotFound - приглашение с таким ID не существует
+	ErrInviteNotFound = errors.New("invite not found")
+)
+
+// Invite - приглашение (сам код не хранится, только его хэш)
+type Invite struct {
+	ID        string
+	CreatedBy string
+	// Email - если задан, зарегистрироваться по коду можно только с этим адресом
+	Email     string
+	MaxUses   int
+	Uses      int
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Revoked   bool
+	// Invitees - ID пользователей, зарегистрированных по приглашению
+	Invitees []string
+}
+
+// Usable сообщает, можно ли зарегистрироваться по приглашению с адресом email к моменту now
+func (i *Invite) Usable(email string, now time.Time) bool {
+	if i.Revoked || !now.Before(i.ExpiresAt) || i.Uses >= i.MaxUses {
+		return false
+	}
+	return i.Email == "" || identity.EmailKey(i.Email) == identity.EmailKey(email)
+}
+
+// InviteStorage хранит приглашения
+type InviteStorage interface {
+	// CreateInvite сохраняет приглашение с хэшем кода и заполняет ID
+	CreateInvite(invite *Invite, codeHash string) (*Invite, error)
+	// GetInvites возвращает все приглашения, начиная с новых
+	GetInvites() ([]*Invite, error)
+	// RevokeInvite отзывает приглашение; ErrInviteNotFound, если его нет
+	RevokeInvite(id string) error
+	// RedeemInvite атомарно засчитывает использование приглашения; ErrInviteInvalid, если оно не Usable
+	RedeemInvite(codeHash, email string, now time.Time) (*Invite, error)
+	// ReleaseInvite возвращает использование, если регистрация после RedeemInvite не удалась
+	ReleaseInvite(id string) error
+	// AddInvitee записывает, что пользователь зарегистрировался по приглашению
+	AddInvitee(id, userID string) error
+}
+
+// NewCode генерирует код приглашения для выдачи и его хэш для хранения
+func NewCode() (code, hash string, err error) {
+	b := make([]byte, 15)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", "", fmt.Errorf("could not generate invite code: %w", err)
+	}
+
+	// 120 бит в base32 без дополнения - код удобно продиктовать или переписать
+	code = strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+	return code, HashCode(code), nil
+}
+
+// HashCode - SHA-256 кода без учета регистра и пробелов по краям; у кода 120 бит случайности, медленный хэш не нужен
+func HashCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
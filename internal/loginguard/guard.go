@@ -0,0 +1,179 @@
+// Package loginguard ограничивает подбор паролей: считает неудачные входы по аккаунту и по IP,
+// после нескольких ошибок требует паузу, растущую экспоненциально, а затем временно блокирует вход
+package loginguard
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrTooManyAttempts - вход временно запрещен. Возвращается и для несуществующих имен,
+// поэтому не раскрывает, зарегистрирован ли пользователь.
+var ErrTooManyAttempts = errors.New("too many failed login attempts, try again later")
+
+// Config - параметры ограничения
+type Config struct {
+	FreeAttempts    int           // сколько ошибок подряд допускается без паузы
+	BaseDelay       time.Duration // пауза после первой ошибки сверх FreeAttempts, дальше удваивается
+	MaxDelay        time.Duration
+	LockoutAfter    int // после стольких ошибок аккаунт блокируется
+	LockoutDuration time.Duration
+	IPMultiplier    int           // с одного IP допускается во столько раз больше ошибок (IP бывает общим)
+	Window          time.Duration // через это время без ошибок счетчик сбрасывается
+}
+
+func DefaultConfig() Config {
+	return Config{
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        5 * time.Minute,
+		LockoutAfter:    10,
+		LockoutDuration: 15 * time.Minute,
+		IPMultiplier:    5,
+		Window:          time.Hour,
+	}
+}
+
+// attempts - счетчик ошибок по одному ключу (аккаунту или IP)
+type attempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// Guard хранит счетчики в памяти процесса
+type Guard struct {
+	cfg Config
+	now func() time.Time
+
+	mu       sync.Mutex
+	accounts map[string]*attempts
+	ips      map[string]*attempts
+	swept    time.Time // время последней очистки устаревших счетчиков
+}
+
+func New(cfg Config) *Guard {
+	return &Guard{
+		cfg:      cfg,
+		now:      time.Now,
+		accounts: make(map[string]*attempts),
+		ips:      make(map[string]*attempts),
+	}
+}
+
+// Check проверяет, можно ли сейчас пробовать войти; возвращает ErrTooManyAttempts с временем ожидания
+func (g *Guard) Check(username, ip string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	wait := g.waitFor(g.accounts[accountKey(username)], 1, now)
+	if ip != "" {
+		if ipWait := g.waitFor(g.ips[ip], g.cfg.IPMultiplier, now); ipWait > wait {
+			wait = ipWait
+		}
+	}
+
+	if wait > 0 {
+		return fmt.Errorf("%w (retry in %s)", ErrTooManyAttempts, wait.Round(time.Second))
+	}
+	return nil
+}
+
+// Failure учитывает неудачный вход; возвращает true, если аккаунт только что заблокирован
+func (g *Guard) Failure(username, ip string) (locked bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	// устаревшие счетчики удаляются не чаще раза в Window: обход всех счетчиков под мьютексом на каждой ошибке
+	// замедлял бы вход при подборе паролей с многих адресов
+	if now.Sub(g.swept) >= g.cfg.Window {
+		g.removeStale(now)
+		g.swept = now
+	}
+
+	locked = g.fail(g.accounts, accountKey(username), 1, now)
+	if ip != "" {
+		g.fail(g.ips, ip, g.cfg.IPMultiplier, now)
+	}
+	return locked
+}
+
+// Success сбрасывает счетчик аккаунта. Счетчик IP не сбрасывается - иначе, зная один пароль,
+// можно было бы бесконечно перебирать чужие аккаунты с того же адреса.
+func (g *Guard) Success(username string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.accounts, accountKey(username))
+}
+
+// Unlock снимает блокировку и паузу с аккаунта (административная операция)
+func (g *Guard) Unlock(username string) {
+	g.Success(username)
+}
+
+func (g *Guard) fail(counters map[string]*attempts, key string, multiplier int, now time.Time) bool {
+	a, ok := counters[key]
+	if !ok {
+		a = &attempts{}
+		counters[key] = a
+	}
+
+	a.failures++
+	a.lastFailure = now
+	if a.failures >= g.cfg.LockoutAfter*multiplier && !now.Before(a.lockedUntil) {
+		a.lockedUntil = now.Add(g.cfg.LockoutDuration)
+		return true
+	}
+	return false
+}
+
+// waitFor - сколько еще ждать до следующей попытки (вызывается под мьютексом)
+func (g *Guard) waitFor(a *attempts, multiplier int, now time.Time) time.Duration {
+	if a == nil {
+		return 0
+	}
+	if now.Before(a.lockedUntil) {
+		return a.lockedUntil.Sub(now)
+	}
+
+	excess := a.failures - g.cfg.FreeAttempts*multiplier
+	if excess <= 0 {
+		return 0
+	}
+
+	delay := g.cfg.MaxDelay
+	if excess <= 32 {
+		scaled := float64(g.cfg.BaseDelay) * math.Pow(2, float64(excess-1))
+		if scaled < float64(g.cfg.MaxDelay) {
+			delay = time.Duration(scaled)
+		}
+	}
+
+	if next := a.lastFailure.Add(delay); now.Before(next) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+// removeStale удаляет счетчики без ошибок дольше Window (вызывается под мьютексом)
+func (g *Guard) removeStale(now time.Time) {
+	for _, counters := range []map[string]*attempts{g.accounts, g.ips} {
+		for key, a := range counters {
+			if now.Sub(a.lastFailure) > g.cfg.Window && !now.Before(a.lockedUntil) {
+				delete(counters, key)
+			}
+		}
+	}
+}
+
+// accountKey - имена сравниваются без учета регистра, чтобы "Admin" и "admin" делили счетчик
+func accountKey(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
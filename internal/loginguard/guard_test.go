@@ -0,0 +1,137 @@
+package loginguard
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestGuard возвращает Guard с управляемыми часами
+func newTestGuard() (*Guard, *time.Time) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	g := New(DefaultConfig())
+	g.now = func() time.Time { return now }
+	return g, &now
+}
+
+func TestGuard_Backoff(t *testing.T) {
+	g, now := newTestGuard()
+
+	// первые ошибки без паузы
+	for i := 0; i < 3; i++ {
+		require.NoError(t, g.Check("alice", "10.0.0.1"))
+		g.Failure("alice", "10.0.0.1")
+	}
+
+	t.Run("Delay doubles after free attempts", func(t *testing.T) {
+		// 3 ошибки - еще без паузы, 4-я дает паузу 1с
+		require.NoError(t, g.Check("alice", "10.0.0.1"))
+		g.Failure("alice", "10.0.0.1")
+		assert.ErrorIs(t, g.Check("alice", "10.0.0.1"), ErrTooManyAttempts)
+
+		*now = now.Add(time.Second)
+		require.NoError(t, g.Check("alice", "10.0.0.1"))
+
+		// 5-я ошибка - пауза 2с
+		g.Failure("alice", "10.0.0.1")
+		*now = now.Add(time.Second)
+		assert.ErrorIs(t, g.Check("alice", "10.0.0.1"), ErrTooManyAttempts)
+		*now = now.Add(time.Second)
+		assert.NoError(t, g.Check("alice", "10.0.0.1"))
+	})
+
+	t.Run("Username is case-insensitive", func(t *testing.T) {
+		g.Failure("ALICE", "10.0.0.1")
+		assert.ErrorIs(t, g.Check("alice", "10.0.0.2"), ErrTooManyAttempts)
+	})
+
+	t.Run("Other accounts are not affected", func(t *testing.T) {
+		assert.NoError(t, g.Check("bob", "10.0.0.2"))
+	})
+
+	t.Run("Success resets account", func(t *testing.T) {
+		*now = now.Add(time.Hour)
+		g.Success("alice")
+		g.Failure("alice", "10.0.0.3")
+		assert.NoError(t, g.Check("alice", "10.0.0.3"))
+	})
+}
+
+func TestGuard_Lockout(t *testing.T) {
+	g, now := newTestGuard()
+
+	var locked bool
+	for i := 0; i < 10; i++ {
+		*now = now.Add(10 * time.Minute) // ждем окончания паузы перед каждой попыткой
+		locked = g.Failure("alice", "")
+	}
+	require.True(t, locked, "аккаунт блокируется после 10 ошибок")
+
+	t.Run("Locked for lockout duration", func(t *testing.T) {
+		*now = now.Add(14 * time.Minute)
+		err := g.Check("alice", "")
+		assert.ErrorIs(t, err, ErrTooManyAttempts)
+		assert.Contains(t, err.Error(), "retry in 1m0s")
+
+		*now = now.Add(time.Minute)
+		assert.NoError(t, g.Check("alice", ""))
+	})
+
+	t.Run("Admin unlock", func(t *testing.T) {
+		assert.True(t, g.Failure("alice", ""), "после блокировки следующая ошибка снова блокирует")
+		assert.ErrorIs(t, g.Check("alice", ""), ErrTooManyAttempts)
+
+		g.Unlock("alice")
+		assert.NoError(t, g.Check("alice", ""))
+	})
+}
+
+func TestGuard_IP(t *testing.T) {
+	g, _ := newTestGuard()
+
+	// перебор разных аккаунтов с одного IP
+	for i := 0; i < 16; i++ {
+		g.Failure("user"+string(rune('a'+i)), "10.0.0.1")
+	}
+
+	assert.ErrorIs(t, g.Check("newuser", "10.0.0.1"), ErrTooManyAttempts)
+	assert.NoError(t, g.Check("newuser", "10.0.0.2"))
+
+	t.Run("Success does not reset IP", func(t *testing.T) {
+		g.Success("newuser")
+		assert.ErrorIs(t, g.Check("newuser", "10.0.0.1"), ErrTooManyAttempts)
+	})
+}
+
+func TestGuard_RemoveStale(t *testing.T) {
+	g, now := newTestGuard()
+
+	g.Failure("alice", "10.0.0.1")
+	*now = now.Add(2 * time.Hour)
+	g.Failure("bob", "10.0.0.2")
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	assert.NotContains(t, g.accounts, "alice")
+	assert.NotContains(t, g.ips, "10.0.0.1")
+	assert.Contains(t, g.accounts, "bob")
+}
+
+func TestGuard_SweepInterval(t *testing.T) {
+	g, now := newTestGuard()
+
+	g.Failure("alice", "10.0.0.1")
+	swept := g.swept
+
+	// следующие ошибки в пределах Window не обходят счетчики
+	*now = now.Add(30 * time.Minute)
+	g.Failure("bob", "10.0.0.2")
+	assert.Equal(t, swept, g.swept)
+
+	*now = now.Add(31 * time.Minute)
+	g.Failure("bob", "10.0.0.2")
+	assert.Equal(t, *now, g.swept)
+	assert.NotContains(t, g.accounts, "alice")
+}
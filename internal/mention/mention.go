@@ -0,0 +1,57 @@
+// Package mention - упоминания пользователей (@username) в постах и комментариях.
+// Упоминание сохраняется по ID пользователя в момент публикации, поэтому продолжает указывать
+// на тот же аккаунт после смены имени, даже если старое имя потом займет другой пользователь.
+package mention
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/VitaminP8/postery/internal/identity"
+)
+
+// Kind - вид контента с упоминаниями
+type Kind string
+
+const (
+	KindPost    Kind = "post"
+	KindComment Kind = "comment"
+)
+
+// MaxMentions - сколько упоминаний в одном тексте учитывается (остальные остаются обычным текстом)
+const MaxMentions = 20
+
+// @ после буквы или цифры (адрес почты) упоминанием не считается
+var pattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_.@-])@([\p{L}\p{N}][\p{L}\p{N}_.-]*)`)
+
+// Parse возвращает имена, упомянутые в тексте, без повторов (сравнение без учета регистра)
+func Parse(content string) []string {
+	var names []string
+	seen := make(map[string]struct{})
+	for _, match := range pattern.FindAllStringSubmatch(content, -1) {
+		// точка или дефис в конце - знак препинания, а не часть имени ("спасибо, @alice.")
+		name := strings.TrimRight(match[1], ".-")
+
+		key := identity.UsernameKey(name)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		names = append(names, name)
+		if len(names) == MaxMentions {
+			break
+		}
+	}
+	return names
+}
+
+// MentionStorage хранит упомянутых пользователей для постов и комментариев
+type MentionStorage interface {
+	// AddMentions сохраняет упоминания в контенте; повторное упоминание не считается ошибкой
+	AddMentions(kind Kind, contentID string, userIDs []string) error
+	// GetMentions возвращает ID упомянутых пользователей в порядке сохранения
+	GetMentions(kind Kind, contentID string) ([]string, error)
+	// DeleteMentionsOf удаляет упоминания пользователя (при удалении аккаунта)
+	DeleteMentionsOf(userID string) error
+}
@@ -0,0 +1,33 @@
+package mention
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("Mentions are extracted", func(t *testing.T) {
+		assert.Equal(t, []string{"alice", "bob.smith"}, Parse("@alice, посмотри вместе с @bob.smith."))
+		assert.Equal(t, []string{"Иван"}, Parse("привет, @Иван!"))
+	})
+
+	t.Run("Repeated mentions are ignored", func(t *testing.T) {
+		assert.Equal(t, []string{"alice"}, Parse("@alice @ALICE @Alice"))
+	})
+
+	t.Run("Emails and bare @ are not mentions", func(t *testing.T) {
+		assert.Empty(t, Parse("пишите на mail@example.com или @ _"))
+		assert.Empty(t, Parse("@@alice"))
+	})
+
+	t.Run("Number of mentions is limited", func(t *testing.T) {
+		var b strings.Builder
+		for i := 0; i < MaxMentions+5; i++ {
+			fmt.Fprintf(&b, "@user%d ", i)
+		}
+		assert.Len(t, Parse(b.String()), MaxMentions)
+	})
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/VitaminP8/postery/graph/model"
 	"github.com/VitaminP8/postery/internal/auth"
 	"github.com/VitaminP8/postery/internal/subscription"
+	"github.com/VitaminP8/postery/internal/user"
 )
 
 type MockCommentStorage struct {
@@ -76,7 +77,11 @@ func (m *MockCommentStorage) CreateComment(ctx context.Context, postID, parentID
 	m.postIDs[postID] = append(m.postIDs[postID], commentID)
 
 	if m.manager != nil {
-		m.manager.Publish(postID, comment)
+		var ancestors []string
+		for c := comment; c.ParentID != nil; c = m.comments[*c.ParentID] {
+			ancestors = append(ancestors, *c.ParentID)
+		}
+		subscription.PublishComment(m.manager, comment, ancestors)
 	}
 
 	return comment, nil
@@ -170,3 +175,70 @@ func (m *MockCommentStorage) GetReplies(parentID string, limit, offset int) (*mo
 		NextOffset: offset + limit,
 	}, nil
 }
+
+func (m *MockCommentStorage) DeleteCommentsByAuthor(authorID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, comment := range m.comments {
+		if comment.AuthorID != authorID {
+			continue
+		}
+		if len(m.parentIDs[id]) > 0 {
+			comment.Content = "[deleted]"
+			comment.AuthorID = user.DeletedUserID
+			continue
+		}
+		delete(m.comments, id)
+		m.postIDs[comment.PostID] = removeID(m.postIDs[comment.PostID], id)
+		if comment.ParentID != nil {
+			m.parentIDs[*comment.ParentID] = removeID(m.parentIDs[*comment.ParentID], id)
+		}
+	}
+	return nil
+}
+
+func (m *MockCommentStorage) AnonymizeCommentsByAuthor(authorID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, comment := range m.comments {
+		if comment.AuthorID == authorID {
+			comment.AuthorID = user.DeletedUserID
+		}
+	}
+	return nil
+}
+
+func removeID(ids []string, id string) []string {
+	for i, cur := range ids {
+		if cur == id {
+			return append(ids[:i], ids[i+1:]...)
+		}
+	}
+	return ids
+}
+
+func (m *MockCommentStorage) GetCommentsByAuthor(authorID string) ([]*model.Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	comments := []*model.Comment{}
+	for _, comment := range m.comments {
+		if comment.AuthorID == authorID {
+			comments = append(comments, comment)
+		}
+	}
+	return comments, nil
+}
+
+func (m *MockCommentStorage) GetCommentByID(id string) (*model.Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	comment, exists := m.comments[id]
+	if !exists {
+		return nil, errors.New("comment not found")
+	}
+	return comment, nil
+}
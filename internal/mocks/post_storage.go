@@ -3,21 +3,26 @@ package mocks
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strconv"
 	"sync"
 
 	"github.com/VitaminP8/postery/graph/model"
 	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/subscription"
+	"github.com/VitaminP8/postery/internal/user"
 )
 
 type MockPostStorage struct {
-	posts map[string]*model.Post
-	mu    sync.Mutex
+	posts   map[string]*model.Post
+	mu      sync.Mutex
+	manager subscription.Manager // Для событий создания, изменения и удаления постов
 }
 
-func NewMockPostStorage() *MockPostStorage {
+func NewMockPostStorage(manager subscription.Manager) *MockPostStorage {
 	return &MockPostStorage{
-		posts: make(map[string]*model.Post),
+		posts:   make(map[string]*model.Post),
+		manager: manager,
 	}
 }
 
@@ -39,6 +44,8 @@ func (m *MockPostStorage) CreatePost(ctx context.Context, title, content string)
 		CommentsDisabled: false,
 	}
 	m.posts[id] = post
+	published := *post
+	m.publish(subscription.PostsTopic, subscription.EventPostCreated, &published)
 	return post, nil
 }
 
@@ -72,7 +79,10 @@ func (m *MockPostStorage) DisableComment(ctx context.Context, id string) error {
 	if !ok {
 		return fmt.Errorf("post not found")
 	}
-	post.CommentsDisabled = true
+	if !post.CommentsDisabled {
+		post.CommentsDisabled = true
+		m.publishCommentsToggled(post)
+	}
 	return nil
 }
 
@@ -84,7 +94,10 @@ func (m *MockPostStorage) EnableComment(ctx context.Context, id string) error {
 	if !ok {
 		return fmt.Errorf("post not found")
 	}
-	post.CommentsDisabled = false
+	if post.CommentsDisabled {
+		post.CommentsDisabled = false
+		m.publishCommentsToggled(post)
+	}
 	return nil
 }
 
@@ -96,5 +109,87 @@ func (m *MockPostStorage) DeletePostById(ctx context.Context, id string) error {
 		return fmt.Errorf("post not found")
 	}
 	delete(m.posts, id)
+	m.publish(subscription.PostTopic(id), subscription.EventPostDeleted, id)
 	return nil
 }
+
+func (m *MockPostStorage) DeletePostsByAuthor(authorID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, post := range m.posts {
+		if post.AuthorID == authorID {
+			delete(m.posts, id)
+			m.publish(subscription.PostTopic(id), subscription.EventPostDeleted, id)
+		}
+	}
+	return nil
+}
+
+func (m *MockPostStorage) AnonymizePostsByAuthor(authorID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, post := range m.posts {
+		if post.AuthorID == authorID {
+			post.AuthorID = user.DeletedUserID
+			updated := *post
+			m.publish(subscription.PostTopic(post.ID), subscription.EventPostUpdated, &updated)
+		}
+	}
+	return nil
+}
+
+func (m *MockPostStorage) publishCommentsToggled(post *model.Post) {
+	updated := *post
+	m.publish(subscription.PostTopic(post.ID), subscription.EventCommentsToggled, &updated)
+	m.publish(subscription.PostTopic(post.ID), subscription.EventPostUpdated, &updated)
+}
+
+func (m *MockPostStorage) publish(topic string, eventType subscription.EventType, payload interface{}) {
+	if m.manager != nil {
+		m.manager.Publish(topic, subscription.Event{Type: eventType, Payload: payload})
+	}
+}
+
+func (m *MockPostStorage) GetPostsByAuthor(authorID string) ([]*model.Post, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	posts := []*model.Post{}
+	for _, post := range m.posts {
+		if post.AuthorID == authorID {
+			posts = append(posts, post)
+		}
+	}
+	return posts, nil
+}
+
+func (m *MockPostStorage) GetPostsByAuthors(authorIDs []string, beforeID string, limit int) ([]*model.Post, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	authors := make(map[string]bool, len(authorIDs))
+	for _, id := range authorIDs {
+		authors[id] = true
+	}
+	before, _ := strconv.Atoi(beforeID)
+
+	posts := []*model.Post{}
+	for _, post := range m.posts {
+		id, _ := strconv.Atoi(post.ID)
+		if authors[post.AuthorID] && (beforeID == "" || id < before) {
+			posts = append(posts, post)
+		}
+	}
+
+	sort.Slice(posts, func(i, j int) bool {
+		a, _ := strconv.Atoi(posts[i].ID)
+		b, _ := strconv.Atoi(posts[j].ID)
+		return a > b
+	})
+	if len(posts) > limit {
+		posts = posts[:limit]
+	}
+	return posts, nil
+}
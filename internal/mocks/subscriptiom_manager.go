@@ -5,38 +5,39 @@ import (
 	"time"
 
 	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/subscription"
 )
 
 type MockSubscriptionManager struct {
-	mu            sync.Mutex
-	subs          map[string][]chan *model.Comment // postID -> список каналов подписчиков
-	notifications map[string][]*model.Comment      // Для отслеживания в тестах
+	mu        sync.Mutex
+	seq       uint64
+	topics    map[string][]chan subscription.Event // тема -> список каналов подписчиков
+	published map[string][]subscription.Event      // тема -> опубликованные события (для тестов)
 }
 
 func NewMockSubscriptionManager() *MockSubscriptionManager {
 	return &MockSubscriptionManager{
-		subs:          make(map[string][]chan *model.Comment),
-		notifications: make(map[string][]*model.Comment),
+		topics:    make(map[string][]chan subscription.Event),
+		published: make(map[string][]subscription.Event),
 	}
 }
 
-func (m *MockSubscriptionManager) Subscribe(postID string) (<-chan *model.Comment, func()) {
+func (m *MockSubscriptionManager) Subscribe(topic string) (<-chan subscription.Event, func()) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	ch := make(chan *model.Comment, 1) // Буфер 1, чтобы не блокировался писатель
-
-	m.subs[postID] = append(m.subs[postID], ch)
+	ch := make(chan subscription.Event, 1) // Буфер 1, чтобы не блокировался писатель
+	m.topics[topic] = append(m.topics[topic], ch)
 
 	// функция для отписки
 	cancel := func() {
 		m.mu.Lock()
 		defer m.mu.Unlock()
-		subscribers := m.subs[postID]
+		subscribers := m.topics[topic]
 		for i, sub := range subscribers {
 			if sub == ch {
 				// Удаляем подписчика
-				m.subs[postID] = append(subscribers[:i], subscribers[i+1:]...)
+				m.topics[topic] = append(subscribers[:i], subscribers[i+1:]...)
 				close(ch)
 				break
 			}
@@ -46,33 +47,71 @@ func (m *MockSubscriptionManager) Subscribe(postID string) (<-chan *model.Commen
 	return ch, cancel
 }
 
-func (m *MockSubscriptionManager) Publish(postID string, comment *model.Comment) {
+func (m *MockSubscriptionManager) Publish(topic string, event subscription.Event) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	for _, sub := range m.subs[postID] {
+	if event.Seq == 0 {
+		m.seq++
+		event.Seq = m.seq
+	}
+
+	for _, sub := range m.topics[topic] {
 		select {
-		case sub <- comment:
+		case sub <- event:
 		case <-time.After(500 * time.Millisecond):
 		}
 	}
 
-	// Сохраняем уведомление для тестирования
-	if _, ok := m.notifications[postID]; !ok {
-		m.notifications[postID] = make([]*model.Comment, 0)
+	// Сохраняем событие для тестирования
+	m.published[topic] = append(m.published[topic], event)
+}
+
+// History возвращает все опубликованные в теме события после since - история мока не ограничена
+func (m *MockSubscriptionManager) History(topic string, since uint64) ([]subscription.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []subscription.Event
+	for _, event := range m.published[topic] {
+		if event.Seq > since {
+			events = append(events, event)
+		}
 	}
-	m.notifications[postID] = append(m.notifications[postID], comment)
+	return events, nil
 }
 
 // GetNotificationsForPost - вспомогательный метод для тестирования,
-// возвращает все уведомления для конкретного поста
+// возвращает все новые комментарии, опубликованные для конкретного поста
 func (m *MockSubscriptionManager) GetNotificationsForPost(postID string) []*model.Comment {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	comments, ok := m.notifications[postID]
-	if !ok {
-		return nil
+	var comments []*model.Comment
+	for _, event := range m.published[subscription.CommentsTopic(postID)] {
+		if comment, ok := event.Payload.(*model.Comment); ok && event.Type == subscription.EventCommentAdded {
+			comments = append(comments, comment)
+		}
 	}
 	return comments
 }
+
+// GetPublishedForTopic - вспомогательный метод для тестирования, возвращает данные всех событий, опубликованных в теме
+func (m *MockSubscriptionManager) GetPublishedForTopic(topic string) []interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var payloads []interface{}
+	for _, event := range m.published[topic] {
+		payloads = append(payloads, event.Payload)
+	}
+	return payloads
+}
+
+// GetEventsForTopic - вспомогательный метод для тестирования, возвращает все события, опубликованные в теме
+func (m *MockSubscriptionManager) GetEventsForTopic(topic string) []subscription.Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]subscription.Event(nil), m.published[topic]...)
+}
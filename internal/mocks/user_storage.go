@@ -4,15 +4,21 @@ import (
 	"errors"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/identity"
+	"github.com/VitaminP8/postery/internal/user"
 )
 
 type MockUserStorage struct {
 	mu        sync.Mutex
-	users     map[string]*model.User // username -> user
-	emails    map[string]string      // email -> username
-	passwords map[string]string      // username -> password
+	users     map[string]*model.User            // username -> user
+	emails    map[string]string                 // email -> username
+	passwords map[string]string                 // username -> password
+	identity  map[string]*model.User            // issuer|subject -> user
+	twoFactor map[string]*user.TwoFactor        // userID -> 2FA
+	history   map[string][]*user.UsernameChange // userID -> прежние имена, от новых к старым
 	nextID    int
 }
 
@@ -21,20 +27,31 @@ func NewMockUserStorage() *MockUserStorage {
 		users:     make(map[string]*model.User),
 		emails:    make(map[string]string),
 		passwords: make(map[string]string),
+		identity:  make(map[string]*model.User),
+		twoFactor: make(map[string]*user.TwoFactor),
+		history:   make(map[string][]*user.UsernameChange),
 		nextID:    1,
 	}
 }
 
 func (m *MockUserStorage) RegisterUser(username, email, password string) (*model.User, error) {
+	return m.createUser(username, email, password, model.RoleUser)
+}
+
+func (m *MockUserStorage) CreateAdmin(username, email, password string) (*model.User, error) {
+	return m.createUser(username, email, password, model.RoleAdmin)
+}
+
+func (m *MockUserStorage) createUser(username, email, password string, role model.Role) (*model.User, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if _, exists := m.users[username]; exists {
-		return nil, errors.New("user with username " + username + " already exists")
+		return nil, identity.ErrUsernameTaken
 	}
 
-	if existingUsername, exists := m.emails[email]; exists {
-		return nil, errors.New("email " + email + " already registered to user " + existingUsername)
+	if _, exists := m.emails[email]; exists {
+		return nil, identity.ErrEmailTaken
 	}
 
 	id := m.nextID
@@ -44,6 +61,7 @@ func (m *MockUserStorage) RegisterUser(username, email, password string) (*model
 		ID:       strconv.Itoa(id),
 		Username: username,
 		Email:    email,
+		Role:     role,
 	}
 
 	m.users[username] = user
@@ -53,46 +71,240 @@ func (m *MockUserStorage) RegisterUser(username, email, password string) (*model
 	return user, nil
 }
 
-func (m *MockUserStorage) LoginUser(username, password string) (string, error) {
+func (m *MockUserStorage) VerifyCredentials(username, password string) (*model.User, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	user, exists := m.users[username]
-	if !exists {
-		return "", errors.New("user with username " + username + " not found")
+	u, exists := m.users[username]
+	if !exists || m.passwords[username] != password {
+		return nil, user.ErrInvalidCredentials
 	}
 
-	storedPassword, exists := m.passwords[username]
-	if !exists || storedPassword != password {
-		return "", errors.New("invalid password or username")
+	return u, nil
+}
+
+func (m *MockUserStorage) GetUserRole(userID uint) (string, error) {
+	user, err := m.GetUserByID(strconv.FormatUint(uint64(userID), 10))
+	if err != nil {
+		return "", err
 	}
+	return user.Role.String(), nil
+}
 
-	token := "jwt-token-for-user-" + user.ID
+func (m *MockUserStorage) GetUserByID(id string) (*model.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	return token, nil
+	for _, user := range m.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+
+	return nil, errors.New("user not found")
 }
 
 func (m *MockUserStorage) GetUserByUsername(username string) (*model.User, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	user, exists := m.users[username]
-	if !exists {
+	if u, ok := m.users[username]; ok {
+		return u, nil
+	}
+	for userID, history := range m.history {
+		for _, change := range history {
+			if change.Username == username {
+				return m.findByID(userID), nil
+			}
+		}
+	}
+	return nil, errors.New("user not found")
+}
+
+func (m *MockUserStorage) ChangeUsername(userID, username string) (*model.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.findByID(userID)
+	if u == nil {
 		return nil, errors.New("user not found")
 	}
+	if u.Username == username {
+		return nil, user.ErrUsernameUnchanged
+	}
+	if _, exists := m.users[username]; exists {
+		return nil, identity.ErrUsernameTaken
+	}
+	now := time.Now()
+	if history := m.history[userID]; len(history) > 0 && now.Before(user.NextChangeAt(history[0].ChangedAt)) {
+		return nil, user.ErrUsernameChangeTooSoon
+	}
 
-	return user, nil
+	m.history[userID] = append([]*user.UsernameChange{{Username: u.Username, ChangedAt: now}}, m.history[userID]...)
+	m.users[username] = u
+	m.passwords[username] = m.passwords[u.Username]
+	delete(m.users, u.Username)
+	delete(m.passwords, u.Username)
+	u.Username = username
+	return u, nil
 }
 
-func (m *MockUserStorage) GetUserByID(id string) (*model.User, error) {
+func (m *MockUserStorage) GetUsernameHistory(userID string) ([]*user.UsernameChange, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]*user.UsernameChange(nil), m.history[userID]...), nil
+}
+
+// findByID ищет пользователя по ID (вызывается под мьютексом)
+func (m *MockUserStorage) findByID(id string) *model.User {
+	for _, u := range m.users {
+		if u.ID == id {
+			return u
+		}
+	}
+	return nil
+}
+
+func (m *MockUserStorage) SetUserRole(userID string, role model.Role) (*model.User, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	for _, user := range m.users {
-		if user.ID == id {
+		if user.ID == userID {
+			user.Role = role
 			return user, nil
 		}
 	}
 
 	return nil, errors.New("user not found")
 }
+
+func (m *MockUserStorage) CheckPassword(userID, password string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for username, user := range m.users {
+		if user.ID == userID {
+			if m.passwords[username] != password {
+				return errors.New("password is incorrect")
+			}
+			return nil
+		}
+	}
+
+	return errors.New("user not found")
+}
+
+func (m *MockUserStorage) DeleteUser(userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for username, user := range m.users {
+		if user.ID == userID {
+			delete(m.users, username)
+			delete(m.emails, user.Email)
+			delete(m.passwords, username)
+			delete(m.twoFactor, userID)
+			return nil
+		}
+	}
+
+	return errors.New("user not found")
+}
+
+func (m *MockUserStorage) FindOrCreateByIdentity(issuer, subject, username, email string) (*model.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, exists := m.identity[issuer+"|"+subject]; exists {
+		return user, nil
+	}
+
+	if _, exists := m.users[username]; exists {
+		return nil, errors.New("user with username " + username + " already exists")
+	}
+
+	user := &model.User{
+		ID:       strconv.Itoa(m.nextID),
+		Username: username,
+		Email:    email,
+		Role:     model.RoleUser,
+	}
+	m.nextID++
+
+	m.users[username] = user
+	m.emails[email] = username
+	m.identity[issuer+"|"+subject] = user
+	return user, nil
+}
+
+func (m *MockUserStorage) FindUserByIdentity(issuer, subject string) (*model.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.identity[issuer+"|"+subject], nil
+}
+
+func (m *MockUserStorage) GetTwoFactor(userID string) (*user.TwoFactor, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, exists := m.twoFactor[userID]
+	if !exists {
+		return nil, nil
+	}
+
+	result := *state
+	result.RecoveryCodes = append([]string(nil), state.RecoveryCodes...)
+	return &result, nil
+}
+
+func (m *MockUserStorage) SaveTwoFactor(userID string, state *user.TwoFactor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	saved := *state
+	saved.RecoveryCodes = append([]string(nil), state.RecoveryCodes...)
+	m.twoFactor[userID] = &saved
+	return nil
+}
+
+func (m *MockUserStorage) DeleteTwoFactor(userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.twoFactor, userID)
+	return nil
+}
+
+func (m *MockUserStorage) UseTotpStep(userID string, step int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, exists := m.twoFactor[userID]
+	if !exists || step <= state.LastStep {
+		return user.ErrTotpCodeReused
+	}
+
+	state.LastStep = step
+	return nil
+}
+
+func (m *MockUserStorage) UseRecoveryCode(userID, codeHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, exists := m.twoFactor[userID]
+	if !exists {
+		return user.ErrRecoveryCodeInvalid
+	}
+
+	for i, hash := range state.RecoveryCodes {
+		if hash == codeHash {
+			state.RecoveryCodes = append(state.RecoveryCodes[:i], state.RecoveryCodes[i+1:]...)
+			return nil
+		}
+	}
+	return user.ErrRecoveryCodeInvalid
+}
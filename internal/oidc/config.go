@@ -0,0 +1,48 @@
+package oidc
+
+import (
+	"os"
+	"strings"
+)
+
+// Config - настройки OIDC провайдера (authorization code flow с PKCE)
+type Config struct {
+	Issuer       string // URL провайдера, по нему загружается /.well-known/openid-configuration
+	ClientID     string
+	ClientSecret string   // необязателен для публичных клиентов
+	RedirectURL  string   // полный URL CallbackPath этого сервера
+	Scopes       []string // по умолчанию openid profile email
+	// StateKey - ключ подписи параметров незавершенного входа; у всех экземпляров сервера должен быть одинаковым
+	StateKey []byte
+}
+
+// ConfigFromEnv читает настройки из OIDC_ISSUER, OIDC_CLIENT_ID, OIDC_CLIENT_SECRET, OIDC_REDIRECT_URL,
+// OIDC_SCOPES (через пробел) и OIDC_STATE_KEY (по умолчанию JWT_SECRET). ok == false, если OIDC не настроен.
+func ConfigFromEnv() (cfg Config, ok bool) {
+	cfg = Config{
+		Issuer:       os.Getenv("OIDC_ISSUER"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+	}
+
+	stateKey := os.Getenv("OIDC_STATE_KEY")
+	if stateKey == "" {
+		stateKey = os.Getenv("JWT_SECRET")
+	}
+	cfg.StateKey = []byte(stateKey)
+
+	if scopes := os.Getenv("OIDC_SCOPES"); scopes != "" {
+		cfg.Scopes = strings.Fields(scopes)
+	}
+
+	ok = cfg.Issuer != "" && cfg.ClientID != "" && cfg.RedirectURL != ""
+	return cfg, ok
+}
+
+func (c Config) scopes() []string {
+	if len(c.Scopes) == 0 {
+		return []string{"openid", "profile", "email"}
+	}
+	return c.Scopes
+}
@@ -0,0 +1,361 @@
+package oidc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/identity"
+	"github.com/VitaminP8/postery/internal/user"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Маршруты регистрируются рядом с /query
+const (
+	LoginPath    = "/auth/oidc/login"
+	CallbackPath = "/auth/oidc/callback"
+)
+
+var errSignupDisabled = errors.New("registration is closed, identity is not linked to an account")
+
+// loginTTL - сколько ждем возврата пользователя от провайдера
+const loginTTL = 10 * time.Minute
+
+// LoginFunc завершает вход пользователя, которого подтвердил провайдер, так же, как вход по паролю (ограничение
+// попыток, 2FA): возвращает токен Postery или, если у пользователя включена 2FA, challenge для completeLogin
+type LoginFunc func(ctx context.Context, u *model.User) (*model.LoginResult, error)
+
+// Handler реализует вход через OIDC провайдера: LoginPath перенаправляет на провайдера,
+// CallbackPath обменивает код на ID токен, связывает identity с пользователем и завершает вход через LoginFunc
+type Handler struct {
+	// DisableSignup запрещает создавать аккаунты при первом входе (регистрация только по приглашению или закрыта);
+	// уже связанные identity входят как обычно
+	DisableSignup bool
+
+	cfg      Config
+	users    user.UserStorage
+	login    LoginFunc
+	client   *http.Client
+	stateKey []byte // ключ подписи stateCookie
+
+	mu       sync.Mutex
+	metadata *metadata
+	keys     map[string]*rsa.PublicKey
+}
+
+// NewHandler создает обработчик входа; без cfg.StateKey ключ подписи state генерируется при запуске,
+// и вход, начатый на одном экземпляре сервера, не завершится на другом
+func NewHandler(cfg Config, users user.UserStorage, login LoginFunc) (*Handler, error) {
+	key := cfg.StateKey
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		_, err := rand.Read(key)
+		if err != nil {
+			return nil, fmt.Errorf("could not generate state key: %w", err)
+		}
+	}
+
+	return &Handler{
+		cfg:      cfg,
+		users:    users,
+		login:    login,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		stateKey: key,
+	}, nil
+}
+
+// provider лениво загружает метаданные провайдера, чтобы сервер стартовал и при недоступном IdP
+func (h *Handler) provider(ctx context.Context) (*metadata, error) {
+	h.mu.Lock()
+	md := h.metadata
+	h.mu.Unlock()
+	if md != nil {
+		return md, nil
+	}
+
+	md, err := discover(ctx, h.client, h.cfg.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	h.metadata = md
+	h.mu.Unlock()
+	return md, nil
+}
+
+// LoginHandler начинает authorization code flow с PKCE
+func (h *Handler) LoginHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		md, err := h.provider(r.Context())
+		if err != nil {
+			log.Printf("oidc: %v", err)
+			http.Error(w, "identity provider unavailable", http.StatusBadGateway)
+			return
+		}
+
+		state, err := randomString(32)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		nonce, err := randomString(32)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		verifier, err := randomString(48)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		value, err := h.encodeLogin(pendingLogin{
+			State:     state,
+			Verifier:  verifier,
+			Nonce:     nonce,
+			ExpiresAt: time.Now().Add(loginTTL).Unix(),
+		})
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		// SameSite=Lax: cookie отправляется при возврате от провайдера (переход верхнего уровня)
+		http.SetCookie(w, &http.Cookie{
+			Name:     stateCookie,
+			Value:    value,
+			Path:     CallbackPath,
+			MaxAge:   int(loginTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   strings.HasPrefix(h.cfg.RedirectURL, "https://"),
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		query := url.Values{
+			"response_type":         {"code"},
+			"client_id":             {h.cfg.ClientID},
+			"redirect_uri":          {h.cfg.RedirectURL},
+			"scope":                 {strings.Join(h.cfg.scopes(), " ")},
+			"state":                 {state},
+			"nonce":                 {nonce},
+			"code_challenge":        {codeChallenge(verifier)},
+			"code_challenge_method": {"S256"},
+		}
+
+		target := md.AuthorizationEndpoint
+		if strings.Contains(target, "?") {
+			target += "&" + query.Encode()
+		} else {
+			target += "?" + query.Encode()
+		}
+		http.Redirect(w, r, target, http.StatusFound)
+	})
+}
+
+// CallbackHandler завершает вход и отвечает JSON {"token": "..."} или, если у пользователя включена 2FA,
+// {"challenge": "..."} для мутации completeLogin
+func (h *Handler) CallbackHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// state одноразовый: cookie удаляется при любом исходе
+		http.SetCookie(w, &http.Cookie{Name: stateCookie, Path: CallbackPath, MaxAge: -1})
+
+		query := r.URL.Query()
+		if e := query.Get("error"); e != "" {
+			http.Error(w, "login failed: "+e, http.StatusUnauthorized)
+			return
+		}
+
+		state := query.Get("state")
+		code := query.Get("code")
+		if state == "" || code == "" {
+			http.Error(w, "missing code or state", http.StatusBadRequest)
+			return
+		}
+
+		// state из ответа провайдера должен совпасть с подписанным state браузера, начавшего вход
+		cookie, err := r.Cookie(stateCookie)
+		if err != nil {
+			http.Error(w, errInvalidState.Error(), http.StatusBadRequest)
+			return
+		}
+		login, err := h.decodeLogin(cookie.Value, time.Now())
+		if err != nil || !hmac.Equal([]byte(login.State), []byte(state)) {
+			http.Error(w, errInvalidState.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result, err := h.completeLogin(r.Context(), code, login)
+		if err != nil {
+			log.Printf("oidc: %v", err)
+			http.Error(w, "login failed", http.StatusUnauthorized)
+			return
+		}
+
+		body := map[string]string{}
+		if result.Challenge != nil {
+			body["challenge"] = *result.Challenge
+		} else if result.Token != nil {
+			body["token"] = *result.Token
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(body)
+	})
+}
+
+func (h *Handler) completeLogin(ctx context.Context, code string, login pendingLogin) (*model.LoginResult, error) {
+	md, err := h.provider(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, err := h.exchange(ctx, md, code, login.Verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := h.verifyIDToken(ctx, md, rawIDToken, login.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	// email обязателен, как и при регистрации по паролю
+	if claims.Email == "" {
+		return nil, errors.New("ID token has no email claim")
+	}
+
+	var u *model.User
+	if h.DisableSignup {
+		u, err = h.users.FindUserByIdentity(h.cfg.Issuer, claims.Subject)
+		if err == nil && u == nil {
+			err = errSignupDisabled
+		}
+	} else {
+		u, err = h.users.FindOrCreateByIdentity(h.cfg.Issuer, claims.Subject, usernameFromClaims(claims), claims.Email)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// блокировка входа и 2FA действуют и при входе через провайдера
+	return h.login(ctx, u)
+}
+
+// exchange обменивает код авторизации на ID токен
+func (h *Handler) exchange(ctx context.Context, md *metadata, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {h.cfg.RedirectURL},
+		"client_id":     {h.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	if h.cfg.ClientSecret != "" {
+		form.Set("client_secret", h.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		IDToken string `json:"id_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return "", fmt.Errorf("could not decode token response: %w", err)
+	}
+	if body.IDToken == "" {
+		return "", errors.New("token response has no id_token")
+	}
+	return body.IDToken, nil
+}
+
+// verifyIDToken проверяет подпись (RS256, ключ из JWKS по kid), issuer, audience, срок действия и nonce
+func (h *Handler) verifyIDToken(ctx context.Context, md *metadata, raw, nonce string) (*idTokenClaims, error) {
+	claims := &idTokenClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256"}))
+	_, err := parser.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return h.key(ctx, md, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	if !claims.VerifyIssuer(h.cfg.Issuer, true) {
+		return nil, errors.New("invalid ID token: issuer mismatch")
+	}
+	if !claims.VerifyAudience(h.cfg.ClientID, true) {
+		return nil, errors.New("invalid ID token: audience mismatch")
+	}
+	if claims.ExpiresAt == nil {
+		return nil, errors.New("invalid ID token: missing exp")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("invalid ID token: nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("invalid ID token: missing sub")
+	}
+	return claims, nil
+}
+
+// key возвращает ключ провайдера по kid, при неизвестном kid один раз перезагружает JWKS (ротация ключей)
+func (h *Handler) key(ctx context.Context, md *metadata, kid string) (*rsa.PublicKey, error) {
+	h.mu.Lock()
+	key, ok := h.keys[kid]
+	h.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	keys, err := fetchKeys(ctx, h.client, md.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	h.keys = keys
+	h.mu.Unlock()
+
+	key, ok = keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// usernameFromClaims выбирает желаемое имя для нового аккаунта: preferred_username, затем локальная часть email
+func usernameFromClaims(claims *idTokenClaims) string {
+	name := claims.PreferredUsername
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	return identity.SuggestUsername(name)
+}
@@ -0,0 +1,412 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/oidc/oidctest"
+	"github.com/VitaminP8/postery/internal/storage/memory"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "test_secret_key_for_jwt"
+
+type testEnv struct {
+	idp     *oidctest.Provider
+	server  *httptest.Server
+	handler *Handler
+	users   *memory.UserMemoryStorage
+	// loginFunc завершает вход; по умолчанию выдает токен без проверок
+	loginFunc LoginFunc
+}
+
+// newTestEnv поднимает mock IdP и сервер с маршрутами входа
+func newTestEnv(t *testing.T) *testEnv {
+	t.Setenv("JWT_SECRET", testSecret)
+
+	env := &testEnv{
+		idp:   oidctest.NewProvider("postery"),
+		users: memory.NewUserMemoryStorage(),
+	}
+	t.Cleanup(env.idp.Close)
+
+	mux := http.NewServeMux()
+	env.server = httptest.NewServer(mux)
+	t.Cleanup(env.server.Close)
+
+	env.loginFunc = func(ctx context.Context, u *model.User) (*model.LoginResult, error) {
+		userID, err := strconv.ParseUint(u.ID, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		token, err := auth.StartSession(ctx, nil, uint(userID), u.Username, u.Role.String())
+		if err != nil {
+			return nil, err
+		}
+		return &model.LoginResult{Token: &token}, nil
+	}
+
+	var err error
+	env.handler, err = NewHandler(Config{
+		Issuer:      env.idp.Issuer(),
+		ClientID:    "postery",
+		RedirectURL: env.server.URL + CallbackPath,
+	}, env.users, func(ctx context.Context, u *model.User) (*model.LoginResult, error) {
+		return env.loginFunc(ctx, u)
+	})
+	require.NoError(t, err)
+	mux.Handle(LoginPath, env.handler.LoginHandler())
+	mux.Handle(CallbackPath, env.handler.CallbackHandler())
+
+	return env
+}
+
+// newClient возвращает клиента с cookie, как у браузера; follow == false отключает переход по редиректам
+func newClient(t *testing.T, follow bool) *http.Client {
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	client := &http.Client{Jar: jar}
+	if !follow {
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	return client
+}
+
+// login проходит весь flow, следуя редиректам, и возвращает ответ callback
+func (env *testEnv) login(t *testing.T) (*http.Response, string) {
+	resp, err := newClient(t, true).Get(env.server.URL + LoginPath)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var body struct {
+		Token string `json:"token"`
+	}
+	if resp.StatusCode == http.StatusOK {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	}
+	return resp, body.Token
+}
+
+func parseClaims(t *testing.T, tokenStr string) jwt.MapClaims {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(testSecret), nil
+	})
+	require.NoError(t, err)
+	return claims
+}
+
+func TestHandler_Login(t *testing.T) {
+	env := newTestEnv(t)
+
+	t.Run("First login creates account and issues token", func(t *testing.T) {
+		resp, token := env.login(t)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		claims := parseClaims(t, token)
+		assert.Equal(t, "oidcuser", claims["username"])
+		assert.Equal(t, "USER", claims["role"])
+	})
+
+	t.Run("Next login uses linked account", func(t *testing.T) {
+		// имя у провайдера поменялось, но аккаунт тот же
+		env.idp.SetIdentity(oidctest.Identity{Subject: "subject-1", Email: "oidc@example.com", PreferredUsername: "renamed"})
+
+		resp, token := env.login(t)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "oidcuser", parseClaims(t, token)["username"])
+	})
+
+	t.Run("Taken username gets suffix", func(t *testing.T) {
+		env.idp.SetIdentity(oidctest.Identity{Subject: "subject-2", Email: "second@example.com", PreferredUsername: "oidcuser"})
+
+		resp, token := env.login(t)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "oidcuser2", parseClaims(t, token)["username"])
+	})
+
+	t.Run("Email of password account is rejected", func(t *testing.T) {
+		_, err := env.users.RegisterUser("local", "local@example.com", "s3cure-passw0rd")
+		require.NoError(t, err)
+		env.idp.SetIdentity(oidctest.Identity{Subject: "subject-3", Email: "local@example.com"})
+
+		resp, _ := env.login(t)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("Login goes through login func", func(t *testing.T) {
+		env.idp.SetIdentity(oidctest.Identity{Subject: "subject-1", Email: "oidc@example.com"})
+		defer func(loginFunc LoginFunc) { env.loginFunc = loginFunc }(env.loginFunc)
+
+		// вход заблокирован
+		env.loginFunc = func(ctx context.Context, u *model.User) (*model.LoginResult, error) {
+			return nil, errors.New("too many failed login attempts")
+		}
+		resp, _ := env.login(t)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		// у пользователя включена 2FA - вместо токена challenge
+		challenge := "challenge-token"
+		env.loginFunc = func(ctx context.Context, u *model.User) (*model.LoginResult, error) {
+			assert.Equal(t, "oidcuser", u.Username)
+			return &model.LoginResult{Challenge: &challenge}, nil
+		}
+		resp, err := newClient(t, true).Get(env.server.URL + LoginPath)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, map[string]string{"challenge": challenge}, body)
+	})
+}
+
+func TestHandler_DisableSignup(t *testing.T) {
+	env := newTestEnv(t)
+
+	// аккаунт связан до закрытия регистрации
+	resp, _ := env.login(t)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	env.handler.DisableSignup = true
+
+	t.Run("Linked identity logs in", func(t *testing.T) {
+		resp, token := env.login(t)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "oidcuser", parseClaims(t, token)["username"])
+	})
+
+	t.Run("New identity is rejected", func(t *testing.T) {
+		env.idp.SetIdentity(oidctest.Identity{Subject: "subject-new", Email: "new@example.com", PreferredUsername: "newcomer"})
+
+		resp, _ := env.login(t)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		_, err := env.users.GetUserByUsername("newcomer")
+		assert.Error(t, err)
+	})
+}
+
+func TestHandler_Callback(t *testing.T) {
+	env := newTestEnv(t)
+	client := newClient(t, false)
+
+	// startLogin начинает вход клиентом client и возвращает адрес callback, на который вернул провайдер
+	startLogin := func(t *testing.T, client *http.Client) *url.URL {
+		resp, err := client.Get(env.server.URL + LoginPath)
+		require.NoError(t, err)
+		resp.Body.Close()
+		authorizeURL, err := resp.Location()
+		require.NoError(t, err)
+
+		resp, err = client.Get(authorizeURL.String())
+		require.NoError(t, err)
+		resp.Body.Close()
+		callbackURL, err := resp.Location()
+		require.NoError(t, err)
+		return callbackURL
+	}
+
+	t.Run("Login redirects with PKCE", func(t *testing.T) {
+		resp, err := client.Get(env.server.URL + LoginPath)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		require.Equal(t, http.StatusFound, resp.StatusCode)
+		location, err := resp.Location()
+		require.NoError(t, err)
+		assert.Equal(t, "S256", location.Query().Get("code_challenge_method"))
+		assert.NotEmpty(t, location.Query().Get("code_challenge"))
+		assert.NotEmpty(t, location.Query().Get("state"))
+		assert.NotEmpty(t, location.Query().Get("nonce"))
+
+		// параметры входа хранятся в подписанной cookie, а не на сервере
+		cookies := resp.Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, stateCookie, cookies[0].Name)
+		assert.Equal(t, CallbackPath, cookies[0].Path)
+		assert.True(t, cookies[0].HttpOnly)
+		assert.Equal(t, http.SameSiteLaxMode, cookies[0].SameSite)
+	})
+
+	t.Run("Unknown state", func(t *testing.T) {
+		resp, err := client.Get(env.server.URL + CallbackPath + "?code=abc&state=unknown")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Replayed callback", func(t *testing.T) {
+		callbackURL := startLogin(t, client)
+
+		resp, err := client.Get(callbackURL.String())
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		// state одноразовый
+		resp, err = client.Get(callbackURL.String())
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Callback in another browser", func(t *testing.T) {
+		callbackURL := startLogin(t, client)
+
+		// у другого браузера нет cookie начатого входа
+		resp, err := newClient(t, false).Get(callbackURL.String())
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("State of another login", func(t *testing.T) {
+		first := startLogin(t, newClient(t, false))
+		second := startLogin(t, client)
+
+		// код и state первого входа с cookie второго
+		callbackURL := *second
+		callbackURL.RawQuery = first.RawQuery
+		resp, err := client.Get(callbackURL.String())
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Tampered cookie", func(t *testing.T) {
+		callbackURL := startLogin(t, client)
+
+		login := pendingLogin{State: callbackURL.Query().Get("state"), ExpiresAt: time.Now().Add(time.Minute).Unix()}
+		other, err := NewHandler(Config{}, nil, nil)
+		require.NoError(t, err)
+		value, err := other.encodeLogin(login)
+		require.NoError(t, err)
+
+		req, err := http.NewRequest(http.MethodGet, callbackURL.String(), nil)
+		require.NoError(t, err)
+		req.AddCookie(&http.Cookie{Name: stateCookie, Value: value})
+		resp, err := newClient(t, false).Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Provider error", func(t *testing.T) {
+		resp, err := client.Get(env.server.URL + CallbackPath + "?error=access_denied&state=x")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+}
+
+func TestHandler_VerifyIDToken(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	md, err := env.handler.provider(ctx)
+	require.NoError(t, err)
+
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   env.idp.Issuer(),
+			"aud":   "postery",
+			"sub":   "subject-1",
+			"nonce": "nonce",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+		}
+	}
+
+	t.Run("Valid token", func(t *testing.T) {
+		raw, err := env.idp.SignIDToken(validClaims())
+		require.NoError(t, err)
+
+		claims, err := env.handler.verifyIDToken(ctx, md, raw, "nonce")
+		require.NoError(t, err)
+		assert.Equal(t, "subject-1", claims.Subject)
+	})
+
+	tests := []struct {
+		name   string
+		modify func(jwt.MapClaims)
+	}{
+		{"Wrong nonce", func(c jwt.MapClaims) { c["nonce"] = "other" }},
+		{"Wrong audience", func(c jwt.MapClaims) { c["aud"] = "someone-else" }},
+		{"Wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{"Expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{"Missing exp", func(c jwt.MapClaims) { delete(c, "exp") }},
+		{"Missing subject", func(c jwt.MapClaims) { delete(c, "sub") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			tt.modify(claims)
+			raw, err := env.idp.SignIDToken(claims)
+			require.NoError(t, err)
+
+			_, err = env.handler.verifyIDToken(ctx, md, raw, "nonce")
+			assert.Error(t, err)
+		})
+	}
+
+	t.Run("HMAC signed token", func(t *testing.T) {
+		raw, err := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims()).SignedString([]byte(testSecret))
+		require.NoError(t, err)
+
+		_, err = env.handler.verifyIDToken(ctx, md, raw, "nonce")
+		assert.Error(t, err)
+	})
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("OIDC_ISSUER", "")
+	_, ok := ConfigFromEnv()
+	assert.False(t, ok)
+
+	t.Setenv("OIDC_ISSUER", "https://idp.example.com")
+	t.Setenv("OIDC_CLIENT_ID", "postery")
+	t.Setenv("OIDC_REDIRECT_URL", "http://localhost:8080/auth/oidc/callback")
+	t.Setenv("OIDC_SCOPES", "openid email")
+	t.Setenv("JWT_SECRET", "jwt-secret")
+	cfg, ok := ConfigFromEnv()
+	assert.True(t, ok)
+	assert.Equal(t, []string{"openid", "email"}, cfg.scopes())
+	assert.Equal(t, []byte("jwt-secret"), cfg.StateKey)
+
+	t.Setenv("OIDC_STATE_KEY", "state-key")
+	cfg, _ = ConfigFromEnv()
+	assert.Equal(t, []byte("state-key"), cfg.StateKey)
+}
+
+func TestHandler_DecodeLogin(t *testing.T) {
+	handler, err := NewHandler(Config{StateKey: []byte("key")}, nil, nil)
+	require.NoError(t, err)
+	now := time.Now()
+
+	value, err := handler.encodeLogin(pendingLogin{State: "state", Verifier: "verifier", Nonce: "nonce", ExpiresAt: now.Add(time.Minute).Unix()})
+	require.NoError(t, err)
+
+	login, err := handler.decodeLogin(value, now)
+	require.NoError(t, err)
+	assert.Equal(t, "verifier", login.Verifier)
+
+	_, err = handler.decodeLogin(value, now.Add(2*time.Minute))
+	assert.ErrorIs(t, err, errInvalidState)
+
+	_, err = handler.decodeLogin(value+"x", now)
+	assert.ErrorIs(t, err, errInvalidState)
+}
@@ -0,0 +1,61 @@
+package oidc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// stateCookie хранит параметры незавершенного входа в браузере пользователя, а не на сервере:
+// запросы к LoginPath не занимают память, и незавершенные входы не нужно ограничивать и чистить
+const stateCookie = "postery_oidc_login"
+
+var errInvalidState = errors.New("unknown or expired login state")
+
+// pendingLogin - незавершенный вход; подписывается ключом Handler, поэтому клиент не может его подменить
+type pendingLogin struct {
+	State     string `json:"state"`
+	Verifier  string `json:"verifier"`
+	Nonce     string `json:"nonce"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// encodeLogin кодирует вход в значение cookie: base64url(JSON) и подпись HMAC-SHA256 через точку
+func (h *Handler) encodeLogin(login pendingLogin) (string, error) {
+	data, err := json.Marshal(login)
+	if err != nil {
+		return "", fmt.Errorf("could not encode login state: %w", err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + h.sign(payload), nil
+}
+
+// decodeLogin проверяет подпись и срок действия значения cookie
+func (h *Handler) decodeLogin(value string, now time.Time) (pendingLogin, error) {
+	payload, signature, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(h.sign(payload))) {
+		return pendingLogin{}, errInvalidState
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return pendingLogin{}, errInvalidState
+	}
+	var login pendingLogin
+	err = json.Unmarshal(data, &login)
+	if err != nil || now.Unix() > login.ExpiresAt {
+		return pendingLogin{}, errInvalidState
+	}
+	return login, nil
+}
+
+func (h *Handler) sign(payload string) string {
+	mac := hmac.New(sha256.New, h.stateKey)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,195 @@
+// Package password - хэширование паролей (argon2id, проверка старых bcrypt хэшей) и политика паролей
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrMismatch - пароль не совпадает с хэшем
+var ErrMismatch = errors.New("password does not match")
+
+// Params - параметры argon2id
+type Params struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultParams - минимальные параметры argon2id, рекомендованные OWASP (19 MiB, 2 итерации)
+func DefaultParams() Params {
+	return Params{
+		Memory:      19 * 1024,
+		Iterations:  2,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+// ParamsFromEnv берет параметры по умолчанию и переопределяет их из PASSWORD_ARGON2_MEMORY (KiB),
+// PASSWORD_ARGON2_ITERATIONS и PASSWORD_ARGON2_PARALLELISM
+func ParamsFromEnv() (Params, error) {
+	p := DefaultParams()
+
+	for _, v := range []struct {
+		key  string
+		bits int
+		set  func(uint64)
+	}{
+		{"PASSWORD_ARGON2_MEMORY", 32, func(n uint64) { p.Memory = uint32(n) }},
+		{"PASSWORD_ARGON2_ITERATIONS", 32, func(n uint64) { p.Iterations = uint32(n) }},
+		{"PASSWORD_ARGON2_PARALLELISM", 8, func(n uint64) { p.Parallelism = uint8(n) }},
+	} {
+		raw := os.Getenv(v.key)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(raw, 10, v.bits)
+		if err != nil || n == 0 {
+			return Params{}, fmt.Errorf("invalid %s: %q", v.key, raw)
+		}
+		v.set(n)
+	}
+
+	return p, nil
+}
+
+// Hasher хэширует новые пароли argon2id и проверяет как argon2id, так и bcrypt хэши
+type Hasher struct {
+	params Params
+}
+
+func NewHasher(params Params) *Hasher {
+	return &Hasher{params: params}
+}
+
+var (
+	defaultMu     sync.Mutex
+	defaultHasher *Hasher
+)
+
+// Default возвращает общий Hasher, при первом вызове настроенный из переменных окружения
+// (при некорректных значениях используются параметры по умолчанию)
+func Default() *Hasher {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultHasher == nil {
+		params, err := ParamsFromEnv()
+		if err != nil {
+			params = DefaultParams()
+		}
+		defaultHasher = NewHasher(params)
+	}
+	return defaultHasher
+}
+
+// SetDefault заменяет общий Hasher (при старте сервера после проверки настроек)
+func SetDefault(h *Hasher) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultHasher = h
+}
+
+// Hash возвращает хэш в формате PHC: $argon2id$v=19$m=...,t=...,p=...$salt$key
+func (h *Hasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", fmt.Errorf("could not generate salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.params.Memory, h.params.Iterations, h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify проверяет пароль. needsRehash == true, если хэш подходит, но создан bcrypt
+// или с другими параметрами argon2id - тогда его стоит пересчитать методом Hash.
+func (h *Hasher) Verify(password, encoded string) (needsRehash bool, err error) {
+	if isBcrypt(encoded) {
+		err = bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if err != nil {
+			return false, ErrMismatch
+		}
+		return true, nil
+	}
+
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	actual := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(actual, key) != 1 {
+		return false, ErrMismatch
+	}
+
+	needsRehash = params.Memory != h.params.Memory ||
+		params.Iterations != h.params.Iterations ||
+		params.Parallelism != h.params.Parallelism ||
+		uint32(len(salt)) != h.params.SaltLength ||
+		uint32(len(key)) != h.params.KeyLength
+	return needsRehash, nil
+}
+
+// SimulateVerify тратит на проверку столько же времени, сколько Verify с текущими параметрами,
+// чтобы по времени ответа нельзя было отличить несуществующего пользователя
+func (h *Hasher) SimulateVerify(password string) {
+	salt := make([]byte, h.params.SaltLength)
+	argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+}
+
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func decodeArgon2id(encoded string) (Params, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Params{}, nil, nil, errors.New("unsupported password hash format")
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return Params{}, nil, nil, errors.New("unsupported argon2 version")
+	}
+
+	var p Params
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism)
+	if err != nil {
+		return Params{}, nil, nil, fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Params{}, nil, nil, fmt.Errorf("invalid argon2 salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Params{}, nil, nil, fmt.Errorf("invalid argon2 key: %w", err)
+	}
+
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+	return p, salt, key, nil
+}
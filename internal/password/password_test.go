@@ -0,0 +1,164 @@
+package password
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testParams - облегченные параметры, чтобы тесты шли быстро
+func testParams() Params {
+	return Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+}
+
+func TestHasher(t *testing.T) {
+	h := NewHasher(testParams())
+
+	t.Run("Hash and verify", func(t *testing.T) {
+		encoded, err := h.Hash("correct horse")
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+		needsRehash, err := h.Verify("correct horse", encoded)
+		require.NoError(t, err)
+		assert.False(t, needsRehash)
+
+		_, err = h.Verify("wrong horse", encoded)
+		assert.ErrorIs(t, err, ErrMismatch)
+	})
+
+	t.Run("Unique salt", func(t *testing.T) {
+		a, err := h.Hash("same password")
+		require.NoError(t, err)
+		b, err := h.Hash("same password")
+		require.NoError(t, err)
+		assert.NotEqual(t, a, b)
+	})
+
+	t.Run("Bcrypt hash verifies and needs rehash", func(t *testing.T) {
+		legacy, err := bcrypt.GenerateFromPassword([]byte("old password"), bcrypt.MinCost)
+		require.NoError(t, err)
+
+		needsRehash, err := h.Verify("old password", string(legacy))
+		require.NoError(t, err)
+		assert.True(t, needsRehash)
+
+		_, err = h.Verify("wrong", string(legacy))
+		assert.ErrorIs(t, err, ErrMismatch)
+	})
+
+	t.Run("Changed parameters need rehash", func(t *testing.T) {
+		encoded, err := h.Hash("correct horse")
+		require.NoError(t, err)
+
+		stronger := testParams()
+		stronger.Iterations = 2
+		needsRehash, err := NewHasher(stronger).Verify("correct horse", encoded)
+		require.NoError(t, err)
+		assert.True(t, needsRehash)
+	})
+
+	t.Run("Invalid hash", func(t *testing.T) {
+		_, err := h.Verify("anything", "")
+		assert.Error(t, err)
+		_, err = h.Verify("anything", "$argon2id$v=19$m=x$salt$key")
+		assert.Error(t, err)
+	})
+}
+
+func TestParamsFromEnv(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		params, err := ParamsFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, DefaultParams(), params)
+	})
+
+	t.Run("Overrides", func(t *testing.T) {
+		t.Setenv("PASSWORD_ARGON2_MEMORY", "65536")
+		t.Setenv("PASSWORD_ARGON2_ITERATIONS", "3")
+		t.Setenv("PASSWORD_ARGON2_PARALLELISM", "4")
+
+		params, err := ParamsFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, uint32(65536), params.Memory)
+		assert.Equal(t, uint32(3), params.Iterations)
+		assert.Equal(t, uint8(4), params.Parallelism)
+	})
+
+	t.Run("Invalid value", func(t *testing.T) {
+		t.Setenv("PASSWORD_ARGON2_PARALLELISM", "1000")
+		_, err := ParamsFromEnv()
+		assert.Error(t, err)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		wantErr  string
+	}{
+		{"Strong password", "s3cure-passw0rd", ""},
+		{"Too short", "abc123", "at least 8"},
+		{"Too long", strings.Repeat("a", MaxLength+1), "at most"},
+		{"Length in characters, not bytes", "пароль!!", ""},
+		{"Common password", "Password123", "too common"},
+		{"Same as username", "AliceSmith", "must not match"},
+		{"Same as email", "alice@example.com", "must not match"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.password, "alicesmith", "alice@example.com")
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrWeakPassword)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestLoadBlocklistFromEnv(t *testing.T) {
+	builtin := commonPasswords
+	t.Cleanup(func() { commonPasswords = builtin })
+
+	t.Run("Built-in list without variable", func(t *testing.T) {
+		t.Setenv("PASSWORD_BLOCKLIST_FILE", "")
+		n, err := LoadBlocklistFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, len(builtin), n)
+	})
+
+	t.Run("File replaces built-in list", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "blocklist.txt")
+		require.NoError(t, os.WriteFile(path, []byte("# top passwords\nCorrectHorse\n\ntr0ub4dor&3\n"), 0o600))
+		t.Setenv("PASSWORD_BLOCKLIST_FILE", path)
+
+		n, err := LoadBlocklistFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+
+		assert.ErrorIs(t, Validate("correcthorse", "", ""), ErrWeakPassword)
+		assert.ErrorIs(t, Validate("Tr0ub4dor&3", "", ""), ErrWeakPassword)
+		assert.NoError(t, Validate("Password123", "", ""))
+	})
+
+	t.Run("Missing or empty file", func(t *testing.T) {
+		t.Setenv("PASSWORD_BLOCKLIST_FILE", filepath.Join(t.TempDir(), "missing.txt"))
+		_, err := LoadBlocklistFromEnv()
+		assert.Error(t, err)
+
+		path := filepath.Join(t.TempDir(), "empty.txt")
+		require.NoError(t, os.WriteFile(path, []byte("# nothing\n"), 0o600))
+		t.Setenv("PASSWORD_BLOCKLIST_FILE", path)
+		_, err = LoadBlocklistFromEnv()
+		assert.Error(t, err)
+	})
+}
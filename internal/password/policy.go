@@ -0,0 +1,97 @@
+package password
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Ограничения длины пароля (в символах). Верхняя граница защищает от очень дорогого хэширования.
+const (
+	MinLength = 8
+	MaxLength = 128
+)
+
+// ErrWeakPassword - пароль не проходит политику; конкретная причина в тексте обернутой ошибки
+var ErrWeakPassword = errors.New("password does not meet the policy")
+
+// common_passwords.txt - небольшой встроенный список-заглушка на случай, когда PASSWORD_BLOCKLIST_FILE не задан;
+// в рабочей установке стоит подключить полный список (например, 10 тысяч самых распространенных паролей)
+//
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+var (
+	blocklistMu     sync.RWMutex
+	commonPasswords = parseBlocklist(commonPasswordsFile)
+)
+
+func parseBlocklist(data string) map[string]struct{} {
+	list := make(map[string]struct{})
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		list[strings.ToLower(line)] = struct{}{}
+	}
+	return list
+}
+
+// LoadBlocklistFromEnv заменяет встроенный список распространенных паролей файлом из PASSWORD_BLOCKLIST_FILE:
+// по паролю в строке, строки с # - комментарии. Без переменной остается встроенный список. Возвращает число
+// паролей в действующем списке.
+func LoadBlocklistFromEnv() (int, error) {
+	path := os.Getenv("PASSWORD_BLOCKLIST_FILE")
+	if path == "" {
+		blocklistMu.RLock()
+		defer blocklistMu.RUnlock()
+		return len(commonPasswords), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("could not read password blocklist: %w", err)
+	}
+	list := parseBlocklist(string(data))
+	if len(list) == 0 {
+		return 0, fmt.Errorf("password blocklist %s is empty", path)
+	}
+
+	blocklistMu.Lock()
+	defer blocklistMu.Unlock()
+	commonPasswords = list
+	return len(list), nil
+}
+
+func isCommon(lower string) bool {
+	blocklistMu.RLock()
+	defer blocklistMu.RUnlock()
+	_, common := commonPasswords[lower]
+	return common
+}
+
+// Validate проверяет новый пароль: длину, список распространенных паролей и совпадение с именем или email
+func Validate(password, username, email string) error {
+	length := utf8.RuneCountInString(password)
+	if length < MinLength {
+		return fmt.Errorf("%w: must be at least %d characters", ErrWeakPassword, MinLength)
+	}
+	if length > MaxLength {
+		return fmt.Errorf("%w: must be at most %d characters", ErrWeakPassword, MaxLength)
+	}
+
+	lower := strings.ToLower(password)
+	if isCommon(lower) {
+		return fmt.Errorf("%w: password is too common", ErrWeakPassword)
+	}
+	if (username != "" && lower == strings.ToLower(username)) || (email != "" && lower == strings.ToLower(email)) {
+		return fmt.Errorf("%w: must not match username or email", ErrWeakPassword)
+	}
+
+	return nil
+}
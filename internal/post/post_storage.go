@@ -10,7 +10,13 @@ type PostStorage interface {
 	CreatePost(ctx context.Context, title, content string) (*model.Post, error)
 	GetPostById(id string) (*model.Post, error)
 	GetAllPosts() ([]*model.Post, error)
+	GetPostsByAuthor(authorID string) ([]*model.Post, error)
+	// GetPostsByAuthors возвращает не больше limit постов указанных авторов, начиная с самых новых;
+	// если задан beforeID, только посты, созданные раньше него (курсор для пагинации ленты)
+	GetPostsByAuthors(authorIDs []string, beforeID string, limit int) ([]*model.Post, error)
 	DisableComment(ctx context.Context, id string) error
 	EnableComment(ctx context.Context, id string) error
 	DeletePostById(ctx context.Context, id string) error
+	DeletePostsByAuthor(authorID string) error
+	AnonymizePostsByAuthor(authorID string) error
 }
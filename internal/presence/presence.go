@@ -0,0 +1,402 @@
+// Package presence - эфемерное присутствие на странице поста: сколько человек смотрит пост, кто из них вошел
+// и кто пишет ответ. Ничего не сохраняется: каждый экземпляр сервера периодически публикует через subscription.Manager
+// один heartbeat на пост со всеми своими зрителями, собирает состояние из событий других экземпляров и забывает
+// экземпляры, у которых истек TTL. Поэтому присутствие работает с любым менеджером подписок, в том числе
+// распределенным, а число событий растет с числом экземпляров, а не зрителей.
+package presence
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/VitaminP8/postery/internal/subscription"
+)
+
+const (
+	// DefaultViewerTTL - через сколько зрители экземпляра без heartbeat считаются ушедшими (упавший сервер)
+	DefaultViewerTTL = 30 * time.Second
+	// DefaultTypingTTL - сколько показывается индикатор набора после последнего SetTyping
+	DefaultTypingTTL = 6 * time.Second
+
+	// announceDelay - экземпляр публикует изменение своих зрителей и отвечает на EventViewerJoined с задержкой,
+	// чтобы одним событием сообщить о нескольких пришедших и ушедших зрителях и ответить нескольким экземплярам
+	announceDelay = 200 * time.Millisecond
+)
+
+// Typist - пользователь, который пишет комментарий к посту (ParentID пуст) или ответ на комментарий ParentID
+type Typist struct {
+	UserID   string
+	ParentID string
+}
+
+// Snapshot - присутствие на посте в момент последнего изменения
+type Snapshot struct {
+	PostID string
+	// ViewerCount - все зрители, включая анонимных; каждая вкладка считается отдельно
+	ViewerCount int
+	// UserIDs - вошедшие зрители без повторов
+	UserIDs []string
+	Typing  []Typist
+}
+
+// Tracker публикует присутствие своих зрителей и собирает присутствие всех экземпляров.
+// ViewerTTL и TypingTTL задаются до первого вызова Watch.
+type Tracker struct {
+	m subscription.Manager
+
+	// ViewerTTL - срок записи экземпляра; heartbeat отправляется каждую треть срока
+	ViewerTTL time.Duration
+	// TypingTTL - срок индикатора набора
+	TypingTTL time.Duration
+
+	mu    sync.Mutex
+	posts map[string]*post // посты, у которых есть зрители на этом экземпляре
+}
+
+func NewTracker(m subscription.Manager) *Tracker {
+	return &Tracker{
+		m:         m,
+		ViewerTTL: DefaultViewerTTL,
+		TypingTTL: DefaultTypingTTL,
+		posts:     make(map[string]*post),
+	}
+}
+
+// post - присутствие на посте, за которым следят зрители этого экземпляра. Одна горутина (run) на пост
+// слушает PresenceTopic, отправляет heartbeat и раздает снимки всем локальным зрителям.
+type post struct {
+	id       string
+	instance string // InstanceID в событиях; новый при каждом начале наблюдения за постом
+	topic    string
+	cancel   context.CancelFunc
+	changed  chan struct{} // локальные зрители изменились, нужно опубликовать их
+
+	mu       sync.Mutex
+	st       *state
+	viewers  map[string]string        // локальные зрители: ID пользователя по ID зрителя
+	watchers map[string]chan Snapshot // каналы локальных зрителей по ID зрителя
+}
+
+// Watch регистрирует зрителя поста (userID пуст у анонимного) и возвращает канал снимков присутствия: первый
+// приходит сразу, следующие - при каждом изменении. Медленный читатель получает только последний снимок.
+// Когда ctx отменяется, канал закрывается, а другие экземпляры узнают об уходе зрителя без ожидания TTL.
+func (t *Tracker) Watch(ctx context.Context, postID, userID string) <-chan Snapshot {
+	viewerID := newID()
+	out := make(chan Snapshot, 1)
+
+	t.mu.Lock()
+	p, watched := t.posts[postID]
+	var run func()
+	if !watched {
+		p, run = t.newPost(postID)
+		t.posts[postID] = p
+	}
+
+	p.mu.Lock()
+	p.viewers[viewerID] = userID
+	p.watchers[viewerID] = out
+	p.st.setInstance(p.instance, p.viewers, time.Now())
+	out <- p.st.snapshot()
+	p.broadcast(viewerID)
+	p.mu.Unlock()
+	t.mu.Unlock()
+
+	if watched {
+		p.notifyChanged()
+	} else {
+		// EventViewerJoined уже включит этого зрителя
+		go run()
+	}
+
+	go func() {
+		<-ctx.Done()
+		t.unwatch(p, viewerID)
+	}()
+	return out
+}
+
+// unwatch удаляет зрителя; с последним зрителем экземпляр перестает следить за постом
+func (t *Tracker) unwatch(p *post, viewerID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	close(p.watchers[viewerID])
+	delete(p.watchers, viewerID)
+	delete(p.viewers, viewerID)
+
+	if len(p.viewers) == 0 {
+		delete(t.posts, p.id)
+		p.cancel()
+		return
+	}
+	p.st.setInstance(p.instance, p.viewers, time.Now())
+	p.broadcast("")
+	p.notifyChanged()
+}
+
+// newPost подписывается на PresenceTopic и возвращает пост с функцией, которая следит за ним до отмены
+func (t *Tracker) newPost(postID string) (*post, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &post{
+		id:       postID,
+		instance: newID(),
+		topic:    subscription.PresenceTopic(postID),
+		cancel:   cancel,
+		changed:  make(chan struct{}, 1),
+		st:       newState(postID, t.ViewerTTL, t.TypingTTL),
+		viewers:  make(map[string]string),
+		watchers: make(map[string]chan Snapshot),
+	}
+	// подписываемся до EventViewerJoined, чтобы не пропустить ответы других экземпляров
+	events := subscription.ListenEvents(ctx, t.m, p.topic,
+		subscription.EventViewerJoined, subscription.EventViewerSeen, subscription.EventViewerLeft, subscription.EventTyping)
+	return p, func() { t.run(ctx, p, events) }
+}
+
+func (t *Tracker) run(ctx context.Context, p *post, events <-chan subscription.Event) {
+	t.publish(p, subscription.EventViewerJoined)
+	defer t.m.Publish(p.topic, subscription.Event{
+		Type:    subscription.EventViewerLeft,
+		Payload: &subscription.Presence{PostID: p.id, InstanceID: p.instance},
+	})
+
+	heartbeat := time.NewTicker(t.ViewerTTL / 3)
+	defer heartbeat.Stop()
+	sweep := time.NewTicker(sweepInterval(t.ViewerTTL, t.TypingTTL))
+	defer sweep.Stop()
+
+	// announce - таймер публикации своих зрителей; nil, пока публиковать нечего
+	var announce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			p.mu.Lock()
+			if p.st.apply(event, p.instance, time.Now()) {
+				p.broadcast("")
+			}
+			p.mu.Unlock()
+			if presence, ok := event.Payload.(*subscription.Presence); ok && event.Type == subscription.EventViewerJoined &&
+				presence.InstanceID != p.instance && announce == nil {
+				announce = time.After(announceDelay)
+			}
+		case <-p.changed:
+			if announce == nil {
+				announce = time.After(announceDelay)
+			}
+		case <-announce:
+			announce = nil
+			t.publish(p, subscription.EventViewerSeen)
+		case <-heartbeat.C:
+			t.publish(p, subscription.EventViewerSeen)
+		case <-sweep.C:
+			p.mu.Lock()
+			if p.st.expire(time.Now()) {
+				p.broadcast("")
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+// publish отправляет другим экземплярам текущих локальных зрителей поста; своя запись продлевается без обхода
+// через менеджер
+func (t *Tracker) publish(p *post, eventType subscription.EventType) {
+	p.mu.Lock()
+	viewers := make(map[string]string, len(p.viewers))
+	for id, userID := range p.viewers {
+		viewers[id] = userID
+	}
+	p.st.setInstance(p.instance, viewers, time.Now())
+	p.mu.Unlock()
+
+	t.m.Publish(p.topic, subscription.Event{
+		Type:    eventType,
+		Payload: &subscription.Presence{PostID: p.id, InstanceID: p.instance, Viewers: viewers},
+	})
+}
+
+// notifyChanged просит run опубликовать изменившихся локальных зрителей
+func (p *post) notifyChanged() {
+	select {
+	case p.changed <- struct{}{}:
+	default:
+	}
+}
+
+// broadcast отправляет текущий снимок всем локальным зрителям, кроме skip; вызывается под p.mu
+func (p *post) broadcast(skip string) {
+	snapshot := p.st.snapshot()
+	for id, out := range p.watchers {
+		if id != skip {
+			sendLatest(out, snapshot)
+		}
+	}
+}
+
+// SetTyping сообщает зрителям поста, что userID пишет комментарий или ответ на parentID
+func (t *Tracker) SetTyping(postID, parentID, userID string) {
+	t.m.Publish(subscription.PresenceTopic(postID), subscription.Event{
+		Type:    subscription.EventTyping,
+		Payload: &subscription.Typing{PostID: postID, ParentID: parentID, UserID: userID},
+	})
+}
+
+// sendLatest заменяет непрочитанный снимок новым; в канал пишут только под мьютексом поста
+func sendLatest(out chan Snapshot, s Snapshot) {
+	select {
+	case out <- s:
+		return
+	default:
+	}
+	select {
+	case <-out:
+	default:
+	}
+	out <- s
+}
+
+func sweepInterval(viewerTTL, typingTTL time.Duration) time.Duration {
+	interval := viewerTTL
+	if typingTTL < interval {
+		interval = typingTTL
+	}
+	return interval / 4
+}
+
+func newID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// instance - зрители поста на одном экземпляре сервера
+type instance struct {
+	viewers   map[string]string // ID пользователя по ID зрителя
+	expiresAt time.Time
+}
+
+// state - присутствие на посте с точки зрения одного экземпляра
+type state struct {
+	postID    string
+	viewerTTL time.Duration
+	typingTTL time.Duration
+
+	instances map[string]instance  // по InstanceID
+	typing    map[Typist]time.Time // срок действия индикатора
+}
+
+func newState(postID string, viewerTTL, typingTTL time.Duration) *state {
+	return &state{
+		postID:    postID,
+		viewerTTL: viewerTTL,
+		typingTTL: typingTTL,
+		instances: make(map[string]instance),
+		typing:    make(map[Typist]time.Time),
+	}
+}
+
+// setInstance заменяет зрителей экземпляра; true - изменился их состав
+func (s *state) setInstance(instanceID string, viewers map[string]string, now time.Time) bool {
+	previous, known := s.instances[instanceID]
+	copied := make(map[string]string, len(viewers))
+	for id, userID := range viewers {
+		copied[id] = userID
+	}
+	s.instances[instanceID] = instance{viewers: copied, expiresAt: now.Add(s.viewerTTL)}
+	return !known || !sameViewers(previous.viewers, copied)
+}
+
+// apply учитывает событие другого экземпляра (события self - свой же heartbeat - пропускаются:
+// свои зрители известны точнее); true - изменился состав зрителей или пишущих
+func (s *state) apply(event subscription.Event, self string, now time.Time) bool {
+	switch payload := event.Payload.(type) {
+	case *subscription.Presence:
+		if payload.PostID != s.postID || payload.InstanceID == self {
+			return false
+		}
+		if event.Type == subscription.EventViewerLeft || len(payload.Viewers) == 0 {
+			previous, known := s.instances[payload.InstanceID]
+			delete(s.instances, payload.InstanceID)
+			return known && len(previous.viewers) > 0
+		}
+		return s.setInstance(payload.InstanceID, payload.Viewers, now)
+	case *subscription.Typing:
+		if payload.PostID != s.postID {
+			return false
+		}
+		key := Typist{UserID: payload.UserID, ParentID: payload.ParentID}
+		_, known := s.typing[key]
+		s.typing[key] = now.Add(s.typingTTL)
+		return !known
+	}
+	return false
+}
+
+// expire удаляет записи с истекшим сроком; true - что-то удалено
+func (s *state) expire(now time.Time) bool {
+	changed := false
+	for id, inst := range s.instances {
+		if now.After(inst.expiresAt) {
+			delete(s.instances, id)
+			changed = true
+		}
+	}
+	for key, expiresAt := range s.typing {
+		if now.After(expiresAt) {
+			delete(s.typing, key)
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (s *state) snapshot() Snapshot {
+	snapshot := Snapshot{PostID: s.postID, UserIDs: []string{}, Typing: []Typist{}}
+
+	seen := make(map[string]bool)
+	for _, inst := range s.instances {
+		snapshot.ViewerCount += len(inst.viewers)
+		for _, userID := range inst.viewers {
+			if userID != "" && !seen[userID] {
+				seen[userID] = true
+				snapshot.UserIDs = append(snapshot.UserIDs, userID)
+			}
+		}
+	}
+	sort.Strings(snapshot.UserIDs)
+
+	for key := range s.typing {
+		snapshot.Typing = append(snapshot.Typing, key)
+	}
+	sort.Slice(snapshot.Typing, func(i, j int) bool {
+		a, b := snapshot.Typing[i], snapshot.Typing[j]
+		if a.UserID != b.UserID {
+			return a.UserID < b.UserID
+		}
+		return a.ParentID < b.ParentID
+	})
+	return snapshot
+}
+
+func sameViewers(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for id, userID := range a {
+		if other, ok := b[id]; !ok || other != userID {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,274 @@
+package presence
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/VitaminP8/postery/internal/subscription"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTracker() (*Tracker, *subscription.SubscriptionManager) {
+	manager := subscription.NewSubscriptionManager()
+	tracker := NewTracker(manager)
+	tracker.ViewerTTL = 300 * time.Millisecond
+	tracker.TypingTTL = 200 * time.Millisecond
+	return tracker, manager
+}
+
+// waitSnapshot читает снимки, пока очередной не удовлетворит условию
+func waitSnapshot(t *testing.T, ch <-chan Snapshot, cond func(Snapshot) bool) Snapshot {
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case s, ok := <-ch:
+			require.True(t, ok, "Snapshot channel closed")
+			if cond(s) {
+				return s
+			}
+		case <-timeout:
+			t.Fatal("Timed out waiting for snapshot")
+			return Snapshot{}
+		}
+	}
+}
+
+func viewers(n int) func(Snapshot) bool {
+	return func(s Snapshot) bool { return s.ViewerCount == n }
+}
+
+func TestTracker_Watch(t *testing.T) {
+	t.Run("First snapshot includes the viewer", func(t *testing.T) {
+		tracker, _ := newTestTracker()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		s := <-tracker.Watch(ctx, "1", "7")
+		assert.Equal(t, "1", s.PostID)
+		assert.Equal(t, 1, s.ViewerCount)
+		assert.Equal(t, []string{"7"}, s.UserIDs)
+		assert.Empty(t, s.Typing)
+	})
+
+	t.Run("Viewers see each other", func(t *testing.T) {
+		tracker, _ := newTestTracker()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		first := tracker.Watch(ctx, "1", "7")
+		second := tracker.Watch(ctx, "1", "")
+		anonymous := tracker.Watch(ctx, "1", "")
+
+		s := waitSnapshot(t, first, viewers(3))
+		assert.Equal(t, []string{"7"}, s.UserIDs)
+		// зрители одного экземпляра известны новому зрителю сразу
+		s = <-anonymous
+		assert.Equal(t, 3, s.ViewerCount)
+		assert.Equal(t, []string{"7"}, s.UserIDs)
+		waitSnapshot(t, second, viewers(3))
+	})
+
+	t.Run("Tabs of one user are listed once", func(t *testing.T) {
+		tracker, _ := newTestTracker()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		first := tracker.Watch(ctx, "1", "7")
+		tracker.Watch(ctx, "1", "7")
+
+		s := waitSnapshot(t, first, viewers(2))
+		assert.Equal(t, []string{"7"}, s.UserIDs)
+	})
+
+	t.Run("Leaving viewer is removed immediately", func(t *testing.T) {
+		tracker, _ := newTestTracker()
+		tracker.ViewerTTL = time.Hour
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		first := tracker.Watch(ctx, "1", "7")
+		leaveCtx, leave := context.WithCancel(context.Background())
+		tracker.Watch(leaveCtx, "1", "8")
+		waitSnapshot(t, first, viewers(2))
+
+		leave()
+		s := waitSnapshot(t, first, viewers(1))
+		assert.Equal(t, []string{"7"}, s.UserIDs)
+	})
+
+	t.Run("Silent viewer expires", func(t *testing.T) {
+		tracker, manager := newTestTracker()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ch := tracker.Watch(ctx, "1", "7")
+		<-ch
+		// экземпляр, который перестал присылать heartbeat
+		manager.Publish(subscription.PresenceTopic("1"), subscription.Event{
+			Type:    subscription.EventViewerSeen,
+			Payload: &subscription.Presence{PostID: "1", InstanceID: "gone", Viewers: map[string]string{"v1": "9"}},
+		})
+
+		s := waitSnapshot(t, ch, viewers(2))
+		assert.Equal(t, []string{"7", "9"}, s.UserIDs)
+		s = waitSnapshot(t, ch, viewers(1))
+		assert.Equal(t, []string{"7"}, s.UserIDs)
+	})
+
+	t.Run("Heartbeat keeps viewer alive", func(t *testing.T) {
+		tracker, _ := newTestTracker()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		first := tracker.Watch(ctx, "1", "7")
+		tracker.Watch(ctx, "1", "8")
+		waitSnapshot(t, first, viewers(2))
+
+		deadline := time.After(3 * tracker.ViewerTTL)
+		for {
+			select {
+			case s := <-first:
+				assert.Equal(t, 2, s.ViewerCount)
+			case <-deadline:
+				return
+			}
+		}
+	})
+
+	t.Run("Channel closes on cancel", func(t *testing.T) {
+		tracker, _ := newTestTracker()
+		ctx, cancel := context.WithCancel(context.Background())
+
+		ch := tracker.Watch(ctx, "1", "7")
+		<-ch
+		cancel()
+
+		select {
+		case _, ok := <-ch:
+			assert.False(t, ok)
+		case <-time.After(time.Second):
+			t.Fatal("Channel was not closed")
+		}
+	})
+}
+
+func TestTracker_Instances(t *testing.T) {
+	// два экземпляра сервера с общим менеджером подписок
+	newInstances := func() (*Tracker, *Tracker, *subscription.SubscriptionManager) {
+		first, manager := newTestTracker()
+		second := NewTracker(manager)
+		second.ViewerTTL = first.ViewerTTL
+		second.TypingTTL = first.TypingTTL
+		return first, second, manager
+	}
+
+	t.Run("Viewers of another instance are shown without waiting for heartbeat", func(t *testing.T) {
+		first, second, _ := newInstances()
+		first.ViewerTTL, second.ViewerTTL = time.Hour, time.Hour
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		a := first.Watch(ctx, "1", "7")
+		<-a
+		// второй экземпляр узнает о зрителях первого из ответа на EventViewerJoined
+		b := second.Watch(ctx, "1", "8")
+		s := waitSnapshot(t, b, viewers(2))
+		assert.Equal(t, []string{"7", "8"}, s.UserIDs)
+		waitSnapshot(t, a, viewers(2))
+
+		second.Watch(ctx, "1", "")
+		s = waitSnapshot(t, a, viewers(3))
+		assert.Equal(t, []string{"7", "8"}, s.UserIDs)
+	})
+
+	t.Run("Last viewer leaving removes the instance immediately", func(t *testing.T) {
+		first, second, _ := newInstances()
+		first.ViewerTTL, second.ViewerTTL = time.Hour, time.Hour
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		a := first.Watch(ctx, "1", "7")
+		leaveCtx, leave := context.WithCancel(context.Background())
+		second.Watch(leaveCtx, "1", "8")
+		second.Watch(leaveCtx, "1", "9")
+		waitSnapshot(t, a, viewers(3))
+
+		leave()
+		s := waitSnapshot(t, a, viewers(1))
+		assert.Equal(t, []string{"7"}, s.UserIDs)
+	})
+
+	t.Run("One heartbeat per instance regardless of viewers", func(t *testing.T) {
+		first, second, manager := newInstances()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		const perInstance = 5
+		a := first.Watch(ctx, "1", "")
+		for i := 1; i < perInstance; i++ {
+			first.Watch(ctx, "1", "")
+		}
+		for i := 0; i < perInstance; i++ {
+			second.Watch(ctx, "1", "")
+		}
+		waitSnapshot(t, a, viewers(2*perInstance))
+
+		events, unsubscribe := manager.Subscribe(subscription.PresenceTopic("1"))
+		defer unsubscribe()
+
+		// за окно каждый экземпляр отправляет heartbeat раз в треть ViewerTTL со всеми своими зрителями;
+		// heartbeat каждого зрителя дал бы в perInstance раз больше событий
+		window := 3 * first.ViewerTTL
+		deadline := time.After(window)
+		counts := make(map[string]int)
+		for done := false; !done; {
+			select {
+			case event := <-events:
+				presence, ok := event.Payload.(*subscription.Presence)
+				require.True(t, ok)
+				assert.Len(t, presence.Viewers, perInstance)
+				counts[presence.InstanceID]++
+			case <-deadline:
+				done = true
+			}
+		}
+
+		require.Len(t, counts, 2)
+		maxPerInstance := int(window/(first.ViewerTTL/3)) + 1
+		for _, count := range counts {
+			assert.LessOrEqual(t, count, maxPerInstance)
+		}
+	})
+}
+
+func TestTracker_SetTyping(t *testing.T) {
+	t.Run("Typing indicator is shown and expires", func(t *testing.T) {
+		tracker, _ := newTestTracker()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ch := tracker.Watch(ctx, "1", "7")
+		<-ch
+		tracker.SetTyping("1", "5", "8")
+
+		s := waitSnapshot(t, ch, func(s Snapshot) bool { return len(s.Typing) == 1 })
+		assert.Equal(t, Typist{UserID: "8", ParentID: "5"}, s.Typing[0])
+		waitSnapshot(t, ch, func(s Snapshot) bool { return len(s.Typing) == 0 })
+	})
+
+	t.Run("Typing on another post is ignored", func(t *testing.T) {
+		tracker, _ := newTestTracker()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ch := tracker.Watch(ctx, "1", "7")
+		<-ch
+		tracker.SetTyping("2", "", "8")
+		tracker.SetTyping("1", "", "9")
+
+		s := waitSnapshot(t, ch, func(s Snapshot) bool { return len(s.Typing) > 0 })
+		assert.Equal(t, []Typist{{UserID: "9"}}, s.Typing)
+	})
+}
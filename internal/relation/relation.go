@@ -0,0 +1,33 @@
+// Package relation - отношения между пользователями (блокировка, скрытие)
+package relation
+
+import "errors"
+
+// Kind - вид отношения пользователя к другому пользователю
+type Kind string
+
+const (
+	// KindBlock - заблокированный пользователь не может отвечать на посты и комментарии заблокировавшего
+	KindBlock Kind = "block"
+	// KindMute - посты и комментарии скрытого пользователя не показываются скрывшему
+	KindMute Kind = "mute"
+	// KindFollow - посты автора попадают в ленту подписчика (homeFeed)
+	KindFollow Kind = "follow"
+)
+
+// ErrBlocked - пользователь заблокирован: отвечать на его посты и комментарии и подписываться на него нельзя
+var ErrBlocked = errors.New("this user has blocked you")
+
+// RelationStorage хранит направленные отношения userID -> targetID
+type RelationStorage interface {
+	// AddRelation идемпотентна: повторное добавление не считается ошибкой
+	AddRelation(userID, targetID string, kind Kind) error
+	RemoveRelation(userID, targetID string, kind Kind) error
+	HasRelation(userID, targetID string, kind Kind) (bool, error)
+	// GetTargets возвращает ID пользователей, к которым у userID есть отношение kind
+	GetTargets(userID string, kind Kind) ([]string, error)
+	// GetSources возвращает ID пользователей, у которых есть отношение kind к targetID
+	GetSources(targetID string, kind Kind) ([]string, error)
+	// DeleteRelationsOf удаляет все отношения пользователя в обе стороны (при удалении аккаунта)
+	DeleteRelationsOf(userID string) error
+}
@@ -0,0 +1,114 @@
+package memory
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VitaminP8/postery/internal/auth"
+)
+
+type AccessTokenMemoryStorage struct {
+	mu     sync.Mutex
+	tokens map[string]*auth.AccessToken // id -> токен
+	hashes map[string]string            // хэш -> id
+	nextId int
+}
+
+func NewAccessTokenMemoryStorage() *AccessTokenMemoryStorage {
+	return &AccessTokenMemoryStorage{
+		tokens: make(map[string]*auth.AccessToken),
+		hashes: make(map[string]string),
+		nextId: 1,
+	}
+}
+
+func (s *AccessTokenMemoryStorage) CreateAccessToken(token *auth.AccessToken, hash string) (*auth.AccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *token
+	stored.ID = strconv.Itoa(s.nextId)
+	stored.CreatedAt = time.Now()
+	s.nextId++
+
+	s.tokens[stored.ID] = &stored
+	s.hashes[hash] = stored.ID
+
+	result := stored
+	return &result, nil
+}
+
+func (s *AccessTokenMemoryStorage) GetAccessTokens(userID uint) ([]*auth.AccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := []*auth.AccessToken{}
+	for _, token := range s.tokens {
+		if token.UserID == userID {
+			copied := *token
+			tokens = append(tokens, &copied)
+		}
+	}
+
+	// порядок создания
+	sort.Slice(tokens, func(i, j int) bool {
+		a, _ := strconv.Atoi(tokens[i].ID)
+		b, _ := strconv.Atoi(tokens[j].ID)
+		return a < b
+	})
+
+	return tokens, nil
+}
+
+func (s *AccessTokenMemoryStorage) RevokeAccessToken(userID uint, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[id]
+	if !ok || token.UserID != userID {
+		return auth.ErrAccessTokenNotFound
+	}
+
+	delete(s.tokens, id)
+	for hash, tokenID := range s.hashes {
+		if tokenID == id {
+			delete(s.hashes, hash)
+		}
+	}
+	return nil
+}
+
+func (s *AccessTokenMemoryStorage) DeleteUserAccessTokens(userID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, token := range s.tokens {
+		if token.UserID == userID {
+			delete(s.tokens, id)
+		}
+	}
+	for hash, id := range s.hashes {
+		if _, ok := s.tokens[id]; !ok {
+			delete(s.hashes, hash)
+		}
+	}
+	return nil
+}
+
+func (s *AccessTokenMemoryStorage) UseAccessToken(hash string, now time.Time) (*auth.AccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, ok := s.hashes[hash]
+	if !ok {
+		return nil, auth.ErrAccessTokenNotFound
+	}
+
+	token := s.tokens[id]
+	token.LastUsedAt = &now
+
+	copied := *token
+	return &copied, nil
+}
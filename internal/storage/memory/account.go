@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"fmt"
+
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/comment"
+	"github.com/VitaminP8/postery/internal/mention"
+	"github.com/VitaminP8/postery/internal/post"
+	"github.com/VitaminP8/postery/internal/relation"
+	"github.com/VitaminP8/postery/internal/user"
+	"github.com/VitaminP8/postery/internal/webhook"
+)
+
+// AccountMemoryStorage удаляет аккаунт из хранилищ по очереди: общей транзакции у хранилищ в памяти нет.
+// Сначала удаляются сессии и токены, чтобы при ошибке на середине аккаунтом уже нельзя было воспользоваться.
+// Users, Posts и Comments обязательны, хранилища с nil пропускаются.
+type AccountMemoryStorage struct {
+	Users        user.UserStorage
+	Posts        post.PostStorage
+	Comments     comment.CommentStorage
+	Relations    relation.RelationStorage
+	Mentions     mention.MentionStorage
+	Webhooks     webhook.WebhookStorage
+	Sessions     auth.SessionStorage
+	AccessTokens auth.AccessTokenStorage
+}
+
+func (s *AccountMemoryStorage) DeleteAccount(userID uint, anonymize bool) error {
+	id := fmt.Sprint(userID)
+
+	if s.Sessions != nil {
+		err := s.Sessions.DeleteUserSessions(userID)
+		if err != nil {
+			return err
+		}
+	}
+	if s.AccessTokens != nil {
+		err := s.AccessTokens.DeleteUserAccessTokens(userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if anonymize {
+		err = s.Comments.AnonymizeCommentsByAuthor(id)
+		if err == nil {
+			err = s.Posts.AnonymizePostsByAuthor(id)
+		}
+	} else {
+		err = s.Comments.DeleteCommentsByAuthor(id)
+		if err == nil {
+			err = s.Posts.DeletePostsByAuthor(id)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	err = s.Users.DeleteUser(id)
+	if err != nil {
+		return err
+	}
+	if s.Relations != nil {
+		err = s.Relations.DeleteRelationsOf(id)
+		if err != nil {
+			return err
+		}
+	}
+	if s.Mentions != nil {
+		err = s.Mentions.DeleteMentionsOf(id)
+		if err != nil {
+			return err
+		}
+	}
+	if s.Webhooks != nil {
+		err = s.Webhooks.DeleteWebhooksByOwner(id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/relation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountMemoryStorage_DeleteAccount(t *testing.T) {
+	users := NewUserMemoryStorage()
+	posts := NewPostMemoryStorage(nil)
+	sessions := NewSessionMemoryStorage()
+	tokens := NewAccessTokenMemoryStorage()
+	relations := NewRelationMemoryStorage()
+	storage := &AccountMemoryStorage{
+		Users:        users,
+		Posts:        posts,
+		Comments:     NewCommentMemoryStorage(posts, nil),
+		Relations:    relations,
+		Sessions:     sessions,
+		AccessTokens: tokens,
+	}
+
+	owner, err := users.RegisterUser("owner", "owner@example.com", "s3cure-passw0rd")
+	require.NoError(t, err)
+	_, err = users.RegisterUser("other", "other@example.com", "s3cure-passw0rd")
+	require.NoError(t, err)
+
+	post, err := posts.CreatePost(auth.WithUserID(context.Background(), 1), "Title", "Content")
+	require.NoError(t, err)
+	require.NoError(t, sessions.CreateSession(&auth.Session{ID: "owner", UserID: 1, CreatedAt: time.Now()}))
+	require.NoError(t, sessions.CreateSession(&auth.Session{ID: "other", UserID: 2, CreatedAt: time.Now()}))
+	_, err = tokens.CreateAccessToken(&auth.AccessToken{UserID: 1, Name: "ci"}, "hash")
+	require.NoError(t, err)
+	require.NoError(t, relations.AddRelation("2", "1", relation.KindFollow))
+
+	require.NoError(t, storage.DeleteAccount(1, false))
+
+	_, err = users.GetUserByID(owner.ID)
+	assert.Error(t, err)
+	_, err = posts.GetPostById(post.ID)
+	assert.Error(t, err)
+
+	own, err := sessions.GetSessions(1)
+	require.NoError(t, err)
+	assert.Empty(t, own)
+	others, err := sessions.GetSessions(2)
+	require.NoError(t, err)
+	assert.Len(t, others, 1)
+
+	_, err = tokens.UseAccessToken("hash", time.Now())
+	assert.ErrorIs(t, err, auth.ErrAccessTokenNotFound)
+
+	following, err := relations.GetTargets("2", relation.KindFollow)
+	require.NoError(t, err)
+	assert.Empty(t, following)
+}
@@ -10,8 +10,10 @@ import (
 
 	"github.com/VitaminP8/postery/graph/model"
 	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/comment"
 	"github.com/VitaminP8/postery/internal/post"
 	"github.com/VitaminP8/postery/internal/subscription"
+	"github.com/VitaminP8/postery/internal/user"
 )
 
 type CommentMemoryStorage struct {
@@ -38,19 +40,37 @@ func (s *CommentMemoryStorage) CreateComment(ctx context.Context, postID, parent
 
 	userID, err := auth.GetUserIDFromContext(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("unautorized: %w", err)
+		return nil, err
 	}
 
+	comment, ancestors, err := s.addComment(postID, parentID, content, fmt.Sprint(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	// публикуем без s.mu, чтобы раздача событий не держала хранилище; подписчики получают копию -
+	// хранимый комментарий дальше меняется под мьютексом (HasReplies, Children)
+	if s.manager != nil {
+		published := *comment
+		published.Children = []*model.Comment{}
+		subscription.PublishComment(s.manager, &published, ancestors)
+	}
+
+	return comment, nil
+}
+
+// addComment сохраняет комментарий и возвращает его вместе с ID предков
+func (s *CommentMemoryStorage) addComment(postID, parentID, content, authorID string) (*model.Comment, []string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	curPost, err := s.postStorage.GetPostById(postID)
 	if err != nil {
-		return nil, fmt.Errorf("post with ID %s not found", postID)
+		return nil, nil, fmt.Errorf("post with ID %s not found", postID)
 	}
 
 	if curPost.CommentsDisabled {
-		return nil, fmt.Errorf("comments are disabled for post %s", postID)
+		return nil, nil, fmt.Errorf("comments are disabled for post %s", postID)
 	}
 
 	id := strconv.Itoa(s.nextID)
@@ -62,10 +82,10 @@ func (s *CommentMemoryStorage) CreateComment(ctx context.Context, postID, parent
 		// проверяем что родительский комментарий существует и принадлежит тому же посту
 		parentComment, ok := s.comments[parentID]
 		if !ok {
-			return nil, fmt.Errorf("parent comment with ID %s not found", parentID)
+			return nil, nil, fmt.Errorf("parent comment with ID %s not found", parentID)
 		}
 		if parentComment.PostID != postID {
-			return nil, fmt.Errorf("parent comment belongs to a different post")
+			return nil, nil, fmt.Errorf("parent comment belongs to a different post")
 		}
 		parentComment.HasReplies = true
 	}
@@ -75,7 +95,7 @@ func (s *CommentMemoryStorage) CreateComment(ctx context.Context, postID, parent
 		PostID:     postID,
 		ParentID:   parentPtr,
 		Content:    content,
-		AuthorID:   fmt.Sprint(userID),
+		AuthorID:   authorID,
 		CreatedAt:  time.Now().Format(time.RFC3339),
 		HasReplies: false,
 		Children:   []*model.Comment{},
@@ -90,12 +110,21 @@ func (s *CommentMemoryStorage) CreateComment(ctx context.Context, postID, parent
 	}
 
 	s.comments[id] = comment
+	return comment, s.ancestorIDs(comment), nil
+}
 
-	if s.manager != nil {
-		s.manager.Publish(postID, comment)
+// ancestorIDs возвращает ID предков комментария от родителя к корню (вызывается под s.mu)
+func (s *CommentMemoryStorage) ancestorIDs(c *model.Comment) []string {
+	var ids []string
+	for c.ParentID != nil {
+		ids = append(ids, *c.ParentID)
+		parent, ok := s.comments[*c.ParentID]
+		if !ok {
+			break
+		}
+		c = parent
 	}
-
-	return comment, nil
+	return ids
 }
 
 func (s *CommentMemoryStorage) GetComments(postID string, limit, offset int) (*model.CommentConnection, error) {
@@ -197,3 +226,97 @@ func (s *CommentMemoryStorage) GetReplies(parentID string, limit, offset int) (*
 		NextOffset: offset + limit,
 	}, nil
 }
+
+// DeleteCommentsByAuthor удаляет комментарии автора.
+// Комментарии с ответами остаются в дереве с текстом "[deleted]" и анонимным автором.
+func (s *CommentMemoryStorage) DeleteCommentsByAuthor(authorID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var own []*model.Comment
+	for _, c := range s.comments {
+		if c.AuthorID == authorID {
+			own = append(own, c)
+		}
+	}
+
+	// сначала обрабатываем более новые комментарии, чтобы ответы удалялись раньше родителей
+	sort.Slice(own, func(i, j int) bool {
+		return commentNumber(own[i].ID) > commentNumber(own[j].ID)
+	})
+
+	for _, c := range own {
+		if len(c.Children) > 0 {
+			c.Content = comment.DeletedContent
+			c.AuthorID = user.DeletedUserID
+			continue
+		}
+
+		delete(s.comments, c.ID)
+		if c.ParentID == nil {
+			continue
+		}
+
+		parent, ok := s.comments[*c.ParentID]
+		if !ok {
+			continue
+		}
+		for i, child := range parent.Children {
+			if child.ID == c.ID {
+				parent.Children = append(parent.Children[:i], parent.Children[i+1:]...)
+				break
+			}
+		}
+		parent.HasReplies = len(parent.Children) > 0
+	}
+
+	return nil
+}
+
+func (s *CommentMemoryStorage) AnonymizeCommentsByAuthor(authorID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.comments {
+		if c.AuthorID == authorID {
+			c.AuthorID = user.DeletedUserID
+		}
+	}
+	return nil
+}
+
+// commentNumber переводит ID комментария в число для сортировки по порядку создания
+func commentNumber(id string) int {
+	n, _ := strconv.Atoi(id)
+	return n
+}
+
+func (s *CommentMemoryStorage) GetCommentsByAuthor(authorID string) ([]*model.Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	comments := []*model.Comment{}
+	for _, c := range s.comments {
+		if c.AuthorID == authorID {
+			comments = append(comments, c)
+		}
+	}
+
+	// порядок создания
+	sort.Slice(comments, func(i, j int) bool {
+		return commentNumber(comments[i].ID) < commentNumber(comments[j].ID)
+	})
+
+	return comments, nil
+}
+
+func (s *CommentMemoryStorage) GetCommentByID(id string) (*model.Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.comments[id]
+	if !ok {
+		return nil, fmt.Errorf("comment with ID %s not found", id)
+	}
+	return c, nil
+}
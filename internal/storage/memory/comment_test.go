@@ -8,13 +8,17 @@ import (
 	"time"
 
 	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/comment"
 	"github.com/VitaminP8/postery/internal/mocks"
+	"github.com/VitaminP8/postery/internal/subscription"
+	"github.com/VitaminP8/postery/internal/user"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestCommentMemoryStorage_CreateComment(t *testing.T) {
-	postStorage := mocks.NewMockPostStorage()
+	postStorage := mocks.NewMockPostStorage(nil)
 	subscriptionManager := mocks.NewMockSubscriptionManager()
 	commentStorage := NewCommentMemoryStorage(postStorage, subscriptionManager)
 
@@ -66,6 +70,27 @@ func TestCommentMemoryStorage_CreateComment(t *testing.T) {
 		assert.Equal(t, childComment.ID, commentWithReplies.Items[0].ID)
 	})
 
+	t.Run("Reply is published to every ancestor thread", func(t *testing.T) {
+		root, err := commentStorage.CreateComment(ctx, post.ID, "", "Root")
+		require.NoError(t, err)
+		child, err := commentStorage.CreateComment(ctx, post.ID, root.ID, "Child")
+		require.NoError(t, err)
+		grandchild, err := commentStorage.CreateComment(ctx, post.ID, child.ID, "Grandchild")
+		require.NoError(t, err)
+
+		// публикуется копия комментария в момент создания
+		publishedIDs := func(topic string) []string {
+			var ids []string
+			for _, payload := range subscriptionManager.GetPublishedForTopic(topic) {
+				ids = append(ids, payload.(*model.Comment).ID)
+			}
+			return ids
+		}
+		assert.Equal(t, []string{child.ID, grandchild.ID}, publishedIDs(subscription.RepliesTopic(root.ID)))
+		assert.Equal(t, []string{grandchild.ID}, publishedIDs(subscription.RepliesTopic(child.ID)))
+		assert.Empty(t, subscriptionManager.GetPublishedForTopic(subscription.RepliesTopic(grandchild.ID)))
+	})
+
 	t.Run("Error when creating comment for disabled comments", func(t *testing.T) {
 		// Отключаем комментарии у поста
 		err = postStorage.DisableComment(ctx, post.ID)
@@ -113,12 +138,12 @@ func TestCommentMemoryStorage_CreateComment(t *testing.T) {
 		unauthorizedCtx := context.Background()
 		_, err = commentStorage.CreateComment(unauthorizedCtx, post.ID, "", "Test Comment")
 		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "unautorized")
+		assert.ErrorIs(t, err, auth.ErrUnauthenticated)
 	})
 }
 
 func TestCommentMemoryStorage_GetComments(t *testing.T) {
-	postStorage := mocks.NewMockPostStorage()
+	postStorage := mocks.NewMockPostStorage(nil)
 	subscriptionManager := mocks.NewMockSubscriptionManager()
 	commentStorage := NewCommentMemoryStorage(postStorage, subscriptionManager)
 
@@ -212,7 +237,7 @@ func TestCommentMemoryStorage_GetComments(t *testing.T) {
 }
 
 func TestCommentMemoryStorage_GetReplies(t *testing.T) {
-	postStorage := mocks.NewMockPostStorage()
+	postStorage := mocks.NewMockPostStorage(nil)
 	subscriptionManager := mocks.NewMockSubscriptionManager()
 	commentStorage := NewCommentMemoryStorage(postStorage, subscriptionManager)
 
@@ -289,7 +314,7 @@ func TestCommentMemoryStorage_GetReplies(t *testing.T) {
 }
 
 func TestCommentMemoryStorage_ConcurrentOperations(t *testing.T) {
-	postStorage := mocks.NewMockPostStorage()
+	postStorage := mocks.NewMockPostStorage(nil)
 	subscriptionManager := mocks.NewMockSubscriptionManager()
 	commentStorage := NewCommentMemoryStorage(postStorage, subscriptionManager)
 
@@ -466,3 +491,86 @@ func TestCommentMemoryStorage_ConcurrentOperations(t *testing.T) {
 		}
 	})
 }
+
+func TestCommentMemoryStorage_DeleteAndAnonymizeByAuthor(t *testing.T) {
+	t.Run("Delete comments by author keeps threads with replies", func(t *testing.T) {
+		postStorage := mocks.NewMockPostStorage(nil)
+		commentStorage := NewCommentMemoryStorage(postStorage, nil)
+
+		authorCtx := createUserContext(1)
+		otherCtx := createUserContext(2)
+
+		post, err := postStorage.CreatePost(otherCtx, "Test Post", "Test Content")
+		require.NoError(t, err)
+
+		// комментарий автора с ответом другого пользователя
+		parent, err := commentStorage.CreateComment(authorCtx, post.ID, "", "Parent")
+		require.NoError(t, err)
+		reply, err := commentStorage.CreateComment(otherCtx, post.ID, parent.ID, "Reply")
+		require.NoError(t, err)
+
+		// ответ автора без ответов на него
+		_, err = commentStorage.CreateComment(authorCtx, post.ID, reply.ID, "Own reply")
+		require.NoError(t, err)
+
+		err = commentStorage.DeleteCommentsByAuthor("1")
+		require.NoError(t, err)
+
+		// у ответа больше нет вложенных комментариев
+		replies, err := commentStorage.GetReplies(reply.ID, 10, 0)
+		require.NoError(t, err)
+		assert.Empty(t, replies.Items)
+		assert.False(t, reply.HasReplies)
+
+		// родительский комментарий остался в дереве, но без текста и автора
+		roots, err := commentStorage.GetComments(post.ID, 10, 0)
+		require.NoError(t, err)
+		require.Len(t, roots.Items, 1)
+		assert.Equal(t, comment.DeletedContent, roots.Items[0].Content)
+		assert.Equal(t, user.DeletedUserID, roots.Items[0].AuthorID)
+		assert.True(t, roots.Items[0].HasReplies)
+	})
+
+	t.Run("Anonymize comments by author", func(t *testing.T) {
+		postStorage := mocks.NewMockPostStorage(nil)
+		commentStorage := NewCommentMemoryStorage(postStorage, nil)
+
+		ctx := createUserContext(1)
+		post, err := postStorage.CreatePost(ctx, "Test Post", "Test Content")
+		require.NoError(t, err)
+
+		_, err = commentStorage.CreateComment(ctx, post.ID, "", "Comment")
+		require.NoError(t, err)
+
+		err = commentStorage.AnonymizeCommentsByAuthor("1")
+		require.NoError(t, err)
+
+		roots, err := commentStorage.GetComments(post.ID, 10, 0)
+		require.NoError(t, err)
+		require.Len(t, roots.Items, 1)
+		assert.Equal(t, "Comment", roots.Items[0].Content)
+		assert.Equal(t, user.DeletedUserID, roots.Items[0].AuthorID)
+	})
+}
+
+func TestCommentMemoryStorage_GetCommentsByAuthor(t *testing.T) {
+	postStorage := mocks.NewMockPostStorage(nil)
+	commentStorage := NewCommentMemoryStorage(postStorage, nil)
+
+	ctx := createUserContext(1)
+	post, err := postStorage.CreatePost(ctx, "Test Post", "Test Content")
+	require.NoError(t, err)
+
+	root, err := commentStorage.CreateComment(ctx, post.ID, "", "Root")
+	require.NoError(t, err)
+	_, err = commentStorage.CreateComment(createUserContext(2), post.ID, root.ID, "Other")
+	require.NoError(t, err)
+	reply, err := commentStorage.CreateComment(ctx, post.ID, root.ID, "Reply")
+	require.NoError(t, err)
+
+	comments, err := commentStorage.GetCommentsByAuthor("1")
+	require.NoError(t, err)
+	require.Len(t, comments, 2)
+	assert.Equal(t, root.ID, comments[0].ID)
+	assert.Equal(t, reply.ID, comments[1].ID)
+}
@@ -0,0 +1,117 @@
+package memory
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VitaminP8/postery/internal/invite"
+)
+
+type InviteMemoryStorage struct {
+	mu      sync.Mutex
+	invites map[string]*invite.Invite // id -> приглашение
+	hashes  map[string]string         // хэш кода -> id
+	nextId  int
+}
+
+func NewInviteMemoryStorage() *InviteMemoryStorage {
+	return &InviteMemoryStorage{
+		invites: make(map[string]*invite.Invite),
+		hashes:  make(map[string]string),
+		nextId:  1,
+	}
+}
+
+func (s *InviteMemoryStorage) CreateInvite(inv *invite.Invite, codeHash string) (*invite.Invite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *inv
+	stored.ID = strconv.Itoa(s.nextId)
+	stored.CreatedAt = time.Now()
+	stored.Uses = 0
+	stored.Invitees = nil
+	s.nextId++
+
+	s.invites[stored.ID] = &stored
+	s.hashes[codeHash] = stored.ID
+
+	return copyInvite(&stored), nil
+}
+
+func (s *InviteMemoryStorage) GetInvites() ([]*invite.Invite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invites := []*invite.Invite{}
+	for _, inv := range s.invites {
+		invites = append(invites, copyInvite(inv))
+	}
+
+	// от новых к старым
+	sort.Slice(invites, func(i, j int) bool {
+		a, _ := strconv.Atoi(invites[i].ID)
+		b, _ := strconv.Atoi(invites[j].ID)
+		return a > b
+	})
+	return invites, nil
+}
+
+func (s *InviteMemoryStorage) RevokeInvite(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv, ok := s.invites[id]
+	if !ok {
+		return invite.ErrInviteNotFound
+	}
+	inv.Revoked = true
+	return nil
+}
+
+func (s *InviteMemoryStorage) RedeemInvite(codeHash, email string, now time.Time) (*invite.Invite, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv, ok := s.invites[s.hashes[codeHash]]
+	if !ok || !inv.Usable(email, now) {
+		return nil, invite.ErrInviteInvalid
+	}
+
+	inv.Uses++
+	return copyInvite(inv), nil
+}
+
+func (s *InviteMemoryStorage) ReleaseInvite(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv, ok := s.invites[id]
+	if !ok {
+		return invite.ErrInviteNotFound
+	}
+	if inv.Uses > 0 {
+		inv.Uses--
+	}
+	return nil
+}
+
+func (s *InviteMemoryStorage) AddInvitee(id, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv, ok := s.invites[id]
+	if !ok {
+		return invite.ErrInviteNotFound
+	}
+	inv.Invitees = append(inv.Invitees, userID)
+	return nil
+}
+
+func copyInvite(inv *invite.Invite) *invite.Invite {
+	result := *inv
+	result.Invitees = append([]string(nil), inv.Invitees...)
+	return &result
+}
@@ -0,0 +1,64 @@
+package memory
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/VitaminP8/postery/internal/mention"
+)
+
+type mentionKey struct {
+	kind      mention.Kind
+	contentID string
+}
+
+type MentionMemoryStorage struct {
+	mu       sync.Mutex
+	mentions map[mentionKey][]string // пост или комментарий -> ID упомянутых пользователей
+}
+
+func NewMentionMemoryStorage() *MentionMemoryStorage {
+	return &MentionMemoryStorage{
+		mentions: make(map[mentionKey][]string),
+	}
+}
+
+func (s *MentionMemoryStorage) AddMentions(kind mention.Kind, contentID string, userIDs []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := mentionKey{kind, contentID}
+	for _, userID := range userIDs {
+		if !slices.Contains(s.mentions[key], userID) {
+			s.mentions[key] = append(s.mentions[key], userID)
+		}
+	}
+	return nil
+}
+
+func (s *MentionMemoryStorage) GetMentions(kind mention.Kind, contentID string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.mentions[mentionKey{kind, contentID}]...), nil
+}
+
+func (s *MentionMemoryStorage) DeleteMentionsOf(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, userIDs := range s.mentions {
+		kept := userIDs[:0]
+		for _, id := range userIDs {
+			if id != userID {
+				kept = append(kept, id)
+			}
+		}
+		if len(kept) == 0 {
+			delete(s.mentions, key)
+		} else {
+			s.mentions[key] = kept
+		}
+	}
+	return nil
+}
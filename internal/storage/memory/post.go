@@ -4,23 +4,28 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"sync"
 
 	"github.com/VitaminP8/postery/graph/model"
 	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/subscription"
+	"github.com/VitaminP8/postery/internal/user"
 )
 
 type PostMemoryStorage struct {
-	mu     sync.Mutex
-	posts  map[string]*model.Post
-	nextId int // Для хранения актуального ID (можно было использовать UUID)
+	mu      sync.Mutex
+	posts   map[string]*model.Post
+	nextId  int // Для хранения актуального ID (можно было использовать UUID)
+	manager subscription.Manager
 }
 
-func NewPostMemoryStorage() *PostMemoryStorage {
+func NewPostMemoryStorage(manager subscription.Manager) *PostMemoryStorage {
 	return &PostMemoryStorage{
-		posts:  make(map[string]*model.Post),
-		nextId: 1,
+		posts:   make(map[string]*model.Post),
+		nextId:  1,
+		manager: manager,
 	}
 }
 
@@ -28,12 +33,10 @@ func (s *PostMemoryStorage) CreatePost(ctx context.Context, title, content strin
 	// Контекст — это read-only структура (при каждом запросе он не обновляется, а создается заново)(поэтому над мьютексом)
 	userID, err := auth.GetUserIDFromContext(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("unautorized: %w", err)
+		return nil, err
 	}
 
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	id := strconv.Itoa(s.nextId)
 	s.nextId++
 
@@ -46,6 +49,10 @@ func (s *PostMemoryStorage) CreatePost(ctx context.Context, title, content strin
 	}
 
 	s.posts[id] = post
+	published := *post
+	s.mu.Unlock()
+
+	s.publish(subscription.PostsTopic, subscription.EventPostCreated, &published)
 	return post, nil
 }
 
@@ -74,67 +81,147 @@ func (s *PostMemoryStorage) GetAllPosts() ([]*model.Post, error) {
 }
 
 func (s *PostMemoryStorage) DisableComment(ctx context.Context, id string) error {
-	userID, err := auth.GetUserIDFromContext(ctx)
-	if err != nil {
-		return fmt.Errorf("unautorized: %w", err)
-	}
+	return s.setCommentsDisabled(id, true)
+}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+func (s *PostMemoryStorage) EnableComment(ctx context.Context, id string) error {
+	return s.setCommentsDisabled(id, false)
+}
 
+// setCommentsDisabled меняет настройку комментариев; событие отправляется, только если она изменилась
+func (s *PostMemoryStorage) setCommentsDisabled(id string, disabled bool) error {
+	s.mu.Lock()
 	post, exists := s.posts[id]
 	if !exists {
+		s.mu.Unlock()
 		return errors.New("post not found")
 	}
 
-	if post.AuthorID != fmt.Sprint(userID) {
-		return errors.New("forbidden: not author")
-	}
+	changed := post.CommentsDisabled != disabled
+	post.CommentsDisabled = disabled
+	published := *post
+	s.mu.Unlock()
 
-	post.CommentsDisabled = true
+	if changed {
+		s.publish(subscription.PostTopic(id), subscription.EventCommentsToggled, &published)
+		s.publish(subscription.PostTopic(id), subscription.EventPostUpdated, &published)
+	}
 	return nil
 }
 
-func (s *PostMemoryStorage) EnableComment(ctx context.Context, id string) error {
-	userID, err := auth.GetUserIDFromContext(ctx)
-	if err != nil {
-		return fmt.Errorf("unautorized: %w", err)
+func (s *PostMemoryStorage) DeletePostById(ctx context.Context, id string) error {
+	s.mu.Lock()
+	_, exists := s.posts[id]
+	if !exists {
+		s.mu.Unlock()
+		return errors.New("post not found")
 	}
 
+	delete(s.posts, id)
+	s.mu.Unlock()
+
+	s.publish(subscription.PostTopic(id), subscription.EventPostDeleted, id)
+	return nil
+}
+
+func (s *PostMemoryStorage) DeletePostsByAuthor(authorID string) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	var deleted []string
+	for id, post := range s.posts {
+		if post.AuthorID == authorID {
+			delete(s.posts, id)
+			deleted = append(deleted, id)
+		}
+	}
+	s.mu.Unlock()
 
-	post, exists := s.posts[id]
-	if !exists {
-		return errors.New("post not found")
+	for _, id := range deleted {
+		s.publish(subscription.PostTopic(id), subscription.EventPostDeleted, id)
 	}
+	return nil
+}
 
-	if post.AuthorID != fmt.Sprint(userID) {
-		return errors.New("forbidden: not author")
+func (s *PostMemoryStorage) AnonymizePostsByAuthor(authorID string) error {
+	s.mu.Lock()
+	var updated []model.Post
+	for _, post := range s.posts {
+		if post.AuthorID == authorID {
+			post.AuthorID = user.DeletedUserID
+			updated = append(updated, *post)
+		}
 	}
+	s.mu.Unlock()
 
-	post.CommentsDisabled = false
+	for i := range updated {
+		s.publish(subscription.PostTopic(updated[i].ID), subscription.EventPostUpdated, &updated[i])
+	}
 	return nil
 }
 
-func (s *PostMemoryStorage) DeletePostById(ctx context.Context, id string) error {
-	userID, err := auth.GetUserIDFromContext(ctx)
-	if err != nil {
-		return fmt.Errorf("unautorized: %w", err)
+// publish отправляет событие поста подписчикам; вызывается без s.mu, чтобы медленный подписчик не держал хранилище.
+// Подписчики получают копию поста - хранимый пост дальше меняется под мьютексом.
+func (s *PostMemoryStorage) publish(topic string, eventType subscription.EventType, payload interface{}) {
+	if s.manager != nil {
+		s.manager.Publish(topic, subscription.Event{Type: eventType, Payload: payload})
 	}
+}
 
+func (s *PostMemoryStorage) GetPostsByAuthor(authorID string) ([]*model.Post, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	post, exists := s.posts[id]
-	if !exists {
-		return errors.New("post not found")
+	posts := []*model.Post{}
+	for _, post := range s.posts {
+		if post.AuthorID == authorID {
+			posts = append(posts, post)
+		}
+	}
+
+	// порядок создания
+	sort.Slice(posts, func(i, j int) bool {
+		a, _ := strconv.Atoi(posts[i].ID)
+		b, _ := strconv.Atoi(posts[j].ID)
+		return a < b
+	})
+
+	return posts, nil
+}
+
+func (s *PostMemoryStorage) GetPostsByAuthors(authorIDs []string, beforeID string, limit int) ([]*model.Post, error) {
+	authors := make(map[string]bool, len(authorIDs))
+	for _, id := range authorIDs {
+		authors[id] = true
 	}
 
-	if post.AuthorID != fmt.Sprint(userID) {
-		return errors.New("forbidden: not author")
+	before := -1
+	if beforeID != "" {
+		n, err := strconv.Atoi(beforeID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid post ID: %w", err)
+		}
+		before = n
 	}
 
-	delete(s.posts, id)
-	return nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	posts := []*model.Post{}
+	for _, post := range s.posts {
+		n, _ := strconv.Atoi(post.ID)
+		if authors[post.AuthorID] && (before < 0 || n < before) {
+			posts = append(posts, post)
+		}
+	}
+
+	// ID выдаются по порядку, поэтому сортировка по убыванию ID - от новых к старым
+	sort.Slice(posts, func(i, j int) bool {
+		a, _ := strconv.Atoi(posts[i].ID)
+		b, _ := strconv.Atoi(posts[j].ID)
+		return a > b
+	})
+
+	if len(posts) > limit {
+		posts = posts[:limit]
+	}
+	return posts, nil
 }
@@ -7,7 +7,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/VitaminP8/postery/graph/model"
 	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/mocks"
+	"github.com/VitaminP8/postery/internal/subscription"
+	"github.com/VitaminP8/postery/internal/user"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -19,7 +23,7 @@ func createUserContext(userID uint) context.Context {
 }
 
 func TestPostMemoryStorage_CreatePost(t *testing.T) {
-	storage := NewPostMemoryStorage()
+	storage := NewPostMemoryStorage(nil)
 
 	t.Run("Success post creation", func(t *testing.T) {
 		userID := 1
@@ -47,13 +51,12 @@ func TestPostMemoryStorage_CreatePost(t *testing.T) {
 
 		_, err := storage.CreatePost(ctx, "title", "content")
 
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "unautorized")
+		assert.ErrorIs(t, err, auth.ErrUnauthenticated)
 	})
 }
 
 func TestPostMemoryStorage_GetPostById(t *testing.T) {
-	storage := NewPostMemoryStorage()
+	storage := NewPostMemoryStorage(nil)
 	userID := 1
 	ctx := createUserContext(uint(userID))
 
@@ -80,7 +83,7 @@ func TestPostMemoryStorage_GetPostById(t *testing.T) {
 }
 
 func TestPostMemoryStorage_GetAllPosts(t *testing.T) {
-	storage := NewPostMemoryStorage()
+	storage := NewPostMemoryStorage(nil)
 	userID := 1
 	ctx := createUserContext(uint(userID))
 
@@ -100,7 +103,7 @@ func TestPostMemoryStorage_GetAllPosts(t *testing.T) {
 }
 
 func TestPostMemoryStorage_DisableComment(t *testing.T) {
-	storage := NewPostMemoryStorage()
+	storage := NewPostMemoryStorage(nil)
 	userID := 1
 	ctx := createUserContext(uint(userID))
 
@@ -116,31 +119,15 @@ func TestPostMemoryStorage_DisableComment(t *testing.T) {
 		assert.True(t, updatedPost.CommentsDisabled)
 	})
 
-	t.Run("Disable comments by not author", func(t *testing.T) {
-		otherUserCtx := createUserContext(2)
-
-		err := storage.DisableComment(otherUserCtx, post.ID)
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "forbidden")
-	})
-
 	t.Run("Disable comment for not exists post", func(t *testing.T) {
 		err := storage.DisableComment(ctx, "234234")
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "not found")
 	})
-
-	t.Run("Disable comment by unauthorized user", func(t *testing.T) {
-		unauthorizedCtx := context.Background()
-
-		err := storage.DisableComment(unauthorizedCtx, post.ID)
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "unautorized")
-	})
 }
 
 func TestPostMemoryStorage_EnableComment(t *testing.T) {
-	storage := NewPostMemoryStorage()
+	storage := NewPostMemoryStorage(nil)
 	userID := 1
 	ctx := createUserContext(uint(userID))
 
@@ -159,35 +146,15 @@ func TestPostMemoryStorage_EnableComment(t *testing.T) {
 		assert.False(t, updatedPost.CommentsDisabled)
 	})
 
-	t.Run("Enable comment by not author", func(t *testing.T) {
-		// Сначала отключаем комментарии
-		err := storage.DisableComment(ctx, post.ID)
-		require.NoError(t, err)
-
-		otherUserCtx := createUserContext(2)
-
-		err = storage.EnableComment(otherUserCtx, post.ID)
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "forbidden")
-	})
-
 	t.Run("Enable comment for not exists post", func(t *testing.T) {
 		err := storage.EnableComment(ctx, "25325")
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "not found")
 	})
-
-	t.Run("Enable comment by unauthorized user", func(t *testing.T) {
-		unauthorizedCtx := context.Background()
-
-		err := storage.EnableComment(unauthorizedCtx, post.ID)
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "unautorized")
-	})
 }
 
 func TestPostMemoryStorage_DeletePostById(t *testing.T) {
-	storage := NewPostMemoryStorage()
+	storage := NewPostMemoryStorage(nil)
 	userID := 1
 	ctx := createUserContext(uint(userID))
 
@@ -203,39 +170,15 @@ func TestPostMemoryStorage_DeletePostById(t *testing.T) {
 		assert.Contains(t, err.Error(), "not found")
 	})
 
-	// Создаем еще один пост для тестирования других случаев
-	post, err = storage.CreatePost(ctx, "title 2", "content 2")
-	require.NoError(t, err)
-
-	t.Run("Delete post by not author", func(t *testing.T) {
-		otherUserCtx := createUserContext(2)
-
-		err := storage.DeletePostById(otherUserCtx, post.ID)
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "forbidden")
-
-		// Проверяем, что пост не был удален
-		_, err = storage.GetPostById(post.ID)
-		assert.NoError(t, err)
-	})
-
 	t.Run("Delete not exist post", func(t *testing.T) {
 		err := storage.DeletePostById(ctx, "345345")
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "not found")
 	})
-
-	t.Run("Delete by unauthorized user", func(t *testing.T) {
-		unauthorizedCtx := context.Background()
-
-		err := storage.DeletePostById(unauthorizedCtx, post.ID)
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "unautorized")
-	})
 }
 
 func TestPostMemoryStorage_ConcurrentOperations(t *testing.T) {
-	storage := NewPostMemoryStorage()
+	storage := NewPostMemoryStorage(nil)
 
 	t.Run("Concurrent post creation", func(t *testing.T) {
 		var wg sync.WaitGroup
@@ -382,3 +325,131 @@ func TestPostMemoryStorage_ConcurrentOperations(t *testing.T) {
 		readWg.Wait()
 	})
 }
+
+func TestPostMemoryStorage_DeleteAndAnonymizeByAuthor(t *testing.T) {
+	t.Run("Delete posts by author", func(t *testing.T) {
+		storage := NewPostMemoryStorage(nil)
+
+		_, err := storage.CreatePost(createUserContext(1), "post 1", "content 1")
+		require.NoError(t, err)
+		otherPost, err := storage.CreatePost(createUserContext(2), "post 2", "content 2")
+		require.NoError(t, err)
+
+		err = storage.DeletePostsByAuthor("1")
+		require.NoError(t, err)
+
+		posts, err := storage.GetAllPosts()
+		require.NoError(t, err)
+		require.Len(t, posts, 1)
+		assert.Equal(t, otherPost.ID, posts[0].ID)
+	})
+
+	t.Run("Anonymize posts by author", func(t *testing.T) {
+		storage := NewPostMemoryStorage(nil)
+
+		post, err := storage.CreatePost(createUserContext(1), "post 1", "content 1")
+		require.NoError(t, err)
+
+		err = storage.AnonymizePostsByAuthor("1")
+		require.NoError(t, err)
+
+		post, err = storage.GetPostById(post.ID)
+		require.NoError(t, err)
+		assert.Equal(t, user.DeletedUserID, post.AuthorID)
+		assert.Equal(t, "content 1", post.Content)
+	})
+}
+
+func TestPostMemoryStorage_GetPostsByAuthor(t *testing.T) {
+	storage := NewPostMemoryStorage(nil)
+
+	first, err := storage.CreatePost(createUserContext(1), "post 1", "content 1")
+	require.NoError(t, err)
+	_, err = storage.CreatePost(createUserContext(2), "post 2", "content 2")
+	require.NoError(t, err)
+	second, err := storage.CreatePost(createUserContext(1), "post 3", "content 3")
+	require.NoError(t, err)
+
+	posts, err := storage.GetPostsByAuthor("1")
+	require.NoError(t, err)
+	require.Len(t, posts, 2)
+	assert.Equal(t, first.ID, posts[0].ID)
+	assert.Equal(t, second.ID, posts[1].ID)
+
+	posts, err = storage.GetPostsByAuthor("3")
+	require.NoError(t, err)
+	assert.Empty(t, posts)
+}
+
+func TestPostMemoryStorage_GetPostsByAuthors(t *testing.T) {
+	storage := NewPostMemoryStorage(nil)
+
+	var ids []string
+	for _, userID := range []uint{1, 2, 3, 1} {
+		post, err := storage.CreatePost(createUserContext(userID), "post", "content")
+		require.NoError(t, err)
+		ids = append(ids, post.ID)
+	}
+
+	t.Run("Newest first", func(t *testing.T) {
+		posts, err := storage.GetPostsByAuthors([]string{"1", "2"}, "", 10)
+		require.NoError(t, err)
+		require.Len(t, posts, 3)
+		assert.Equal(t, ids[3], posts[0].ID)
+		assert.Equal(t, ids[1], posts[1].ID)
+		assert.Equal(t, ids[0], posts[2].ID)
+	})
+
+	t.Run("Before cursor with limit", func(t *testing.T) {
+		posts, err := storage.GetPostsByAuthors([]string{"1", "2"}, ids[3], 1)
+		require.NoError(t, err)
+		require.Len(t, posts, 1)
+		assert.Equal(t, ids[1], posts[0].ID)
+	})
+
+	t.Run("No authors", func(t *testing.T) {
+		posts, err := storage.GetPostsByAuthors(nil, "", 10)
+		require.NoError(t, err)
+		assert.Empty(t, posts)
+	})
+}
+
+func TestPostMemoryStorage_Events(t *testing.T) {
+	manager := mocks.NewMockSubscriptionManager()
+	storage := NewPostMemoryStorage(manager)
+	ctx := createUserContext(1)
+
+	post, err := storage.CreatePost(ctx, "Title", "Content")
+	require.NoError(t, err)
+	topic := subscription.PostTopic(post.ID)
+
+	t.Run("Create", func(t *testing.T) {
+		events := manager.GetEventsForTopic(subscription.PostsTopic)
+		require.Len(t, events, 1)
+		assert.Equal(t, subscription.EventPostCreated, events[0].Type)
+		assert.Equal(t, post.ID, events[0].Payload.(*model.Post).ID)
+	})
+
+	t.Run("Toggle comments only when changed", func(t *testing.T) {
+		require.NoError(t, storage.DisableComment(ctx, post.ID))
+		require.NoError(t, storage.DisableComment(ctx, post.ID))
+
+		events := manager.GetEventsForTopic(topic)
+		require.Len(t, events, 2)
+		assert.Equal(t, subscription.EventCommentsToggled, events[0].Type)
+		assert.Equal(t, subscription.EventPostUpdated, events[1].Type)
+
+		// подписчик получает копию: последующие изменения хранилища ее не затрагивают
+		require.NoError(t, storage.EnableComment(ctx, post.ID))
+		assert.True(t, events[0].Payload.(*model.Post).CommentsDisabled)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		require.NoError(t, storage.DeletePostById(ctx, post.ID))
+
+		events := manager.GetEventsForTopic(topic)
+		require.Len(t, events, 5)
+		assert.Equal(t, subscription.EventPostDeleted, events[4].Type)
+		assert.Equal(t, post.ID, events[4].Payload)
+	})
+}
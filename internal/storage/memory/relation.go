@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/VitaminP8/postery/internal/relation"
+)
+
+type relationKey struct {
+	userID   string
+	targetID string
+	kind     relation.Kind
+}
+
+type RelationMemoryStorage struct {
+	mu        sync.Mutex
+	relations map[relationKey]struct{}
+}
+
+func NewRelationMemoryStorage() *RelationMemoryStorage {
+	return &RelationMemoryStorage{
+		relations: make(map[relationKey]struct{}),
+	}
+}
+
+func (s *RelationMemoryStorage) AddRelation(userID, targetID string, kind relation.Kind) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.relations[relationKey{userID, targetID, kind}] = struct{}{}
+	return nil
+}
+
+func (s *RelationMemoryStorage) RemoveRelation(userID, targetID string, kind relation.Kind) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.relations, relationKey{userID, targetID, kind})
+	return nil
+}
+
+func (s *RelationMemoryStorage) HasRelation(userID, targetID string, kind relation.Kind) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.relations[relationKey{userID, targetID, kind}]
+	return ok, nil
+}
+
+func (s *RelationMemoryStorage) GetTargets(userID string, kind relation.Kind) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var targets []string
+	for key := range s.relations {
+		if key.userID == userID && key.kind == kind {
+			targets = append(targets, key.targetID)
+		}
+	}
+	// порядок map случаен - сортируем, чтобы результат был стабильным
+	sort.Strings(targets)
+	return targets, nil
+}
+
+func (s *RelationMemoryStorage) GetSources(targetID string, kind relation.Kind) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sources []string
+	for key := range s.relations {
+		if key.targetID == targetID && key.kind == kind {
+			sources = append(sources, key.userID)
+		}
+	}
+	sort.Strings(sources)
+	return sources, nil
+}
+
+func (s *RelationMemoryStorage) DeleteRelationsOf(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.relations {
+		if key.userID == userID || key.targetID == userID {
+			delete(s.relations, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/VitaminP8/postery/internal/relation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelationMemoryStorage(t *testing.T) {
+	storage := NewRelationMemoryStorage()
+
+	t.Run("Add is idempotent", func(t *testing.T) {
+		require.NoError(t, storage.AddRelation("1", "2", relation.KindBlock))
+		require.NoError(t, storage.AddRelation("1", "2", relation.KindBlock))
+		require.NoError(t, storage.AddRelation("1", "3", relation.KindMute))
+
+		blocked, err := storage.GetTargets("1", relation.KindBlock)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"2"}, blocked)
+	})
+
+	t.Run("Relations are directed and typed", func(t *testing.T) {
+		ok, err := storage.HasRelation("1", "2", relation.KindBlock)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = storage.HasRelation("2", "1", relation.KindBlock)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		ok, err = storage.HasRelation("1", "2", relation.KindMute)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("Sources", func(t *testing.T) {
+		require.NoError(t, storage.AddRelation("5", "2", relation.KindFollow))
+		require.NoError(t, storage.AddRelation("3", "2", relation.KindFollow))
+
+		followers, err := storage.GetSources("2", relation.KindFollow)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"3", "5"}, followers)
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		require.NoError(t, storage.RemoveRelation("1", "2", relation.KindBlock))
+
+		ok, err := storage.HasRelation("1", "2", relation.KindBlock)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("Delete relations of user", func(t *testing.T) {
+		require.NoError(t, storage.AddRelation("4", "1", relation.KindMute))
+		require.NoError(t, storage.DeleteRelationsOf("1"))
+
+		muted, err := storage.GetTargets("1", relation.KindMute)
+		require.NoError(t, err)
+		assert.Empty(t, muted)
+
+		ok, err := storage.HasRelation("4", "1", relation.KindMute)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,38 @@
+package memory
+
+import (
+	"sync"
+	"time"
+)
+
+type RevocationMemoryStorage struct {
+	mu      sync.Mutex
+	revoked map[uint]time.Time // userID -> момент отзыва токенов
+}
+
+func NewRevocationMemoryStorage() *RevocationMemoryStorage {
+	return &RevocationMemoryStorage{
+		revoked: make(map[uint]time.Time),
+	}
+}
+
+func (s *RevocationMemoryStorage) RevokeUserTokens(userID uint, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revoked[userID] = before
+	return nil
+}
+
+func (s *RevocationMemoryStorage) IsRevoked(userID uint, issuedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, ok := s.revoked[userID]
+	if !ok {
+		return false, nil
+	}
+
+	// сравниваем с точностью до секунды, как в claim "iat"
+	return issuedAt.Unix() <= before.Unix(), nil
+}
@@ -0,0 +1,38 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevocationMemoryStorage(t *testing.T) {
+	t.Run("Tokens are valid without revocation", func(t *testing.T) {
+		storage := NewRevocationMemoryStorage()
+
+		revoked, err := storage.IsRevoked(1, time.Now())
+		require.NoError(t, err)
+		assert.False(t, revoked)
+	})
+
+	t.Run("Tokens issued before revocation are revoked", func(t *testing.T) {
+		storage := NewRevocationMemoryStorage()
+
+		revokedAt := time.Now()
+		require.NoError(t, storage.RevokeUserTokens(1, revokedAt))
+
+		revoked, err := storage.IsRevoked(1, revokedAt.Add(-time.Hour))
+		require.NoError(t, err)
+		assert.True(t, revoked)
+
+		revoked, err = storage.IsRevoked(1, revokedAt.Add(time.Hour))
+		require.NoError(t, err)
+		assert.False(t, revoked)
+
+		revoked, err = storage.IsRevoked(2, revokedAt.Add(-time.Hour))
+		require.NoError(t, err)
+		assert.False(t, revoked)
+	})
+}
@@ -0,0 +1,112 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/VitaminP8/postery/internal/auth"
+)
+
+type SessionMemoryStorage struct {
+	mu       sync.Mutex
+	sessions map[string]*auth.Session // id -> сессия
+}
+
+func NewSessionMemoryStorage() *SessionMemoryStorage {
+	return &SessionMemoryStorage{
+		sessions: make(map[string]*auth.Session),
+	}
+}
+
+func (s *SessionMemoryStorage) CreateSession(session *auth.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *session
+	s.sessions[stored.ID] = &stored
+	return nil
+}
+
+func (s *SessionMemoryStorage) GetSession(id string) (*auth.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, auth.ErrSessionNotFound
+	}
+
+	result := *session
+	return &result, nil
+}
+
+func (s *SessionMemoryStorage) GetSessions(userID uint) ([]*auth.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := []*auth.Session{}
+	for _, session := range s.sessions {
+		if session.UserID == userID {
+			copied := *session
+			sessions = append(sessions, &copied)
+		}
+	}
+
+	// последние активные - первыми
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+func (s *SessionMemoryStorage) TouchSession(id string, seenAt time.Time, ip string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return auth.ErrSessionNotFound
+	}
+
+	session.LastSeenAt = seenAt
+	session.IP = ip
+	return nil
+}
+
+func (s *SessionMemoryStorage) RevokeSession(userID uint, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || session.UserID != userID {
+		return auth.ErrSessionNotFound
+	}
+
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *SessionMemoryStorage) DeleteUserSessions(userID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, session := range s.sessions {
+		if session.UserID == userID {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (s *SessionMemoryStorage) DeleteSessionsBefore(createdBefore time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, session := range s.sessions {
+		if session.CreatedAt.Before(createdBefore) {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionMemoryStorage(t *testing.T) {
+	storage := NewSessionMemoryStorage()
+
+	now := time.Now().Truncate(time.Second)
+	for _, session := range []*auth.Session{
+		{ID: "laptop", UserID: 1, UserAgent: "Firefox", IP: "10.0.0.1", CreatedAt: now.Add(-time.Hour), LastSeenAt: now.Add(-time.Hour)},
+		{ID: "phone", UserID: 1, UserAgent: "Safari", IP: "10.0.0.2", CreatedAt: now, LastSeenAt: now},
+		{ID: "other", UserID: 2, UserAgent: "Chrome", IP: "10.0.0.3", CreatedAt: now, LastSeenAt: now},
+	} {
+		require.NoError(t, storage.CreateSession(session))
+	}
+
+	t.Run("Get session", func(t *testing.T) {
+		session, err := storage.GetSession("laptop")
+		require.NoError(t, err)
+		assert.Equal(t, uint(1), session.UserID)
+		assert.Equal(t, "Firefox", session.UserAgent)
+
+		_, err = storage.GetSession("unknown")
+		assert.ErrorIs(t, err, auth.ErrSessionNotFound)
+	})
+
+	t.Run("List user sessions by last activity", func(t *testing.T) {
+		sessions, err := storage.GetSessions(1)
+		require.NoError(t, err)
+		require.Len(t, sessions, 2)
+		assert.Equal(t, "phone", sessions[0].ID)
+		assert.Equal(t, "laptop", sessions[1].ID)
+	})
+
+	t.Run("Touch session", func(t *testing.T) {
+		require.NoError(t, storage.TouchSession("laptop", now.Add(time.Minute), "10.0.0.9"))
+
+		session, err := storage.GetSession("laptop")
+		require.NoError(t, err)
+		assert.True(t, now.Add(time.Minute).Equal(session.LastSeenAt))
+		assert.Equal(t, "10.0.0.9", session.IP)
+	})
+
+	t.Run("Cannot revoke another user's session", func(t *testing.T) {
+		err := storage.RevokeSession(1, "other")
+		assert.ErrorIs(t, err, auth.ErrSessionNotFound)
+	})
+
+	t.Run("Revoke session", func(t *testing.T) {
+		require.NoError(t, storage.RevokeSession(1, "laptop"))
+
+		_, err := storage.GetSession("laptop")
+		assert.ErrorIs(t, err, auth.ErrSessionNotFound)
+	})
+
+	t.Run("Delete old sessions", func(t *testing.T) {
+		require.NoError(t, storage.DeleteSessionsBefore(now.Add(time.Second)))
+
+		sessions, err := storage.GetSessions(2)
+		require.NoError(t, err)
+		assert.Empty(t, sessions)
+	})
+}
@@ -8,41 +8,75 @@ import (
 	"time"
 
 	"github.com/VitaminP8/postery/graph/model"
-	"github.com/VitaminP8/postery/internal/config"
-
-	"github.com/golang-jwt/jwt"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/VitaminP8/postery/internal/identity"
+	passwordpkg "github.com/VitaminP8/postery/internal/password"
+	userpkg "github.com/VitaminP8/postery/internal/user"
 )
 
+// UserMemoryStorage хранит пользователей в памяти. Хэширование и проверка паролей (argon2id) выполняются
+// без мьютекса, чтобы попытки входа не задерживали остальные запросы (GetUserRole вызывается на каждый запрос).
 type UserMemoryStorage struct {
-	mu        sync.Mutex
-	users     map[string]*model.User
-	passwords map[string]string
+	mu        sync.RWMutex
+	users     map[string]*model.User               // ключ имени (identity.UsernameKey) -> пользователь
+	byID      map[string]*model.User               // ID -> пользователь (тот же указатель, что в users)
+	passwords map[string]string                    // ключ имени -> хэш пароля
+	identity  map[string]string                    // issuer|subject -> ID пользователя
+	twoFactor map[string]*userpkg.TwoFactor        // ID пользователя -> состояние 2FA
+	history   map[string][]*userpkg.UsernameChange // ID пользователя -> прежние имена, от новых к старым
 	nextId    int
+	hasher    *passwordpkg.Hasher
 }
 
 func NewUserMemoryStorage() *UserMemoryStorage {
 	return &UserMemoryStorage{
 		users:     make(map[string]*model.User),
+		byID:      make(map[string]*model.User),
 		passwords: make(map[string]string),
+		identity:  make(map[string]string),
+		twoFactor: make(map[string]*userpkg.TwoFactor),
+		history:   make(map[string][]*userpkg.UsernameChange),
 		nextId:    1,
+		hasher:    passwordpkg.Default(),
 	}
 }
 
 func (s *UserMemoryStorage) RegisterUser(username, email, password string) (*model.User, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.createUser(username, email, password, model.RoleUser, false)
+}
+
+func (s *UserMemoryStorage) CreateAdmin(username, email, password string) (*model.User, error) {
+	return s.createUser(username, email, password, model.RoleAdmin, true)
+}
 
-	_, exists := s.users[username]
-	if exists {
-		return nil, fmt.Errorf("user %s already exists", username)
+// createUser создает аккаунт с паролем и ролью; allowReserved разрешает служебные имена
+func (s *UserMemoryStorage) createUser(username, email, password string, role model.Role, allowReserved bool) (*model.User, error) {
+	username, email, err := identity.Validate(username, email, allowReserved)
+	if err != nil {
+		return nil, err
+	}
+
+	err = passwordpkg.Validate(password, username, email)
+	if err != nil {
+		return nil, err
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	// хэшируем до захвата мьютекса; имя и email проверяются уже под ним
+	hashedPassword, err := s.hasher.Hash(password)
 	if err != nil {
 		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := identity.UsernameKey(username)
+	if s.usernameTaken(key, "", time.Now()) {
+		return nil, identity.ErrUsernameTaken
+	}
+	if s.emailTaken(email) {
+		return nil, identity.ErrEmailTaken
+	}
+
 	id := strconv.Itoa(s.nextId)
 	s.nextId++
 
@@ -50,50 +84,390 @@ func (s *UserMemoryStorage) RegisterUser(username, email, password string) (*mod
 		ID:       id,
 		Username: username,
 		Email:    email,
+		Role:     role,
+	}
+
+	s.users[key] = user
+	s.byID[id] = user
+	s.passwords[key] = hashedPassword
+
+	return user, nil
+}
+
+func (s *UserMemoryStorage) VerifyCredentials(username, password string) (*model.User, error) {
+	key := identity.UsernameKey(username)
+
+	s.mu.RLock()
+	user, exists := s.users[key]
+	hashedPassword, ok := s.passwords[key]
+	s.mu.RUnlock()
+
+	if !exists || !ok {
+		s.hasher.SimulateVerify(password)
+		return nil, userpkg.ErrInvalidCredentials
+	}
+
+	needsRehash, err := s.hasher.Verify(password, hashedPassword)
+	if err != nil {
+		return nil, userpkg.ErrInvalidCredentials
+	}
+
+	// хэш старого формата (bcrypt) или с прежними параметрами пересчитываем, пока пароль известен
+	if needsRehash {
+		s.rehash(key, hashedPassword, password)
+	}
+
+	return user, nil
+}
+
+// rehash сохраняет новый хэш пароля, если за время проверки хэш не изменился (смена пароля или имени)
+func (s *UserMemoryStorage) rehash(key, oldHash, password string) {
+	rehashed, err := s.hasher.Hash(password)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.passwords[key] == oldHash {
+		s.passwords[key] = rehashed
+	}
+}
+
+func (s *UserMemoryStorage) SetUserRole(userID string, role model.Role) (*model.User, error) {
+	if !role.IsValid() {
+		return nil, fmt.Errorf("invalid role %s", role)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.findByID(userID)
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+
+	user.Role = role
+	return user, nil
+}
+
+func (s *UserMemoryStorage) CheckPassword(userID, password string) error {
+	s.mu.RLock()
+	user := s.findByID(userID)
+	var hashedPassword string
+	if user != nil {
+		hashedPassword = s.passwords[identity.UsernameKey(user.Username)]
+	}
+	s.mu.RUnlock()
+
+	if user == nil {
+		return errors.New("user not found")
+	}
+
+	_, err := s.hasher.Verify(password, hashedPassword)
+	if err != nil {
+		return errors.New("password is incorrect")
+	}
+
+	return nil
+}
+
+// DeleteUser удаляет учетные данные и персональные данные пользователя
+func (s *UserMemoryStorage) DeleteUser(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.findByID(userID)
+	if user == nil {
+		return errors.New("user not found")
+	}
+
+	key := identity.UsernameKey(user.Username)
+	delete(s.users, key)
+	delete(s.byID, userID)
+	delete(s.passwords, key)
+	delete(s.twoFactor, userID)
+	delete(s.history, userID)
+	for key, id := range s.identity {
+		if id == userID {
+			delete(s.identity, key)
+		}
+	}
+	return nil
+}
+
+func (s *UserMemoryStorage) FindOrCreateByIdentity(issuer, subject, username, email string) (*model.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := issuer + "|" + subject
+	if userID, ok := s.identity[key]; ok {
+		user := s.findByID(userID)
+		if user == nil {
+			return nil, errors.New("user not found")
+		}
+		return user, nil
+	}
+
+	// адрес, не прошедший проверку, не сохраняется - аккаунт создается без email
+	email, err := identity.ValidateEmail(email)
+	if err != nil {
+		email = ""
+	}
+
+	// аккаунт не связывается с существующим по email - провайдер мог не подтвердить адрес
+	if email != "" && s.emailTaken(email) {
+		return nil, fmt.Errorf("email %s is already registered, log in with password", email)
+	}
+
+	base := identity.SuggestUsername(username)
+	name := base
+	now := time.Now()
+	for i := 2; ; i++ {
+		if !s.usernameTaken(identity.UsernameKey(name), "", now) {
+			break
+		}
+		name = base + strconv.Itoa(i)
+	}
+
+	id := strconv.Itoa(s.nextId)
+	s.nextId++
+
+	user := &model.User{
+		ID:       id,
+		Username: name,
+		Email:    email,
+		Role:     model.RoleUser,
 	}
 
-	s.users[username] = user
-	s.passwords[username] = string(hashedPassword)
+	// пароля нет - вход по паролю невозможен, пока он не будет задан
+	s.users[identity.UsernameKey(name)] = user
+	s.byID[id] = user
+	s.identity[key] = id
+	return user, nil
+}
+
+func (s *UserMemoryStorage) FindUserByIdentity(issuer, subject string) (*model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
+	userID, ok := s.identity[issuer+"|"+subject]
+	if !ok {
+		return nil, nil
+	}
+	user := s.findByID(userID)
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
 	return user, nil
 }
 
-func (s *UserMemoryStorage) LoginUser(username, password string) (string, error) {
+func (s *UserMemoryStorage) GetTwoFactor(userID string) (*userpkg.TwoFactor, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	state, ok := s.twoFactor[userID]
+	if !ok {
+		return nil, nil
+	}
+
+	// копия, чтобы вызывающий не менял состояние в обход хранилища
+	result := *state
+	result.RecoveryCodes = append([]string(nil), state.RecoveryCodes...)
+	return &result, nil
+}
+
+func (s *UserMemoryStorage) SaveTwoFactor(userID string, state *userpkg.TwoFactor) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	user, exists := s.users[username]
-	if !exists {
-		return "", fmt.Errorf("user %s not found", username)
+	if s.findByID(userID) == nil {
+		return errors.New("user not found")
 	}
 
-	hashedPassword, ok := s.passwords[username]
+	saved := *state
+	saved.RecoveryCodes = append([]string(nil), state.RecoveryCodes...)
+	s.twoFactor[userID] = &saved
+	return nil
+}
+
+func (s *UserMemoryStorage) DeleteTwoFactor(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.twoFactor, userID)
+	return nil
+}
+
+func (s *UserMemoryStorage) UseTotpStep(userID string, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.twoFactor[userID]
 	if !ok {
-		return "", fmt.Errorf("password for user %s not found", username)
+		return errors.New("two-factor authentication is not configured")
 	}
+	if step <= state.LastStep {
+		return userpkg.ErrTotpCodeReused
+	}
+
+	state.LastStep = step
+	return nil
+}
+
+func (s *UserMemoryStorage) UseRecoveryCode(userID, codeHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	state, ok := s.twoFactor[userID]
+	if !ok {
+		return userpkg.ErrRecoveryCodeInvalid
+	}
+
+	for i, hash := range state.RecoveryCodes {
+		if hash == codeHash {
+			state.RecoveryCodes = append(state.RecoveryCodes[:i], state.RecoveryCodes[i+1:]...)
+			return nil
+		}
+	}
+	return userpkg.ErrRecoveryCodeInvalid
+}
+
+func (s *UserMemoryStorage) GetUserByUsername(username string) (*model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := identity.UsernameKey(username)
+	if user, ok := s.users[key]; ok {
+		return user, nil
+	}
+
+	// имя никем не занято - ищем последнего пользователя, который его носил
+	var ownerID string
+	var changedAt time.Time
+	for userID, history := range s.history {
+		for _, change := range history {
+			if identity.UsernameKey(change.Username) == key && change.ChangedAt.After(changedAt) {
+				ownerID = userID
+				changedAt = change.ChangedAt
+			}
+		}
+	}
+	if user := s.findByID(ownerID); user != nil {
+		return user, nil
+	}
+	return nil, errors.New("user not found")
+}
+
+func (s *UserMemoryStorage) ChangeUsername(userID, username string) (*model.User, error) {
+	name, err := identity.ValidateUsername(username)
 	if err != nil {
-		return "", fmt.Errorf("password for user %s is incorrect", username)
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.findByID(userID)
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+	if name == user.Username {
+		return nil, userpkg.ErrUsernameUnchanged
 	}
 
-	// достаем из .env jwtSecret
-	jwtSecret := config.GetEnv("JWT_SECRET")
-	if jwtSecret == "" {
-		return "", errors.New("JWT_SECRET is not set in environment")
+	now := time.Now()
+	history := s.history[userID]
+	if len(history) > 0 {
+		next := userpkg.NextChangeAt(history[0].ChangedAt)
+		if now.Before(next) {
+			return nil, fmt.Errorf("%w: next change is allowed after %s", userpkg.ErrUsernameChangeTooSoon, next.Format(time.RFC3339))
+		}
 	}
 
-	userIDInt, err := strconv.Atoi(user.ID)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  userIDInt,
-		"username": user.Username,
-		"exp":      time.Now().Add(72 * time.Hour).Unix(),
-	})
+	oldKey := identity.UsernameKey(user.Username)
+	newKey := identity.UsernameKey(name)
+	// смена только регистра ("alice" -> "Alice") не освобождает и не занимает имя
+	if newKey != oldKey && s.usernameTaken(newKey, userID, now) {
+		return nil, identity.ErrUsernameTaken
+	}
+
+	s.history[userID] = append([]*userpkg.UsernameChange{{Username: user.Username, ChangedAt: now}}, history...)
+
+	password, hasPassword := s.passwords[oldKey]
+	delete(s.users, oldKey)
+	delete(s.passwords, oldKey)
 
-	tokenString, err := token.SignedString([]byte(jwtSecret))
+	user.Username = name
+	s.users[newKey] = user
+	if hasPassword {
+		s.passwords[newKey] = password
+	}
+	return user, nil
+}
+
+func (s *UserMemoryStorage) GetUsernameHistory(userID string) ([]*userpkg.UsernameChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]*userpkg.UsernameChange, 0, len(s.history[userID]))
+	for _, change := range s.history[userID] {
+		copied := *change
+		result = append(result, &copied)
+	}
+	return result, nil
+}
+
+// usernameTaken проверяет, занято ли имя с ключом key: текущим именем или прежним именем другого
+// пользователя в течение UsernameGracePeriod; свои прежние имена exceptUserID может вернуть (вызывается под мьютексом)
+func (s *UserMemoryStorage) usernameTaken(key, exceptUserID string, now time.Time) bool {
+	if _, exists := s.users[key]; exists {
+		return true
+	}
+	for userID, history := range s.history {
+		if userID == exceptUserID {
+			continue
+		}
+		for _, change := range history {
+			if identity.UsernameKey(change.Username) == key && change.HeldBy(now) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// emailTaken проверяет, занят ли email без учета регистра (вызывается под мьютексом)
+func (s *UserMemoryStorage) emailTaken(email string) bool {
+	key := identity.EmailKey(email)
+	for _, user := range s.users {
+		if user.Email != "" && identity.EmailKey(user.Email) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// findByID ищет пользователя по ID (вызывается под мьютексом)
+func (s *UserMemoryStorage) findByID(userID string) *model.User {
+	return s.byID[userID]
+}
+
+func (s *UserMemoryStorage) GetUserRole(userID uint) (string, error) {
+	user, err := s.GetUserByID(strconv.FormatUint(uint64(userID), 10))
 	if err != nil {
-		return "", fmt.Errorf("failed to sign token: %w", err)
+		return "", err
 	}
+	return user.Role.String(), nil
+}
+
+func (s *UserMemoryStorage) GetUserByID(id string) (*model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	return tokenString, nil
+	user := s.findByID(id)
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+	return user, nil
 }
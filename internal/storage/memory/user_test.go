@@ -1,14 +1,19 @@
 package memory
 
 import (
-	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/identity"
+	"github.com/VitaminP8/postery/internal/password"
+	"github.com/VitaminP8/postery/internal/user"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestUserMemoryStorage_RegisterUser(t *testing.T) {
@@ -17,7 +22,7 @@ func TestUserMemoryStorage_RegisterUser(t *testing.T) {
 	t.Run("Successful user registration", func(t *testing.T) {
 		username := "testuser"
 		email := "test@example.com"
-		password := "password123"
+		password := "s3cure-passw0rd"
 
 		user, err := storage.RegisterUser(username, email, password)
 		require.NoError(t, err)
@@ -29,7 +34,7 @@ func TestUserMemoryStorage_RegisterUser(t *testing.T) {
 	t.Run("Register user with duplicate username", func(t *testing.T) {
 		username := "duplicateuser"
 		email := "duplicate@example.com"
-		password := "password123"
+		password := "s3cure-passw0rd"
 
 		// Первая регистрация должна быть успешной
 		_, err := storage.RegisterUser(username, email, password)
@@ -37,71 +42,46 @@ func TestUserMemoryStorage_RegisterUser(t *testing.T) {
 
 		// Вторая регистрация с тем же именем пользователя должна вернуть ошибку
 		_, err = storage.RegisterUser(username, "another@example.com", "anotherpassword")
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "already exists")
+		assert.ErrorIs(t, err, identity.ErrUsernameTaken)
 	})
 }
 
-func TestUserMemoryStorage_LoginUser(t *testing.T) {
+func TestUserMemoryStorage_VerifyCredentials(t *testing.T) {
 	storage := NewUserMemoryStorage()
 
-	// Устанавливаем переменную окружения JWT_SECRET перед тестами
-	originalJWTSecret := os.Getenv("JWT_SECRET")
-	err := os.Setenv("JWT_SECRET", "test_secret_key_for_jwt")
-	require.NoError(t, err)
-
-	// Восстанавливаем оригинальное значение после тестов
-	defer os.Setenv("JWT_SECRET", originalJWTSecret)
-
-	// Регистрируем пользователя для тестирования входа
+	// Регистрируем пользователя для проверки пароля
 	username := "loginuser"
 	email := "login@example.com"
 	password := "loginpassword123"
 
-	_, err = storage.RegisterUser(username, email, password)
+	registered, err := storage.RegisterUser(username, email, password)
 	require.NoError(t, err)
 
-	t.Run("Successful login", func(t *testing.T) {
-		token, err := storage.LoginUser(username, password)
+	t.Run("Successful verification", func(t *testing.T) {
+		verified, err := storage.VerifyCredentials(username, password)
 
 		require.NoError(t, err)
-		assert.NotEmpty(t, token)
-
-		// Простая проверка, что это похоже на JWT токен
-		// JWT токен должен содержать две точки, разделяющие три части
-		assert.Contains(t, token, ".")
-		parts := 0
-		for _, char := range token {
-			if char == '.' {
-				parts++
-			}
-		}
-		assert.Equal(t, 2, parts, "JWT token должен состоять из трех частей, разделенных двумя точками")
+		assert.Equal(t, registered.ID, verified.ID)
+		assert.Equal(t, username, verified.Username)
 	})
 
 	t.Run("Login with incorrect password", func(t *testing.T) {
-		_, err := storage.LoginUser(username, "wrongpassword")
+		_, err := storage.VerifyCredentials(username, "wrongpassword")
 		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "incorrect")
+		assert.ErrorIs(t, err, user.ErrInvalidCredentials)
 	})
 
 	t.Run("Login with non-existent user", func(t *testing.T) {
-		_, err := storage.LoginUser("nonexistentuser", "anypassword")
+		_, err := storage.VerifyCredentials("nonexistentuser", "anypassword")
 
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "not found")
+		// та же ошибка, что и при неверном пароле - имя пользователя не раскрывается
+		assert.ErrorIs(t, err, user.ErrInvalidCredentials)
 	})
 }
 
 func TestUserMemoryStorage_ConcurrentOperations(t *testing.T) {
 	storage := NewUserMemoryStorage()
 
-	originalJWTSecret := os.Getenv("JWT_SECRET")
-	err := os.Setenv("JWT_SECRET", "test_secret_key_for_jwt")
-	require.NoError(t, err)
-
-	defer os.Setenv("JWT_SECRET", originalJWTSecret)
-
 	t.Run("Concurrent user registration", func(t *testing.T) {
 		var wg sync.WaitGroup
 		numGoroutines := 10
@@ -113,7 +93,7 @@ func TestUserMemoryStorage_ConcurrentOperations(t *testing.T) {
 
 				username := "concurrent_user_" + strconv.Itoa(idx)
 				email := "concurrent" + strconv.Itoa(idx) + "@example.com"
-				password := "pass" + strconv.Itoa(idx)
+				password := "password_" + strconv.Itoa(idx)
 
 				user, err := storage.RegisterUser(username, email, password)
 
@@ -145,9 +125,9 @@ func TestUserMemoryStorage_ConcurrentOperations(t *testing.T) {
 			go func() {
 				defer wg.Done()
 
-				token, err := storage.LoginUser(username, password)
+				verified, err := storage.VerifyCredentials(username, password)
 				assert.NoError(t, err)
-				assert.NotEmpty(t, token)
+				assert.NotNil(t, verified)
 			}()
 		}
 
@@ -158,12 +138,6 @@ func TestUserMemoryStorage_ConcurrentOperations(t *testing.T) {
 func TestUserMemoryStorage_MixedConcurrentOperations(t *testing.T) {
 	storage := NewUserMemoryStorage()
 
-	originalJWTSecret := os.Getenv("JWT_SECRET")
-	err := os.Setenv("JWT_SECRET", "test_secret_key_for_jwt")
-	require.NoError(t, err)
-
-	defer os.Setenv("JWT_SECRET", originalJWTSecret)
-
 	// Регистрируем некоторых пользователей заранее
 	preregisteredUsers := 5
 	for i := 0; i < preregisteredUsers; i++ {
@@ -214,9 +188,9 @@ func TestUserMemoryStorage_MixedConcurrentOperations(t *testing.T) {
 				username := "preregistered_user_" + strconv.Itoa(idx)
 				password := "preregistered_pass" + strconv.Itoa(idx)
 
-				token, err := storage.LoginUser(username, password)
+				verified, err := storage.VerifyCredentials(username, password)
 				assert.NoError(t, err)
-				assert.NotEmpty(t, token)
+				assert.NotNil(t, verified)
 			}(i)
 		}
 
@@ -230,9 +204,9 @@ func TestUserMemoryStorage_MixedConcurrentOperations(t *testing.T) {
 				case username := <-registeredCh:
 					password := "mixed_pass" + username[len("mixed_user_"):]
 					// Пытаемся войти как этот пользователь
-					token, err := storage.LoginUser(username, password)
+					verified, err := storage.VerifyCredentials(username, password)
 					assert.NoError(t, err)
-					assert.NotEmpty(t, token)
+					assert.NotNil(t, verified)
 				case <-time.After(time.Second):
 					// Тайм-аут, если ни одна регистрация не завершилась вовремя
 					t.Log("Timeout waiting for registration")
@@ -268,9 +242,9 @@ func TestUserMemoryStorage_MixedConcurrentOperations(t *testing.T) {
 			defer wg.Done()
 			// Небольшая задержка, чтобы увеличить шансы на доступ
 			time.Sleep(10 * time.Millisecond)
-			token, err := storage.LoginUser(username, password)
+			verified, err := storage.VerifyCredentials(username, password)
 			loginErr = err
-			loginSuccess = (err == nil && token != "")
+			loginSuccess = (err == nil && verified != nil)
 		}()
 
 		wg.Wait()
@@ -280,8 +254,334 @@ func TestUserMemoryStorage_MixedConcurrentOperations(t *testing.T) {
 				// Все ок, регистрация и вход прошли успешно
 			} else {
 				// Возможно, вход был слишком рано
-				assert.Contains(t, loginErr.Error(), "not found")
+				assert.ErrorIs(t, loginErr, user.ErrInvalidCredentials)
 			}
 		}
 	})
 }
+
+func TestUserMemoryStorage_DeleteUser(t *testing.T) {
+	storage := NewUserMemoryStorage()
+
+	user, err := storage.RegisterUser("deleteuser", "delete@example.com", "s3cure-passw0rd")
+	require.NoError(t, err)
+
+	t.Run("Check password", func(t *testing.T) {
+		assert.Error(t, storage.CheckPassword(user.ID, "wrongpassword"))
+		assert.NoError(t, storage.CheckPassword(user.ID, "s3cure-passw0rd"))
+		assert.Error(t, storage.CheckPassword("999", "s3cure-passw0rd"))
+	})
+
+	t.Run("Delete user", func(t *testing.T) {
+		err := storage.DeleteUser(user.ID)
+		require.NoError(t, err)
+
+		// учетные данные удалены - проверить пароль нельзя, имя снова свободно
+		assert.Error(t, storage.CheckPassword(user.ID, "s3cure-passw0rd"))
+		_, err = storage.RegisterUser("deleteuser", "delete@example.com", "s3cure-passw0rd")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Delete non-existent user", func(t *testing.T) {
+		err := storage.DeleteUser("999")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "not found")
+	})
+}
+
+func TestUserMemoryStorage_FindOrCreateByIdentity(t *testing.T) {
+	storage := NewUserMemoryStorage()
+
+	_, err := storage.RegisterUser("oidcuser", "local@example.com", "s3cure-passw0rd")
+	require.NoError(t, err)
+
+	t.Run("First login creates account", func(t *testing.T) {
+		user, err := storage.FindOrCreateByIdentity("https://idp", "sub-1", "oidcuser", "oidc@example.com")
+		require.NoError(t, err)
+		// имя занято - добавляется суффикс
+		assert.Equal(t, "oidcuser2", user.Username)
+
+		// пароля нет - вход по паролю невозможен
+		_, err = storage.VerifyCredentials("oidcuser2", "")
+		assert.Error(t, err)
+	})
+
+	t.Run("Next login returns linked account", func(t *testing.T) {
+		user, err := storage.FindOrCreateByIdentity("https://idp", "sub-1", "other", "other@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "oidcuser2", user.Username)
+	})
+
+	t.Run("Find by identity", func(t *testing.T) {
+		user, err := storage.FindUserByIdentity("https://idp", "sub-1")
+		require.NoError(t, err)
+		require.NotNil(t, user)
+		assert.Equal(t, "oidcuser2", user.Username)
+
+		user, err = storage.FindUserByIdentity("https://idp", "unknown")
+		require.NoError(t, err)
+		assert.Nil(t, user)
+	})
+
+	t.Run("Email of password account is not linked", func(t *testing.T) {
+		_, err := storage.FindOrCreateByIdentity("https://idp", "sub-2", "someone", "local@example.com")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "already registered")
+	})
+
+	t.Run("Delete user removes identity", func(t *testing.T) {
+		user, err := storage.FindOrCreateByIdentity("https://idp", "sub-3", "temp", "temp@example.com")
+		require.NoError(t, err)
+		require.NoError(t, storage.DeleteUser(user.ID))
+
+		again, err := storage.FindOrCreateByIdentity("https://idp", "sub-3", "temp", "temp@example.com")
+		require.NoError(t, err)
+		assert.NotEqual(t, user.ID, again.ID)
+	})
+}
+
+func TestUserMemoryStorage_TwoFactor(t *testing.T) {
+	storage := NewUserMemoryStorage()
+
+	u, err := storage.RegisterUser("testuser", "test@example.com", "s3cure-passw0rd")
+	require.NoError(t, err)
+
+	t.Run("No settings", func(t *testing.T) {
+		state, err := storage.GetTwoFactor(u.ID)
+		require.NoError(t, err)
+		assert.Nil(t, state)
+	})
+
+	t.Run("Save and get", func(t *testing.T) {
+		err := storage.SaveTwoFactor(u.ID, &user.TwoFactor{Secret: "v1:encrypted"})
+		require.NoError(t, err)
+
+		err = storage.SaveTwoFactor(u.ID, &user.TwoFactor{Secret: "v1:encrypted", Enabled: true, RecoveryCodes: []string{"a", "b"}, LastStep: 10})
+		require.NoError(t, err)
+
+		state, err := storage.GetTwoFactor(u.ID)
+		require.NoError(t, err)
+		require.NotNil(t, state)
+		assert.True(t, state.Enabled)
+		assert.Equal(t, "v1:encrypted", state.Secret)
+		assert.Equal(t, []string{"a", "b"}, state.RecoveryCodes)
+		assert.Equal(t, int64(10), state.LastStep)
+	})
+
+	t.Run("Code step is used once", func(t *testing.T) {
+		assert.ErrorIs(t, storage.UseTotpStep(u.ID, 10), user.ErrTotpCodeReused)
+		assert.NoError(t, storage.UseTotpStep(u.ID, 11))
+		assert.ErrorIs(t, storage.UseTotpStep(u.ID, 11), user.ErrTotpCodeReused)
+	})
+
+	t.Run("Recovery code is used once", func(t *testing.T) {
+		assert.NoError(t, storage.UseRecoveryCode(u.ID, "a"))
+		assert.ErrorIs(t, storage.UseRecoveryCode(u.ID, "a"), user.ErrRecoveryCodeInvalid)
+
+		state, err := storage.GetTwoFactor(u.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b"}, state.RecoveryCodes)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		require.NoError(t, storage.DeleteTwoFactor(u.ID))
+
+		state, err := storage.GetTwoFactor(u.ID)
+		require.NoError(t, err)
+		assert.Nil(t, state)
+	})
+}
+
+func TestUserMemoryStorage_PasswordHashing(t *testing.T) {
+	storage := NewUserMemoryStorage()
+
+	t.Run("Weak password is rejected", func(t *testing.T) {
+		_, err := storage.RegisterUser("weakuser", "weak@example.com", "password123")
+		assert.ErrorIs(t, err, password.ErrWeakPassword)
+
+		_, err = storage.RegisterUser("weakuser", "weak@example.com", "short")
+		assert.ErrorIs(t, err, password.ErrWeakPassword)
+	})
+
+	t.Run("New passwords use argon2id", func(t *testing.T) {
+		_, err := storage.RegisterUser("argonuser", "argon@example.com", "s3cure-passw0rd")
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(storage.passwords["argonuser"], "$argon2id$"))
+	})
+
+	t.Run("Bcrypt hash is replaced on verification", func(t *testing.T) {
+		_, err := storage.RegisterUser("legacyuser", "legacy@example.com", "s3cure-passw0rd")
+		require.NoError(t, err)
+
+		// пароль, сохраненный до перехода на argon2id
+		legacy, err := bcrypt.GenerateFromPassword([]byte("old-passw0rd"), bcrypt.MinCost)
+		require.NoError(t, err)
+		storage.passwords["legacyuser"] = string(legacy)
+
+		_, err = storage.VerifyCredentials("legacyuser", "old-passw0rd")
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(storage.passwords["legacyuser"], "$argon2id$"))
+
+		// со старым паролем по-прежнему можно войти
+		_, err = storage.VerifyCredentials("legacyuser", "old-passw0rd")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Rehash does not overwrite changed password", func(t *testing.T) {
+		before := storage.passwords["argonuser"]
+		storage.rehash("argonuser", "stale-hash", "s3cure-passw0rd")
+		assert.Equal(t, before, storage.passwords["argonuser"])
+	})
+
+	t.Run("Password verification does not block other requests", func(t *testing.T) {
+		slow := NewUserMemoryStorage()
+		// проверка с такими параметрами занимает заметное время
+		params := password.DefaultParams()
+		params.Memory = 64 * 1024
+		params.Iterations = 4
+		slow.hasher = password.NewHasher(params)
+
+		u, err := slow.RegisterUser("slowuser", "slow@example.com", "s3cure-passw0rd")
+		require.NoError(t, err)
+		userID, err := strconv.ParseUint(u.ID, 10, 64)
+		require.NoError(t, err)
+
+		verified := make(chan struct{})
+		go func() {
+			defer close(verified)
+			_, _ = slow.VerifyCredentials("slowuser", "wrong-passw0rd")
+		}()
+		time.Sleep(10 * time.Millisecond)
+
+		role, err := slow.GetUserRole(uint(userID))
+		require.NoError(t, err)
+		assert.Equal(t, "USER", role)
+		select {
+		case <-verified:
+			t.Fatal("role lookup waited for password verification")
+		default:
+		}
+		<-verified
+	})
+}
+
+func TestUserMemoryStorage_IdentityUniqueness(t *testing.T) {
+	storage := NewUserMemoryStorage()
+
+	_, err := storage.RegisterUser("Alice", "Alice@Example.com", "s3cure-passw0rd")
+	require.NoError(t, err)
+
+	t.Run("Username differing only in case is taken", func(t *testing.T) {
+		_, err := storage.RegisterUser("ALICE", "other@example.com", "s3cure-passw0rd")
+		assert.ErrorIs(t, err, identity.ErrUsernameTaken)
+	})
+
+	t.Run("Email differing only in case is taken", func(t *testing.T) {
+		_, err := storage.RegisterUser("bob", "alice@example.COM", "s3cure-passw0rd")
+		assert.ErrorIs(t, err, identity.ErrEmailTaken)
+	})
+
+	t.Run("Invalid and reserved names are rejected", func(t *testing.T) {
+		_, err := storage.RegisterUser("Admin", "admin@example.com", "s3cure-passw0rd")
+		assert.ErrorIs(t, err, &identity.FieldError{Field: identity.FieldUsername, Reason: identity.ReasonReserved})
+
+		_, err = storage.RegisterUser("a b", "bad", "s3cure-passw0rd")
+		assert.Len(t, identity.Fields(err), 2)
+	})
+
+	t.Run("Bootstrap administrator may take reserved name", func(t *testing.T) {
+		user, err := storage.CreateAdmin("Root", "root@example.com", "s3cure-passw0rd")
+		require.NoError(t, err)
+		assert.Equal(t, model.RoleAdmin, user.Role)
+	})
+
+	t.Run("Login ignores case", func(t *testing.T) {
+		user, err := storage.VerifyCredentials("alice", "s3cure-passw0rd")
+		require.NoError(t, err)
+		assert.Equal(t, "Alice", user.Username)
+	})
+}
+
+func TestUserMemoryStorage_ChangeUsername(t *testing.T) {
+	storage := NewUserMemoryStorage()
+
+	alice, err := storage.RegisterUser("alice", "alice@example.com", "s3cure-passw0rd")
+	require.NoError(t, err)
+	_, err = storage.RegisterUser("bob", "bob@example.com", "s3cure-passw0rd")
+	require.NoError(t, err)
+
+	// сдвигает последнюю смену имени в прошлое, как будто прошло d
+	rewind := func(userID string, d time.Duration) {
+		storage.mu.Lock()
+		defer storage.mu.Unlock()
+		for _, change := range storage.history[userID] {
+			change.ChangedAt = change.ChangedAt.Add(-d)
+		}
+	}
+
+	t.Run("Rename keeps password and history", func(t *testing.T) {
+		found, err := storage.ChangeUsername(alice.ID, "Alicia")
+		require.NoError(t, err)
+		assert.Equal(t, "Alicia", found.Username)
+
+		_, err = storage.VerifyCredentials("alicia", "s3cure-passw0rd")
+		assert.NoError(t, err)
+		_, err = storage.VerifyCredentials("alice", "s3cure-passw0rd")
+		assert.ErrorIs(t, err, user.ErrInvalidCredentials)
+
+		history, err := storage.GetUsernameHistory(alice.ID)
+		require.NoError(t, err)
+		require.Len(t, history, 1)
+		assert.Equal(t, "alice", history[0].Username)
+	})
+
+	t.Run("Old handle resolves to renamed account", func(t *testing.T) {
+		found, err := storage.GetUserByUsername("ALICE")
+		require.NoError(t, err)
+		assert.Equal(t, alice.ID, found.ID)
+	})
+
+	t.Run("Cooldown between changes", func(t *testing.T) {
+		_, err := storage.ChangeUsername(alice.ID, "alicia2")
+		assert.ErrorIs(t, err, user.ErrUsernameChangeTooSoon)
+	})
+
+	t.Run("Released handle is held during grace period", func(t *testing.T) {
+		bob, err := storage.GetUserByUsername("bob")
+		require.NoError(t, err)
+
+		_, err = storage.ChangeUsername(bob.ID, "alice")
+		assert.ErrorIs(t, err, identity.ErrUsernameTaken)
+		_, err = storage.RegisterUser("Alice", "other@example.com", "s3cure-passw0rd")
+		assert.ErrorIs(t, err, identity.ErrUsernameTaken)
+	})
+
+	t.Run("Owner may take the old handle back", func(t *testing.T) {
+		rewind(alice.ID, user.UsernameChangeCooldown)
+
+		found, err := storage.ChangeUsername(alice.ID, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, "alice", found.Username)
+	})
+
+	t.Run("Released handle is free after grace period", func(t *testing.T) {
+		rewind(alice.ID, user.UsernameChangeCooldown)
+		_, err := storage.ChangeUsername(alice.ID, "alicia")
+		require.NoError(t, err)
+		rewind(alice.ID, user.UsernameGracePeriod)
+
+		carol, err := storage.RegisterUser("alice", "carol@example.com", "s3cure-passw0rd")
+		require.NoError(t, err)
+
+		found, err := storage.GetUserByUsername("alice")
+		require.NoError(t, err)
+		assert.Equal(t, carol.ID, found.ID)
+	})
+
+	t.Run("Validation errors", func(t *testing.T) {
+		_, err := storage.ChangeUsername(alice.ID, "alicia")
+		assert.ErrorIs(t, err, user.ErrUsernameUnchanged)
+		_, err = storage.ChangeUsername(alice.ID, "root")
+		assert.ErrorIs(t, err, &identity.FieldError{Field: identity.FieldUsername, Reason: identity.ReasonReserved})
+	})
+}
@@ -0,0 +1,258 @@
+package memory
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VitaminP8/postery/internal/webhook"
+)
+
+type WebhookMemoryStorage struct {
+	mu             sync.Mutex
+	webhooks       map[string]*webhook.Webhook  // id -> вебхук
+	deliveries     map[string]*webhook.Delivery // id -> доставка
+	nextWebhookId  int
+	nextDeliveryId int
+}
+
+func NewWebhookMemoryStorage() *WebhookMemoryStorage {
+	return &WebhookMemoryStorage{
+		webhooks:       make(map[string]*webhook.Webhook),
+		deliveries:     make(map[string]*webhook.Delivery),
+		nextWebhookId:  1,
+		nextDeliveryId: 1,
+	}
+}
+
+func (s *WebhookMemoryStorage) CreateWebhook(hook *webhook.Webhook) (*webhook.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *hook
+	stored.ID = strconv.Itoa(s.nextWebhookId)
+	stored.Events = append([]webhook.Event(nil), hook.Events...)
+	stored.CreatedAt = time.Now()
+	s.nextWebhookId++
+
+	s.webhooks[stored.ID] = &stored
+	return copyWebhook(&stored), nil
+}
+
+func (s *WebhookMemoryStorage) GetWebhook(id string) (*webhook.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hook, ok := s.webhooks[id]
+	if !ok {
+		return nil, webhook.ErrWebhookNotFound
+	}
+	return copyWebhook(hook), nil
+}
+
+func (s *WebhookMemoryStorage) GetWebhooks(ownerID string) ([]*webhook.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hooks := []*webhook.Webhook{}
+	for _, hook := range s.webhooks {
+		if ownerID == "" || hook.OwnerID == ownerID {
+			hooks = append(hooks, copyWebhook(hook))
+		}
+	}
+
+	// от новых к старым
+	sort.Slice(hooks, func(i, j int) bool {
+		return idLess(hooks[j].ID, hooks[i].ID)
+	})
+	return hooks, nil
+}
+
+func (s *WebhookMemoryStorage) GetWebhooksForEvent(event webhook.Event) ([]*webhook.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hooks := []*webhook.Webhook{}
+	for _, hook := range s.webhooks {
+		if hook.Accepts(event) {
+			hooks = append(hooks, copyWebhook(hook))
+		}
+	}
+	return hooks, nil
+}
+
+func (s *WebhookMemoryStorage) DeleteWebhook(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[id]; !ok {
+		return webhook.ErrWebhookNotFound
+	}
+	s.deleteWebhook(id)
+	return nil
+}
+
+func (s *WebhookMemoryStorage) DeleteWebhooksByOwner(ownerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, hook := range s.webhooks {
+		if hook.OwnerID == ownerID {
+			s.deleteWebhook(id)
+		}
+	}
+	return nil
+}
+
+// deleteWebhook удаляет вебхук и его доставки; вызывается под s.mu
+func (s *WebhookMemoryStorage) deleteWebhook(id string) {
+	delete(s.webhooks, id)
+	for deliveryID, delivery := range s.deliveries {
+		if delivery.WebhookID == id {
+			delete(s.deliveries, deliveryID)
+		}
+	}
+}
+
+func (s *WebhookMemoryStorage) CreateDelivery(delivery *webhook.Delivery) (*webhook.Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[delivery.WebhookID]; !ok {
+		return nil, webhook.ErrWebhookNotFound
+	}
+
+	stored := *delivery
+	stored.ID = strconv.Itoa(s.nextDeliveryId)
+	stored.Status = webhook.StatusPending
+	stored.Attempts = 0
+	stored.Log = nil
+	stored.CreatedAt = time.Now()
+	s.nextDeliveryId++
+
+	s.deliveries[stored.ID] = &stored
+	return copyDelivery(&stored), nil
+}
+
+func (s *WebhookMemoryStorage) GetDelivery(id string) (*webhook.Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return nil, webhook.ErrDeliveryNotFound
+	}
+	return copyDelivery(delivery), nil
+}
+
+func (s *WebhookMemoryStorage) GetDeliveries(webhookID string, limit int) ([]*webhook.Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deliveries := []*webhook.Delivery{}
+	for _, delivery := range s.deliveries {
+		if delivery.WebhookID == webhookID {
+			deliveries = append(deliveries, copyDelivery(delivery))
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		return idLess(deliveries[j].ID, deliveries[i].ID)
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (s *WebhookMemoryStorage) ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]*webhook.Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	due := []*webhook.Delivery{}
+	for _, delivery := range s.deliveries {
+		if delivery.Status == webhook.StatusPending && !delivery.NextAttemptAt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+
+	// сначала самые старые
+	sort.Slice(due, func(i, j int) bool {
+		return idLess(due[i].ID, due[j].ID)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimed := make([]*webhook.Delivery, 0, len(due))
+	for _, delivery := range due {
+		delivery.NextAttemptAt = now.Add(lease)
+		claimed = append(claimed, copyDelivery(delivery))
+	}
+	return claimed, nil
+}
+
+func (s *WebhookMemoryStorage) RecordAttempt(id string, attempt webhook.Attempt, status webhook.Status, attempts int, nextAttemptAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return webhook.ErrDeliveryNotFound
+	}
+	delivery.Log = append(delivery.Log, attempt)
+	delivery.Status = status
+	delivery.Attempts = attempts
+	delivery.NextAttemptAt = nextAttemptAt
+	return nil
+}
+
+func (s *WebhookMemoryStorage) RetryDelivery(id string, now time.Time) (*webhook.Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return nil, webhook.ErrDeliveryNotFound
+	}
+	if delivery.Status != webhook.StatusFailed {
+		return nil, webhook.ErrNotFailed
+	}
+
+	delivery.Status = webhook.StatusPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = now
+	return copyDelivery(delivery), nil
+}
+
+func (s *WebhookMemoryStorage) PruneDeliveries(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, delivery := range s.deliveries {
+		if delivery.Status != webhook.StatusPending && delivery.CreatedAt.Before(before) {
+			delete(s.deliveries, id)
+		}
+	}
+	return nil
+}
+
+// idLess сравнивает числовые ID
+func idLess(a, b string) bool {
+	x, _ := strconv.Atoi(a)
+	y, _ := strconv.Atoi(b)
+	return x < y
+}
+
+func copyWebhook(hook *webhook.Webhook) *webhook.Webhook {
+	result := *hook
+	result.Events = append([]webhook.Event(nil), hook.Events...)
+	return &result
+}
+
+func copyDelivery(delivery *webhook.Delivery) *webhook.Delivery {
+	result := *delivery
+	result.Log = append([]webhook.Attempt(nil), delivery.Log...)
+	return &result
+}
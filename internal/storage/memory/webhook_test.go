@@ -0,0 +1,121 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VitaminP8/postery/internal/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookMemoryStorage(t *testing.T) {
+	storage := NewWebhookMemoryStorage()
+
+	create := func(ownerID string, events ...webhook.Event) *webhook.Webhook {
+		hook, err := storage.CreateWebhook(&webhook.Webhook{
+			OwnerID: ownerID,
+			URL:     "https://example.com/hook",
+			Events:  events,
+			Secret:  "secret",
+		})
+		require.NoError(t, err)
+		return hook
+	}
+
+	comments := create("1", webhook.EventCommentCreated)
+	posts := create("2", webhook.EventPostPublished, webhook.EventPostDeleted)
+
+	t.Run("Webhooks by owner and event", func(t *testing.T) {
+		hooks, err := storage.GetWebhooks("1")
+		require.NoError(t, err)
+		require.Len(t, hooks, 1)
+		assert.Equal(t, comments.ID, hooks[0].ID)
+
+		all, err := storage.GetWebhooks("")
+		require.NoError(t, err)
+		require.Len(t, all, 2)
+		assert.Equal(t, posts.ID, all[0].ID)
+
+		hooks, err = storage.GetWebhooksForEvent(webhook.EventPostDeleted)
+		require.NoError(t, err)
+		require.Len(t, hooks, 1)
+		assert.Equal(t, posts.ID, hooks[0].ID)
+	})
+
+	t.Run("Claim takes due deliveries once", func(t *testing.T) {
+		now := time.Now()
+		due, err := storage.CreateDelivery(&webhook.Delivery{WebhookID: comments.ID, Event: webhook.EventCommentCreated, Payload: []byte("{}"), NextAttemptAt: now})
+		require.NoError(t, err)
+		assert.Equal(t, webhook.StatusPending, due.Status)
+		_, err = storage.CreateDelivery(&webhook.Delivery{WebhookID: comments.ID, Event: webhook.EventCommentCreated, Payload: []byte("{}"), NextAttemptAt: now.Add(time.Hour)})
+		require.NoError(t, err)
+
+		claimed, err := storage.ClaimDueDeliveries(now, time.Minute, 10)
+		require.NoError(t, err)
+		require.Len(t, claimed, 1)
+		assert.Equal(t, due.ID, claimed[0].ID)
+
+		claimed, err = storage.ClaimDueDeliveries(now, time.Minute, 10)
+		require.NoError(t, err)
+		assert.Empty(t, claimed)
+
+		// отправитель не записал результат - после lease доставка снова доступна
+		claimed, err = storage.ClaimDueDeliveries(now.Add(2*time.Minute), time.Minute, 10)
+		require.NoError(t, err)
+		assert.Len(t, claimed, 1)
+	})
+
+	t.Run("Attempts are logged and failed delivery can be retried", func(t *testing.T) {
+		delivery, err := storage.CreateDelivery(&webhook.Delivery{WebhookID: posts.ID, Event: webhook.EventPostPublished, Payload: []byte("{}"), NextAttemptAt: time.Now()})
+		require.NoError(t, err)
+
+		_, err = storage.RetryDelivery(delivery.ID, time.Now())
+		assert.ErrorIs(t, err, webhook.ErrNotFailed)
+
+		attempt := webhook.Attempt{At: time.Now(), StatusCode: 500, Error: "unexpected response status 500"}
+		require.NoError(t, storage.RecordAttempt(delivery.ID, attempt, webhook.StatusFailed, 3, time.Time{}))
+
+		stored, err := storage.GetDelivery(delivery.ID)
+		require.NoError(t, err)
+		assert.Equal(t, webhook.StatusFailed, stored.Status)
+		assert.Equal(t, 3, stored.Attempts)
+		require.Len(t, stored.Log, 1)
+		assert.Equal(t, 500, stored.Log[0].StatusCode)
+
+		retried, err := storage.RetryDelivery(delivery.ID, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, webhook.StatusPending, retried.Status)
+		assert.Equal(t, 0, retried.Attempts)
+		assert.Len(t, retried.Log, 1)
+	})
+
+	t.Run("Deliveries are listed newest first", func(t *testing.T) {
+		deliveries, err := storage.GetDeliveries(comments.ID, 1)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, "2", deliveries[0].ID)
+	})
+
+	t.Run("Prune keeps pending deliveries", func(t *testing.T) {
+		require.NoError(t, storage.PruneDeliveries(time.Now().Add(time.Hour)))
+
+		deliveries, err := storage.GetDeliveries(comments.ID, 10)
+		require.NoError(t, err)
+		assert.Len(t, deliveries, 2)
+	})
+
+	t.Run("Deleting webhook deletes deliveries", func(t *testing.T) {
+		deliveries, err := storage.GetDeliveries(posts.ID, 10)
+		require.NoError(t, err)
+		require.NotEmpty(t, deliveries)
+
+		require.NoError(t, storage.DeleteWebhooksByOwner("2"))
+		_, err = storage.GetWebhook(posts.ID)
+		assert.ErrorIs(t, err, webhook.ErrWebhookNotFound)
+		_, err = storage.GetDelivery(deliveries[0].ID)
+		assert.ErrorIs(t, err, webhook.ErrDeliveryNotFound)
+
+		assert.ErrorIs(t, storage.DeleteWebhook(posts.ID), webhook.ErrWebhookNotFound)
+	})
+}
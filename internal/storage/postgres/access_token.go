@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/models"
+	"github.com/jinzhu/gorm"
+)
+
+type AccessTokenPostgresStorage struct{}
+
+func NewAccessTokenPostgresStorage() *AccessTokenPostgresStorage {
+	return &AccessTokenPostgresStorage{}
+}
+
+func (s *AccessTokenPostgresStorage) CreateAccessToken(token *auth.AccessToken, hash string) (*auth.AccessToken, error) {
+	record := &models.AccessToken{
+		UserID:    token.UserID,
+		Name:      token.Name,
+		TokenHash: hash,
+		Scopes:    strings.Join(token.Scopes, ","),
+		ExpiresAt: token.ExpiresAt,
+	}
+
+	err := DB.Create(record).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not create access token: %w", err)
+	}
+
+	return toAccessToken(record), nil
+}
+
+func (s *AccessTokenPostgresStorage) GetAccessTokens(userID uint) ([]*auth.AccessToken, error) {
+	var records []models.AccessToken
+	err := DB.Where("user_id = ?", userID).Order("id").Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get access tokens: %w", err)
+	}
+
+	tokens := []*auth.AccessToken{}
+	for i := range records {
+		tokens = append(tokens, toAccessToken(&records[i]))
+	}
+	return tokens, nil
+}
+
+func (s *AccessTokenPostgresStorage) RevokeAccessToken(userID uint, id string) error {
+	result := DB.Where("id = ? AND user_id = ?", id, userID).Delete(&models.AccessToken{})
+	if result.Error != nil {
+		return fmt.Errorf("could not revoke access token: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return auth.ErrAccessTokenNotFound
+	}
+
+	return nil
+}
+
+func (s *AccessTokenPostgresStorage) DeleteUserAccessTokens(userID uint) error {
+	return deleteUserAccessTokens(DB, userID)
+}
+
+func deleteUserAccessTokens(db *gorm.DB, userID uint) error {
+	err := db.Where("user_id = ?", userID).Delete(&models.AccessToken{}).Error
+	if err != nil {
+		return fmt.Errorf("could not delete access tokens: %w", err)
+	}
+	return nil
+}
+
+func (s *AccessTokenPostgresStorage) UseAccessToken(hash string, now time.Time) (*auth.AccessToken, error) {
+	var record models.AccessToken
+	err := DB.Where("token_hash = ?", hash).First(&record).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, auth.ErrAccessTokenNotFound
+		}
+		return nil, fmt.Errorf("could not get access token: %w", err)
+	}
+
+	err = DB.Model(&record).Update("last_used_at", now).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not update access token: %w", err)
+	}
+
+	return toAccessToken(&record), nil
+}
+
+func toAccessToken(record *models.AccessToken) *auth.AccessToken {
+	var scopes []string
+	if record.Scopes != "" {
+		scopes = strings.Split(record.Scopes, ",")
+	}
+
+	return &auth.AccessToken{
+		ID:         fmt.Sprint(record.ID),
+		UserID:     record.UserID,
+		Name:       record.Name,
+		Scopes:     scopes,
+		CreatedAt:  record.CreatedAt,
+		ExpiresAt:  record.ExpiresAt,
+		LastUsedAt: record.LastUsedAt,
+	}
+}
@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessTokenPostgresStorage(t *testing.T) {
+	// Настраиваем тестовую БД
+	oldDB := setupTestDB(t)
+	defer teardownTestDB(oldDB)
+
+	storage := NewAccessTokenPostgresStorage()
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	created, err := storage.CreateAccessToken(&auth.AccessToken{
+		UserID:    1,
+		Name:      "ci bot",
+		Scopes:    []string{auth.ScopeRead, auth.ScopeCommentWrite},
+		ExpiresAt: &expiresAt,
+	}, "hash-1")
+	require.NoError(t, err)
+	assert.NotEmpty(t, created.ID)
+	assert.False(t, created.CreatedAt.IsZero())
+
+	_, err = storage.CreateAccessToken(&auth.AccessToken{UserID: 2, Name: "other", Scopes: []string{auth.ScopeRead}}, "hash-2")
+	require.NoError(t, err)
+
+	t.Run("List user tokens", func(t *testing.T) {
+		tokens, err := storage.GetAccessTokens(1)
+		require.NoError(t, err)
+		require.Len(t, tokens, 1)
+		assert.Equal(t, "ci bot", tokens[0].Name)
+		assert.Equal(t, []string{auth.ScopeRead, auth.ScopeCommentWrite}, tokens[0].Scopes)
+		assert.True(t, expiresAt.Equal(*tokens[0].ExpiresAt))
+		assert.Nil(t, tokens[0].LastUsedAt)
+	})
+
+	t.Run("Use token by hash", func(t *testing.T) {
+		now := time.Now()
+		token, err := storage.UseAccessToken("hash-1", now)
+		require.NoError(t, err)
+		assert.Equal(t, uint(1), token.UserID)
+
+		tokens, err := storage.GetAccessTokens(1)
+		require.NoError(t, err)
+		require.NotNil(t, tokens[0].LastUsedAt)
+		assert.Equal(t, now.Unix(), tokens[0].LastUsedAt.Unix())
+
+		_, err = storage.UseAccessToken("unknown", now)
+		assert.ErrorIs(t, err, auth.ErrAccessTokenNotFound)
+	})
+
+	t.Run("Revoke only own token", func(t *testing.T) {
+		err := storage.RevokeAccessToken(2, created.ID)
+		assert.ErrorIs(t, err, auth.ErrAccessTokenNotFound)
+
+		err = storage.RevokeAccessToken(1, created.ID)
+		require.NoError(t, err)
+
+		_, err = storage.UseAccessToken("hash-1", time.Now())
+		assert.ErrorIs(t, err, auth.ErrAccessTokenNotFound)
+
+		tokens, err := storage.GetAccessTokens(1)
+		require.NoError(t, err)
+		assert.Empty(t, tokens)
+	})
+}
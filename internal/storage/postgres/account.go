@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"fmt"
+
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/jinzhu/gorm"
+)
+
+// AccountPostgresStorage удаляет аккаунт одной транзакцией. События об удаленных и анонимизированных постах
+// публикуются через хранилище постов после фиксации транзакции.
+type AccountPostgresStorage struct {
+	posts *PostPostgresStorage
+}
+
+func NewAccountPostgresStorage(posts *PostPostgresStorage) *AccountPostgresStorage {
+	return &AccountPostgresStorage{posts: posts}
+}
+
+func (s *AccountPostgresStorage) DeleteAccount(userID uint, anonymize bool) error {
+	id := fmt.Sprint(userID)
+
+	var deleted []uint
+	var anonymized []*model.Post
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if anonymize {
+			err = anonymizeCommentsByAuthor(tx, id)
+			if err == nil {
+				anonymized, err = anonymizePostsByAuthor(tx, id)
+			}
+		} else {
+			err = deleteCommentsByAuthor(tx, id)
+			if err == nil {
+				deleted, err = deletePostsByAuthor(tx, id)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		err = deleteUser(tx, id)
+		if err == nil {
+			err = deleteRelationsOf(tx, id)
+		}
+		if err == nil {
+			err = deleteMentionsOf(tx, id)
+		}
+		if err == nil {
+			err = deleteWebhooksByOwner(tx, id)
+		}
+		if err == nil {
+			err = deleteUserSessions(tx, userID)
+		}
+		if err == nil {
+			err = deleteUserAccessTokens(tx, userID)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.posts.publishDeleted(deleted)
+	s.posts.publishUpdated(anonymized)
+	return nil
+}
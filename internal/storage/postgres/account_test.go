@@ -0,0 +1,71 @@
+package postgres
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/VitaminP8/postery/internal/mocks"
+	"github.com/VitaminP8/postery/internal/subscription"
+	"github.com/VitaminP8/postery/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountPostgresStorage_DeleteAccount(t *testing.T) {
+	// Настраиваем тестовую БД
+	oldDB := setupTestDB(t)
+	defer teardownTestDB(oldDB)
+
+	manager := mocks.NewMockSubscriptionManager()
+	storage := NewAccountPostgresStorage(NewPostPostgresStorage(manager))
+
+	// addUserData создает пост, сессию, токен доступа и подписку пользователя userID
+	addUserData := func(t *testing.T, userID uint) uint {
+		postID := createTestPost(t, userID, "Title", "Content")
+		require.NoError(t, DB.Create(&models.Session{ID: fmt.Sprint("session-", userID), UserID: userID, CreatedAt: time.Now()}).Error)
+		require.NoError(t, DB.Create(&models.AccessToken{UserID: userID, Name: "ci", TokenHash: fmt.Sprint("hash-", userID)}).Error)
+		require.NoError(t, DB.Create(&models.UserRelation{UserID: userID, TargetID: userID + 100, Kind: "follow"}).Error)
+		return postID
+	}
+	count := func(t *testing.T, model interface{}, userID uint) int {
+		var n int
+		require.NoError(t, DB.Model(model).Where("user_id = ?", userID).Count(&n).Error)
+		return n
+	}
+
+	t.Run("Account is deleted with sessions and access tokens", func(t *testing.T) {
+		userID := createTestUser(t)
+		postID := addUserData(t, userID)
+
+		require.NoError(t, storage.DeleteAccount(userID, false))
+
+		var users int
+		require.NoError(t, DB.Model(&models.User{}).Where("id = ?", userID).Count(&users).Error)
+		assert.Zero(t, users)
+		assert.Zero(t, count(t, &models.Post{}, userID))
+		assert.Zero(t, count(t, &models.Session{}, userID))
+		assert.Zero(t, count(t, &models.AccessToken{}, userID))
+		assert.Zero(t, count(t, &models.UserRelation{}, userID))
+
+		// событие об удалении поста публикуется после фиксации транзакции
+		events := manager.GetEventsForTopic(subscription.PostTopic(fmt.Sprint(postID)))
+		require.Len(t, events, 1)
+		assert.Equal(t, subscription.EventPostDeleted, events[0].Type)
+	})
+
+	t.Run("Failed deletion keeps all data", func(t *testing.T) {
+		// данные пользователя без записи в users: удаление учетной записи завершится ошибкой
+		const userID = 999
+		postID := addUserData(t, userID)
+
+		err := storage.DeleteAccount(userID, false)
+		assert.Error(t, err)
+
+		assert.Equal(t, 1, count(t, &models.Post{}, userID))
+		assert.Equal(t, 1, count(t, &models.Session{}, userID))
+		assert.Equal(t, 1, count(t, &models.AccessToken{}, userID))
+		assert.Equal(t, 1, count(t, &models.UserRelation{}, userID))
+		assert.Empty(t, manager.GetEventsForTopic(subscription.PostTopic(fmt.Sprint(postID))))
+	})
+}
@@ -3,13 +3,17 @@ package postgres
 import (
 	"context"
 	"fmt"
+	"log"
 	"strconv"
 	"time"
 
 	"github.com/VitaminP8/postery/graph/model"
 	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/comment"
 	"github.com/VitaminP8/postery/internal/subscription"
+	"github.com/VitaminP8/postery/internal/user"
 	"github.com/VitaminP8/postery/models"
+	"github.com/jinzhu/gorm"
 )
 
 type CommentPostgresStorage struct {
@@ -29,7 +33,7 @@ func (s *CommentPostgresStorage) CreateComment(ctx context.Context, postID, pare
 
 	userID, err := auth.GetUserIDFromContext(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("unautorized: %w", err)
+		return nil, err
 	}
 
 	postIDint, err := strconv.Atoi(postID)
@@ -96,12 +100,46 @@ func (s *CommentPostgresStorage) CreateComment(ctx context.Context, postID, pare
 	}
 
 	if s.manager != nil {
-		s.manager.Publish(postID, result)
+		ancestors, err := ancestorIDs(comment.ParentID)
+		if err != nil {
+			// комментарий уже сохранен - без предков событие получат только подписчики поста
+			log.Printf("could not resolve ancestors of comment %d: %v", comment.ID, err)
+		}
+		subscription.PublishComment(s.manager, result, ancestors)
 	}
 
 	return result, nil
 }
 
+// ancestorIDs возвращает ID комментария parentID и всех его предков до корня одним рекурсивным запросом
+func ancestorIDs(parentID *uint) ([]string, error) {
+	if parentID == nil {
+		return nil, nil
+	}
+
+	rows, err := DB.Raw(`WITH RECURSIVE ancestors(id, parent_id, depth) AS (
+			SELECT id, parent_id, 0 FROM comments WHERE id = ?
+			UNION ALL
+			SELECT c.id, c.parent_id, a.depth + 1 FROM comments c JOIN ancestors a ON c.id = a.parent_id
+		)
+		SELECT id FROM ancestors ORDER BY depth`, *parentID).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id uint
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, fmt.Sprint(id))
+	}
+	return ids, rows.Err()
+}
+
 func (s *CommentPostgresStorage) GetComments(postID string, limit, offset int) (*model.CommentConnection, error) {
 	postIDUint, err := strconv.Atoi(postID)
 	if err != nil {
@@ -209,3 +247,114 @@ func (s *CommentPostgresStorage) GetReplies(parentID string, limit, offset int)
 		NextOffset: offset + limit,
 	}, nil
 }
+
+// DeleteCommentsByAuthor удаляет комментарии автора.
+// Комментарии с ответами остаются в дереве с текстом "[deleted]" и анонимным автором.
+func (s *CommentPostgresStorage) DeleteCommentsByAuthor(authorID string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return deleteCommentsByAuthor(tx, authorID)
+	})
+}
+
+// deleteCommentsByAuthor - DeleteCommentsByAuthor в транзакции tx
+func deleteCommentsByAuthor(tx *gorm.DB, authorID string) error {
+	// сначала обрабатываем более новые комментарии, чтобы ответы удалялись раньше родителей
+	var own []models.Comment
+	err := tx.Where("user_id = ?", authorID).Order("id desc").Find(&own).Error
+	if err != nil {
+		return fmt.Errorf("could not get comments: %w", err)
+	}
+
+	for _, c := range own {
+		var repliesCount int
+		err = tx.Model(&models.Comment{}).Where("parent_id = ?", c.ID).Count(&repliesCount).Error
+		if err != nil {
+			return fmt.Errorf("could not count replies: %w", err)
+		}
+
+		if repliesCount > 0 {
+			err = tx.Model(&models.Comment{}).Where("id = ?", c.ID).Updates(map[string]interface{}{
+				"content": comment.DeletedContent,
+				"user_id": user.DeletedUserID,
+			}).Error
+			if err != nil {
+				return fmt.Errorf("could not anonymize comment: %w", err)
+			}
+			continue
+		}
+
+		err = tx.Unscoped().Delete(&models.Comment{}, c.ID).Error
+		if err != nil {
+			return fmt.Errorf("could not delete comment: %w", err)
+		}
+
+		if c.ParentID != nil {
+			var siblingsCount int
+			err = tx.Model(&models.Comment{}).Where("parent_id = ?", *c.ParentID).Count(&siblingsCount).Error
+			if err != nil {
+				return fmt.Errorf("could not count replies: %w", err)
+			}
+			err = tx.Model(&models.Comment{}).Where("id = ?", *c.ParentID).Update("has_replies", siblingsCount > 0).Error
+			if err != nil {
+				return fmt.Errorf("could not update parent comment: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *CommentPostgresStorage) AnonymizeCommentsByAuthor(authorID string) error {
+	return anonymizeCommentsByAuthor(DB, authorID)
+}
+
+func anonymizeCommentsByAuthor(db *gorm.DB, authorID string) error {
+	err := db.Model(&models.Comment{}).Where("user_id = ?", authorID).Update("user_id", user.DeletedUserID).Error
+	if err != nil {
+		return fmt.Errorf("could not anonymize comments: %w", err)
+	}
+
+	return nil
+}
+
+func (s *CommentPostgresStorage) GetCommentsByAuthor(authorID string) ([]*model.Comment, error) {
+	var comments []models.Comment
+	err := DB.Where("user_id = ?", authorID).Order("id").Find(&comments).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get comments: %w", err)
+	}
+
+	results := []*model.Comment{}
+	for i := range comments {
+		results = append(results, toComment(&comments[i]))
+	}
+
+	return results, nil
+}
+
+func (s *CommentPostgresStorage) GetCommentByID(id string) (*model.Comment, error) {
+	var c models.Comment
+	err := DB.First(&c, id).Error
+	if err != nil {
+		return nil, fmt.Errorf("comment with ID %s not found", id)
+	}
+	return toComment(&c), nil
+}
+
+func toComment(c *models.Comment) *model.Comment {
+	var parentStr *string
+	if c.ParentID != nil {
+		pid := fmt.Sprint(*c.ParentID)
+		parentStr = &pid
+	}
+	return &model.Comment{
+		ID:         fmt.Sprint(c.ID),
+		PostID:     fmt.Sprint(c.PostID),
+		ParentID:   parentStr,
+		Content:    c.Content,
+		AuthorID:   fmt.Sprint(c.UserID),
+		HasReplies: c.HasReplies,
+		CreatedAt:  c.CreatedAt.Format(time.RFC3339),
+		Children:   []*model.Comment{},
+	}
+}
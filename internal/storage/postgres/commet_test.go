@@ -7,7 +7,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/comment"
 	"github.com/VitaminP8/postery/internal/mocks"
+	"github.com/VitaminP8/postery/internal/subscription"
+	"github.com/VitaminP8/postery/internal/user"
 	"github.com/VitaminP8/postery/models"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
 	"github.com/stretchr/testify/assert"
@@ -90,6 +94,39 @@ func TestCommentPostgresStorage_CreateComment(t *testing.T) {
 		assert.Equal(t, uint(parentIDUint), *dbChildComment.ParentID)
 	})
 
+	t.Run("Reply is published to every ancestor thread", func(t *testing.T) {
+		// Настраиваем тестовую БД
+		oldDB := setupTestDB(t)
+		defer teardownTestDB(oldDB)
+
+		// отдельный менеджер: ID комментариев в новой БД совпадают с предыдущими тестами
+		subscriptionManager := mocks.NewMockSubscriptionManager()
+		commentStorage := NewCommentPostgresStorage(subscriptionManager)
+
+		userID := createTestUser(t)
+		postID := fmt.Sprint(createTestPost(t, userID, "Test Post", "Test Content"))
+		ctx := createUserContext(userID)
+
+		root, err := commentStorage.CreateComment(ctx, postID, "", "Root")
+		require.NoError(t, err)
+		child, err := commentStorage.CreateComment(ctx, postID, root.ID, "Child")
+		require.NoError(t, err)
+		grandchild, err := commentStorage.CreateComment(ctx, postID, child.ID, "Grandchild")
+		require.NoError(t, err)
+
+		rootReplies := subscriptionManager.GetPublishedForTopic(subscription.RepliesTopic(root.ID))
+		assert.Equal(t, []interface{}{child, grandchild}, rootReplies)
+		childReplies := subscriptionManager.GetPublishedForTopic(subscription.RepliesTopic(child.ID))
+		assert.Equal(t, []interface{}{grandchild}, childReplies)
+
+		parentID, err := strconv.Atoi(*grandchild.ParentID)
+		require.NoError(t, err)
+		parent := uint(parentID)
+		ancestors, err := ancestorIDs(&parent)
+		require.NoError(t, err)
+		assert.Equal(t, []string{child.ID, root.ID}, ancestors)
+	})
+
 	t.Run("Error when creating comment for disabled comments", func(t *testing.T) {
 		// Настраиваем тестовую БД
 		oldDB := setupTestDB(t)
@@ -189,7 +226,7 @@ func TestCommentPostgresStorage_CreateComment(t *testing.T) {
 
 		_, err := commentStorage.CreateComment(unauthorizedCtx, fmt.Sprint(postID), "", "Test Comment")
 		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "unautorized")
+		assert.ErrorIs(t, err, auth.ErrUnauthenticated)
 	})
 }
 
@@ -468,3 +505,96 @@ func TestCommentPostgresStorage_GetReplies(t *testing.T) {
 // Тестирование многопоточности с использованием SQLite в режиме in-memory не имеет смысла
 // SQLite не предназначен для интенсивного параллельного доступа, особенно в режиме in-memory
 // Код в CommentPostgresStorage делегирует всю работу с данными базе данных PostgreSQL, которая имеет встроенное управление параллельным доступом.
+
+func TestCommentPostgresStorage_DeleteAndAnonymizeByAuthor(t *testing.T) {
+	commentStorage := NewCommentPostgresStorage(nil)
+
+	t.Run("Delete comments by author keeps threads with replies", func(t *testing.T) {
+		// Настраиваем тестовую БД
+		oldDB := setupTestDB(t)
+		defer teardownTestDB(oldDB)
+
+		authorID := createTestUser(t)
+		otherID := authorID + 1
+		postID := createTestPost(t, otherID, "Test Post", "Test Content")
+
+		authorCtx := createUserContext(authorID)
+		otherCtx := createUserContext(otherID)
+
+		// комментарий автора с ответом другого пользователя
+		parent, err := commentStorage.CreateComment(authorCtx, fmt.Sprint(postID), "", "Parent")
+		require.NoError(t, err)
+		reply, err := commentStorage.CreateComment(otherCtx, fmt.Sprint(postID), parent.ID, "Reply")
+		require.NoError(t, err)
+
+		// ответ автора без ответов на него
+		ownReply, err := commentStorage.CreateComment(authorCtx, fmt.Sprint(postID), reply.ID, "Own reply")
+		require.NoError(t, err)
+
+		err = commentStorage.DeleteCommentsByAuthor(fmt.Sprint(authorID))
+		require.NoError(t, err)
+
+		// комментарий без ответов удален полностью
+		var deleted models.Comment
+		err = DB.Unscoped().First(&deleted, ownReply.ID).Error
+		assert.Error(t, err)
+
+		// у ответа больше нет вложенных комментариев
+		var dbReply models.Comment
+		require.NoError(t, DB.First(&dbReply, reply.ID).Error)
+		assert.False(t, dbReply.HasReplies)
+
+		// родительский комментарий остался в дереве, но без текста и автора
+		var dbParent models.Comment
+		require.NoError(t, DB.First(&dbParent, parent.ID).Error)
+		assert.Equal(t, comment.DeletedContent, dbParent.Content)
+		assert.Equal(t, user.DeletedUserID, fmt.Sprint(dbParent.UserID))
+	})
+
+	t.Run("Anonymize comments by author", func(t *testing.T) {
+		// Настраиваем тестовую БД
+		oldDB := setupTestDB(t)
+		defer teardownTestDB(oldDB)
+
+		authorID := createTestUser(t)
+		postID := createTestPost(t, authorID, "Test Post", "Test Content")
+
+		created, err := commentStorage.CreateComment(createUserContext(authorID), fmt.Sprint(postID), "", "Comment")
+		require.NoError(t, err)
+
+		err = commentStorage.AnonymizeCommentsByAuthor(fmt.Sprint(authorID))
+		require.NoError(t, err)
+
+		var dbComment models.Comment
+		require.NoError(t, DB.First(&dbComment, created.ID).Error)
+		assert.Equal(t, "Comment", dbComment.Content)
+		assert.Equal(t, user.DeletedUserID, fmt.Sprint(dbComment.UserID))
+	})
+}
+
+func TestCommentPostgresStorage_GetCommentsByAuthor(t *testing.T) {
+	commentStorage := NewCommentPostgresStorage(nil)
+
+	// Настраиваем тестовую БД
+	oldDB := setupTestDB(t)
+	defer teardownTestDB(oldDB)
+
+	userID := createTestUser(t)
+	postID := createTestPost(t, userID, "Test Post", "Test Content")
+	ctx := createUserContext(userID)
+
+	root, err := commentStorage.CreateComment(ctx, fmt.Sprint(postID), "", "Root")
+	require.NoError(t, err)
+	_, err = commentStorage.CreateComment(createUserContext(userID+1), fmt.Sprint(postID), root.ID, "Other")
+	require.NoError(t, err)
+	reply, err := commentStorage.CreateComment(ctx, fmt.Sprint(postID), root.ID, "Reply")
+	require.NoError(t, err)
+
+	comments, err := commentStorage.GetCommentsByAuthor(fmt.Sprint(userID))
+	require.NoError(t, err)
+	require.Len(t, comments, 2)
+	assert.Equal(t, root.ID, comments[0].ID)
+	assert.Equal(t, reply.ID, comments[1].ID)
+	require.NotNil(t, comments[1].ParentID)
+	assert.Equal(t, root.ID, *comments[1].ParentID)
+}
@@ -17,14 +17,9 @@ func GetDB() *gorm.DB {
 	return DB
 }
 
-// InitDB подключается к базе данных PostgreSQL и устанавливает глобальную переменную DB
-func InitDB() error {
-	err := godotenv.Load()
-	if err != nil {
-		log.Println("Error loading .env file")
-	}
-
-	dsn := fmt.Sprintf(
+// DSN - строка подключения к PostgreSQL из переменных окружения DB_*
+func DSN() string {
+	return fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
 		config.GetEnv("DB_HOST"),
 		config.GetEnv("DB_USER"),
@@ -33,8 +28,16 @@ func InitDB() error {
 		config.GetEnv("DB_PORT"),
 		config.GetEnv("DB_SSLMODE"),
 	)
+}
+
+// InitDB подключается к базе данных PostgreSQL и устанавливает глобальную переменную DB
+func InitDB() error {
+	err := godotenv.Load()
+	if err != nil {
+		log.Println("Error loading .env file")
+	}
 
-	db, err := gorm.Open("postgres", dsn)
+	db, err := gorm.Open("postgres", DSN())
 	if err != nil {
 		return fmt.Errorf("failed to connect to the database: %v", err)
 	}
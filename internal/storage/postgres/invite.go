@@ -0,0 +1,143 @@
+package postgres
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/VitaminP8/postery/internal/invite"
+	"github.com/VitaminP8/postery/models"
+	"github.com/jinzhu/gorm"
+)
+
+type InvitePostgresStorage struct{}
+
+func NewInvitePostgresStorage() *InvitePostgresStorage {
+	return &InvitePostgresStorage{}
+}
+
+func (s *InvitePostgresStorage) CreateInvite(inv *invite.Invite, codeHash string) (*invite.Invite, error) {
+	createdBy, err := strconv.ParseUint(inv.CreatedBy, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	record := &models.Invite{
+		CreatedBy: uint(createdBy),
+		Email:     inv.Email,
+		CodeHash:  codeHash,
+		MaxUses:   inv.MaxUses,
+		ExpiresAt: inv.ExpiresAt,
+	}
+	err = DB.Create(record).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not create invite: %w", err)
+	}
+
+	return toInvite(record, nil), nil
+}
+
+func (s *InvitePostgresStorage) GetInvites() ([]*invite.Invite, error) {
+	var records []models.Invite
+	err := DB.Order("id DESC").Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get invites: %w", err)
+	}
+
+	var redemptions []models.InviteRedemption
+	err = DB.Order("id").Find(&redemptions).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get invite redemptions: %w", err)
+	}
+	invitees := make(map[uint][]string)
+	for _, redemption := range redemptions {
+		invitees[redemption.InviteID] = append(invitees[redemption.InviteID], fmt.Sprint(redemption.UserID))
+	}
+
+	invites := []*invite.Invite{}
+	for i := range records {
+		invites = append(invites, toInvite(&records[i], invitees[records[i].ID]))
+	}
+	return invites, nil
+}
+
+func (s *InvitePostgresStorage) RevokeInvite(id string) error {
+	result := DB.Model(&models.Invite{}).Where("id = ?", id).Update("revoked", true)
+	if result.Error != nil {
+		return fmt.Errorf("could not revoke invite: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return invite.ErrInviteNotFound
+	}
+	return nil
+}
+
+func (s *InvitePostgresStorage) RedeemInvite(codeHash, email string, now time.Time) (*invite.Invite, error) {
+	var record models.Invite
+	err := DB.Where("code_hash = ?", codeHash).First(&record).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, invite.ErrInviteInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get invite: %w", err)
+	}
+
+	inv := toInvite(&record, nil)
+	if !inv.Usable(email, now) {
+		return nil, invite.ErrInviteInvalid
+	}
+
+	// условие повторяется в UPDATE, чтобы параллельные регистрации не превысили MaxUses
+	result := DB.Model(&models.Invite{}).
+		Where("id = ? AND uses < max_uses AND NOT revoked AND expires_at > ?", record.ID, now).
+		UpdateColumn("uses", gorm.Expr("uses + 1"))
+	if result.Error != nil {
+		return nil, fmt.Errorf("could not redeem invite: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, invite.ErrInviteInvalid
+	}
+
+	inv.Uses++
+	return inv, nil
+}
+
+func (s *InvitePostgresStorage) ReleaseInvite(id string) error {
+	err := DB.Model(&models.Invite{}).Where("id = ? AND uses > 0", id).
+		UpdateColumn("uses", gorm.Expr("uses - 1")).Error
+	if err != nil {
+		return fmt.Errorf("could not release invite: %w", err)
+	}
+	return nil
+}
+
+func (s *InvitePostgresStorage) AddInvitee(id, userID string) error {
+	inviteID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid invite ID: %w", err)
+	}
+	userIDUint, err := strconv.ParseUint(userID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	err = DB.Create(&models.InviteRedemption{InviteID: uint(inviteID), UserID: uint(userIDUint)}).Error
+	if err != nil {
+		return fmt.Errorf("could not save invitee: %w", err)
+	}
+	return nil
+}
+
+func toInvite(record *models.Invite, invitees []string) *invite.Invite {
+	return &invite.Invite{
+		ID:        fmt.Sprint(record.ID),
+		CreatedBy: fmt.Sprint(record.CreatedBy),
+		Email:     record.Email,
+		MaxUses:   record.MaxUses,
+		Uses:      record.Uses,
+		CreatedAt: record.CreatedAt,
+		ExpiresAt: record.ExpiresAt,
+		Revoked:   record.Revoked,
+		Invitees:  invitees,
+	}
+}
@@ -0,0 +1,98 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VitaminP8/postery/internal/invite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvitePostgresStorage(t *testing.T) {
+	storage := NewInvitePostgresStorage()
+
+	// Настраиваем тестовую БД
+	oldDB := setupTestDB(t)
+	defer teardownTestDB(oldDB)
+
+	now := time.Now()
+	create := func(hash, email string, maxUses int) *invite.Invite {
+		inv, err := storage.CreateInvite(&invite.Invite{
+			CreatedBy: "1",
+			Email:     email,
+			MaxUses:   maxUses,
+			ExpiresAt: now.Add(time.Hour),
+		}, hash)
+		require.NoError(t, err)
+		return inv
+	}
+
+	single := create("single", "", 1)
+	multi := create("multi", "", 2)
+	bound := create("bound", "Guest@Example.com", 1)
+
+	t.Run("Single-use invite", func(t *testing.T) {
+		redeemed, err := storage.RedeemInvite("single", "a@example.com", now)
+		require.NoError(t, err)
+		assert.Equal(t, single.ID, redeemed.ID)
+		assert.Equal(t, 1, redeemed.Uses)
+
+		_, err = storage.RedeemInvite("single", "b@example.com", now)
+		assert.ErrorIs(t, err, invite.ErrInviteInvalid)
+	})
+
+	t.Run("Released use can be redeemed again", func(t *testing.T) {
+		require.NoError(t, storage.ReleaseInvite(single.ID))
+		_, err := storage.RedeemInvite("single", "b@example.com", now)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Multi-use invite", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			_, err := storage.RedeemInvite("multi", "a@example.com", now)
+			require.NoError(t, err)
+		}
+		_, err := storage.RedeemInvite("multi", "a@example.com", now)
+		assert.ErrorIs(t, err, invite.ErrInviteInvalid)
+	})
+
+	t.Run("Email binding", func(t *testing.T) {
+		_, err := storage.RedeemInvite("bound", "other@example.com", now)
+		assert.ErrorIs(t, err, invite.ErrInviteInvalid)
+
+		redeemed, err := storage.RedeemInvite("bound", "guest@example.com", now)
+		require.NoError(t, err)
+		assert.Equal(t, bound.ID, redeemed.ID)
+	})
+
+	t.Run("Expired, revoked and unknown codes", func(t *testing.T) {
+		create("late", "", 5)
+		_, err := storage.RedeemInvite("late", "a@example.com", now.Add(2*time.Hour))
+		assert.ErrorIs(t, err, invite.ErrInviteInvalid)
+
+		revoked := create("revoked", "", 5)
+		require.NoError(t, storage.RevokeInvite(revoked.ID))
+		_, err = storage.RedeemInvite("revoked", "a@example.com", now)
+		assert.ErrorIs(t, err, invite.ErrInviteInvalid)
+
+		_, err = storage.RedeemInvite("unknown", "a@example.com", now)
+		assert.ErrorIs(t, err, invite.ErrInviteInvalid)
+		assert.ErrorIs(t, storage.RevokeInvite("404"), invite.ErrInviteNotFound)
+	})
+
+	t.Run("Invitees are recorded", func(t *testing.T) {
+		require.NoError(t, storage.AddInvitee(multi.ID, "7"))
+		require.NoError(t, storage.AddInvitee(multi.ID, "8"))
+
+		invites, err := storage.GetInvites()
+		require.NoError(t, err)
+		require.Len(t, invites, 5)
+		// от новых к старым
+		assert.Equal(t, single.ID, invites[4].ID)
+		assert.Equal(t, multi.ID, invites[3].ID)
+		assert.Equal(t, []string{"7", "8"}, invites[3].Invitees)
+		assert.Equal(t, 2, invites[3].Uses)
+		assert.Equal(t, "1", invites[3].CreatedBy)
+	})
+}
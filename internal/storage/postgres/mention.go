@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/VitaminP8/postery/internal/mention"
+	"github.com/VitaminP8/postery/models"
+	"github.com/jinzhu/gorm"
+)
+
+type MentionPostgresStorage struct{}
+
+func NewMentionPostgresStorage() *MentionPostgresStorage {
+	return &MentionPostgresStorage{}
+}
+
+func (s *MentionPostgresStorage) AddMentions(kind mention.Kind, contentID string, userIDs []string) error {
+	contentIDUint, err := strconv.ParseUint(contentID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid content ID: %w", err)
+	}
+
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		for _, userID := range userIDs {
+			userIDUint, err := strconv.ParseUint(userID, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid user ID: %w", err)
+			}
+
+			record := models.Mention{Kind: string(kind), ContentID: uint(contentIDUint), UserID: uint(userIDUint)}
+			err = tx.Where(record).FirstOrCreate(&record).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not save mentions: %w", err)
+	}
+	return nil
+}
+
+func (s *MentionPostgresStorage) GetMentions(kind mention.Kind, contentID string) ([]string, error) {
+	var records []models.Mention
+	err := DB.Where("kind = ? AND content_id = ?", string(kind), contentID).Order("id").Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get mentions: %w", err)
+	}
+
+	userIDs := make([]string, 0, len(records))
+	for _, record := range records {
+		userIDs = append(userIDs, fmt.Sprint(record.UserID))
+	}
+	return userIDs, nil
+}
+
+func (s *MentionPostgresStorage) DeleteMentionsOf(userID string) error {
+	return deleteMentionsOf(DB, userID)
+}
+
+func deleteMentionsOf(db *gorm.DB, userID string) error {
+	err := db.Where("user_id = ?", userID).Delete(&models.Mention{}).Error
+	if err != nil {
+		return fmt.Errorf("could not delete mentions: %w", err)
+	}
+	return nil
+}
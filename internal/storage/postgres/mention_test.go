@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/VitaminP8/postery/internal/mention"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMentionPostgresStorage(t *testing.T) {
+	storage := NewMentionPostgresStorage()
+
+	// Настраиваем тестовую БД
+	oldDB := setupTestDB(t)
+	defer teardownTestDB(oldDB)
+
+	t.Run("Add is idempotent and keeps order", func(t *testing.T) {
+		require.NoError(t, storage.AddMentions(mention.KindPost, "1", []string{"3", "2"}))
+		require.NoError(t, storage.AddMentions(mention.KindPost, "1", []string{"2"}))
+
+		userIDs, err := storage.GetMentions(mention.KindPost, "1")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"3", "2"}, userIDs)
+	})
+
+	t.Run("Posts and comments are separate", func(t *testing.T) {
+		require.NoError(t, storage.AddMentions(mention.KindComment, "1", []string{"4"}))
+
+		userIDs, err := storage.GetMentions(mention.KindComment, "1")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"4"}, userIDs)
+
+		userIDs, err = storage.GetMentions(mention.KindComment, "2")
+		require.NoError(t, err)
+		assert.Empty(t, userIDs)
+	})
+
+	t.Run("Delete mentions of user", func(t *testing.T) {
+		require.NoError(t, storage.DeleteMentionsOf("3"))
+
+		userIDs, err := storage.GetMentions(mention.KindPost, "1")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"2"}, userIDs)
+	})
+}
@@ -0,0 +1,295 @@
+package postgres
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VitaminP8/postery/internal/subscription"
+	"github.com/VitaminP8/postery/models"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+const (
+	// NotifyChannel - канал LISTEN/NOTIFY, общий для всех экземпляров сервера
+	NotifyChannel = "postery_events"
+	// maxNotifyPayload - NOTIFY принимает не больше 8000 байт, остаток - запас на служебные данные
+	maxNotifyPayload = 7900
+	// payloadRefPrefix - уведомление со ссылкой на событие в subscription_events вместо самого события
+	payloadRefPrefix = "ref:"
+	// eventRetention - сколько события хранятся для повторной доставки
+	eventRetention = time.Hour
+	// pruneInterval - как часто удаляются устаревшие события
+	pruneInterval = time.Minute
+	// listenerPingInterval - проверка соединения LISTEN, если уведомлений давно не было
+	listenerPingInterval = 90 * time.Second
+)
+
+// listener - источник уведомлений LISTEN (*pq.Listener, в тестах - заглушка)
+type listener interface {
+	NotificationChannel() <-chan *pq.Notification
+	Ping() error
+	Close() error
+}
+
+// NotifyManager реализует subscription.Manager для нескольких экземпляров сервера: Publish сохраняет событие
+// в subscription_events с очередным номером темы и отправляет его через Postgres NOTIFY, а каждый
+// экземпляр (включая отправителя) получает его через LISTEN и раздает своим подписчикам. Переподключение после
+// обрыва выполняет pq.Listener; пропущенные за время обрыва события клиенты получают из History.
+type NotifyManager struct {
+	local    *subscription.SubscriptionManager
+	listener listener
+	notify   func(payload string) error
+
+	mu     sync.Mutex
+	pruned time.Time // время последнего удаления устаревших событий
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewNotifyManager подключается к PostgreSQL по dsn и подписывается на NotifyChannel. Полученные события
+// раздает local; его история отключается - она хранится в базе, общая для всех экземпляров.
+func NewNotifyManager(dsn string, local *subscription.SubscriptionManager) (*NotifyManager, error) {
+	l := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			log.Printf("subscriptions: LISTEN connection lost: %v", err)
+		case pq.ListenerEventReconnected:
+			log.Println("subscriptions: LISTEN connection restored")
+		case pq.ListenerEventConnectionAttemptFailed:
+			log.Printf("subscriptions: LISTEN reconnect failed: %v", err)
+		}
+	})
+
+	err := l.Listen(NotifyChannel)
+	if err != nil {
+		l.Close()
+		return nil, fmt.Errorf("could not listen on %s: %w", NotifyChannel, err)
+	}
+
+	return newNotifyManager(l, notifyPostgres, local), nil
+}
+
+func newNotifyManager(l listener, notify func(payload string) error, local *subscription.SubscriptionManager) *NotifyManager {
+	local.HistorySize = 0
+
+	m := &NotifyManager{
+		local:    local,
+		listener: l,
+		notify:   notify,
+		done:     make(chan struct{}),
+	}
+	go m.run()
+	return m
+}
+
+func (m *NotifyManager) Subscribe(topic string) (<-chan subscription.Event, func()) {
+	return m.local.Subscribe(topic)
+}
+
+// Publish отправляет событие всем экземплярам; если NOTIFY не удался, событие получат хотя бы локальные
+// подписчики. Ephemeral события не сохраняются в subscription_events и нумеруются каждым экземпляром локально.
+// Остальные события без записи в subscription_events не доставляются: номер из локального счетчика совпал бы
+// с номерами чужих записей, и клиент с таким since пропустил бы события при переподключении.
+func (m *NotifyManager) Publish(topic string, event subscription.Event) {
+	data, err := subscription.MarshalEvent(topic, event)
+	if err != nil {
+		log.Printf("subscriptions: %v", err)
+		if event.Type.Ephemeral() {
+			m.local.Publish(topic, event)
+		}
+		return
+	}
+
+	// присутствие и индикаторы набора не сохраняются: уведомление несет само событие
+	if event.Type.Ephemeral() {
+		if len(data) > maxNotifyPayload {
+			log.Printf("subscriptions: ephemeral event %s is too large for NOTIFY", event.Type)
+			m.local.Publish(topic, event)
+			return
+		}
+		err = m.notify(string(data))
+		if err != nil {
+			log.Printf("subscriptions: NOTIFY failed: %v", err)
+			m.local.Publish(topic, event)
+		}
+		return
+	}
+
+	m.pruneExpired()
+	record := &models.SubscriptionEvent{Topic: topic, Data: string(data)}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		seq, err := nextTopicSeq(tx, topic)
+		if err != nil {
+			return err
+		}
+		record.Seq = seq
+		return tx.Create(record).Error
+	})
+	if err != nil {
+		log.Printf("subscriptions: could not store event %s, event dropped: %v", event.Type, err)
+		return
+	}
+	event.Seq = record.Seq
+
+	// в уведомлении - событие с номером, а если оно не помещается - ссылка на запись
+	payload := payloadRefPrefix + strconv.FormatUint(uint64(record.ID), 10)
+	data, err = subscription.MarshalEvent(topic, event)
+	if err == nil && len(data) <= maxNotifyPayload {
+		payload = string(data)
+	}
+
+	// событие уже сохранено: локальные подписчики получат его с номером из базы, остальные - из History
+	err = m.notify(payload)
+	if err != nil {
+		log.Printf("subscriptions: NOTIFY failed: %v", err)
+		m.local.Publish(topic, event)
+	}
+}
+
+// History читает пропущенные события из subscription_events. Номера событий темы идут подряд, поэтому пропуск
+// после since (события удалены как устаревшие) виден сразу; как и больше subscription.DefaultHistorySize
+// пропущенных событий, он возвращает subscription.ErrHistoryTruncated.
+func (m *NotifyManager) History(topic string, since uint64) ([]subscription.Event, error) {
+	// счетчик читается до событий: все события с номерами до него уже зафиксированы
+	var counter models.SubscriptionTopic
+	err := DB.Where("topic = ?", topic).First(&counter).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	if counter.Seq <= since {
+		return nil, nil
+	}
+
+	var records []models.SubscriptionEvent
+	err = DB.Where("topic = ? AND seq > ? AND created_at > ?", topic, since, time.Now().Add(-eventRetention)).
+		Order("seq").Limit(subscription.DefaultHistorySize + 1).Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 || records[0].Seq != since+1 || len(records) > subscription.DefaultHistorySize {
+		return nil, subscription.ErrHistoryTruncated
+	}
+
+	events := make([]subscription.Event, 0, len(records))
+	for i := range records {
+		_, event, err := decodeRecord(&records[i])
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// Close останавливает получение уведомлений
+func (m *NotifyManager) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.done)
+		err = m.listener.Close()
+	})
+	return err
+}
+
+func (m *NotifyManager) run() {
+	ticker := time.NewTicker(listenerPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case n, ok := <-m.listener.NotificationChannel():
+			if !ok {
+				return
+			}
+			// nil приходит после переподключения
+			if n != nil {
+				m.deliver(n.Extra)
+			}
+		case <-ticker.C:
+			// ошибку обработает pq.Listener, переподключившись
+			go m.listener.Ping()
+		case <-m.done:
+			return
+		}
+	}
+}
+
+func (m *NotifyManager) deliver(payload string) {
+	if ref, ok := strings.CutPrefix(payload, payloadRefPrefix); ok {
+		var record models.SubscriptionEvent
+		err := DB.First(&record, "id = ?", ref).Error
+		if err != nil {
+			log.Printf("subscriptions: could not load event %s: %v", ref, err)
+			return
+		}
+
+		topic, event, err := decodeRecord(&record)
+		if err != nil {
+			log.Printf("subscriptions: %v", err)
+			return
+		}
+		m.local.Publish(topic, event)
+		return
+	}
+
+	topic, event, err := subscription.UnmarshalEvent([]byte(payload))
+	if err != nil {
+		log.Printf("subscriptions: %v", err)
+		return
+	}
+	m.local.Publish(topic, event)
+}
+
+// pruneExpired не чаще раза в pruneInterval удаляет события старше eventRetention
+func (m *NotifyManager) pruneExpired() {
+	m.mu.Lock()
+	if time.Since(m.pruned) < pruneInterval {
+		m.mu.Unlock()
+		return
+	}
+	m.pruned = time.Now()
+	m.mu.Unlock()
+
+	err := DB.Where("created_at < ?", time.Now().Add(-eventRetention)).Delete(&models.SubscriptionEvent{}).Error
+	if err != nil {
+		log.Printf("subscriptions: could not prune events: %v", err)
+	}
+}
+
+// nextTopicSeq увеличивает счетчик темы и возвращает новый номер. Строка счетчика заблокирована до конца
+// транзакции, поэтому события одной темы фиксируются в порядке номеров: ID записи (BIGSERIAL) такого
+// не гарантирует, и клиент, получивший событие N+1 раньше фиксации N, пропустил бы N при переподключении.
+func nextTopicSeq(tx *gorm.DB, topic string) (uint64, error) {
+	err := tx.Exec("INSERT INTO subscription_topics (topic, seq) VALUES (?, 1) "+
+		"ON CONFLICT (topic) DO UPDATE SET seq = subscription_topics.seq + 1", topic).Error
+	if err != nil {
+		return 0, fmt.Errorf("could not advance topic sequence: %w", err)
+	}
+
+	var counter models.SubscriptionTopic
+	err = tx.Where("topic = ?", topic).First(&counter).Error
+	if err != nil {
+		return 0, fmt.Errorf("could not read topic sequence: %w", err)
+	}
+	return counter.Seq, nil
+}
+
+func notifyPostgres(payload string) error {
+	return DB.Exec("SELECT pg_notify(?, ?)", NotifyChannel, payload).Error
+}
+
+// decodeRecord восстанавливает событие из записи вместе с его номером в теме
+func decodeRecord(record *models.SubscriptionEvent) (string, subscription.Event, error) {
+	topic, event, err := subscription.UnmarshalEvent([]byte(record.Data))
+	if err != nil {
+		return "", subscription.Event{}, err
+	}
+	event.Seq = record.Seq
+	return topic, event, nil
+}
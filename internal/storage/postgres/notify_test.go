@@ -0,0 +1,224 @@
+package postgres
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/subscription"
+	"github.com/VitaminP8/postery/models"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeListener заменяет pq.Listener: notify отправляет уведомление в канал, как это сделал бы Postgres
+type fakeListener struct {
+	notifications chan *pq.Notification
+	sent          []string // отправленные через notify уведомления
+}
+
+func newFakeListener() *fakeListener {
+	return &fakeListener{notifications: make(chan *pq.Notification, 16)}
+}
+
+func (l *fakeListener) NotificationChannel() <-chan *pq.Notification { return l.notifications }
+func (l *fakeListener) Ping() error                                  { return nil }
+func (l *fakeListener) Close() error                                 { return nil }
+
+func (l *fakeListener) notify(payload string) error {
+	l.sent = append(l.sent, payload)
+	l.notifications <- &pq.Notification{Channel: NotifyChannel, Extra: payload}
+	return nil
+}
+
+func receiveEvent(t *testing.T, ch <-chan subscription.Event) subscription.Event {
+	select {
+	case event := <-ch:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for event")
+		return subscription.Event{}
+	}
+}
+
+func TestNotifyManager(t *testing.T) {
+	// Настраиваем тестовую БД
+	oldDB := setupTestDB(t)
+	defer teardownTestDB(oldDB)
+
+	l := newFakeListener()
+	manager := newNotifyManager(l, l.notify, subscription.NewSubscriptionManager())
+	defer manager.Close()
+
+	t.Run("Event goes through NOTIFY", func(t *testing.T) {
+		ch, cancel := manager.Subscribe(subscription.CommentsTopic("1"))
+		defer cancel()
+
+		comment := &model.Comment{ID: "5", PostID: "1", Content: "Привет"}
+		manager.Publish(subscription.CommentsTopic("1"), subscription.Event{Type: subscription.EventCommentAdded, Payload: comment})
+
+		event := receiveEvent(t, ch)
+		assert.Equal(t, subscription.EventCommentAdded, event.Type)
+		assert.Equal(t, comment, event.Payload)
+	})
+
+	t.Run("Notification from another replica", func(t *testing.T) {
+		ch, cancel := manager.Subscribe(subscription.PostTopic("7"))
+		defer cancel()
+
+		data, err := subscription.MarshalEvent(subscription.PostTopic("7"), subscription.Event{Type: subscription.EventPostDeleted, Payload: "7"})
+		require.NoError(t, err)
+		// после переподключения pq присылает nil, а мусор в канале не должен останавливать доставку
+		l.notifications <- nil
+		l.notifications <- &pq.Notification{Channel: NotifyChannel, Extra: "not json"}
+		l.notifications <- &pq.Notification{Channel: NotifyChannel, Extra: string(data)}
+
+		event := receiveEvent(t, ch)
+		assert.Equal(t, "7", event.Payload)
+	})
+
+	t.Run("Large event is passed by reference", func(t *testing.T) {
+		ch, cancel := manager.Subscribe(subscription.PostsTopic)
+		defer cancel()
+
+		post := &model.Post{ID: "8", Title: "Long", Content: strings.Repeat("ж", 5000)}
+		manager.Publish(subscription.PostsTopic, subscription.Event{Type: subscription.EventPostCreated, Payload: post})
+
+		event := receiveEvent(t, ch)
+		assert.Equal(t, post, event.Payload)
+
+		var record models.SubscriptionEvent
+		require.NoError(t, DB.Last(&record).Error)
+		assert.Equal(t, "ref:"+strconv.FormatUint(uint64(record.ID), 10), l.sent[len(l.sent)-1])
+		assert.Equal(t, record.Seq, event.Seq)
+	})
+
+	t.Run("Events are numbered per topic", func(t *testing.T) {
+		ch, cancel := manager.Subscribe(subscription.PostTopic("10"))
+		defer cancel()
+
+		for i := uint64(1); i <= 2; i++ {
+			manager.Publish(subscription.PostTopic("10"), subscription.Event{Type: subscription.EventPostDeleted, Payload: "10"})
+			event := receiveEvent(t, ch)
+
+			var record models.SubscriptionEvent
+			require.NoError(t, DB.Last(&record).Error)
+			assert.Equal(t, i, event.Seq)
+			assert.Equal(t, record.Seq, event.Seq)
+			assert.Equal(t, subscription.PostTopic("10"), record.Topic)
+		}
+	})
+
+	t.Run("Ephemeral event is not stored", func(t *testing.T) {
+		topic := subscription.PresenceTopic("11")
+		ch, cancel := manager.Subscribe(topic)
+		defer cancel()
+
+		var before int
+		require.NoError(t, DB.Model(&models.SubscriptionEvent{}).Count(&before).Error)
+
+		presence := &subscription.Presence{PostID: "11", InstanceID: "i1", Viewers: map[string]string{"v1": "3"}}
+		manager.Publish(topic, subscription.Event{Type: subscription.EventViewerSeen, Payload: presence})
+		event := receiveEvent(t, ch)
+		assert.Equal(t, presence, event.Payload)
+
+		var after int
+		require.NoError(t, DB.Model(&models.SubscriptionEvent{}).Count(&after).Error)
+		assert.Equal(t, before, after)
+
+		history, err := manager.History(topic, 0)
+		require.NoError(t, err)
+		assert.Empty(t, history)
+	})
+
+	t.Run("History replays stored events after cursor", func(t *testing.T) {
+		topic := subscription.CommentsTopic("20")
+		for i := 1; i <= 3; i++ {
+			manager.Publish(topic, subscription.Event{Type: subscription.EventCommentAdded, Payload: &model.Comment{ID: strconv.Itoa(i), PostID: "20"}})
+		}
+		manager.Publish(subscription.CommentsTopic("21"), subscription.Event{Type: subscription.EventCommentAdded, Payload: &model.Comment{ID: "4", PostID: "21"}})
+
+		all, err := manager.History(topic, 0)
+		require.NoError(t, err)
+		require.Len(t, all, 3)
+
+		events, err := manager.History(topic, all[0].Seq)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, "2", events[0].Payload.(*model.Comment).ID)
+		assert.Equal(t, all[2].Seq, events[1].Seq)
+	})
+
+	t.Run("Expired events truncate history", func(t *testing.T) {
+		topic := subscription.CommentsTopic("30")
+		manager.Publish(topic, subscription.Event{Type: subscription.EventCommentAdded, Payload: &model.Comment{ID: "1", PostID: "30"}})
+		manager.Publish(topic, subscription.Event{Type: subscription.EventCommentAdded, Payload: &model.Comment{ID: "2", PostID: "30"}})
+		require.NoError(t, DB.Model(&models.SubscriptionEvent{}).Where("topic = ? AND seq = 1", topic).
+			Update("created_at", time.Now().Add(-2*eventRetention)).Error)
+
+		_, err := manager.History(topic, 0)
+		assert.ErrorIs(t, err, subscription.ErrHistoryTruncated)
+
+		events, err := manager.History(topic, 1)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, uint64(2), events[0].Seq)
+
+		// после since событий нет
+		events, err = manager.History(topic, 2)
+		require.NoError(t, err)
+		assert.Empty(t, events)
+	})
+
+	t.Run("Too many missed events truncate history", func(t *testing.T) {
+		topic := subscription.CommentsTopic("31")
+		for i := 0; i <= subscription.DefaultHistorySize; i++ {
+			manager.Publish(topic, subscription.Event{Type: subscription.EventCommentAdded, Payload: &model.Comment{ID: strconv.Itoa(i), PostID: "31"}})
+		}
+
+		_, err := manager.History(topic, 0)
+		assert.ErrorIs(t, err, subscription.ErrHistoryTruncated)
+
+		events, err := manager.History(topic, 1)
+		require.NoError(t, err)
+		assert.Len(t, events, subscription.DefaultHistorySize)
+	})
+
+	t.Run("Failed NOTIFY falls back to local delivery", func(t *testing.T) {
+		failing := newNotifyManager(newFakeListener(), func(string) error { return assert.AnError }, subscription.NewSubscriptionManager())
+		defer failing.Close()
+
+		ch, cancel := failing.Subscribe(subscription.PostTopic("9"))
+		defer cancel()
+
+		failing.Publish(subscription.PostTopic("9"), subscription.Event{Type: subscription.EventPostDeleted, Payload: "9"})
+		event := receiveEvent(t, ch)
+		assert.Equal(t, "9", event.Payload)
+
+		// номер - из счетчика темы в базе, а не локальный
+		var record models.SubscriptionEvent
+		require.NoError(t, DB.Last(&record).Error)
+		assert.Equal(t, record.Seq, event.Seq)
+	})
+
+	t.Run("Event that could not be stored is not delivered", func(t *testing.T) {
+		ch, cancel := manager.Subscribe(subscription.PostTopic("12"))
+		defer cancel()
+
+		require.NoError(t, DB.DropTable(&models.SubscriptionEvent{}).Error)
+		defer DB.AutoMigrate(&models.SubscriptionEvent{})
+
+		sent := len(l.sent)
+		manager.Publish(subscription.PostTopic("12"), subscription.Event{Type: subscription.EventPostDeleted, Payload: "12"})
+
+		select {
+		case event := <-ch:
+			t.Fatalf("Unexpected event without stored number: %+v", event)
+		case <-time.After(100 * time.Millisecond):
+		}
+		assert.Len(t, l.sent, sent)
+	})
+}
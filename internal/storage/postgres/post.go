@@ -6,19 +6,24 @@ import (
 
 	"github.com/VitaminP8/postery/graph/model"
 	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/subscription"
+	"github.com/VitaminP8/postery/internal/user"
 	"github.com/VitaminP8/postery/models"
+	"github.com/jinzhu/gorm"
 )
 
-type PostPostgresStorage struct{}
+type PostPostgresStorage struct {
+	manager subscription.Manager
+}
 
-func NewPostPostgresStorage() *PostPostgresStorage {
-	return &PostPostgresStorage{}
+func NewPostPostgresStorage(manager subscription.Manager) *PostPostgresStorage {
+	return &PostPostgresStorage{manager: manager}
 }
 
 func (s *PostPostgresStorage) CreatePost(ctx context.Context, title, content string) (*model.Post, error) {
 	userID, err := auth.GetUserIDFromContext(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("unautorized:  %w", err)
+		return nil, err
 	}
 
 	post := &models.Post{
@@ -33,13 +38,10 @@ func (s *PostPostgresStorage) CreatePost(ctx context.Context, title, content str
 		return nil, fmt.Errorf("could not create post: %w", err)
 	}
 
-	return &model.Post{
-		ID:               fmt.Sprint(post.ID),
-		Title:            post.Title,
-		Content:          post.Content,
-		AuthorID:         fmt.Sprint(post.UserID),
-		CommentsDisabled: post.CommentsDisabled,
-	}, nil
+	result := toPost(post)
+	published := *result
+	s.publish(subscription.PostsTopic, subscription.EventPostCreated, &published)
+	return result, nil
 }
 
 func (s *PostPostgresStorage) GetPostById(id string) (*model.Post, error) {
@@ -49,13 +51,7 @@ func (s *PostPostgresStorage) GetPostById(id string) (*model.Post, error) {
 		return nil, fmt.Errorf("could not get post by id: %w", err)
 	}
 
-	return &model.Post{
-		ID:               fmt.Sprint(post.ID),
-		Title:            post.Title,
-		Content:          post.Content,
-		AuthorID:         fmt.Sprint(post.UserID),
-		CommentsDisabled: post.CommentsDisabled,
-	}, nil
+	return toPost(&post), nil
 }
 
 func (s *PostPostgresStorage) GetAllPosts() ([]*model.Post, error) {
@@ -67,86 +63,191 @@ func (s *PostPostgresStorage) GetAllPosts() ([]*model.Post, error) {
 
 	var results []*model.Post
 	for _, post := range posts {
-		results = append(results, &model.Post{
-			ID:               fmt.Sprint(post.ID),
-			Title:            post.Title,
-			Content:          post.Content,
-			AuthorID:         fmt.Sprint(post.UserID),
-			CommentsDisabled: post.CommentsDisabled,
-		})
+		results = append(results, toPost(&post))
 	}
 
 	return results, nil
 }
 
 func (s *PostPostgresStorage) DisableComment(ctx context.Context, id string) error {
-	userID, err := auth.GetUserIDFromContext(ctx)
-	if err != nil {
-		return fmt.Errorf("unauthorized: %w", err)
-	}
-
 	var post models.Post
-	err = DB.First(&post, id).Error
+	err := DB.First(&post, id).Error
 	if err != nil {
 		return fmt.Errorf("post not found: %w", err)
 	}
 
-	if post.UserID != userID {
-		return fmt.Errorf("forbidden: you are not the author of this post")
-	}
-
 	err = DB.Model(&models.Post{}).Where("id = ?", id).Update("comments_disabled", true).Error
 	if err != nil {
 		return fmt.Errorf("could not disable comment: %w", err)
 	}
 
+	s.publishCommentsToggled(&post, true)
 	return nil
 }
 
 func (s *PostPostgresStorage) EnableComment(ctx context.Context, id string) error {
-	userID, err := auth.GetUserIDFromContext(ctx)
+	var post models.Post
+	err := DB.First(&post, id).Error
+	if err != nil {
+		return fmt.Errorf("post not found: %w", err)
+	}
+
+	err = DB.Model(&models.Post{}).Where("id = ?", id).Update("comments_disabled", false).Error
 	if err != nil {
-		return fmt.Errorf("unauthorized: %w", err)
+		return fmt.Errorf("could not enable comment: %w", err)
 	}
 
+	s.publishCommentsToggled(&post, false)
+	return nil
+}
+
+func (s *PostPostgresStorage) DeletePostById(ctx context.Context, id string) error {
 	var post models.Post
-	err = DB.First(&post, id).Error
+	err := DB.First(&post, id).Error
 	if err != nil {
 		return fmt.Errorf("post not found: %w", err)
 	}
 
-	if post.UserID != userID {
-		return fmt.Errorf("forbidden: you are not the author of this post")
+	err = DB.Delete(&models.Post{}, id).Error
+	if err != nil {
+		return fmt.Errorf("could not delete post: %w", err)
 	}
 
-	err = DB.Model(&models.Post{}).Where("id = ?", id).Update("comments_disabled", false).Error
+	s.publish(subscription.PostTopic(fmt.Sprint(post.ID)), subscription.EventPostDeleted, fmt.Sprint(post.ID))
+	return nil
+}
+
+func (s *PostPostgresStorage) DeletePostsByAuthor(authorID string) error {
+	ids, err := deletePostsByAuthor(DB, authorID)
 	if err != nil {
-		return fmt.Errorf("could not enable comment: %w", err)
+		return err
+	}
+	s.publishDeleted(ids)
+	return nil
+}
+
+// deletePostsByAuthor удаляет посты автора и возвращает их ID для событий удаления
+func deletePostsByAuthor(db *gorm.DB, authorID string) ([]uint, error) {
+	var ids []uint
+	err := db.Model(&models.Post{}).Where("user_id = ?", authorID).Pluck("id", &ids).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get posts: %w", err)
 	}
 
+	err = db.Unscoped().Where("user_id = ?", authorID).Delete(&models.Post{}).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not delete posts: %w", err)
+	}
+	return ids, nil
+}
+
+func (s *PostPostgresStorage) publishDeleted(ids []uint) {
+	for _, id := range ids {
+		s.publish(subscription.PostTopic(fmt.Sprint(id)), subscription.EventPostDeleted, fmt.Sprint(id))
+	}
+}
+
+func (s *PostPostgresStorage) AnonymizePostsByAuthor(authorID string) error {
+	posts, err := anonymizePostsByAuthor(DB, authorID)
+	if err != nil {
+		return err
+	}
+	s.publishUpdated(posts)
 	return nil
 }
 
-func (s *PostPostgresStorage) DeletePostById(ctx context.Context, id string) error {
-	userID, err := auth.GetUserIDFromContext(ctx)
+// anonymizePostsByAuthor передает посты автора DeletedUserID и возвращает их для событий изменения
+func anonymizePostsByAuthor(db *gorm.DB, authorID string) ([]*model.Post, error) {
+	var posts []models.Post
+	err := db.Where("user_id = ?", authorID).Find(&posts).Error
 	if err != nil {
-		return fmt.Errorf("unauthorized: %w", err)
+		return nil, fmt.Errorf("could not get posts: %w", err)
 	}
 
-	var post models.Post
-	err = DB.First(&post, id).Error
+	err = db.Model(&models.Post{}).Where("user_id = ?", authorID).Update("user_id", user.DeletedUserID).Error
 	if err != nil {
-		return fmt.Errorf("post not found: %w", err)
+		return nil, fmt.Errorf("could not anonymize posts: %w", err)
 	}
 
-	if post.UserID != userID {
-		return fmt.Errorf("forbidden: you are not the author of this post")
+	updated := make([]*model.Post, 0, len(posts))
+	for i := range posts {
+		p := toPost(&posts[i])
+		p.AuthorID = user.DeletedUserID
+		updated = append(updated, p)
 	}
+	return updated, nil
+}
 
-	err = DB.Delete(&models.Post{}, id).Error
+func (s *PostPostgresStorage) publishUpdated(posts []*model.Post) {
+	for _, p := range posts {
+		s.publish(subscription.PostTopic(p.ID), subscription.EventPostUpdated, p)
+	}
+}
+
+// publishCommentsToggled отправляет события, если настройка комментариев действительно изменилась
+func (s *PostPostgresStorage) publishCommentsToggled(post *models.Post, disabled bool) {
+	if post.CommentsDisabled == disabled {
+		return
+	}
+
+	post.CommentsDisabled = disabled
+	topic := subscription.PostTopic(fmt.Sprint(post.ID))
+	s.publish(topic, subscription.EventCommentsToggled, toPost(post))
+	s.publish(topic, subscription.EventPostUpdated, toPost(post))
+}
+
+func (s *PostPostgresStorage) publish(topic string, eventType subscription.EventType, payload interface{}) {
+	if s.manager != nil {
+		s.manager.Publish(topic, subscription.Event{Type: eventType, Payload: payload})
+	}
+}
+
+func toPost(post *models.Post) *model.Post {
+	return &model.Post{
+		ID:               fmt.Sprint(post.ID),
+		Title:            post.Title,
+		Content:          post.Content,
+		AuthorID:         fmt.Sprint(post.UserID),
+		CommentsDisabled: post.CommentsDisabled,
+	}
+}
+
+func (s *PostPostgresStorage) GetPostsByAuthor(authorID string) ([]*model.Post, error) {
+	var posts []models.Post
+	err := DB.Where("user_id = ?", authorID).Order("id").Find(&posts).Error
 	if err != nil {
-		return fmt.Errorf("could not delete post: %w", err)
+		return nil, fmt.Errorf("could not get posts: %w", err)
 	}
 
-	return nil
+	results := []*model.Post{}
+	for _, post := range posts {
+		results = append(results, toPost(&post))
+	}
+
+	return results, nil
+}
+
+func (s *PostPostgresStorage) GetPostsByAuthors(authorIDs []string, beforeID string, limit int) ([]*model.Post, error) {
+	results := []*model.Post{}
+	if len(authorIDs) == 0 {
+		return results, nil
+	}
+
+	query := DB.Where("user_id IN (?)", authorIDs)
+	if beforeID != "" {
+		query = query.Where("id < ?", beforeID)
+	}
+
+	// id растет с каждым постом, поэтому сортировка по убыванию id - от новых к старым
+	var posts []models.Post
+	err := query.Order("id DESC").Limit(limit).Find(&posts).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get posts: %w", err)
+	}
+
+	for _, post := range posts {
+		results = append(results, toPost(&post))
+	}
+
+	return results, nil
 }
@@ -7,6 +7,9 @@ import (
 
 	"github.com/VitaminP8/postery/graph/model"
 	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/mocks"
+	"github.com/VitaminP8/postery/internal/subscription"
+	"github.com/VitaminP8/postery/internal/user"
 	"github.com/VitaminP8/postery/models"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/sqlite" // Импортируем драйвер SQLite
@@ -34,10 +37,11 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	// Отключаем логирование запросов для тестов
 	db.LogMode(false)
 	// Выполняем миграцию схемы базы данных
-	err = db.AutoMigrate(&models.User{}, &models.Post{}, &models.Comment{}).Error
+	err = db.AutoMigrate(&models.User{}, &models.Post{}, &models.Comment{}, &models.TokenRevocation{}, &models.UserIdentity{}, &models.AccessToken{}, &models.UserTwoFactor{}, &models.UserRelation{}, &models.Session{}, &models.UsernameChange{}, &models.Mention{}, &models.Invite{}, &models.InviteRedemption{}, &models.SubscriptionEvent{}, &models.SubscriptionTopic{}, &models.Webhook{}, &models.WebhookDelivery{}, &models.WebhookAttempt{}).Error
 	require.NoError(t, err, "Failed to migrate database schema")
 	// Устанавливаем SQLite в качестве глобальной DB
 	InitDBWithConnection(db)
+	require.NoError(t, MigrateUserKeys(), "Failed to create user key indexes")
 
 	return oldDB
 }
@@ -78,7 +82,7 @@ func createTestPost(t *testing.T, userID uint, title, content string) uint {
 }
 
 func TestPostPostgresStorage_CreatePost(t *testing.T) {
-	storage := NewPostPostgresStorage()
+	storage := NewPostPostgresStorage(nil)
 
 	t.Run("Success post creation", func(t *testing.T) {
 		// Настраиваем тестовую БД
@@ -116,12 +120,12 @@ func TestPostPostgresStorage_CreatePost(t *testing.T) {
 		post, err := storage.CreatePost(ctx, "Test Title", "Test Content")
 		assert.Error(t, err)
 		assert.Nil(t, post)
-		assert.Contains(t, err.Error(), "unautorized")
+		assert.ErrorIs(t, err, auth.ErrUnauthenticated)
 	})
 }
 
 func TestPostPostgresStorage_GetPostById(t *testing.T) {
-	storage := NewPostPostgresStorage()
+	storage := NewPostPostgresStorage(nil)
 
 	t.Run("Getting exists post", func(t *testing.T) {
 		// Настраиваем тестовую БД
@@ -155,7 +159,7 @@ func TestPostPostgresStorage_GetPostById(t *testing.T) {
 }
 
 func TestPostPostgresStorage_GetAllPosts(t *testing.T) {
-	storage := NewPostPostgresStorage()
+	storage := NewPostPostgresStorage(nil)
 
 	t.Run("Get all posts", func(t *testing.T) {
 		// Настраиваем тестовую БД
@@ -194,7 +198,7 @@ func TestPostPostgresStorage_GetAllPosts(t *testing.T) {
 }
 
 func TestPostPostgresStorage_DisableComment(t *testing.T) {
-	storage := NewPostPostgresStorage()
+	storage := NewPostPostgresStorage(nil)
 
 	t.Run("Disable comments by author", func(t *testing.T) {
 		// Настраиваем тестовую БД
@@ -215,39 +219,6 @@ func TestPostPostgresStorage_DisableComment(t *testing.T) {
 		assert.True(t, post.CommentsDisabled)
 	})
 
-	t.Run("Disable comments by not author", func(t *testing.T) {
-		// Настраиваем тестовую БД
-		oldDB := setupTestDB(t)
-		defer teardownTestDB(oldDB)
-
-		authorID := createTestUser(t)
-
-		anotherUser := &models.User{
-			Username: "anotheruser",
-			Email:    "another@example.com",
-			Password: "password123",
-		}
-		err := DB.Create(anotherUser).Error
-		require.NoError(t, err)
-
-		// Создаем тестовый пост от имени первого пользователя
-		postID := createTestPost(t, authorID, "Test Post", "Test Content")
-
-		// Создаем контекст с ID второго пользователя (не автора)
-		ctx := createUserContext(anotherUser.ID)
-
-		// Вызываем тестируемый метод
-		err = storage.DisableComment(ctx, fmt.Sprint(postID))
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "forbidden")
-
-		// Проверяем, что комментарии не были отключены
-		var post models.Post
-		err = DB.First(&post, postID).Error
-		assert.NoError(t, err)
-		assert.False(t, post.CommentsDisabled)
-	})
-
 	t.Run("Disable comment for not exists post", func(t *testing.T) {
 		// Настраиваем тестовую БД
 		oldDB := setupTestDB(t)
@@ -260,31 +231,10 @@ func TestPostPostgresStorage_DisableComment(t *testing.T) {
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "post not found")
 	})
-
-	t.Run("Disable comment by unauthorized user", func(t *testing.T) {
-		// Настраиваем тестовую БД
-		oldDB := setupTestDB(t)
-		defer teardownTestDB(oldDB)
-
-		userID := createTestUser(t)
-		postID := createTestPost(t, userID, "Test Post", "Test Content")
-
-		ctx := context.Background()
-
-		err := storage.DisableComment(ctx, fmt.Sprint(postID))
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "unauthorized")
-
-		// Проверяем, что комментарии не были отключены
-		var post models.Post
-		err = DB.First(&post, postID).Error
-		assert.NoError(t, err)
-		assert.False(t, post.CommentsDisabled)
-	})
 }
 
 func TestPostPostgresStorage_EnableComment(t *testing.T) {
-	storage := NewPostPostgresStorage()
+	storage := NewPostPostgresStorage(nil)
 
 	t.Run("Enable comment by author", func(t *testing.T) {
 		// Настраиваем тестовую БД
@@ -315,46 +265,6 @@ func TestPostPostgresStorage_EnableComment(t *testing.T) {
 		assert.False(t, updatedPost.CommentsDisabled)
 	})
 
-	t.Run("Enable comment by not author", func(t *testing.T) {
-		// Настраиваем тестовую БД
-		oldDB := setupTestDB(t)
-		defer teardownTestDB(oldDB)
-
-		authorID := createTestUser(t)
-
-		// Создаем второго пользователя
-		anotherUser := &models.User{
-			Username: "anotheruser",
-			Email:    "another@example.com",
-			Password: "password123",
-		}
-		err := DB.Create(anotherUser).Error
-		require.NoError(t, err)
-
-		// Создаем тестовый пост с отключенными комментариями
-		post := &models.Post{
-			Title:            "Test Post",
-			Content:          "Test Content",
-			UserID:           authorID,
-			CommentsDisabled: true,
-		}
-		err = DB.Create(post).Error
-		require.NoError(t, err)
-
-		// Создаем контекст с ID второго пользователя (не автора)
-		ctx := createUserContext(anotherUser.ID)
-
-		err = storage.EnableComment(ctx, fmt.Sprint(post.ID))
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "forbidden")
-
-		// Проверяем, что комментарии остались отключенными
-		var updatedPost models.Post
-		err = DB.First(&updatedPost, post.ID).Error
-		assert.NoError(t, err)
-		assert.True(t, updatedPost.CommentsDisabled)
-	})
-
 	t.Run("Enable comment for not exists post", func(t *testing.T) {
 		// Настраиваем тестовую БД
 		oldDB := setupTestDB(t)
@@ -367,39 +277,10 @@ func TestPostPostgresStorage_EnableComment(t *testing.T) {
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "post not found")
 	})
-
-	t.Run("Enable comment by unauthorized user", func(t *testing.T) {
-		// Настраиваем тестовую БД
-		oldDB := setupTestDB(t)
-		defer teardownTestDB(oldDB)
-
-		userID := createTestUser(t)
-
-		// Создаем тестовый пост с отключенными комментариями
-		post := &models.Post{
-			Title:            "Test Post",
-			Content:          "Test Content",
-			UserID:           userID,
-			CommentsDisabled: true,
-		}
-		err := DB.Create(post).Error
-		require.NoError(t, err)
-
-		ctx := context.Background()
-		err = storage.EnableComment(ctx, fmt.Sprint(post.ID))
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "unauthorized")
-
-		// Проверяем, что комментарии остались отключенными
-		var updatedPost models.Post
-		err = DB.First(&updatedPost, post.ID).Error
-		assert.NoError(t, err)
-		assert.True(t, updatedPost.CommentsDisabled)
-	})
 }
 
 func TestPostPostgresStorage_DeletePostById(t *testing.T) {
-	storage := NewPostPostgresStorage()
+	storage := NewPostPostgresStorage(nil)
 
 	t.Run("Delete post by author", func(t *testing.T) {
 		// Настраиваем тестовую БД
@@ -439,66 +320,168 @@ func TestPostPostgresStorage_DeletePostById(t *testing.T) {
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "post not found")
 	})
+}
 
-	t.Run("Delete post by not author", func(t *testing.T) {
+// Тестирование многопоточности с использованием SQLite в режиме in-memory не имеет смысла
+// SQLite не предназначен для интенсивного параллельного доступа, особенно в режиме in-memory
+// Мой код в PostPostgresStorage делегирует всю работу с данными базе данных PostgreSQL, которая имеет встроенное управление параллельным доступом.
+
+func TestPostPostgresStorage_DeleteAndAnonymizeByAuthor(t *testing.T) {
+	storage := NewPostPostgresStorage(nil)
+
+	t.Run("Delete posts by author", func(t *testing.T) {
 		// Настраиваем тестовую БД
 		oldDB := setupTestDB(t)
 		defer teardownTestDB(oldDB)
 
-		// Создаем двух тестовых пользователей
-		authorID := createTestUser(t)
+		userID := createTestUser(t)
+		createTestPost(t, userID, "Post 1", "Content 1")
+		createTestPost(t, userID, "Post 2", "Content 2")
+		otherPostID := createTestPost(t, userID+1, "Other Post", "Other Content")
 
-		// Создаем второго пользователя
-		anotherUser := &models.User{
-			Username: "anotheruser",
-			Email:    "another@example.com",
-			Password: "password123",
-		}
-		err := DB.Create(anotherUser).Error
+		err := storage.DeletePostsByAuthor(fmt.Sprint(userID))
 		require.NoError(t, err)
 
-		// Создаем тестовый пост от имени первого пользователя
-		postID := createTestPost(t, authorID, "Test Post", "Test Content")
+		var count int
+		DB.Unscoped().Model(&models.Post{}).Where("user_id = ?", userID).Count(&count)
+		assert.Equal(t, 0, count)
 
-		// Создаем контекст с ID второго пользователя (не автора)
-		ctx := createUserContext(anotherUser.ID)
-
-		// Вызываем тестируемый метод
-		err = storage.DeletePostById(ctx, fmt.Sprint(postID))
-
-		// Проверяем, что возникла ошибка "не автор"
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "forbidden")
-
-		// Проверяем, что пост не был удален
-		var post models.Post
-		err = DB.First(&post, postID).Error
+		// посты других авторов не затронуты
+		_, err = storage.GetPostById(fmt.Sprint(otherPostID))
 		assert.NoError(t, err)
-		assert.Equal(t, "Test Post", post.Title)
 	})
 
-	t.Run("Delete by unauthorized user", func(t *testing.T) {
+	t.Run("Anonymize posts by author", func(t *testing.T) {
 		// Настраиваем тестовую БД
 		oldDB := setupTestDB(t)
 		defer teardownTestDB(oldDB)
 
 		userID := createTestUser(t)
-		postID := createTestPost(t, userID, "Test Post", "Test Content")
+		postID := createTestPost(t, userID, "Post 1", "Content 1")
 
-		ctx := context.Background()
+		err := storage.AnonymizePostsByAuthor(fmt.Sprint(userID))
+		require.NoError(t, err)
 
-		err := storage.DeletePostById(ctx, fmt.Sprint(postID))
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "unauthorized")
+		post, err := storage.GetPostById(fmt.Sprint(postID))
+		require.NoError(t, err)
+		assert.Equal(t, user.DeletedUserID, post.AuthorID)
+		assert.Equal(t, "Content 1", post.Content)
+	})
+}
 
-		// Проверяем, что пост не был удален
-		var post models.Post
-		err = DB.First(&post, postID).Error
-		assert.NoError(t, err)
-		assert.Equal(t, "Test Post", post.Title)
+func TestPostPostgresStorage_GetPostsByAuthor(t *testing.T) {
+	storage := NewPostPostgresStorage(nil)
+
+	// Настраиваем тестовую БД
+	oldDB := setupTestDB(t)
+	defer teardownTestDB(oldDB)
+
+	userID := createTestUser(t)
+	firstID := createTestPost(t, userID, "Post 1", "Content 1")
+	createTestPost(t, userID+1, "Other Post", "Other Content")
+	secondID := createTestPost(t, userID, "Post 2", "Content 2")
+
+	posts, err := storage.GetPostsByAuthor(fmt.Sprint(userID))
+	require.NoError(t, err)
+	require.Len(t, posts, 2)
+	assert.Equal(t, fmt.Sprint(firstID), posts[0].ID)
+	assert.Equal(t, fmt.Sprint(secondID), posts[1].ID)
+}
+
+func TestPostPostgresStorage_GetPostsByAuthors(t *testing.T) {
+	storage := NewPostPostgresStorage(nil)
+
+	// Настраиваем тестовую БД
+	oldDB := setupTestDB(t)
+	defer teardownTestDB(oldDB)
+
+	userID := createTestUser(t)
+	firstID := createTestPost(t, userID, "Post 1", "Content 1")
+	otherID := createTestPost(t, userID+1, "Other Post", "Other Content")
+	createTestPost(t, userID+2, "Not followed", "Content")
+	secondID := createTestPost(t, userID, "Post 2", "Content 2")
+
+	authors := []string{fmt.Sprint(userID), fmt.Sprint(userID + 1)}
+
+	t.Run("Newest first", func(t *testing.T) {
+		posts, err := storage.GetPostsByAuthors(authors, "", 10)
+		require.NoError(t, err)
+		require.Len(t, posts, 3)
+		assert.Equal(t, fmt.Sprint(secondID), posts[0].ID)
+		assert.Equal(t, fmt.Sprint(otherID), posts[1].ID)
+		assert.Equal(t, fmt.Sprint(firstID), posts[2].ID)
+	})
+
+	t.Run("Before cursor with limit", func(t *testing.T) {
+		posts, err := storage.GetPostsByAuthors(authors, fmt.Sprint(secondID), 1)
+		require.NoError(t, err)
+		require.Len(t, posts, 1)
+		assert.Equal(t, fmt.Sprint(otherID), posts[0].ID)
+	})
+
+	t.Run("No authors", func(t *testing.T) {
+		posts, err := storage.GetPostsByAuthors(nil, "", 10)
+		require.NoError(t, err)
+		assert.Empty(t, posts)
 	})
 }
 
-// Тестирование многопоточности с использованием SQLite в режиме in-memory не имеет смысла
-// SQLite не предназначен для интенсивного параллельного доступа, особенно в режиме in-memory
-// Мой код в PostPostgresStorage делегирует всю работу с данными базе данных PostgreSQL, которая имеет встроенное управление параллельным доступом.
+func TestPostPostgresStorage_Events(t *testing.T) {
+	manager := mocks.NewMockSubscriptionManager()
+	storage := NewPostPostgresStorage(manager)
+
+	// Настраиваем тестовую БД
+	oldDB := setupTestDB(t)
+	defer teardownTestDB(oldDB)
+
+	userID := createTestUser(t)
+	post, err := storage.CreatePost(createUserContext(userID), "Title", "Content")
+	require.NoError(t, err)
+	topic := subscription.PostTopic(post.ID)
+
+	t.Run("Create", func(t *testing.T) {
+		events := manager.GetEventsForTopic(subscription.PostsTopic)
+		require.Len(t, events, 1)
+		assert.Equal(t, subscription.EventPostCreated, events[0].Type)
+		assert.Equal(t, post.ID, events[0].Payload.(*model.Post).ID)
+	})
+
+	t.Run("Toggle comments only when changed", func(t *testing.T) {
+		require.NoError(t, storage.DisableComment(context.Background(), post.ID))
+		require.NoError(t, storage.DisableComment(context.Background(), post.ID))
+
+		events := manager.GetEventsForTopic(topic)
+		require.Len(t, events, 2)
+		assert.Equal(t, subscription.EventCommentsToggled, events[0].Type)
+		assert.Equal(t, subscription.EventPostUpdated, events[1].Type)
+		assert.True(t, events[0].Payload.(*model.Post).CommentsDisabled)
+	})
+
+	t.Run("Anonymize", func(t *testing.T) {
+		require.NoError(t, storage.AnonymizePostsByAuthor(fmt.Sprint(userID)))
+
+		events := manager.GetEventsForTopic(topic)
+		require.Len(t, events, 3)
+		assert.Equal(t, subscription.EventPostUpdated, events[2].Type)
+		assert.Equal(t, user.DeletedUserID, events[2].Payload.(*model.Post).AuthorID)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		require.NoError(t, storage.DeletePostById(context.Background(), post.ID))
+
+		events := manager.GetEventsForTopic(topic)
+		require.Len(t, events, 4)
+		assert.Equal(t, subscription.EventPostDeleted, events[3].Type)
+		assert.Equal(t, post.ID, events[3].Payload)
+	})
+
+	t.Run("Delete by author", func(t *testing.T) {
+		other, err := storage.CreatePost(createUserContext(userID), "Other", "Content")
+		require.NoError(t, err)
+		require.NoError(t, storage.DeletePostsByAuthor(fmt.Sprint(userID)))
+
+		events := manager.GetEventsForTopic(subscription.PostTopic(other.ID))
+		require.Len(t, events, 1)
+		assert.Equal(t, subscription.EventPostDeleted, events[0].Type)
+	})
+}
@@ -0,0 +1,102 @@
+package postgres
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/VitaminP8/postery/internal/relation"
+	"github.com/VitaminP8/postery/models"
+	"github.com/jinzhu/gorm"
+)
+
+type RelationPostgresStorage struct{}
+
+func NewRelationPostgresStorage() *RelationPostgresStorage {
+	return &RelationPostgresStorage{}
+}
+
+func (s *RelationPostgresStorage) AddRelation(userID, targetID string, kind relation.Kind) error {
+	userIDUint, targetIDUint, err := parseRelationIDs(userID, targetID)
+	if err != nil {
+		return err
+	}
+
+	record := models.UserRelation{UserID: userIDUint, TargetID: targetIDUint, Kind: string(kind)}
+	err = DB.Where(record).FirstOrCreate(&record).Error
+	if err != nil {
+		return fmt.Errorf("could not save relation: %w", err)
+	}
+	return nil
+}
+
+func (s *RelationPostgresStorage) RemoveRelation(userID, targetID string, kind relation.Kind) error {
+	err := DB.Where("user_id = ? AND target_id = ? AND kind = ?", userID, targetID, string(kind)).
+		Delete(&models.UserRelation{}).Error
+	if err != nil {
+		return fmt.Errorf("could not delete relation: %w", err)
+	}
+	return nil
+}
+
+func (s *RelationPostgresStorage) HasRelation(userID, targetID string, kind relation.Kind) (bool, error) {
+	var count int
+	err := DB.Model(&models.UserRelation{}).
+		Where("user_id = ? AND target_id = ? AND kind = ?", userID, targetID, string(kind)).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("could not get relation: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (s *RelationPostgresStorage) GetTargets(userID string, kind relation.Kind) ([]string, error) {
+	var records []models.UserRelation
+	err := DB.Where("user_id = ? AND kind = ?", userID, string(kind)).Order("target_id").Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get relations: %w", err)
+	}
+
+	targets := make([]string, 0, len(records))
+	for _, record := range records {
+		targets = append(targets, fmt.Sprint(record.TargetID))
+	}
+	return targets, nil
+}
+
+func (s *RelationPostgresStorage) GetSources(targetID string, kind relation.Kind) ([]string, error) {
+	var records []models.UserRelation
+	err := DB.Where("target_id = ? AND kind = ?", targetID, string(kind)).Order("user_id").Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get relations: %w", err)
+	}
+
+	sources := make([]string, 0, len(records))
+	for _, record := range records {
+		sources = append(sources, fmt.Sprint(record.UserID))
+	}
+	return sources, nil
+}
+
+func (s *RelationPostgresStorage) DeleteRelationsOf(userID string) error {
+	return deleteRelationsOf(DB, userID)
+}
+
+func deleteRelationsOf(db *gorm.DB, userID string) error {
+	err := db.Where("user_id = ? OR target_id = ?", userID, userID).Delete(&models.UserRelation{}).Error
+	if err != nil {
+		return fmt.Errorf("could not delete relations: %w", err)
+	}
+	return nil
+}
+
+func parseRelationIDs(userID, targetID string) (uint, uint, error) {
+	userIDUint, err := strconv.ParseUint(userID, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+	targetIDUint, err := strconv.ParseUint(targetID, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+	return uint(userIDUint), uint(targetIDUint), nil
+}
@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/VitaminP8/postery/models"
+	"github.com/jinzhu/gorm"
+)
+
+type RevocationPostgresStorage struct{}
+
+func NewRevocationPostgresStorage() *RevocationPostgresStorage {
+	return &RevocationPostgresStorage{}
+}
+
+func (s *RevocationPostgresStorage) RevokeUserTokens(userID uint, before time.Time) error {
+	revocation := models.TokenRevocation{
+		UserID:        userID,
+		RevokedBefore: before,
+	}
+
+	// одна запись на пользователя - обновляем момент отзыва
+	err := DB.Where(models.TokenRevocation{UserID: userID}).
+		Assign(models.TokenRevocation{RevokedBefore: before}).
+		FirstOrCreate(&revocation).Error
+	if err != nil {
+		return fmt.Errorf("could not revoke tokens: %w", err)
+	}
+
+	return nil
+}
+
+func (s *RevocationPostgresStorage) IsRevoked(userID uint, issuedAt time.Time) (bool, error) {
+	var revocation models.TokenRevocation
+	err := DB.Where("user_id = ?", userID).First(&revocation).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("could not get token revocation: %w", err)
+	}
+
+	// сравниваем с точностью до секунды, как в claim "iat"
+	return issuedAt.Unix() <= revocation.RevokedBefore.Unix(), nil
+}
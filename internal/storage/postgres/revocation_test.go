@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevocationPostgresStorage(t *testing.T) {
+	storage := NewRevocationPostgresStorage()
+
+	t.Run("Tokens are valid without revocation", func(t *testing.T) {
+		// Настраиваем тестовую БД
+		oldDB := setupTestDB(t)
+		defer teardownTestDB(oldDB)
+
+		revoked, err := storage.IsRevoked(1, time.Now())
+		require.NoError(t, err)
+		assert.False(t, revoked)
+	})
+
+	t.Run("Tokens issued before revocation are revoked", func(t *testing.T) {
+		// Настраиваем тестовую БД
+		oldDB := setupTestDB(t)
+		defer teardownTestDB(oldDB)
+
+		revokedAt := time.Now()
+		require.NoError(t, storage.RevokeUserTokens(1, revokedAt))
+
+		revoked, err := storage.IsRevoked(1, revokedAt.Add(-time.Hour))
+		require.NoError(t, err)
+		assert.True(t, revoked)
+
+		revoked, err = storage.IsRevoked(1, revokedAt.Add(time.Hour))
+		require.NoError(t, err)
+		assert.False(t, revoked)
+
+		// другие пользователи не затронуты
+		revoked, err = storage.IsRevoked(2, revokedAt.Add(-time.Hour))
+		require.NoError(t, err)
+		assert.False(t, revoked)
+	})
+
+	t.Run("Repeated revocation moves the moment forward", func(t *testing.T) {
+		// Настраиваем тестовую БД
+		oldDB := setupTestDB(t)
+		defer teardownTestDB(oldDB)
+
+		first := time.Now().Add(-time.Hour)
+		require.NoError(t, storage.RevokeUserTokens(1, first))
+		require.NoError(t, storage.RevokeUserTokens(1, time.Now()))
+
+		revoked, err := storage.IsRevoked(1, first.Add(time.Minute))
+		require.NoError(t, err)
+		assert.True(t, revoked)
+	})
+}
@@ -0,0 +1,110 @@
+package postgres
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/models"
+	"github.com/jinzhu/gorm"
+)
+
+type SessionPostgresStorage struct{}
+
+func NewSessionPostgresStorage() *SessionPostgresStorage {
+	return &SessionPostgresStorage{}
+}
+
+func (s *SessionPostgresStorage) CreateSession(session *auth.Session) error {
+	record := &models.Session{
+		ID:         session.ID,
+		UserID:     session.UserID,
+		UserAgent:  session.UserAgent,
+		IP:         session.IP,
+		CreatedAt:  session.CreatedAt,
+		LastSeenAt: session.LastSeenAt,
+	}
+
+	err := DB.Create(record).Error
+	if err != nil {
+		return fmt.Errorf("could not create session: %w", err)
+	}
+	return nil
+}
+
+func (s *SessionPostgresStorage) GetSession(id string) (*auth.Session, error) {
+	var record models.Session
+	err := DB.Where("id = ?", id).First(&record).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, auth.ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("could not get session: %w", err)
+	}
+	return toSession(&record), nil
+}
+
+func (s *SessionPostgresStorage) GetSessions(userID uint) ([]*auth.Session, error) {
+	var records []models.Session
+	err := DB.Where("user_id = ?", userID).Order("last_seen_at DESC").Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get sessions: %w", err)
+	}
+
+	sessions := []*auth.Session{}
+	for i := range records {
+		sessions = append(sessions, toSession(&records[i]))
+	}
+	return sessions, nil
+}
+
+func (s *SessionPostgresStorage) TouchSession(id string, seenAt time.Time, ip string) error {
+	err := DB.Model(&models.Session{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"last_seen_at": seenAt, "ip": ip}).Error
+	if err != nil {
+		return fmt.Errorf("could not update session: %w", err)
+	}
+	return nil
+}
+
+func (s *SessionPostgresStorage) RevokeSession(userID uint, id string) error {
+	result := DB.Where("id = ? AND user_id = ?", id, userID).Delete(&models.Session{})
+	if result.Error != nil {
+		return fmt.Errorf("could not revoke session: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return auth.ErrSessionNotFound
+	}
+	return nil
+}
+
+func (s *SessionPostgresStorage) DeleteUserSessions(userID uint) error {
+	return deleteUserSessions(DB, userID)
+}
+
+func deleteUserSessions(db *gorm.DB, userID uint) error {
+	err := db.Where("user_id = ?", userID).Delete(&models.Session{}).Error
+	if err != nil {
+		return fmt.Errorf("could not delete sessions: %w", err)
+	}
+	return nil
+}
+
+func (s *SessionPostgresStorage) DeleteSessionsBefore(createdBefore time.Time) error {
+	err := DB.Where("created_at < ?", createdBefore).Delete(&models.Session{}).Error
+	if err != nil {
+		return fmt.Errorf("could not delete sessions: %w", err)
+	}
+	return nil
+}
+
+func toSession(record *models.Session) *auth.Session {
+	return &auth.Session{
+		ID:         record.ID,
+		UserID:     record.UserID,
+		UserAgent:  record.UserAgent,
+		IP:         record.IP,
+		CreatedAt:  record.CreatedAt,
+		LastSeenAt: record.LastSeenAt,
+	}
+}
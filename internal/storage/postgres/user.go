@@ -1,33 +1,57 @@
 package postgres
 
 import (
-	"errors"
 	"fmt"
-	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/identity"
+	passwordpkg "github.com/VitaminP8/postery/internal/password"
+	userpkg "github.com/VitaminP8/postery/internal/user"
 	"github.com/VitaminP8/postery/models"
-	"github.com/golang-jwt/jwt"
-
-	"golang.org/x/crypto/bcrypt"
+	"github.com/jinzhu/gorm"
 )
 
-type UserPostgresStorage struct{}
+type UserPostgresStorage struct {
+	hasher *passwordpkg.Hasher
+}
 
 func NewUserPostgresStorage() *UserPostgresStorage {
-	return &UserPostgresStorage{}
+	return &UserPostgresStorage{
+		hasher: passwordpkg.Default(),
+	}
 }
 
 func (s *UserPostgresStorage) RegisterUser(username, email, password string) (*model.User, error) {
-	// проверка - существует ли такой пользователь
-	var existUser models.User
-	err := DB.Where("username = ?", username).First(&existUser).Error
-	if err == nil {
-		return nil, fmt.Errorf("user with username %s already exists", username)
+	return s.createUser(username, email, password, auth.RoleUser, false)
+}
+
+func (s *UserPostgresStorage) CreateAdmin(username, email, password string) (*model.User, error) {
+	return s.createUser(username, email, password, auth.RoleAdmin, true)
+}
+
+// createUser создает аккаунт с паролем и ролью; allowReserved разрешает служебные имена
+func (s *UserPostgresStorage) createUser(username, email, password, role string, allowReserved bool) (*model.User, error) {
+	username, email, err := identity.Validate(username, email, allowReserved)
+	if err != nil {
+		return nil, err
+	}
+
+	err = passwordpkg.Validate(password, username, email)
+	if err != nil {
+		return nil, err
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	// проверка - заняты ли имя и email (без учета регистра)
+	err = checkIdentityTaken(DB, username, email)
+	if err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := s.hasher.Hash(password)
 	if err != nil {
 		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
@@ -35,11 +59,17 @@ func (s *UserPostgresStorage) RegisterUser(username, email, password string) (*m
 	user := &models.User{
 		Username: username,
 		Email:    email,
-		Password: string(hashedPassword),
+		Password: hashedPassword,
+		Role:     role,
 	}
+	setIdentityKeys(user)
 
 	err = DB.Create(user).Error
 	if err != nil {
+		// параллельная регистрация успела занять имя или email - уникальный индекс отклонил запись
+		if takenErr := checkIdentityTaken(DB, username, email); takenErr != nil {
+			return nil, takenErr
+		}
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
@@ -47,38 +77,528 @@ func (s *UserPostgresStorage) RegisterUser(username, email, password string) (*m
 		ID:       fmt.Sprint(user.ID),
 		Username: user.Username,
 		Email:    user.Email,
+		Role:     model.Role(user.Role),
 	}, nil
 }
 
-func (s *UserPostgresStorage) LoginUser(username, password string) (string, error) {
+func (s *UserPostgresStorage) VerifyCredentials(username, password string) (*model.User, error) {
 	// проверка - существует ли такой пользователь
 	var user models.User
-	err := DB.Where("username = ?", username).First(&user).Error
+	err := DB.Where("username_key = ?", identity.UsernameKey(username)).First(&user).Error
+	if err != nil {
+		if !gorm.IsRecordNotFoundError(err) {
+			return nil, fmt.Errorf("could not get user: %w", err)
+		}
+		s.hasher.SimulateVerify(password)
+		return nil, userpkg.ErrInvalidCredentials
+	}
+
+	needsRehash, err := s.hasher.Verify(password, user.Password)
+	if err != nil {
+		return nil, userpkg.ErrInvalidCredentials
+	}
+
+	// хэш старого формата (bcrypt) или с прежними параметрами пересчитываем, пока пароль известен;
+	// ошибка пересчета не мешает входу - попробуем при следующем
+	if needsRehash {
+		rehashed, err := s.hasher.Hash(password)
+		if err == nil {
+			DB.Model(&user).Update("password", rehashed)
+		}
+	}
+
+	return &model.User{
+		ID:       fmt.Sprint(user.ID),
+		Username: user.Username,
+		Email:    user.Email,
+		Role:     model.Role(user.Role),
+	}, nil
+}
+
+func (s *UserPostgresStorage) SetUserRole(userID string, role model.Role) (*model.User, error) {
+	if !role.IsValid() {
+		return nil, fmt.Errorf("invalid role %s", role)
+	}
+
+	var user models.User
+	err := DB.First(&user, userID).Error
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+
+	err = DB.Model(&user).Update("role", role.String()).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not update role: %w", err)
+	}
+
+	return &model.User{
+		ID:       fmt.Sprint(user.ID),
+		Username: user.Username,
+		Email:    user.Email,
+		Role:     role,
+	}, nil
+}
+
+func (s *UserPostgresStorage) CheckPassword(userID, password string) error {
+	var user models.User
+	err := DB.First(&user, userID).Error
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+
+	_, err = s.hasher.Verify(password, user.Password)
+	if err != nil {
+		return fmt.Errorf("password is incorrect")
+	}
+
+	return nil
+}
+
+// DeleteUser удаляет учетные и персональные данные пользователя (без soft delete)
+func (s *UserPostgresStorage) DeleteUser(userID string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return deleteUser(tx, userID)
+	})
+}
+
+// deleteUser удаляет пользователя вместе со связанными identity, 2FA и историей имен. Вызывается в транзакции.
+func deleteUser(tx *gorm.DB, userID string) error {
+	var user models.User
+	err := tx.First(&user, userID).Error
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+
+	err = tx.Where("user_id = ?", user.ID).Delete(&models.UserIdentity{}).Error
+	if err == nil {
+		err = tx.Where("user_id = ?", user.ID).Delete(&models.UserTwoFactor{}).Error
+	}
+	if err == nil {
+		err = tx.Where("user_id = ?", user.ID).Delete(&models.UsernameChange{}).Error
+	}
+	if err == nil {
+		err = tx.Unscoped().Delete(&user).Error
+	}
+	if err != nil {
+		return fmt.Errorf("could not delete user: %w", err)
+	}
+
+	return nil
+}
+
+func (s *UserPostgresStorage) FindOrCreateByIdentity(issuer, subject, username, email string) (*model.User, error) {
+	var user models.User
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var link models.UserIdentity
+		err := tx.Where("issuer = ? AND subject = ?", issuer, subject).First(&link).Error
+		if err == nil {
+			return tx.First(&user, link.UserID).Error
+		}
+		if !gorm.IsRecordNotFoundError(err) {
+			return err
+		}
+
+		// адрес, не прошедший проверку, не сохраняется - аккаунт создается без email
+		email, err = identity.ValidateEmail(email)
+		if err != nil {
+			email = ""
+		}
+
+		// аккаунт не связывается с существующим по email - провайдер мог не подтвердить адрес
+		if email != "" {
+			var count int
+			err = tx.Model(&models.User{}).Where("email_key = ?", identity.EmailKey(email)).Count(&count).Error
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return fmt.Errorf("email %s is already registered, log in with password", email)
+			}
+		}
+
+		base := identity.SuggestUsername(username)
+		name := base
+		now := time.Now()
+		for i := 2; ; i++ {
+			taken, err := usernameTaken(tx, identity.UsernameKey(name), 0, now)
+			if err != nil {
+				return err
+			}
+			if !taken {
+				break
+			}
+			name = base + strconv.Itoa(i)
+		}
+
+		// пароля нет - вход по паролю невозможен, пока он не будет задан
+		user = models.User{
+			Username: name,
+			Email:    email,
+			Role:     auth.RoleUser,
+		}
+		setIdentityKeys(&user)
+		err = tx.Create(&user).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&models.UserIdentity{Issuer: issuer, Subject: subject, UserID: user.ID}).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not log in with identity: %w", err)
+	}
+
+	return &model.User{
+		ID:       fmt.Sprint(user.ID),
+		Username: user.Username,
+		Email:    user.Email,
+		Role:     model.Role(user.Role),
+	}, nil
+}
+
+func (s *UserPostgresStorage) FindUserByIdentity(issuer, subject string) (*model.User, error) {
+	var link models.UserIdentity
+	err := DB.Where("issuer = ? AND subject = ?", issuer, subject).First(&link).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not find identity: %w", err)
+	}
+
+	return s.GetUserByID(fmt.Sprint(link.UserID))
+}
+
+func (s *UserPostgresStorage) GetUserRole(userID uint) (string, error) {
+	var user models.User
+	err := DB.Select("role").Where("id = ?", userID).First(&user).Error
+	if err != nil {
+		return "", fmt.Errorf("user not found: %w", err)
+	}
+	return user.Role, nil
+}
+
+func (s *UserPostgresStorage) GetUserByID(id string) (*model.User, error) {
+	var user models.User
+	err := DB.First(&user, id).Error
 	if err != nil {
-		return "", fmt.Errorf("user with username %s not found", username)
+		return nil, fmt.Errorf("user not found: %w", err)
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	return &model.User{
+		ID:       fmt.Sprint(user.ID),
+		Username: user.Username,
+		Email:    user.Email,
+		Role:     model.Role(user.Role),
+	}, nil
+}
+
+func (s *UserPostgresStorage) GetUserByUsername(username string) (*model.User, error) {
+	key := identity.UsernameKey(username)
+
+	var user models.User
+	err := DB.Where("username_key = ?", key).First(&user).Error
+	if gorm.IsRecordNotFoundError(err) {
+		// имя никем не занято - ищем последнего пользователя, который его носил
+		var change models.UsernameChange
+		err = DB.Where("username_key = ?", key).Order("changed_at DESC").First(&change).Error
+		if err == nil {
+			err = DB.First(&user, change.UserID).Error
+		}
+	}
 	if err != nil {
-		return "", fmt.Errorf("invalid password or username: %w", err)
+		return nil, fmt.Errorf("user not found: %w", err)
 	}
 
-	// достаем из .env jwtSecret
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		return "", errors.New("JWT_SECRET is not set in environment")
+	return &model.User{
+		ID:       fmt.Sprint(user.ID),
+		Username: user.Username,
+		Email:    user.Email,
+		Role:     model.Role(user.Role),
+	}, nil
+}
+
+func (s *UserPostgresStorage) ChangeUsername(userID, username string) (*model.User, error) {
+	name, err := identity.ValidateUsername(username)
+	if err != nil {
+		return nil, err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": user.Username,
-		"exp":      time.Now().Add(72 * time.Hour).Unix(),
+	var user models.User
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.First(&user, userID).Error
+		if err != nil {
+			return fmt.Errorf("user not found: %w", err)
+		}
+		if name == user.Username {
+			return userpkg.ErrUsernameUnchanged
+		}
+
+		now := time.Now()
+		var last models.UsernameChange
+		err = tx.Where("user_id = ?", user.ID).Order("changed_at DESC").First(&last).Error
+		if err == nil {
+			next := userpkg.NextChangeAt(last.ChangedAt)
+			if now.Before(next) {
+				return fmt.Errorf("%w: next change is allowed after %s", userpkg.ErrUsernameChangeTooSoon, next.Format(time.RFC3339))
+			}
+		} else if !gorm.IsRecordNotFoundError(err) {
+			return err
+		}
+
+		newKey := identity.UsernameKey(name)
+		// смена только регистра ("alice" -> "Alice") не освобождает и не занимает имя
+		if newKey != user.UsernameKey {
+			taken, err := usernameTaken(tx, newKey, user.ID, now)
+			if err != nil {
+				return err
+			}
+			if taken {
+				return identity.ErrUsernameTaken
+			}
+		}
+
+		err = tx.Create(&models.UsernameChange{
+			UserID:      user.ID,
+			Username:    user.Username,
+			UsernameKey: user.UsernameKey,
+			ChangedAt:   now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		user.Username = name
+		user.UsernameKey = newKey
+		err = tx.Model(&user).Updates(map[string]interface{}{"username": name, "username_key": newKey}).Error
+		if err != nil {
+			// параллельный запрос успел занять имя - уникальный индекс отклонил запись
+			if taken, _ := usernameTaken(DB, newKey, user.ID, now); taken {
+				return identity.ErrUsernameTaken
+			}
+		}
+		return err
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.User{
+		ID:       fmt.Sprint(user.ID),
+		Username: user.Username,
+		Email:    user.Email,
+		Role:     model.Role(user.Role),
+	}, nil
+}
+
+func (s *UserPostgresStorage) GetUsernameHistory(userID string) ([]*userpkg.UsernameChange, error) {
+	var changes []models.UsernameChange
+	err := DB.Where("user_id = ?", userID).Order("changed_at DESC").Find(&changes).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get username history: %w", err)
+	}
+
+	result := make([]*userpkg.UsernameChange, 0, len(changes))
+	for _, change := range changes {
+		result = append(result, &userpkg.UsernameChange{Username: change.Username, ChangedAt: change.ChangedAt})
+	}
+	return result, nil
+}
+
+// usernameTaken проверяет, занято ли имя с ключом key: текущим именем или прежним именем другого
+// пользователя в течение UsernameGracePeriod; свои прежние имена exceptUserID может вернуть
+func usernameTaken(db *gorm.DB, key string, exceptUserID uint, now time.Time) (bool, error) {
+	var count int
+	err := db.Model(&models.User{}).Where("username_key = ?", key).Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("could not check username: %w", err)
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	err = db.Model(&models.UsernameChange{}).
+		Where("username_key = ? AND user_id <> ? AND changed_at > ?", key, exceptUserID, now.Add(-userpkg.UsernameGracePeriod)).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("could not check username history: %w", err)
+	}
+	return count > 0, nil
+}
 
-	tokenString, err := token.SignedString([]byte(jwtSecret))
+func (s *UserPostgresStorage) GetTwoFactor(userID string) (*userpkg.TwoFactor, error) {
+	var state models.UserTwoFactor
+	err := DB.Where("user_id = ?", userID).First(&state).Error
 	if err != nil {
-		return "", fmt.Errorf("failed to sign token: %w", err)
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get two-factor settings: %w", err)
 	}
 
-	return tokenString, nil
+	return &userpkg.TwoFactor{
+		Secret:        state.Secret,
+		Enabled:       state.Enabled,
+		RecoveryCodes: splitRecoveryCodes(state.RecoveryCodes),
+		LastStep:      state.LastStep,
+	}, nil
+}
+
+func (s *UserPostgresStorage) SaveTwoFactor(userID string, state *userpkg.TwoFactor) error {
+	var user models.User
+	err := DB.First(&user, userID).Error
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+
+	// map, а не структура: gorm пропускает нулевые значения полей структуры (Enabled=false)
+	record := models.UserTwoFactor{UserID: user.ID}
+	err = DB.Where(models.UserTwoFactor{UserID: user.ID}).
+		Assign(map[string]interface{}{
+			"secret":         state.Secret,
+			"enabled":        state.Enabled,
+			"recovery_codes": strings.Join(state.RecoveryCodes, ","),
+			"last_step":      state.LastStep,
+		}).
+		FirstOrCreate(&record).Error
+	if err != nil {
+		return fmt.Errorf("could not save two-factor settings: %w", err)
+	}
+
+	return nil
+}
+
+func (s *UserPostgresStorage) DeleteTwoFactor(userID string) error {
+	err := DB.Where("user_id = ?", userID).Delete(&models.UserTwoFactor{}).Error
+	if err != nil {
+		return fmt.Errorf("could not delete two-factor settings: %w", err)
+	}
+	return nil
+}
+
+func (s *UserPostgresStorage) UseTotpStep(userID string, step int64) error {
+	// условие в UPDATE делает проверку и запись атомарными для параллельных входов
+	result := DB.Model(&models.UserTwoFactor{}).
+		Where("user_id = ? AND last_step < ?", userID, step).
+		Update("last_step", step)
+	if result.Error != nil {
+		return fmt.Errorf("could not save two-factor code: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return userpkg.ErrTotpCodeReused
+	}
+	return nil
+}
+
+func (s *UserPostgresStorage) UseRecoveryCode(userID, codeHash string) error {
+	var state models.UserTwoFactor
+	err := DB.Where("user_id = ?", userID).First(&state).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return userpkg.ErrRecoveryCodeInvalid
+		}
+		return fmt.Errorf("could not get two-factor settings: %w", err)
+	}
+
+	codes := splitRecoveryCodes(state.RecoveryCodes)
+	remaining := make([]string, 0, len(codes))
+	for _, hash := range codes {
+		if hash != codeHash {
+			remaining = append(remaining, hash)
+		}
+	}
+	if len(remaining) == len(codes) {
+		return userpkg.ErrRecoveryCodeInvalid
+	}
+
+	// оптимистичная блокировка: если код параллельно уже использован, список изменился и строка не обновится
+	result := DB.Model(&models.UserTwoFactor{}).
+		Where("user_id = ? AND recovery_codes = ?", userID, state.RecoveryCodes).
+		Update("recovery_codes", strings.Join(remaining, ","))
+	if result.Error != nil {
+		return fmt.Errorf("could not use recovery code: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return userpkg.ErrRecoveryCodeInvalid
+	}
+	return nil
+}
+
+func splitRecoveryCodes(joined string) []string {
+	if joined == "" {
+		return nil
+	}
+	return strings.Split(joined, ",")
+}
+
+// setIdentityKeys заполняет ключи уникальности по имени и email
+func setIdentityKeys(user *models.User) {
+	user.UsernameKey = identity.UsernameKey(user.Username)
+	user.EmailKey = nil
+	if user.Email != "" {
+		key := identity.EmailKey(user.Email)
+		user.EmailKey = &key
+	}
+}
+
+// checkIdentityTaken возвращает identity.ErrUsernameTaken/ErrEmailTaken (обе сразу, если заняты оба поля)
+func checkIdentityTaken(db *gorm.DB, username, email string) error {
+	var errs identity.FieldErrors
+
+	taken, err := usernameTaken(db, identity.UsernameKey(username), 0, time.Now())
+	if err != nil {
+		return err
+	}
+	if taken {
+		errs = append(errs, identity.ErrUsernameTaken)
+	}
+
+	var count int
+	err = db.Model(&models.User{}).Where("email_key = ?", identity.EmailKey(email)).Count(&count).Error
+	if err != nil {
+		return fmt.Errorf("could not check email: %w", err)
+	}
+	if count > 0 {
+		errs = append(errs, identity.ErrEmailTaken)
+	}
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return errs
+}
+
+// MigrateUserKeys заполняет ключи уникальности у пользователей, созданных до их появления,
+// и создает уникальные индексы. Вызывается после AutoMigrate. Если старые аккаунты различаются
+// только регистром ("Admin" и "admin"), индекс не создается - такие имена нужно переименовать вручную.
+func MigrateUserKeys() error {
+	var users []models.User
+	err := DB.Where("username_key IS NULL OR username_key = ''").Find(&users).Error
+	if err != nil {
+		return fmt.Errorf("could not load users: %w", err)
+	}
+
+	for i := range users {
+		setIdentityKeys(&users[i])
+		err = DB.Model(&users[i]).Updates(map[string]interface{}{
+			"username_key": users[i].UsernameKey,
+			"email_key":    users[i].EmailKey,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("could not update user %d: %w", users[i].ID, err)
+		}
+	}
+
+	err = DB.Model(&models.User{}).AddUniqueIndex("idx_users_username_key", "username_key").Error
+	if err != nil {
+		return fmt.Errorf("could not create username index (usernames differing only in case?): %w", err)
+	}
+	err = DB.Model(&models.User{}).AddUniqueIndex("idx_users_email_key", "email_key").Error
+	if err != nil {
+		return fmt.Errorf("could not create email index (emails differing only in case?): %w", err)
+	}
+	return nil
 }
@@ -1,11 +1,21 @@
 package postgres
 
 import (
-	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/auth"
+	"github.com/VitaminP8/postery/internal/identity"
+	"github.com/VitaminP8/postery/internal/password"
+	"github.com/VitaminP8/postery/internal/user"
+	"github.com/VitaminP8/postery/models"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestUserPostgresStorage_RegisterUser(t *testing.T) {
@@ -18,7 +28,7 @@ func TestUserPostgresStorage_RegisterUser(t *testing.T) {
 
 		username := "testuser"
 		email := "test@example.com"
-		password := "password123"
+		password := "s3cure-passw0rd"
 
 		user, err := storage.RegisterUser(username, email, password)
 		require.NoError(t, err)
@@ -34,7 +44,7 @@ func TestUserPostgresStorage_RegisterUser(t *testing.T) {
 
 		username := "duplicateuser"
 		email := "duplicate@example.com"
-		password := "password123"
+		password := "s3cure-passw0rd"
 
 		// Первая регистрация должна быть успешной
 		_, err := storage.RegisterUser(username, email, password)
@@ -42,23 +52,28 @@ func TestUserPostgresStorage_RegisterUser(t *testing.T) {
 
 		// Вторая регистрация с тем же именем пользователя должна вернуть ошибку
 		_, err = storage.RegisterUser(username, "another@example.com", "anotherpassword")
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "already exists")
+		assert.ErrorIs(t, err, identity.ErrUsernameTaken)
 	})
-}
 
-func TestUserPostgresStorage_LoginUser(t *testing.T) {
-	storage := NewUserPostgresStorage()
+	t.Run("Bootstrap administrator may take reserved name", func(t *testing.T) {
+		// Настраиваем тестовую БД
+		oldDB := setupTestDB(t)
+		defer teardownTestDB(oldDB)
 
-	// Устанавливаем переменную окружения JWT_SECRET перед тестами
-	originalJWTSecret := os.Getenv("JWT_SECRET")
-	err := os.Setenv("JWT_SECRET", "test_secret_key_for_jwt")
-	require.NoError(t, err)
+		admin, err := storage.CreateAdmin("admin", "admin@example.com", "s3cure-passw0rd")
+		require.NoError(t, err)
+		assert.Equal(t, model.RoleAdmin, admin.Role)
 
-	// Восстанавливаем оригинальное значение после тестов
-	defer os.Setenv("JWT_SECRET", originalJWTSecret)
+		stored, err := storage.GetUserByID(admin.ID)
+		require.NoError(t, err)
+		assert.Equal(t, model.RoleAdmin, stored.Role)
+	})
+}
+
+func TestUserPostgresStorage_VerifyCredentials(t *testing.T) {
+	storage := NewUserPostgresStorage()
 
-	t.Run("Successful login", func(t *testing.T) {
+	t.Run("Successful verification", func(t *testing.T) {
 		// Настраиваем тестовую БД
 		oldDB := setupTestDB(t)
 		defer teardownTestDB(oldDB)
@@ -67,23 +82,13 @@ func TestUserPostgresStorage_LoginUser(t *testing.T) {
 		email := "login@example.com"
 		password := "loginpassword123"
 
-		_, err = storage.RegisterUser(username, email, password)
+		registered, err := storage.RegisterUser(username, email, password)
 		require.NoError(t, err)
 
-		token, err := storage.LoginUser(username, password)
+		verified, err := storage.VerifyCredentials(username, password)
 		require.NoError(t, err)
-		assert.NotEmpty(t, token)
-
-		// Простая проверка, что это похоже на JWT токен
-		// JWT токен должен содержать две точки, разделяющие три части
-		assert.Contains(t, token, ".")
-		parts := 0
-		for _, char := range token {
-			if char == '.' {
-				parts++
-			}
-		}
-		assert.Equal(t, 2, parts, "JWT token должен состоять из трех частей, разделенных двумя точками")
+		assert.Equal(t, registered.ID, verified.ID)
+		assert.Equal(t, username, verified.Username)
 	})
 
 	t.Run("Login with incorrect password", func(t *testing.T) {
@@ -95,12 +100,12 @@ func TestUserPostgresStorage_LoginUser(t *testing.T) {
 		email := "wrongpass@example.com"
 		password := "correctpassword123"
 
-		_, err = storage.RegisterUser(username, email, password)
+		_, err := storage.RegisterUser(username, email, password)
 		require.NoError(t, err)
 
-		_, err := storage.LoginUser(username, "wrongpassword")
+		_, err = storage.VerifyCredentials(username, "wrongpassword")
 		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "invalid password")
+		assert.ErrorIs(t, err, user.ErrInvalidCredentials)
 	})
 
 	t.Run("Login with non-existent user", func(t *testing.T) {
@@ -108,35 +113,342 @@ func TestUserPostgresStorage_LoginUser(t *testing.T) {
 		oldDB := setupTestDB(t)
 		defer teardownTestDB(oldDB)
 
-		_, err := storage.LoginUser("nonexistentuser", "anypassword")
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "not found")
+		_, err := storage.VerifyCredentials("nonexistentuser", "anypassword")
+		// та же ошибка, что и при неверном пароле - имя пользователя не раскрывается
+		assert.ErrorIs(t, err, user.ErrInvalidCredentials)
 	})
 }
 
-func TestUserPostgresStorage_ErrorCases(t *testing.T) {
+func TestUserPostgresStorage_DeleteUser(t *testing.T) {
 	storage := NewUserPostgresStorage()
 
-	t.Run("Login without JWT_SECRET set", func(t *testing.T) {
+	t.Run("Check password and delete user", func(t *testing.T) {
 		// Настраиваем тестовую БД
 		oldDB := setupTestDB(t)
 		defer teardownTestDB(oldDB)
 
-		// Сохраняем текущее значение JWT_SECRET и сбрасываем его
-		originalJWTSecret := os.Getenv("JWT_SECRET")
-		os.Unsetenv("JWT_SECRET")
-		defer os.Setenv("JWT_SECRET", originalJWTSecret)
+		user, err := storage.RegisterUser("deleteuser", "delete@example.com", "s3cure-passw0rd")
+		require.NoError(t, err)
 
-		username := "jwt_secret_test"
-		email := "jwt_secret@example.com"
-		password := "password123"
+		err = storage.CheckPassword(user.ID, "wrongpassword")
+		assert.Error(t, err)
 
-		_, err := storage.RegisterUser(username, email, password)
+		err = storage.CheckPassword(user.ID, "s3cure-passw0rd")
+		require.NoError(t, err)
+
+		err = storage.DeleteUser(user.ID)
 		require.NoError(t, err)
 
-		// Пытаемся войти без установленного JWT_SECRET
-		_, err = storage.LoginUser(username, password)
+		// учетные данные удалены - войти нельзя
+		_, err = storage.VerifyCredentials("deleteuser", "s3cure-passw0rd")
+		assert.Error(t, err)
+
+		// запись удалена полностью, имя и email снова свободны
+		var count int
+		DB.Unscoped().Model(&models.User{}).Where("username = ?", "deleteuser").Count(&count)
+		assert.Equal(t, 0, count)
+
+		_, err = storage.RegisterUser("deleteuser", "delete@example.com", "s3cure-passw0rd")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Delete non-existent user", func(t *testing.T) {
+		// Настраиваем тестовую БД
+		oldDB := setupTestDB(t)
+		defer teardownTestDB(oldDB)
+
+		err := storage.DeleteUser("999")
 		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "JWT_SECRET is not set")
+		assert.Contains(t, err.Error(), "not found")
+	})
+}
+
+func TestUserPostgresStorage_GetUserByID(t *testing.T) {
+	storage := NewUserPostgresStorage()
+
+	// Настраиваем тестовую БД
+	oldDB := setupTestDB(t)
+	defer teardownTestDB(oldDB)
+
+	user, err := storage.RegisterUser("byid", "byid@example.com", "s3cure-passw0rd")
+	require.NoError(t, err)
+
+	found, err := storage.GetUserByID(user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, user, found)
+
+	_, err = storage.GetUserByID("999")
+	assert.Error(t, err)
+
+	// роль читается при каждом запросе - изменение видно сразу
+	_, err = storage.SetUserRole(user.ID, model.RoleModerator)
+	require.NoError(t, err)
+	id, err := strconv.ParseUint(user.ID, 10, 64)
+	require.NoError(t, err)
+	role, err := storage.GetUserRole(uint(id))
+	require.NoError(t, err)
+	assert.Equal(t, auth.RoleModerator, role)
+
+	_, err = storage.GetUserRole(999)
+	assert.Error(t, err)
+}
+
+func TestUserPostgresStorage_FindOrCreateByIdentity(t *testing.T) {
+	storage := NewUserPostgresStorage()
+
+	// Настраиваем тестовую БД
+	oldDB := setupTestDB(t)
+	defer teardownTestDB(oldDB)
+
+	_, err := storage.RegisterUser("oidcuser", "local@example.com", "s3cure-passw0rd")
+	require.NoError(t, err)
+
+	t.Run("First login creates account", func(t *testing.T) {
+		user, err := storage.FindOrCreateByIdentity("https://idp", "sub-1", "oidcuser", "oidc@example.com")
+		require.NoError(t, err)
+		// имя занято - добавляется суффикс
+		assert.Equal(t, "oidcuser2", user.Username)
+		assert.Equal(t, "oidc@example.com", user.Email)
+
+		// вход по паролю для такого аккаунта невозможен
+		_, err = storage.VerifyCredentials("oidcuser2", "")
+		assert.Error(t, err)
+	})
+
+	t.Run("Next login returns linked account", func(t *testing.T) {
+		first, err := storage.FindOrCreateByIdentity("https://idp", "sub-1", "other", "other@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "oidcuser2", first.Username)
+	})
+
+	t.Run("Find by identity", func(t *testing.T) {
+		user, err := storage.FindUserByIdentity("https://idp", "sub-1")
+		require.NoError(t, err)
+		require.NotNil(t, user)
+		assert.Equal(t, "oidcuser2", user.Username)
+
+		user, err = storage.FindUserByIdentity("https://idp", "unknown")
+		require.NoError(t, err)
+		assert.Nil(t, user)
+	})
+
+	t.Run("Email of password account is not linked", func(t *testing.T) {
+		_, err := storage.FindOrCreateByIdentity("https://idp", "sub-2", "someone", "local@example.com")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "already registered")
+	})
+
+	t.Run("Delete user removes identity", func(t *testing.T) {
+		user, err := storage.FindOrCreateByIdentity("https://idp", "sub-3", "temp", "temp@example.com")
+		require.NoError(t, err)
+		require.NoError(t, storage.DeleteUser(user.ID))
+
+		var count int
+		DB.Model(&models.UserIdentity{}).Where("subject = ?", "sub-3").Count(&count)
+		assert.Equal(t, 0, count)
+	})
+}
+
+func TestUserPostgresStorage_TwoFactor(t *testing.T) {
+	storage := NewUserPostgresStorage()
+
+	// Настраиваем тестовую БД
+	oldDB := setupTestDB(t)
+	defer teardownTestDB(oldDB)
+
+	u, err := storage.RegisterUser("testuser", "test@example.com", "s3cure-passw0rd")
+	require.NoError(t, err)
+
+	t.Run("No settings", func(t *testing.T) {
+		state, err := storage.GetTwoFactor(u.ID)
+		require.NoError(t, err)
+		assert.Nil(t, state)
+	})
+
+	t.Run("Save and get", func(t *testing.T) {
+		err := storage.SaveTwoFactor(u.ID, &user.TwoFactor{Secret: "v1:encrypted"})
+		require.NoError(t, err)
+
+		err = storage.SaveTwoFactor(u.ID, &user.TwoFactor{Secret: "v1:encrypted", Enabled: true, RecoveryCodes: []string{"a", "b"}, LastStep: 10})
+		require.NoError(t, err)
+
+		state, err := storage.GetTwoFactor(u.ID)
+		require.NoError(t, err)
+		require.NotNil(t, state)
+		assert.True(t, state.Enabled)
+		assert.Equal(t, "v1:encrypted", state.Secret)
+		assert.Equal(t, []string{"a", "b"}, state.RecoveryCodes)
+		assert.Equal(t, int64(10), state.LastStep)
+	})
+
+	t.Run("Code step is used once", func(t *testing.T) {
+		assert.ErrorIs(t, storage.UseTotpStep(u.ID, 10), user.ErrTotpCodeReused)
+		assert.NoError(t, storage.UseTotpStep(u.ID, 11))
+		assert.ErrorIs(t, storage.UseTotpStep(u.ID, 11), user.ErrTotpCodeReused)
+	})
+
+	t.Run("Recovery code is used once", func(t *testing.T) {
+		assert.NoError(t, storage.UseRecoveryCode(u.ID, "a"))
+		assert.ErrorIs(t, storage.UseRecoveryCode(u.ID, "a"), user.ErrRecoveryCodeInvalid)
+
+		state, err := storage.GetTwoFactor(u.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b"}, state.RecoveryCodes)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		require.NoError(t, storage.DeleteTwoFactor(u.ID))
+
+		state, err := storage.GetTwoFactor(u.ID)
+		require.NoError(t, err)
+		assert.Nil(t, state)
+	})
+}
+
+func TestUserPostgresStorage_PasswordHashing(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test_secret_key_for_jwt")
+	storage := NewUserPostgresStorage()
+
+	// Настраиваем тестовую БД
+	oldDB := setupTestDB(t)
+	defer teardownTestDB(oldDB)
+
+	t.Run("Weak password is rejected", func(t *testing.T) {
+		_, err := storage.RegisterUser("weakuser", "weak@example.com", "password123")
+		assert.ErrorIs(t, err, password.ErrWeakPassword)
+	})
+
+	t.Run("Bcrypt hash is replaced on verification", func(t *testing.T) {
+		// пользователь, зарегистрированный до перехода на argon2id
+		legacy, err := bcrypt.GenerateFromPassword([]byte("old-passw0rd"), bcrypt.MinCost)
+		require.NoError(t, err)
+		require.NoError(t, DB.Create(&models.User{Username: "legacyuser", Email: "legacy@example.com", Password: string(legacy)}).Error)
+		// ключи уникальности старых записей заполняются миграцией
+		require.NoError(t, MigrateUserKeys())
+
+		_, err = storage.VerifyCredentials("legacyuser", "old-passw0rd")
+		require.NoError(t, err)
+
+		var stored models.User
+		require.NoError(t, DB.Where("username = ?", "legacyuser").First(&stored).Error)
+		assert.True(t, strings.HasPrefix(stored.Password, "$argon2id$"))
+
+		_, err = storage.VerifyCredentials("legacyuser", "old-passw0rd")
+		assert.NoError(t, err)
+	})
+}
+
+func TestUserPostgresStorage_IdentityUniqueness(t *testing.T) {
+	storage := NewUserPostgresStorage()
+	oldDB := setupTestDB(t)
+	defer teardownTestDB(oldDB)
+
+	_, err := storage.RegisterUser("Alice", "Alice@Example.com", "s3cure-passw0rd")
+	require.NoError(t, err)
+
+	t.Run("Username differing only in case is taken", func(t *testing.T) {
+		_, err := storage.RegisterUser("ALICE", "other@example.com", "s3cure-passw0rd")
+		assert.ErrorIs(t, err, identity.ErrUsernameTaken)
+	})
+
+	t.Run("Email differing only in case is taken", func(t *testing.T) {
+		_, err := storage.RegisterUser("bob", "alice@example.COM", "s3cure-passw0rd")
+		assert.ErrorIs(t, err, identity.ErrEmailTaken)
+	})
+
+	t.Run("Unique index rejects keys written directly", func(t *testing.T) {
+		key := identity.EmailKey("carol@example.com")
+		err := DB.Create(&models.User{Username: "aLiCe", UsernameKey: identity.UsernameKey("aLiCe"), EmailKey: &key}).Error
+		assert.Error(t, err)
+	})
+
+	t.Run("Login ignores case", func(t *testing.T) {
+		user, err := storage.VerifyCredentials("alice", "s3cure-passw0rd")
+		require.NoError(t, err)
+		assert.Equal(t, "Alice", user.Username)
+	})
+
+	t.Run("Migration fills keys of old accounts", func(t *testing.T) {
+		require.NoError(t, DB.Create(&models.User{Username: "OldUser", Email: "Old@Example.com"}).Error)
+		require.NoError(t, MigrateUserKeys())
+
+		var stored models.User
+		require.NoError(t, DB.Where("username = ?", "OldUser").First(&stored).Error)
+		assert.Equal(t, "olduser", stored.UsernameKey)
+		require.NotNil(t, stored.EmailKey)
+		assert.Equal(t, "old@example.com", *stored.EmailKey)
+	})
+}
+
+func TestUserPostgresStorage_ChangeUsername(t *testing.T) {
+	storage := NewUserPostgresStorage()
+	oldDB := setupTestDB(t)
+	defer teardownTestDB(oldDB)
+
+	alice, err := storage.RegisterUser("alice", "alice@example.com", "s3cure-passw0rd")
+	require.NoError(t, err)
+	bob, err := storage.RegisterUser("bob", "bob@example.com", "s3cure-passw0rd")
+	require.NoError(t, err)
+
+	// сдвигает смены имени пользователя в прошлое, как будто прошло d
+	rewind := func(userID string, d time.Duration) {
+		var changes []models.UsernameChange
+		require.NoError(t, DB.Where("user_id = ?", userID).Find(&changes).Error)
+		for _, change := range changes {
+			require.NoError(t, DB.Model(&change).Update("changed_at", change.ChangedAt.Add(-d)).Error)
+		}
+	}
+
+	t.Run("Rename keeps password and history", func(t *testing.T) {
+		found, err := storage.ChangeUsername(alice.ID, "Alicia")
+		require.NoError(t, err)
+		assert.Equal(t, "Alicia", found.Username)
+
+		_, err = storage.VerifyCredentials("alicia", "s3cure-passw0rd")
+		assert.NoError(t, err)
+
+		history, err := storage.GetUsernameHistory(alice.ID)
+		require.NoError(t, err)
+		require.Len(t, history, 1)
+		assert.Equal(t, "alice", history[0].Username)
+	})
+
+	t.Run("Old handle resolves to renamed account", func(t *testing.T) {
+		found, err := storage.GetUserByUsername("ALICE")
+		require.NoError(t, err)
+		assert.Equal(t, alice.ID, found.ID)
+		assert.Equal(t, "Alicia", found.Username)
+	})
+
+	t.Run("Cooldown between changes", func(t *testing.T) {
+		_, err := storage.ChangeUsername(alice.ID, "alicia2")
+		assert.ErrorIs(t, err, user.ErrUsernameChangeTooSoon)
+	})
+
+	t.Run("Released handle is held during grace period", func(t *testing.T) {
+		_, err := storage.ChangeUsername(bob.ID, "alice")
+		assert.ErrorIs(t, err, identity.ErrUsernameTaken)
+		_, err = storage.RegisterUser("Alice", "other@example.com", "s3cure-passw0rd")
+		assert.ErrorIs(t, err, identity.ErrUsernameTaken)
+	})
+
+	t.Run("Released handle is free after grace period", func(t *testing.T) {
+		rewind(alice.ID, user.UsernameGracePeriod)
+
+		found, err := storage.ChangeUsername(bob.ID, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, "alice", found.Username)
+
+		found, err = storage.GetUserByUsername("alice")
+		require.NoError(t, err)
+		assert.Equal(t, bob.ID, found.ID)
+	})
+
+	t.Run("Delete user removes history", func(t *testing.T) {
+		require.NoError(t, storage.DeleteUser(alice.ID))
+
+		var count int
+		DB.Model(&models.UsernameChange{}).Where("user_id = ?", alice.ID).Count(&count)
+		assert.Zero(t, count)
 	})
 }
@@ -0,0 +1,353 @@
+package postgres
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VitaminP8/postery/internal/webhook"
+	"github.com/VitaminP8/postery/models"
+	"github.com/jinzhu/gorm"
+)
+
+type WebhookPostgresStorage struct{}
+
+func NewWebhookPostgresStorage() *WebhookPostgresStorage {
+	return &WebhookPostgresStorage{}
+}
+
+func (s *WebhookPostgresStorage) CreateWebhook(hook *webhook.Webhook) (*webhook.Webhook, error) {
+	ownerID, err := strconv.ParseUint(hook.OwnerID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	events := make([]string, len(hook.Events))
+	for i, event := range hook.Events {
+		events[i] = string(event)
+	}
+	record := &models.Webhook{
+		OwnerID: uint(ownerID),
+		URL:     hook.URL,
+		Events:  strings.Join(events, ","),
+		Secret:  hook.Secret,
+	}
+	err = DB.Create(record).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not create webhook: %w", err)
+	}
+	return toWebhook(record), nil
+}
+
+func (s *WebhookPostgresStorage) GetWebhook(id string) (*webhook.Webhook, error) {
+	var record models.Webhook
+	err := DB.Where("id = ?", id).First(&record).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, webhook.ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get webhook: %w", err)
+	}
+	return toWebhook(&record), nil
+}
+
+func (s *WebhookPostgresStorage) GetWebhooks(ownerID string) ([]*webhook.Webhook, error) {
+	query := DB.Order("id DESC")
+	if ownerID != "" {
+		query = query.Where("owner_id = ?", ownerID)
+	}
+
+	var records []models.Webhook
+	err := query.Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get webhooks: %w", err)
+	}
+
+	hooks := []*webhook.Webhook{}
+	for i := range records {
+		hooks = append(hooks, toWebhook(&records[i]))
+	}
+	return hooks, nil
+}
+
+func (s *WebhookPostgresStorage) GetWebhooksForEvent(event webhook.Event) ([]*webhook.Webhook, error) {
+	// LIKE только сужает выборку ("_" в имени события совпадает с любым символом), точно проверяет Accepts
+	var records []models.Webhook
+	err := DB.Where("events LIKE ?", "%"+string(event)+"%").Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get webhooks: %w", err)
+	}
+
+	hooks := []*webhook.Webhook{}
+	for i := range records {
+		hook := toWebhook(&records[i])
+		if hook.Accepts(event) {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks, nil
+}
+
+func (s *WebhookPostgresStorage) DeleteWebhook(id string) error {
+	var record models.Webhook
+	err := DB.Where("id = ?", id).First(&record).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return webhook.ErrWebhookNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not get webhook: %w", err)
+	}
+	return deleteWebhooks([]uint{record.ID})
+}
+
+func (s *WebhookPostgresStorage) DeleteWebhooksByOwner(ownerID string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return deleteWebhooksByOwner(tx, ownerID)
+	})
+}
+
+// deleteWebhooksByOwner удаляет вебхуки владельца; вызывается в транзакции
+func deleteWebhooksByOwner(tx *gorm.DB, ownerID string) error {
+	var ids []uint
+	err := tx.Model(&models.Webhook{}).Where("owner_id = ?", ownerID).Pluck("id", &ids).Error
+	if err != nil {
+		return fmt.Errorf("could not get webhooks: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return deleteWebhooksTx(tx, ids)
+}
+
+// deleteWebhooks удаляет вебхуки вместе с доставками и журналом попыток
+func deleteWebhooks(ids []uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return deleteWebhooksTx(tx, ids)
+	})
+}
+
+func deleteWebhooksTx(tx *gorm.DB, ids []uint) error {
+	deliveries := tx.Model(&models.WebhookDelivery{}).Select("id").Where("webhook_id IN (?)", ids).SubQuery()
+	err := tx.Where("delivery_id IN ?", deliveries).Delete(&models.WebhookAttempt{}).Error
+	if err == nil {
+		err = tx.Where("webhook_id IN (?)", ids).Delete(&models.WebhookDelivery{}).Error
+	}
+	if err == nil {
+		err = tx.Where("id IN (?)", ids).Delete(&models.Webhook{}).Error
+	}
+	if err != nil {
+		return fmt.Errorf("could not delete webhooks: %w", err)
+	}
+	return nil
+}
+
+func (s *WebhookPostgresStorage) CreateDelivery(delivery *webhook.Delivery) (*webhook.Delivery, error) {
+	webhookID, err := strconv.ParseUint(delivery.WebhookID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook ID: %w", err)
+	}
+
+	var count int
+	err = DB.Model(&models.Webhook{}).Where("id = ?", webhookID).Count(&count).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get webhook: %w", err)
+	}
+	if count == 0 {
+		return nil, webhook.ErrWebhookNotFound
+	}
+
+	record := &models.WebhookDelivery{
+		WebhookID:     uint(webhookID),
+		Event:         string(delivery.Event),
+		Payload:       string(delivery.Payload),
+		Status:        string(webhook.StatusPending),
+		NextAttemptAt: delivery.NextAttemptAt,
+	}
+	err = DB.Create(record).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not create webhook delivery: %w", err)
+	}
+	return toDelivery(record, nil), nil
+}
+
+func (s *WebhookPostgresStorage) GetDelivery(id string) (*webhook.Delivery, error) {
+	var record models.WebhookDelivery
+	err := DB.Where("id = ?", id).First(&record).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, webhook.ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get webhook delivery: %w", err)
+	}
+
+	deliveries, err := withAttempts([]models.WebhookDelivery{record})
+	if err != nil {
+		return nil, err
+	}
+	return deliveries[0], nil
+}
+
+func (s *WebhookPostgresStorage) GetDeliveries(webhookID string, limit int) ([]*webhook.Delivery, error) {
+	var records []models.WebhookDelivery
+	err := DB.Where("webhook_id = ?", webhookID).Order("id DESC").Limit(limit).Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get webhook deliveries: %w", err)
+	}
+	return withAttempts(records)
+}
+
+func (s *WebhookPostgresStorage) ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]*webhook.Delivery, error) {
+	var records []models.WebhookDelivery
+	err := DB.Where("status = ? AND next_attempt_at <= ?", webhook.StatusPending, now).
+		Order("id").Limit(limit).Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("could not get due webhook deliveries: %w", err)
+	}
+
+	claimed := []*webhook.Delivery{}
+	for i := range records {
+		// условие повторяется в UPDATE: доставку, которую успел забрать другой экземпляр, пропускаем
+		result := DB.Model(&models.WebhookDelivery{}).
+			Where("id = ? AND status = ? AND next_attempt_at <= ?", records[i].ID, webhook.StatusPending, now).
+			UpdateColumn("next_attempt_at", now.Add(lease))
+		if result.Error != nil {
+			return nil, fmt.Errorf("could not claim webhook delivery: %w", result.Error)
+		}
+		if result.RowsAffected == 1 {
+			claimed = append(claimed, toDelivery(&records[i], nil))
+		}
+	}
+	return claimed, nil
+}
+
+func (s *WebhookPostgresStorage) RecordAttempt(id string, attempt webhook.Attempt, status webhook.Status, attempts int, nextAttemptAt time.Time) error {
+	deliveryID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid delivery ID: %w", err)
+	}
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.WebhookDelivery{}).Where("id = ?", deliveryID).UpdateColumns(map[string]interface{}{
+			"status":          string(status),
+			"attempts":        attempts,
+			"next_attempt_at": nextAttemptAt,
+		})
+		if result.Error != nil {
+			return fmt.Errorf("could not update webhook delivery: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return webhook.ErrDeliveryNotFound
+		}
+
+		err := tx.Create(&models.WebhookAttempt{
+			DeliveryID: uint(deliveryID),
+			StatusCode: attempt.StatusCode,
+			Error:      attempt.Error,
+			DurationMs: attempt.Duration.Milliseconds(),
+			CreatedAt:  attempt.At,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("could not save webhook attempt: %w", err)
+		}
+		return nil
+	})
+}
+
+func (s *WebhookPostgresStorage) RetryDelivery(id string, now time.Time) (*webhook.Delivery, error) {
+	_, err := s.GetDelivery(id)
+	if err != nil {
+		return nil, err
+	}
+
+	result := DB.Model(&models.WebhookDelivery{}).Where("id = ? AND status = ?", id, webhook.StatusFailed).
+		UpdateColumns(map[string]interface{}{
+			"status":          string(webhook.StatusPending),
+			"attempts":        0,
+			"next_attempt_at": now,
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("could not retry webhook delivery: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, webhook.ErrNotFailed
+	}
+	return s.GetDelivery(id)
+}
+
+func (s *WebhookPostgresStorage) PruneDeliveries(before time.Time) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		finished := tx.Model(&models.WebhookDelivery{}).Select("id").
+			Where("status <> ? AND created_at < ?", webhook.StatusPending, before).SubQuery()
+		err := tx.Where("delivery_id IN ?", finished).Delete(&models.WebhookAttempt{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("status <> ? AND created_at < ?", webhook.StatusPending, before).Delete(&models.WebhookDelivery{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("could not prune webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// withAttempts читает журнал попыток для доставок
+func withAttempts(records []models.WebhookDelivery) ([]*webhook.Delivery, error) {
+	ids := make([]uint, len(records))
+	for i := range records {
+		ids[i] = records[i].ID
+	}
+
+	logs := make(map[uint][]webhook.Attempt)
+	if len(ids) > 0 {
+		var attempts []models.WebhookAttempt
+		err := DB.Where("delivery_id IN (?)", ids).Order("id").Find(&attempts).Error
+		if err != nil {
+			return nil, fmt.Errorf("could not get webhook attempts: %w", err)
+		}
+		for _, a := range attempts {
+			logs[a.DeliveryID] = append(logs[a.DeliveryID], webhook.Attempt{
+				At:         a.CreatedAt,
+				StatusCode: a.StatusCode,
+				Error:      a.Error,
+				Duration:   time.Duration(a.DurationMs) * time.Millisecond,
+			})
+		}
+	}
+
+	deliveries := []*webhook.Delivery{}
+	for i := range records {
+		deliveries = append(deliveries, toDelivery(&records[i], logs[records[i].ID]))
+	}
+	return deliveries, nil
+}
+
+func toWebhook(record *models.Webhook) *webhook.Webhook {
+	hook := &webhook.Webhook{
+		ID:        fmt.Sprint(record.ID),
+		OwnerID:   fmt.Sprint(record.OwnerID),
+		URL:       record.URL,
+		Secret:    record.Secret,
+		CreatedAt: record.CreatedAt,
+	}
+	for _, event := range strings.Split(record.Events, ",") {
+		if event != "" {
+			hook.Events = append(hook.Events, webhook.Event(event))
+		}
+	}
+	return hook
+}
+
+func toDelivery(record *models.WebhookDelivery, log []webhook.Attempt) *webhook.Delivery {
+	return &webhook.Delivery{
+		ID:            fmt.Sprint(record.ID),
+		WebhookID:     fmt.Sprint(record.WebhookID),
+		Event:         webhook.Event(record.Event),
+		Payload:       []byte(record.Payload),
+		Status:        webhook.Status(record.Status),
+		Attempts:      record.Attempts,
+		NextAttemptAt: record.NextAttemptAt,
+		CreatedAt:     record.CreatedAt,
+		Log:           log,
+	}
+}
@@ -0,0 +1,64 @@
+package subscription
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/VitaminP8/postery/graph/model"
+)
+
+// wireEvent - событие в JSON для передачи между процессами (например, через Postgres NOTIFY)
+type wireEvent struct {
+	Seq     uint64          `json:"seq,omitempty"`
+	Topic   string          `json:"topic"`
+	Type    EventType       `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// MarshalEvent кодирует событие темы в JSON
+func MarshalEvent(topic string, event Event) ([]byte, error) {
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode %s payload: %w", event.Type, err)
+	}
+	return json.Marshal(wireEvent{Seq: event.Seq, Topic: topic, Type: event.Type, Payload: payload})
+}
+
+// UnmarshalEvent восстанавливает событие из MarshalEvent с тем же типом Payload, что был при публикации
+func UnmarshalEvent(data []byte) (string, Event, error) {
+	var wire wireEvent
+	err := json.Unmarshal(data, &wire)
+	if err != nil {
+		return "", Event{}, fmt.Errorf("could not decode event: %w", err)
+	}
+
+	var payload interface{}
+	switch wire.Type {
+	case EventCommentAdded, EventReplyAdded:
+		payload = &model.Comment{}
+	case EventPostCreated, EventPostUpdated, EventCommentsToggled:
+		payload = &model.Post{}
+	case EventPostDeleted:
+		var id string
+		payload = &id
+	case EventViewerJoined, EventViewerSeen, EventViewerLeft:
+		payload = &Presence{}
+	case EventTyping:
+		payload = &Typing{}
+	case EventRelationChanged:
+		payload = &RelationChange{}
+	default:
+		return "", Event{}, fmt.Errorf("unknown event type %q", wire.Type)
+	}
+
+	err = json.Unmarshal(wire.Payload, payload)
+	if err != nil {
+		return "", Event{}, fmt.Errorf("could not decode %s payload: %w", wire.Type, err)
+	}
+
+	// строки передаются по значению, как при публикации
+	if id, ok := payload.(*string); ok {
+		payload = *id
+	}
+	return wire.Topic, Event{Seq: wire.Seq, Type: wire.Type, Payload: payload}, nil
+}
@@ -0,0 +1,43 @@
+package subscription
+
+import (
+	"testing"
+
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventCodec(t *testing.T) {
+	parentID := "1"
+	tests := []struct {
+		name  string
+		topic string
+		event Event
+	}{
+		{"Comment", CommentsTopic("1"), Event{Type: EventCommentAdded, Payload: &model.Comment{ID: "2", PostID: "1", ParentID: &parentID, Content: "Привет"}}},
+		{"Post", PostTopic("1"), Event{Type: EventCommentsToggled, Payload: &model.Post{ID: "1", CommentsDisabled: true}}},
+		{"Deleted post ID", PostTopic("1"), Event{Type: EventPostDeleted, Payload: "1"}},
+		{"Presence", PresenceTopic("1"), Event{Type: EventViewerSeen, Payload: &Presence{PostID: "1", InstanceID: "i1", Viewers: map[string]string{"v1": "2", "v2": ""}}}},
+		{"Typing", PresenceTopic("1"), Event{Type: EventTyping, Payload: &Typing{PostID: "1", ParentID: "3", UserID: "2"}}},
+		{"Relation change", RelationsTopic("2"), Event{Type: EventRelationChanged, Payload: &RelationChange{UserID: "2", Kind: "follow"}}},
+		{"Sequence number", CommentsTopic("1"), Event{Seq: 42, Type: EventCommentAdded, Payload: &model.Comment{ID: "3", PostID: "1"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := MarshalEvent(tt.topic, tt.event)
+			require.NoError(t, err)
+
+			topic, event, err := UnmarshalEvent(data)
+			require.NoError(t, err)
+			assert.Equal(t, tt.topic, topic)
+			assert.Equal(t, tt.event, event)
+		})
+	}
+
+	t.Run("Unknown type", func(t *testing.T) {
+		_, _, err := UnmarshalEvent([]byte(`{"topic":"posts","type":"post.archived","payload":{}}`))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,202 @@
+package subscription
+
+import (
+	"context"
+
+	"github.com/VitaminP8/postery/graph/model"
+)
+
+// EventType - тип события; по нему подписчик отличает события одной темы
+type EventType string
+
+const (
+	// EventCommentAdded - новый комментарий (*model.Comment) в CommentsTopic
+	EventCommentAdded EventType = "comment.added"
+	// EventReplyAdded - новый ответ (*model.Comment) в RepliesTopic каждого предка
+	EventReplyAdded EventType = "comment.reply_added"
+	// EventPostCreated - новый пост (*model.Post) в PostsTopic
+	EventPostCreated EventType = "post.created"
+	// EventPostUpdated - пост (*model.Post) изменился, публикуется в PostTopic
+	EventPostUpdated EventType = "post.updated"
+	// EventPostDeleted - пост удален, в PostTopic публикуется его ID (string)
+	EventPostDeleted EventType = "post.deleted"
+	// EventCommentsToggled - комментарии к посту (*model.Post) включены или выключены, публикуется в PostTopic
+	EventCommentsToggled EventType = "post.comments_toggled"
+
+	// EventViewerJoined - на экземпляре сервера появились зрители поста (*Presence), публикуется в PresenceTopic;
+	// остальные экземпляры отвечают EventViewerSeen, чтобы новый сразу узнал об их зрителях
+	EventViewerJoined EventType = "presence.joined"
+	// EventViewerSeen - текущие зрители поста на экземпляре (*Presence): периодический heartbeat и изменения состава
+	EventViewerSeen EventType = "presence.seen"
+	// EventViewerLeft - на экземпляре не осталось зрителей поста (*Presence без Viewers)
+	EventViewerLeft EventType = "presence.left"
+	// EventTyping - пользователь пишет ответ (*Typing), публикуется в PresenceTopic
+	EventTyping EventType = "presence.typing"
+
+	// EventRelationChanged - пользователь добавил или убрал отношение (*RelationChange), публикуется в RelationsTopic;
+	// открытые подписки пользователя перечитывают по нему списки подписок и скрытых авторов
+	EventRelationChanged EventType = "relation.changed"
+)
+
+// Ephemeral сообщает, что событие имеет смысл только в момент публикации: такие события не сохраняются
+// в историю и не повторяются после переподключения
+func (t EventType) Ephemeral() bool {
+	switch t {
+	case EventViewerJoined, EventViewerSeen, EventViewerLeft, EventTyping, EventRelationChanged:
+		return true
+	}
+	return false
+}
+
+// Event - событие темы; тип Payload определяется Type
+type Event struct {
+	// Seq - монотонно растущий номер события, его назначает менеджер при публикации.
+	// Клиент передает номер последнего полученного события, чтобы после переподключения получить пропущенные.
+	Seq     uint64
+	Type    EventType
+	Payload interface{}
+}
+
+// Presence - все зрители страницы поста на одном экземпляре сервера. InstanceID различает экземпляры;
+// Viewers - ID пользователей по ID зрителей: ID зрителя различает вкладки, ID пользователя пуст у анонимных.
+type Presence struct {
+	PostID     string            `json:"postID"`
+	InstanceID string            `json:"instanceID"`
+	Viewers    map[string]string `json:"viewers,omitempty"`
+}
+
+// Typing - пользователь пишет комментарий к посту или, если ParentID не пуст, ответ на комментарий
+type Typing struct {
+	PostID   string `json:"postID"`
+	ParentID string `json:"parentID,omitempty"`
+	UserID   string `json:"userID"`
+}
+
+// RelationChange - у пользователя UserID изменились отношения вида Kind (relation.Kind)
+type RelationChange struct {
+	UserID string `json:"userID"`
+	Kind   string `json:"kind"`
+}
+
+// PublishComment отправляет новый комментарий подписчикам поста и веток всех его предков.
+// ancestorIDs - ID родителя, его родителя и так далее до корневого комментария; у корневого комментария пусто.
+func PublishComment(m Manager, comment *model.Comment, ancestorIDs []string) {
+	m.Publish(CommentsTopic(comment.PostID), Event{Type: EventCommentAdded, Payload: comment})
+	for _, id := range ancestorIDs {
+		m.Publish(RepliesTopic(id), Event{Type: EventReplyAdded, Payload: comment})
+	}
+}
+
+// Listen подписывается на тему и отдает полезную нагрузку событий указанных типов (все типы, если types пуст).
+// Подписка отменяется и канал закрывается вместе с ctx; события с нагрузкой другого типа пропускаются.
+func Listen[T any](ctx context.Context, m Manager, topic string, types ...EventType) <-chan T {
+	events := ListenEvents(ctx, m, topic, types...)
+
+	out := make(chan T, 1)
+	go func() {
+		defer close(out)
+		for event := range events {
+			payload, ok := event.Payload.(T)
+			if !ok {
+				continue
+			}
+			select {
+			case out <- payload:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out
+}
+
+// ListenEvents работает как Listen, но отдает события целиком (с номером Seq)
+func ListenEvents(ctx context.Context, m Manager, topic string, types ...EventType) <-chan Event {
+	in, cancel := m.Subscribe(topic)
+	go func() {
+		<-ctx.Done()
+		cancel()
+	}()
+
+	out := make(chan Event, 1)
+	go func() {
+		defer close(out)
+		for event := range in {
+			if !matches(event.Type, types) {
+				continue
+			}
+			select {
+			case out <- event:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out
+}
+
+// ListenSince подписывается на тему и сначала отдает события с Seq больше since из истории менеджера, затем - новые.
+// Подписка оформляется до чтения истории, поэтому события между ними не теряются, а повторы отбрасываются по Seq.
+// История ограничена: если часть пропущенных событий уже удалена, возвращается ErrHistoryTruncated.
+// Канал закрывается вместе с ctx.
+func ListenSince(ctx context.Context, m Manager, topic string, since uint64, types ...EventType) (<-chan Event, error) {
+	in, cancel := m.Subscribe(topic)
+
+	history, err := m.History(topic, since)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	go func() {
+		<-ctx.Done()
+		cancel()
+	}()
+
+	out := make(chan Event, 1)
+	go func() {
+		defer close(out)
+
+		var last uint64
+		send := func(event Event) bool {
+			if !matches(event.Type, types) {
+				return true
+			}
+			select {
+			case out <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for _, event := range history {
+			if event.Seq > last {
+				last = event.Seq
+			}
+			if !send(event) {
+				return
+			}
+		}
+		for event := range in {
+			// событие уже отдано из истории
+			if event.Seq != 0 && event.Seq <= last {
+				continue
+			}
+			if !send(event) {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func matches(eventType EventType, types []EventType) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, t := range types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package subscription
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrTooManySubscriptions - клиент превысил одно из ограничений Limits; конкретное ограничение - в *LimitError
+var ErrTooManySubscriptions = errors.New("too many subscriptions")
+
+// LimitScope - к чему относится ограничение
+type LimitScope string
+
+const (
+	ScopeUser       LimitScope = "user"
+	ScopeIP         LimitScope = "ip"
+	ScopeConnection LimitScope = "connection"
+	ScopeTotal      LimitScope = "total"
+)
+
+// LimitError сообщает, какое ограничение превышено
+type LimitError struct {
+	Scope LimitScope
+	Limit int
+}
+
+func (e *LimitError) Error() string {
+	if e.Scope == ScopeTotal {
+		return fmt.Sprintf("too many subscriptions: server limit of %d reached", e.Limit)
+	}
+	return fmt.Sprintf("too many subscriptions: limit of %d per %s reached", e.Limit, e.Scope)
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrTooManySubscriptions
+}
+
+// Limits - сколько подписок может быть открыто одновременно; 0 - без ограничения
+type Limits struct {
+	PerUser       int
+	PerIP         int // за одним IP бывает много пользователей, поэтому обычно больше PerUser
+	PerConnection int // websocket соединение или SSE поток
+	Total         int // на весь экземпляр сервера
+}
+
+func DefaultLimits() Limits {
+	return Limits{
+		PerUser:       100,
+		PerIP:         300,
+		PerConnection: 50,
+		Total:         10000,
+	}
+}
+
+// Client - кто открывает подписку; пустые поля не учитываются (у анонимного клиента нет UserID)
+type Client struct {
+	UserID     string
+	IP         string
+	Connection string
+}
+
+// Count - число подписок по одному ключу (пользователю или IP)
+type Count struct {
+	Key   string
+	Count int
+}
+
+// Stats - открытые подписки экземпляра сервера
+type Stats struct {
+	Total       int
+	Connections int
+	Users       []Count // по убыванию
+	IPs         []Count // по убыванию
+}
+
+// Limiter считает открытые подписки в памяти процесса, поэтому ограничения действуют на каждый экземпляр отдельно
+type Limiter struct {
+	limits Limits
+
+	mu          sync.Mutex
+	total       int
+	users       map[string]int
+	ips         map[string]int
+	connections map[string]int
+}
+
+func NewLimiter(limits Limits) *Limiter {
+	return &Limiter{
+		limits:      limits,
+		users:       make(map[string]int),
+		ips:         make(map[string]int),
+		connections: make(map[string]int),
+	}
+}
+
+func (l *Limiter) Limits() Limits {
+	return l.limits
+}
+
+// Acquire занимает место для подписки клиента или возвращает *LimitError. release освобождает место,
+// повторные вызовы ничего не делают.
+func (l *Limiter) Acquire(c Client) (release func(), err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch {
+	case c.Connection != "" && reached(l.limits.PerConnection, l.connections[c.Connection]):
+		return nil, &LimitError{Scope: ScopeConnection, Limit: l.limits.PerConnection}
+	case c.UserID != "" && reached(l.limits.PerUser, l.users[c.UserID]):
+		return nil, &LimitError{Scope: ScopeUser, Limit: l.limits.PerUser}
+	case c.IP != "" && reached(l.limits.PerIP, l.ips[c.IP]):
+		return nil, &LimitError{Scope: ScopeIP, Limit: l.limits.PerIP}
+	case reached(l.limits.Total, l.total):
+		return nil, &LimitError{Scope: ScopeTotal, Limit: l.limits.Total}
+	}
+
+	l.total++
+	increment(l.connections, c.Connection, 1)
+	increment(l.users, c.UserID, 1)
+	increment(l.ips, c.IP, 1)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { l.release(c) })
+	}, nil
+}
+
+func (l *Limiter) release(c Client) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.total--
+	increment(l.connections, c.Connection, -1)
+	increment(l.users, c.UserID, -1)
+	increment(l.ips, c.IP, -1)
+}
+
+// Stats возвращает открытые подписки; Users и IPs - не больше top ключей с наибольшим числом подписок
+func (l *Limiter) Stats(top int) Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return Stats{
+		Total:       l.total,
+		Connections: len(l.connections),
+		Users:       topCounts(l.users, top),
+		IPs:         topCounts(l.ips, top),
+	}
+}
+
+func reached(limit, current int) bool {
+	return limit > 0 && current >= limit
+}
+
+// increment меняет счетчик ключа и удаляет нулевые, чтобы карты не росли от закрытых соединений
+func increment(counts map[string]int, key string, delta int) {
+	if key == "" {
+		return
+	}
+	counts[key] += delta
+	if counts[key] <= 0 {
+		delete(counts, key)
+	}
+}
+
+func topCounts(counts map[string]int, top int) []Count {
+	result := make([]Count, 0, len(counts))
+	for key, count := range counts {
+		result = append(result, Count{Key: key, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Key < result[j].Key
+	})
+
+	if top >= 0 && len(result) > top {
+		result = result[:top]
+	}
+	return result
+}
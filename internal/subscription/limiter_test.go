@@ -0,0 +1,99 @@
+package subscription
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter_Acquire(t *testing.T) {
+	t.Run("Each scope is limited", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			limits Limits
+			first  Client
+			second Client
+			scope  LimitScope
+		}{
+			{"Per connection", Limits{PerConnection: 1}, Client{Connection: "c1"}, Client{Connection: "c1"}, ScopeConnection},
+			{"Per user", Limits{PerUser: 1}, Client{UserID: "1", Connection: "c1"}, Client{UserID: "1", Connection: "c2"}, ScopeUser},
+			{"Per IP", Limits{PerIP: 1}, Client{IP: "10.0.0.1", UserID: "1"}, Client{IP: "10.0.0.1", UserID: "2"}, ScopeIP},
+			{"Total", Limits{Total: 1}, Client{UserID: "1"}, Client{UserID: "2"}, ScopeTotal},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				limiter := NewLimiter(tt.limits)
+				_, err := limiter.Acquire(tt.first)
+				require.NoError(t, err)
+
+				_, err = limiter.Acquire(tt.second)
+				require.ErrorIs(t, err, ErrTooManySubscriptions)
+				var limitErr *LimitError
+				require.ErrorAs(t, err, &limitErr)
+				assert.Equal(t, tt.scope, limitErr.Scope)
+				assert.Equal(t, 1, limitErr.Limit)
+			})
+		}
+	})
+
+	t.Run("Other clients are not affected", func(t *testing.T) {
+		limiter := NewLimiter(Limits{PerUser: 1, PerConnection: 1})
+		_, err := limiter.Acquire(Client{UserID: "1", Connection: "c1"})
+		require.NoError(t, err)
+
+		_, err = limiter.Acquire(Client{UserID: "2", Connection: "c2"})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Release frees the slot once", func(t *testing.T) {
+		limiter := NewLimiter(Limits{PerUser: 1})
+		release, err := limiter.Acquire(Client{UserID: "1"})
+		require.NoError(t, err)
+
+		release()
+		release()
+		assert.Equal(t, 0, limiter.Stats(10).Total)
+
+		_, err = limiter.Acquire(Client{UserID: "1"})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, limiter.Stats(10).Total)
+	})
+
+	t.Run("Zero limits mean no limit", func(t *testing.T) {
+		limiter := NewLimiter(Limits{})
+		for i := 0; i < 1000; i++ {
+			_, err := limiter.Acquire(Client{UserID: "1", IP: "10.0.0.1", Connection: "c1"})
+			require.NoError(t, err)
+		}
+	})
+}
+
+func TestLimiter_Stats(t *testing.T) {
+	limiter := NewLimiter(Limits{})
+	clients := []Client{
+		{UserID: "1", IP: "10.0.0.1", Connection: "c1"},
+		{UserID: "1", IP: "10.0.0.1", Connection: "c1"},
+		{UserID: "2", IP: "10.0.0.1", Connection: "c2"},
+		{IP: "10.0.0.2", Connection: "c3"},
+	}
+	releases := make([]func(), len(clients))
+	for i, c := range clients {
+		release, err := limiter.Acquire(c)
+		require.NoError(t, err)
+		releases[i] = release
+	}
+
+	stats := limiter.Stats(1)
+	assert.Equal(t, 4, stats.Total)
+	assert.Equal(t, 3, stats.Connections)
+	assert.Equal(t, []Count{{Key: "1", Count: 2}}, stats.Users)
+	assert.Equal(t, []Count{{Key: "10.0.0.1", Count: 3}}, stats.IPs)
+
+	for _, release := range releases {
+		release()
+	}
+	stats = limiter.Stats(10)
+	assert.Equal(t, Stats{Users: []Count{}, IPs: []Count{}}, stats)
+}
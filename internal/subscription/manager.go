@@ -1,58 +1,297 @@
 package subscription
 
 import (
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
+)
 
-	"github.com/VitaminP8/postery/graph/model"
+const (
+	// DefaultHistorySize - сколько последних событий каждой темы хранится для повторной доставки
+	DefaultHistorySize = 100
+	// DefaultQueueSize - сколько недоставленных событий может накопиться у одного подписчика
+	DefaultQueueSize = 64
+	// historyTTL - события старше удаляются из истории, чтобы не копить темы, в которые больше не пишут
+	historyTTL = time.Hour
 )
 
+// OverflowPolicy - что делать с событием, если очередь подписчика заполнена (подписчик не успевает читать)
+type OverflowPolicy string
+
+const (
+	// DropOldest - отбросить самое старое событие очереди и добавить новое
+	DropOldest OverflowPolicy = "drop-oldest"
+	// DropNewest - отбросить новое событие
+	DropNewest OverflowPolicy = "drop-newest"
+	// Disconnect - отписать подписчика: его канал закрывается, и клиент может переподключиться с since
+	Disconnect OverflowPolicy = "disconnect"
+)
+
+// ParseOverflowPolicy разбирает значение из конфигурации; пустая строка - DropOldest
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch policy := OverflowPolicy(s); policy {
+	case "":
+		return DropOldest, nil
+	case DropOldest, DropNewest, Disconnect:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown overflow policy %q", s)
+}
+
+// storedEvent - событие в истории темы
+type storedEvent struct {
+	event       Event
+	publishedAt time.Time
+}
+
+// SubscriptionManager раздает события подписчикам одного процесса. Publish не обходит подписчиков: событие
+// дописывается в журнал темы (последние QueueSize событий), а горутина каждого подписчика читает журнал со своей
+// позиции и переносит события в его канал. Поэтому время публикации не зависит ни от числа подписчиков, ни от их
+// скорости; темы блокируются по отдельности и не мешают друг другу.
 type SubscriptionManager struct {
-	mu   sync.Mutex
-	subs map[string][]chan *model.Comment // postID -> список каналов подписчиков
+	// HistorySize - размер истории каждой темы; 0 отключает историю
+	HistorySize int
+	// QueueSize - размер журнала темы: на сколько событий подписчик может отстать до OverflowPolicy
+	QueueSize int
+	// Overflow - что делать при переполнении очереди
+	Overflow OverflowPolicy
+	// Настройки меняются только до начала работы
+
+	seq atomic.Uint64
+
+	mu      sync.RWMutex
+	topics  map[string]*topic // тема -> подписчики и история
+	swept   time.Time         // время последней очистки истории
+	expired uint64            // наибольший номер события, удаленного из истории по времени
+}
+
+// topic - подписчики, журнал и история одной темы; поля защищены mu темы
+type topic struct {
+	mu          sync.Mutex
+	subscribers []*subscriber
+	history     []storedEvent // последние события, от старых к новым
+	trimmed     uint64        // наибольший номер события, удаленного из истории
+
+	log     []Event       // кольцевой журнал для доставки: событие с номером n лежит в log[n%len(log)]
+	end     uint64        // номер следующего события журнала
+	waiters []*subscriber // подписчики, прочитавшие весь журнал; их будит следующая публикация
+}
+
+// newTopic создает тему (вызывается под m.mu). Тема могла существовать раньше и быть удалена вместе с устаревшей
+// историей, поэтому новая считает удаленными все события, удаленные по времени из любой темы.
+func (m *SubscriptionManager) newTopic() *topic {
+	size := m.QueueSize
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	return &topic{log: make([]Event, size), trimmed: m.expired}
 }
 
 func NewSubscriptionManager() *SubscriptionManager {
 	return &SubscriptionManager{
-		subs: make(map[string][]chan *model.Comment),
+		HistorySize: DefaultHistorySize,
+		QueueSize:   DefaultQueueSize,
+		Overflow:    DropOldest,
+		topics:      make(map[string]*topic),
 	}
 }
 
-func (m *SubscriptionManager) Subscribe(postID string) (<-chan *model.Comment, func()) {
+func (m *SubscriptionManager) Subscribe(name string) (<-chan Event, func()) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	ch := make(chan *model.Comment, 1) // Буфер 1, чтобы не блокировался писатель
-
-	m.subs[postID] = append(m.subs[postID], ch)
+	t, ok := m.topics[name]
+	if !ok {
+		t = m.newTopic()
+		m.topics[name] = t
+	}
+	sub := newSubscriber(t, m.Overflow)
+	t.mu.Lock()
+	// подписчик получает события, опубликованные после подписки, и ждет их с самого начала: иначе события,
+	// опубликованные до запуска горутины доставки, не попали бы в буфер подписчика с DropNewest
+	sub.pos = t.end
+	sub.waiting = true
+	t.subscribers = append(t.subscribers, sub)
+	t.waiters = append(t.waiters, sub)
+	t.mu.Unlock()
+	m.mu.Unlock()
+	go sub.run()
 
 	// функция для отписки
 	cancel := func() {
 		m.mu.Lock()
 		defer m.mu.Unlock()
-		subscribers := m.subs[postID]
-		for i, sub := range subscribers {
-			if sub == ch {
-				// Удаляем подписчика
-				m.subs[postID] = append(subscribers[:i], subscribers[i+1:]...)
-				close(ch)
-				break
-			}
+
+		t.mu.Lock()
+		t.remove(sub)
+		empty := len(t.subscribers) == 0 && len(t.history) == 0
+		t.mu.Unlock()
+
+		// пустые темы удаляем - тем много (по одной на пост и пользователя)
+		if empty && m.topics[name] == t {
+			delete(m.topics, name)
+		}
+		sub.close()
+	}
+
+	return sub.out, cancel
+}
+
+// Publish назначает событию следующий номер, если его еще нет (события из Postgres приходят уже с номером),
+// сохраняет в историю темы (кроме Ephemeral событий) и дописывает в журнал темы, не дожидаясь доставки
+func (m *SubscriptionManager) Publish(name string, event Event) {
+	now := time.Now()
+
+	// общая блокировка не мешает публикациям в другие темы и защищает тему от удаления отпиской
+	m.mu.RLock()
+	t, ok := m.topics[name]
+	if ok {
+		t.publish(event, now, m.HistorySize, &m.seq)
+	}
+	m.mu.RUnlock()
+
+	// без подписчиков событие нужно только истории
+	if !ok && m.HistorySize > 0 && !event.Type.Ephemeral() {
+		m.mu.Lock()
+		t, ok = m.topics[name]
+		if !ok {
+			t = m.newTopic()
+			m.topics[name] = t
+		}
+		t.publish(event, now, m.HistorySize, &m.seq)
+		m.mu.Unlock()
+	}
+
+	m.sweep(now)
+}
+
+// History возвращает события темы после since. Номера общие для всех тем и идут в теме с пропусками, поэтому
+// неполнота истории определяется по наибольшему номеру удаленного из нее события.
+func (m *SubscriptionManager) History(name string, since uint64) ([]Event, error) {
+	m.mu.RLock()
+	t, ok := m.topics[name]
+	expiredSeq := m.expired
+	m.mu.RUnlock()
+	if !ok {
+		if since < expiredSeq {
+			return nil, ErrHistoryTruncated
 		}
+		return nil, nil
 	}
 
-	return ch, cancel
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if since < t.trimmed {
+		return nil, ErrHistoryTruncated
+	}
+
+	var events []Event
+	expired := time.Now().Add(-historyTTL)
+	for _, stored := range t.history {
+		if stored.event.Seq <= since {
+			continue
+		}
+		// событие устарело, но еще не удалено очисткой
+		if !stored.publishedAt.After(expired) {
+			return nil, ErrHistoryTruncated
+		}
+		events = append(events, stored.event)
+	}
+	return events, nil
 }
 
-func (m *SubscriptionManager) Publish(postID string, comment *model.Comment) {
+// sweep раз в historyTTL удаляет устаревшие события и темы без подписчиков и истории
+func (m *SubscriptionManager) sweep(now time.Time) {
+	m.mu.RLock()
+	due := now.Sub(m.swept) >= historyTTL
+	m.mu.RUnlock()
+	if !due {
+		return
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	for _, sub := range m.subs[postID] {
+	m.swept = now
+	expired := now.Add(-historyTTL)
+	for name, t := range m.topics {
+		t.mu.Lock()
+		i := 0
+		for i < len(t.history) && !t.history[i].publishedAt.After(expired) {
+			i++
+		}
+		if i > 0 {
+			t.trim(i)
+			m.expired = max(m.expired, t.trimmed)
+		}
+		if len(t.history) == 0 && len(t.subscribers) == 0 {
+			delete(m.topics, name)
+		}
+		t.mu.Unlock()
+	}
+}
+
+// publish сохраняет событие в историю (не больше historySize событий), дописывает в журнал и будит подписчиков,
+// которые его ждут. Номер из seq назначается под блокировкой темы: иначе две одновременные публикации могли бы
+// попасть в историю и журнал не по порядку номеров.
+func (t *topic) publish(event Event, now time.Time, historySize int, seq *atomic.Uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if event.Seq == 0 {
+		event.Seq = seq.Add(1)
+	}
+
+	if historySize > 0 && !event.Type.Ephemeral() {
+		t.history = append(t.history, storedEvent{event: event, publishedAt: now})
+		if len(t.history) > historySize {
+			t.trim(len(t.history) - historySize)
+		}
+	}
+
+	// журнал нужен только подписчикам: новый подписчик читает с текущего конца
+	if len(t.subscribers) == 0 {
+		return
+	}
+	t.log[t.end%uint64(len(t.log))] = event
+	t.end++
+
+	// подписчики, которые еще не прочитали предыдущие события, журнал прочтут сами - будить их не нужно
+	waiters := t.waiters[:0]
+	for _, sub := range t.waiters {
+		if sub.deliver(event) {
+			waiters = append(waiters, sub)
+			continue
+		}
+		sub.waiting = false
 		select {
-		case sub <- comment:
-		case <-time.After(500 * time.Millisecond):
-			// Если канал заполнен, ждем короткое время
+		case sub.wake <- struct{}{}:
+		default:
+		}
+	}
+	clear(t.waiters[len(waiters):])
+	t.waiters = waiters
+}
+
+// trim удаляет n самых старых событий истории и запоминает номер последнего из них (вызывается под мьютексом темы)
+func (t *topic) trim(n int) {
+	t.trimmed = max(t.trimmed, t.history[n-1].event.Seq)
+	t.history = append([]storedEvent(nil), t.history[n:]...)
+}
+
+// remove удаляет подписчика из темы (вызывается под мьютексом темы)
+func (t *topic) remove(sub *subscriber) {
+	for i, s := range t.subscribers {
+		if s == sub {
+			t.subscribers = append(t.subscribers[:i], t.subscribers[i+1:]...)
+			break
+		}
+	}
+	for i, s := range t.waiters {
+		if s == sub {
+			t.waiters = append(t.waiters[:i], t.waiters[i+1:]...)
+			break
 		}
 	}
+	sub.waiting = false
 }
@@ -0,0 +1,102 @@
+package subscription
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// benchmarkPublish - публикация в тему с n подписчиками, которые не читают события
+func benchmarkPublish(b *testing.B, n int) {
+	manager := NewSubscriptionManager()
+	manager.HistorySize = 0
+	for i := 0; i < n; i++ {
+		_, cancel := manager.Subscribe(PostsTopic)
+		defer cancel()
+	}
+
+	// подписчики забирают первое событие и встают на отправке в канал, который никто не читает
+	event := Event{Type: EventPostCreated, Payload: &model.Post{ID: "1"}}
+	manager.Publish(PostsTopic, event)
+	waitStalled(manager.topics[PostsTopic])
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		manager.Publish(PostsTopic, event)
+	}
+	b.StopTimer()
+}
+
+// waitStalled ждет, пока все подписчики темы прочитают журнал до конца
+func waitStalled(t *topic) {
+	for {
+		t.mu.Lock()
+		stalled := true
+		for _, sub := range t.subscribers {
+			if sub.pos != t.end {
+				stalled = false
+				break
+			}
+		}
+		t.mu.Unlock()
+		if stalled {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// BenchmarkPublish - время публикации не зависит ни от скорости подписчиков, ни от их числа:
+// событие дописывается в журнал темы, а подписчики читают его сами
+func BenchmarkPublish(b *testing.B) {
+	for _, n := range []int{1, 100, 1000, 10000} {
+		b.Run(fmt.Sprintf("stalled_subscribers=%d", n), func(b *testing.B) {
+			benchmarkPublish(b, n)
+		})
+	}
+}
+
+// TestPublishLatencyIsFlat проверяет то же, что показывает BenchmarkPublish: с 10000 медленных подписчиков
+// публикация не медленнее, чем с одним, с запасом на шум
+func TestPublishLatencyIsFlat(t *testing.T) {
+	if testing.Short() {
+		t.Skip("benchmark based test")
+	}
+
+	one := testing.Benchmark(func(b *testing.B) { benchmarkPublish(b, 1) })
+	many := testing.Benchmark(func(b *testing.B) { benchmarkPublish(b, 10000) })
+	t.Logf("publish with 1 subscriber: %d ns, with 10000: %d ns", one.NsPerOp(), many.NsPerOp())
+	assert.Less(t, many.NsPerOp(), 10*one.NsPerOp()+1000)
+}
+
+// BenchmarkPublishOtherTopics - публикация в тему с одним подписчиком, пока в других темах тысячи
+// медленных подписчиков: время не должно зависеть от их числа
+func BenchmarkPublishOtherTopics(b *testing.B) {
+	for _, n := range []int{0, 1000, 10000} {
+		b.Run(fmt.Sprintf("other_subscribers=%d", n), func(b *testing.B) {
+			manager := NewSubscriptionManager()
+			for i := 0; i < n; i++ {
+				_, cancel := manager.Subscribe(CommentsTopic(fmt.Sprint(i % 100)))
+				defer cancel()
+			}
+
+			ch, cancel := manager.Subscribe(PostsTopic)
+			defer cancel()
+			go func() {
+				for range ch {
+				}
+			}()
+
+			event := Event{Type: EventPostCreated, Payload: &model.Post{ID: "1"}}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					manager.Publish(PostsTopic, event)
+				}
+			})
+		})
+	}
+}
@@ -1,8 +1,47 @@
 package subscription
 
-import "github.com/VitaminP8/postery/graph/model"
+import "errors"
 
+// ErrHistoryTruncated - часть событий после since уже не хранится (история ограничена размером и временем):
+// продолжить с since без пропусков нельзя, клиенту нужно перечитать данные и подписаться заново
+var ErrHistoryTruncated = errors.New("event history is truncated, reload and subscribe without since")
+
+// Manager доставляет события подписчикам тем. Тема - строка вида "comments:<postID>" (см. функции ниже),
+// подписчики одной темы получают все опубликованные в нее события.
 type Manager interface {
-	Subscribe(postID string) (<-chan *model.Comment, func())
-	Publish(postID string, comment *model.Comment)
+	// Subscribe подписывает на тему; вызов cancel отписывает и закрывает канал
+	Subscribe(topic string) (<-chan Event, func())
+	// Publish назначает событию Seq и отправляет его подписчикам темы
+	Publish(topic string, event Event)
+	// History возвращает сохраненные события темы с Seq больше since, от старых к новым. Если какие-то из них
+	// уже удалены из истории, возвращает ErrHistoryTruncated.
+	History(topic string, since uint64) ([]Event, error)
+}
+
+// PostsTopic - тема с новыми постами всех авторов
+const PostsTopic = "posts"
+
+// CommentsTopic - тема с новыми комментариями поста
+func CommentsTopic(postID string) string {
+	return "comments:" + postID
+}
+
+// RepliesTopic - тема с ответами на комментарий на любой глубине (прямые ответы - с ParentID == commentID)
+func RepliesTopic(commentID string) string {
+	return "replies:" + commentID
+}
+
+// PostTopic - тема с изменениями поста (обновление, удаление, включение и выключение комментариев)
+func PostTopic(postID string) string {
+	return "post:" + postID
+}
+
+// PresenceTopic - тема со зрителями поста и индикаторами набора ответа
+func PresenceTopic(postID string) string {
+	return "presence:" + postID
+}
+
+// RelationsTopic - тема с изменениями отношений пользователя к другим (подписки, скрытие, блокировка)
+func RelationsTopic(userID string) string {
+	return "relations:" + userID
 }
@@ -1,6 +1,7 @@
 package subscription
 
 import (
+	"context"
 	"strconv"
 	"sync"
 	"testing"
@@ -16,24 +17,24 @@ func TestSubscriptionManager_Subscribe(t *testing.T) {
 		manager := NewSubscriptionManager()
 		postID := "123"
 
-		ch, cancel := manager.Subscribe(postID)
+		ch, cancel := manager.Subscribe(CommentsTopic(postID))
 		assert.NotNil(t, ch)
 		assert.NotNil(t, cancel)
 
 		manager.mu.Lock()
-		subscribers, exists := manager.subs[postID]
+		subscribers, exists := manager.topics[CommentsTopic(postID)]
 		manager.mu.Unlock()
 		assert.True(t, exists)
-		assert.Len(t, subscribers, 1)
+		assert.Len(t, subscribers.subscribers, 1)
 
 		// Вызываем отмену подписки
 		cancel()
 
+		// последняя отписка удаляет тему
 		manager.mu.Lock()
-		subscribers, exists = manager.subs[postID]
+		_, exists = manager.topics[CommentsTopic(postID)]
 		manager.mu.Unlock()
-		assert.True(t, exists)
-		assert.Len(t, subscribers, 0)
+		assert.False(t, exists)
 	})
 
 	t.Run("Multiple subscriptions to the same post", func(t *testing.T) {
@@ -41,46 +42,45 @@ func TestSubscriptionManager_Subscribe(t *testing.T) {
 		postID := "123"
 
 		// Создаем 3 подписки
-		_, cancel1 := manager.Subscribe(postID)
-		_, cancel2 := manager.Subscribe(postID)
-		_, cancel3 := manager.Subscribe(postID)
+		_, cancel1 := manager.Subscribe(CommentsTopic(postID))
+		_, cancel2 := manager.Subscribe(CommentsTopic(postID))
+		_, cancel3 := manager.Subscribe(CommentsTopic(postID))
 
 		manager.mu.Lock()
-		subscribers, exists := manager.subs[postID]
+		subscribers, exists := manager.topics[CommentsTopic(postID)]
 		manager.mu.Unlock()
 		assert.True(t, exists)
-		assert.Len(t, subscribers, 3)
+		assert.Len(t, subscribers.subscribers, 3)
 
 		// Отменяем вторую подписку
 		cancel2()
 
 		manager.mu.Lock()
-		subscribers, exists = manager.subs[postID]
+		subscribers, exists = manager.topics[CommentsTopic(postID)]
 		manager.mu.Unlock()
 		assert.True(t, exists)
-		assert.Len(t, subscribers, 2)
+		assert.Len(t, subscribers.subscribers, 2)
 
 		// Отменяем остальные подписки
 		cancel1()
 		cancel3()
 
 		manager.mu.Lock()
-		subscribers, exists = manager.subs[postID]
+		_, exists = manager.topics[CommentsTopic(postID)]
 		manager.mu.Unlock()
-		assert.True(t, exists)
-		assert.Len(t, subscribers, 0)
+		assert.False(t, exists)
 	})
 
 	t.Run("Subscriptions to different posts", func(t *testing.T) {
 		manager := NewSubscriptionManager()
 
 		// Создаем подписки на разные посты
-		_, cancel1 := manager.Subscribe("post1")
-		_, cancel2 := manager.Subscribe("post2")
-		_, cancel3 := manager.Subscribe("post3")
+		_, cancel1 := manager.Subscribe(CommentsTopic("post1"))
+		_, cancel2 := manager.Subscribe(CommentsTopic("post2"))
+		_, cancel3 := manager.Subscribe(CommentsTopic("post3"))
 
 		manager.mu.Lock()
-		assert.Len(t, manager.subs, 3)
+		assert.Len(t, manager.topics, 3)
 		manager.mu.Unlock()
 
 		// Отменяем все подписки
@@ -89,9 +89,7 @@ func TestSubscriptionManager_Subscribe(t *testing.T) {
 		cancel3()
 
 		manager.mu.Lock()
-		assert.Len(t, manager.subs["post1"], 0)
-		assert.Len(t, manager.subs["post2"], 0)
-		assert.Len(t, manager.subs["post3"], 0)
+		assert.Empty(t, manager.topics)
 		manager.mu.Unlock()
 	})
 }
@@ -101,7 +99,7 @@ func TestSubscriptionManager_Publish(t *testing.T) {
 		manager := NewSubscriptionManager()
 		postID := "123"
 
-		ch, cancel := manager.Subscribe(postID)
+		ch, cancel := manager.Subscribe(CommentsTopic(postID))
 		defer cancel()
 
 		comment := &model.Comment{
@@ -113,12 +111,13 @@ func TestSubscriptionManager_Publish(t *testing.T) {
 		}
 
 		// Публикуем комментарий
-		manager.Publish(postID, comment)
+		manager.Publish(CommentsTopic(postID), Event{Type: EventCommentAdded, Payload: comment})
 
 		// Проверяем, что комментарий получен
 		select {
-		case receivedComment := <-ch:
-			assert.Equal(t, comment, receivedComment)
+		case event := <-ch:
+			assert.Equal(t, EventCommentAdded, event.Type)
+			assert.Equal(t, comment, event.Payload)
 		case <-time.After(time.Second):
 			t.Fatal("Timed out waiting for comment")
 		}
@@ -128,9 +127,9 @@ func TestSubscriptionManager_Publish(t *testing.T) {
 		manager := NewSubscriptionManager()
 		postID := "123"
 
-		ch1, cancel1 := manager.Subscribe(postID)
-		ch2, cancel2 := manager.Subscribe(postID)
-		ch3, cancel3 := manager.Subscribe(postID)
+		ch1, cancel1 := manager.Subscribe(CommentsTopic(postID))
+		ch2, cancel2 := manager.Subscribe(CommentsTopic(postID))
+		ch3, cancel3 := manager.Subscribe(CommentsTopic(postID))
 		defer cancel1()
 		defer cancel2()
 		defer cancel3()
@@ -143,12 +142,12 @@ func TestSubscriptionManager_Publish(t *testing.T) {
 			CreatedAt: time.Now().Format(time.RFC3339),
 		}
 
-		manager.Publish(postID, comment)
+		manager.Publish(CommentsTopic(postID), Event{Type: EventCommentAdded, Payload: comment})
 
-		for i, ch := range []<-chan *model.Comment{ch1, ch2, ch3} {
+		for i, ch := range []<-chan Event{ch1, ch2, ch3} {
 			select {
-			case receivedComment := <-ch:
-				assert.Equal(t, comment, receivedComment, "Subscriber %d did not receive correct comment", i+1)
+			case event := <-ch:
+				assert.Equal(t, comment, event.Payload, "Subscriber %d did not receive correct comment", i+1)
 			case <-time.After(time.Second):
 				t.Fatalf("Subscriber %d timed out waiting for comment", i+1)
 			}
@@ -158,8 +157,8 @@ func TestSubscriptionManager_Publish(t *testing.T) {
 	t.Run("Should only send to subscribers of the specific post", func(t *testing.T) {
 		manager := NewSubscriptionManager()
 
-		ch1, cancel1 := manager.Subscribe("post1")
-		ch2, cancel2 := manager.Subscribe("post2")
+		ch1, cancel1 := manager.Subscribe(CommentsTopic("post1"))
+		ch2, cancel2 := manager.Subscribe(CommentsTopic("post2"))
 		defer cancel1()
 		defer cancel2()
 
@@ -171,11 +170,11 @@ func TestSubscriptionManager_Publish(t *testing.T) {
 			CreatedAt: time.Now().Format(time.RFC3339),
 		}
 
-		manager.Publish("post1", comment)
+		manager.Publish(CommentsTopic("post1"), Event{Type: EventCommentAdded, Payload: comment})
 
 		select {
-		case receivedComment := <-ch1:
-			assert.Equal(t, comment, receivedComment)
+		case event := <-ch1:
+			assert.Equal(t, comment, event.Payload)
 		case <-time.After(time.Second):
 			t.Fatal("Subscriber of post1 timed out waiting for comment")
 		}
@@ -199,7 +198,7 @@ func TestSubscriptionManager_Publish(t *testing.T) {
 		}
 
 		assert.NotPanics(t, func() {
-			manager.Publish("post1", comment)
+			manager.Publish(CommentsTopic("post1"), Event{Type: EventCommentAdded, Payload: comment})
 		})
 	})
 }
@@ -216,7 +215,7 @@ func TestSubscriptionManager_Concurrent(t *testing.T) {
 		var wg sync.WaitGroup
 
 		// Создаем подписчиков
-		chans := make([]<-chan *model.Comment, numSubscribers)
+		chans := make([]<-chan Event, numSubscribers)
 		cancels := make([]func(), numSubscribers)
 
 		// Счетчик полученных комментариев для каждого подписчика
@@ -228,14 +227,14 @@ func TestSubscriptionManager_Concurrent(t *testing.T) {
 			wg.Add(1)
 			go func(idx int) {
 				defer wg.Done()
-				ch, cancel := manager.Subscribe(postID)
+				ch, cancel := manager.Subscribe(CommentsTopic(postID))
 				chans[idx] = ch
 				cancels[idx] = cancel
 
 				// Запускаем горутину для чтения из канала
-				go func(idx int, ch <-chan *model.Comment) {
-					for comment := range ch {
-						require.Equal(t, postID, comment.PostID)
+				go func(idx int, ch <-chan Event) {
+					for event := range ch {
+						require.Equal(t, postID, event.Payload.(*model.Comment).PostID)
 						mu.Lock()
 						received[idx]++
 						mu.Unlock()
@@ -259,7 +258,7 @@ func TestSubscriptionManager_Concurrent(t *testing.T) {
 					AuthorID:  "789",
 					CreatedAt: time.Now().Format(time.RFC3339),
 				}
-				manager.Publish(postID, comment)
+				manager.Publish(CommentsTopic(postID), Event{Type: EventCommentAdded, Payload: comment})
 			}(i)
 		}
 
@@ -294,7 +293,7 @@ func TestSubscriptionManager_Concurrent(t *testing.T) {
 				defer wg.Done()
 
 				// Подписываемся
-				ch, cancel := manager.Subscribe(postID)
+				ch, cancel := manager.Subscribe(CommentsTopic(postID))
 
 				// Небольшая задержка
 				time.Sleep(5 * time.Millisecond)
@@ -312,7 +311,399 @@ func TestSubscriptionManager_Concurrent(t *testing.T) {
 
 		// Проверяем, что все подписки были корректно удалены
 		manager.mu.Lock()
-		assert.Len(t, manager.subs[postID], 0)
+		assert.Empty(t, manager.topics)
+		manager.mu.Unlock()
+	})
+}
+
+func TestSubscriptionManager_Topics(t *testing.T) {
+	t.Run("Should send payload to topic subscribers only", func(t *testing.T) {
+		manager := NewSubscriptionManager()
+
+		ch, cancel := manager.Subscribe(PostTopic("1"))
+		defer cancel()
+		other, cancelOther := manager.Subscribe(PostTopic("2"))
+		defer cancelOther()
+
+		post := &model.Post{ID: "1", AuthorID: "3"}
+		manager.Publish(PostTopic("1"), Event{Type: EventPostUpdated, Payload: post})
+
+		select {
+		case event := <-ch:
+			assert.Equal(t, post, event.Payload)
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for payload")
+		}
+
+		select {
+		case <-other:
+			t.Fatal("Payload delivered to another topic")
+		default:
+		}
+	})
+
+	t.Run("Topics of one post are independent", func(t *testing.T) {
+		manager := NewSubscriptionManager()
+
+		comments, cancel := manager.Subscribe(CommentsTopic("1"))
+		defer cancel()
+
+		// изменения поста не попадают подписчикам его комментариев
+		manager.Publish(PostTopic("1"), Event{Type: EventPostUpdated, Payload: &model.Post{ID: "1"}})
+
+		select {
+		case <-comments:
+			t.Fatal("Topic payload delivered to comment subscription")
+		default:
+		}
+	})
+
+	t.Run("Cancel removes empty topic", func(t *testing.T) {
+		manager := NewSubscriptionManager()
+
+		ch, cancel := manager.Subscribe("topic")
+		cancel()
+
+		_, ok := <-ch
+		assert.False(t, ok)
+
+		manager.mu.Lock()
+		_, exists := manager.topics["topic"]
 		manager.mu.Unlock()
+		assert.False(t, exists)
 	})
 }
+
+func TestListen(t *testing.T) {
+	t.Run("Filters event types and payloads", func(t *testing.T) {
+		manager := NewSubscriptionManager()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		posts := Listen[*model.Post](ctx, manager, PostTopic("1"), EventPostUpdated, EventCommentsToggled)
+
+		// удаление не входит в запрошенные типы, а нагрузка неверного типа пропускается
+		manager.Publish(PostTopic("1"), Event{Type: EventPostDeleted, Payload: "1"})
+		manager.Publish(PostTopic("1"), Event{Type: EventPostUpdated, Payload: "not a post"})
+		manager.Publish(PostTopic("1"), Event{Type: EventCommentsToggled, Payload: &model.Post{ID: "1", CommentsDisabled: true}})
+
+		select {
+		case post := <-posts:
+			assert.True(t, post.CommentsDisabled)
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for post")
+		}
+	})
+
+	t.Run("Context cancel closes channel and unsubscribes", func(t *testing.T) {
+		manager := NewSubscriptionManager()
+		ctx, cancel := context.WithCancel(context.Background())
+
+		ids := Listen[string](ctx, manager, PostTopic("1"))
+		cancel()
+
+		select {
+		case _, ok := <-ids:
+			assert.False(t, ok)
+		case <-time.After(time.Second):
+			t.Fatal("Channel was not closed")
+		}
+
+		manager.mu.Lock()
+		assert.Empty(t, manager.topics)
+		manager.mu.Unlock()
+	})
+}
+
+func TestSubscriptionManager_History(t *testing.T) {
+	t.Run("Events get increasing sequence numbers", func(t *testing.T) {
+		manager := NewSubscriptionManager()
+		manager.Publish(PostTopic("1"), Event{Type: EventPostDeleted, Payload: "1"})
+		manager.Publish(PostTopic("2"), Event{Type: EventPostDeleted, Payload: "2"})
+
+		events, err := manager.History(PostTopic("2"), 0)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, uint64(2), events[0].Seq)
+	})
+
+	t.Run("Returns events after cursor", func(t *testing.T) {
+		manager := NewSubscriptionManager()
+		for i := 1; i <= 3; i++ {
+			manager.Publish(CommentsTopic("1"), Event{Type: EventCommentAdded, Payload: &model.Comment{ID: strconv.Itoa(i)}})
+		}
+
+		events, err := manager.History(CommentsTopic("1"), 1)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, "2", events[0].Payload.(*model.Comment).ID)
+		assert.Equal(t, "3", events[1].Payload.(*model.Comment).ID)
+	})
+
+	t.Run("History is bounded", func(t *testing.T) {
+		manager := NewSubscriptionManager()
+		manager.HistorySize = 2
+		for i := 1; i <= 5; i++ {
+			manager.Publish(PostsTopic, Event{Type: EventPostCreated, Payload: &model.Post{ID: strconv.Itoa(i)}})
+		}
+
+		// события 1-3 удалены из истории - продолжить с since меньше 3 без пропусков нельзя
+		_, err := manager.History(PostsTopic, 0)
+		assert.ErrorIs(t, err, ErrHistoryTruncated)
+		_, err = manager.History(PostsTopic, 2)
+		assert.ErrorIs(t, err, ErrHistoryTruncated)
+
+		events, err := manager.History(PostsTopic, 3)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, uint64(4), events[0].Seq)
+	})
+
+	t.Run("Expired history is truncated", func(t *testing.T) {
+		manager := NewSubscriptionManager()
+		manager.Publish(PostTopic("1"), Event{Type: EventPostDeleted, Payload: "1"})
+		manager.Publish(PostTopic("2"), Event{Type: EventPostDeleted, Payload: "2"})
+
+		// событие устарело, но очистка еще не прошла
+		manager.topics[PostTopic("1")].history[0].publishedAt = time.Now().Add(-2 * historyTTL)
+		_, err := manager.History(PostTopic("1"), 0)
+		assert.ErrorIs(t, err, ErrHistoryTruncated)
+
+		// очистка удаляет тему, но пропуск заметен и после нее
+		manager.swept = time.Time{}
+		manager.sweep(time.Now())
+		require.NotContains(t, manager.topics, PostTopic("1"))
+		_, err = manager.History(PostTopic("1"), 0)
+		assert.ErrorIs(t, err, ErrHistoryTruncated)
+
+		events, err := manager.History(PostTopic("2"), 1)
+		require.NoError(t, err)
+		assert.Len(t, events, 1)
+	})
+
+	t.Run("Disabled history", func(t *testing.T) {
+		manager := NewSubscriptionManager()
+		manager.HistorySize = 0
+		manager.Publish(PostsTopic, Event{Type: EventPostCreated, Payload: &model.Post{ID: "1"}})
+
+		events, err := manager.History(PostsTopic, 0)
+		require.NoError(t, err)
+		assert.Empty(t, events)
+	})
+
+	t.Run("Concurrent publishes keep sequence order", func(t *testing.T) {
+		manager := NewSubscriptionManager()
+		manager.QueueSize = 1000
+		ch, cancel := manager.Subscribe(PostsTopic)
+		defer cancel()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					manager.Publish(PostsTopic, Event{Type: EventPostCreated, Payload: &model.Post{}})
+				}
+			}()
+		}
+		wg.Wait()
+
+		var last uint64
+		for i := 0; i < 500; i++ {
+			event := <-ch
+			assert.Greater(t, event.Seq, last)
+			last = event.Seq
+		}
+
+		events, err := manager.History(PostsTopic, last-DefaultHistorySize)
+		require.NoError(t, err)
+		assert.Len(t, events, DefaultHistorySize)
+		for i := 1; i < len(events); i++ {
+			assert.Greater(t, events[i].Seq, events[i-1].Seq)
+		}
+	})
+
+	t.Run("Ephemeral events are not stored", func(t *testing.T) {
+		manager := NewSubscriptionManager()
+		ch, cancel := manager.Subscribe(PresenceTopic("1"))
+		defer cancel()
+
+		manager.Publish(PresenceTopic("1"), Event{Type: EventTyping, Payload: &Typing{PostID: "1", UserID: "2"}})
+		event := <-ch
+		assert.Equal(t, EventTyping, event.Type)
+
+		events, err := manager.History(PresenceTopic("1"), 0)
+		require.NoError(t, err)
+		assert.Empty(t, events)
+	})
+}
+
+func TestListenSince(t *testing.T) {
+	t.Run("Replays missed events before live ones", func(t *testing.T) {
+		manager := NewSubscriptionManager()
+		for i := 1; i <= 3; i++ {
+			manager.Publish(CommentsTopic("1"), Event{Type: EventCommentAdded, Payload: &model.Comment{ID: strconv.Itoa(i)}})
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		events, err := ListenSince(ctx, manager, CommentsTopic("1"), 1, EventCommentAdded)
+		require.NoError(t, err)
+		manager.Publish(CommentsTopic("1"), Event{Type: EventCommentAdded, Payload: &model.Comment{ID: "4"}})
+
+		var ids []string
+		for len(ids) < 3 {
+			select {
+			case event := <-events:
+				ids = append(ids, event.Payload.(*model.Comment).ID)
+			case <-time.After(time.Second):
+				t.Fatal("Timed out waiting for events")
+			}
+		}
+		assert.Equal(t, []string{"2", "3", "4"}, ids)
+	})
+
+	t.Run("Skips live events already replayed", func(t *testing.T) {
+		manager := NewSubscriptionManager()
+		manager.Publish(PostsTopic, Event{Type: EventPostCreated, Payload: &model.Post{ID: "1"}})
+		events, err := manager.History(PostsTopic, 0)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		out, err := ListenSince(ctx, manager, PostsTopic, 0)
+		require.NoError(t, err)
+		// то же событие приходит повторно (например, через Postgres NOTIFY уже после чтения истории)
+		manager.Publish(PostsTopic, events[0])
+		manager.Publish(PostsTopic, Event{Type: EventPostCreated, Payload: &model.Post{ID: "2"}})
+
+		var seqs []uint64
+		for len(seqs) < 2 {
+			select {
+			case event := <-out:
+				seqs = append(seqs, event.Seq)
+			case <-time.After(time.Second):
+				t.Fatal("Timed out waiting for events")
+			}
+		}
+		assert.Equal(t, []uint64{1, 2}, seqs)
+	})
+
+	t.Run("Truncated history is an error", func(t *testing.T) {
+		manager := NewSubscriptionManager()
+		manager.HistorySize = 1
+		manager.Publish(PostsTopic, Event{Type: EventPostCreated, Payload: &model.Post{ID: "1"}})
+		manager.Publish(PostsTopic, Event{Type: EventPostCreated, Payload: &model.Post{ID: "2"}})
+
+		_, err := ListenSince(context.Background(), manager, PostsTopic, 0)
+		assert.ErrorIs(t, err, ErrHistoryTruncated)
+
+		// подписка отменена - тема осталась только с историей
+		manager.mu.Lock()
+		assert.Empty(t, manager.topics[PostsTopic].subscribers)
+		manager.mu.Unlock()
+	})
+}
+
+// drain читает канал, пока он не закроется или не перестанут приходить события
+func drain(ch <-chan Event) (seqs []uint64, closed bool) {
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return seqs, true
+			}
+			seqs = append(seqs, event.Seq)
+		case <-time.After(100 * time.Millisecond):
+			return seqs, false
+		}
+	}
+}
+
+func TestSubscriptionManager_Overflow(t *testing.T) {
+	publish := func(manager *SubscriptionManager, n int) {
+		for i := 0; i < n; i++ {
+			manager.Publish(PostsTopic, Event{Type: EventPostCreated, Payload: &model.Post{ID: strconv.Itoa(i)}})
+		}
+	}
+
+	t.Run("Slow subscriber does not block publish", func(t *testing.T) {
+		manager := NewSubscriptionManager()
+		_, cancelSlow := manager.Subscribe(PostsTopic)
+		defer cancelSlow()
+		fast, cancelFast := manager.Subscribe(PostsTopic)
+		defer cancelFast()
+
+		start := time.Now()
+		publish(manager, 10)
+		assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+		seqs, _ := drain(fast)
+		assert.Len(t, seqs, 10)
+	})
+
+	t.Run("Drop oldest keeps latest events", func(t *testing.T) {
+		manager := NewSubscriptionManager()
+		manager.QueueSize = 2
+		ch, cancel := manager.Subscribe(PostsTopic)
+		defer cancel()
+
+		publish(manager, 10)
+
+		// одно событие может уже ждать в горутине доставки, остальные - последние в очереди
+		seqs, closed := drain(ch)
+		assert.False(t, closed)
+		assert.LessOrEqual(t, len(seqs), 3)
+		assert.Equal(t, []uint64{9, 10}, seqs[len(seqs)-2:])
+	})
+
+	t.Run("Drop newest keeps first events", func(t *testing.T) {
+		manager := NewSubscriptionManager()
+		manager.QueueSize = 2
+		manager.Overflow = DropNewest
+		ch, cancel := manager.Subscribe(PostsTopic)
+		defer cancel()
+
+		publish(manager, 10)
+
+		seqs, closed := drain(ch)
+		assert.False(t, closed)
+		assert.LessOrEqual(t, len(seqs), 3)
+		assert.Equal(t, []uint64{1, 2}, seqs[:2])
+	})
+
+	t.Run("Disconnect closes slow subscriber", func(t *testing.T) {
+		manager := NewSubscriptionManager()
+		manager.QueueSize = 2
+		manager.Overflow = Disconnect
+		ch, cancel := manager.Subscribe(PostsTopic)
+
+		publish(manager, 10)
+
+		_, closed := drain(ch)
+		assert.True(t, closed)
+
+		manager.mu.Lock()
+		assert.Empty(t, manager.topics[PostsTopic].subscribers)
+		manager.mu.Unlock()
+
+		// повторная отписка клиентом безопасна
+		assert.NotPanics(t, cancel)
+	})
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	policy, err := ParseOverflowPolicy("")
+	require.NoError(t, err)
+	assert.Equal(t, DropOldest, policy)
+
+	policy, err = ParseOverflowPolicy("disconnect")
+	require.NoError(t, err)
+	assert.Equal(t, Disconnect, policy)
+
+	_, err = ParseOverflowPolicy("block")
+	assert.Error(t, err)
+}
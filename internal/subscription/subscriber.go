@@ -0,0 +1,120 @@
+package subscription
+
+import "sync"
+
+// subscriber - позиция подписчика в журнале темы и горутина, которая читает журнал и отправляет события в out.
+// Publish только дописывает журнал и будит ожидающих подписчиков, поэтому не зависит ни от числа подписчиков,
+// ни от того, как быстро они читают: подписчик, не читающий канал, не стоит публикации ничего.
+type subscriber struct {
+	t      *topic
+	out    chan Event
+	wake   chan struct{} // сигнал ожидающему подписчику: в журнале появились события
+	done   chan struct{} // закрывается при отписке
+	policy OverflowPolicy
+	pos    uint64 // номер следующего события журнала; защищен мьютексом темы
+	// waiting - подписчик в t.waiters; защищен мьютексом темы
+	waiting bool
+	once    sync.Once
+}
+
+func newSubscriber(t *topic, policy OverflowPolicy) *subscriber {
+	s := &subscriber{
+		t:      t,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		policy: policy,
+	}
+	// при DropNewest очередь подписчика - буфер канала: пока подписчик ждет, Publish кладет события прямо в него,
+	// поэтому первые события сохраняются, даже если горутина доставки не успела запуститься
+	if policy == DropNewest {
+		s.out = make(chan Event, len(t.log))
+	} else {
+		s.out = make(chan Event)
+	}
+	return s
+}
+
+// close останавливает доставку; канал out закроет горутина доставки. Повторные вызовы ничего не делают.
+func (s *subscriber) close() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
+
+func (s *subscriber) run() {
+	defer close(s.out)
+
+	for {
+		event, ok := s.next()
+		if !ok {
+			return
+		}
+
+		select {
+		case s.out <- event:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// next ждет следующее событие журнала темы. Если подписчик отстал больше, чем на размер журнала, применяется
+// политика переполнения. false - подписчик отписан.
+func (s *subscriber) next() (Event, bool) {
+	t := s.t
+	for {
+		t.mu.Lock()
+		if s.pos == t.end {
+			if !s.waiting {
+				t.waiters = append(t.waiters, s)
+				s.waiting = true
+			}
+			t.mu.Unlock()
+
+			select {
+			case <-s.wake:
+				continue
+			case <-s.done:
+				return Event{}, false
+			}
+		}
+
+		size := uint64(len(t.log))
+		if t.end-s.pos > size {
+			switch s.policy {
+			case Disconnect:
+				t.remove(s)
+				t.mu.Unlock()
+				s.close()
+				return Event{}, false
+			case DropNewest:
+				// пропущенные события новее тех, что уже ждут в буфере канала
+				s.pos = t.end
+				t.mu.Unlock()
+				continue
+			default:
+				s.pos = t.end - size
+			}
+		}
+
+		event := t.log[s.pos%size]
+		s.pos++
+		t.mu.Unlock()
+		return event, true
+	}
+}
+
+// deliver кладет событие в буфер канала ожидающего подписчика с DropNewest (вызывается под мьютексом темы).
+// false - подписчика нужно разбудить: буфер заполнен или у подписчика другая политика.
+func (s *subscriber) deliver(event Event) bool {
+	if s.policy != DropNewest {
+		return false
+	}
+	select {
+	case s.out <- event:
+		s.pos++
+		return true
+	default:
+		return false
+	}
+}
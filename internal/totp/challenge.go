@@ -0,0 +1,88 @@
+package totp
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Параметры challenge, который loginUser выдает вместо токена при включенной 2FA
+const (
+	ChallengeTTL         = 5 * time.Minute
+	MaxChallengeAttempts = 5
+)
+
+// ErrInvalidChallenge - challenge не существует, истек или исчерпал попытки
+var ErrInvalidChallenge = errors.New("login challenge is invalid or expired, log in again")
+
+type challenge struct {
+	userID    string
+	expiresAt time.Time
+	attempts  int
+}
+
+// Challenges хранит незавершенные входы в памяти процесса
+type Challenges struct {
+	mu         sync.Mutex
+	challenges map[string]*challenge
+	now        func() time.Time
+}
+
+func NewChallenges() *Challenges {
+	return &Challenges{
+		challenges: make(map[string]*challenge),
+		now:        time.Now,
+	}
+}
+
+// Create начинает вход пользователя и возвращает идентификатор challenge
+func (c *Challenges) Create(userID string) (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("could not generate challenge: %w", err)
+	}
+	id := base64.RawURLEncoding.EncodeToString(b)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for key, ch := range c.challenges {
+		if !now.Before(ch.expiresAt) {
+			delete(c.challenges, key)
+		}
+	}
+
+	c.challenges[id] = &challenge{userID: userID, expiresAt: now.Add(ChallengeTTL)}
+	return id, nil
+}
+
+// Attempt учитывает попытку ввода кода и возвращает пользователя challenge.
+// После MaxChallengeAttempts попыток challenge удаляется.
+func (c *Challenges) Attempt(id string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch, ok := c.challenges[id]
+	if !ok || !c.now().Before(ch.expiresAt) {
+		delete(c.challenges, id)
+		return "", ErrInvalidChallenge
+	}
+
+	ch.attempts++
+	if ch.attempts >= MaxChallengeAttempts {
+		delete(c.challenges, id)
+	}
+	return ch.userID, nil
+}
+
+// Complete удаляет challenge после успешного ввода кода
+func (c *Challenges) Complete(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.challenges, id)
+}
@@ -0,0 +1,70 @@
+package totp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// cipherVersion - префикс зашифрованного значения, позволит сменить схему шифрования
+const cipherVersion = "v1:"
+
+// Cipher шифрует секреты TOTP перед сохранением в хранилище (AES-256-GCM)
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher создает шифр из ключа произвольной длины (ключ AES получается через SHA-256)
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) == 0 {
+		return nil, errors.New("TOTP encryption key is empty")
+	}
+
+	sum := sha256.Sum256(key)
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+func (c *Cipher) Encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", fmt.Errorf("could not generate nonce: %w", err)
+	}
+
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return cipherVersion + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (c *Cipher) Decrypt(encrypted string) (string, error) {
+	if !strings.HasPrefix(encrypted, cipherVersion) {
+		return "", errors.New("unsupported encrypted value")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encrypted, cipherVersion))
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	if len(data) < c.aead.NonceSize() {
+		return "", errors.New("invalid encrypted value")
+	}
+
+	nonce, sealed := data[:c.aead.NonceSize()], data[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", errors.New("could not decrypt value: wrong key or corrupted data")
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,158 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// секрет из тестовых векторов RFC 6238 (SHA1)
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// RFC 6238 дает 8-значные коды, у нас последние 6 цифр
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+
+	for unix, expected := range cases {
+		code, err := Code(rfcSecret, Step(time.Unix(unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, expected, code, "time %d", unix)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	current := Step(now)
+
+	t.Run("Accepts current and adjacent steps", func(t *testing.T) {
+		for _, s := range []int64{current - 1, current, current + 1} {
+			code, err := Code(rfcSecret, s)
+			require.NoError(t, err)
+
+			step, ok := Verify(rfcSecret, code, now)
+			assert.True(t, ok)
+			assert.Equal(t, s, step)
+		}
+	})
+
+	t.Run("Rejects codes outside the window", func(t *testing.T) {
+		code, err := Code(rfcSecret, current-2)
+		require.NoError(t, err)
+
+		_, ok := Verify(rfcSecret, code, now)
+		assert.False(t, ok)
+	})
+
+	t.Run("Rejects malformed codes", func(t *testing.T) {
+		_, ok := Verify(rfcSecret, "12345", now)
+		assert.False(t, ok)
+		_, ok = Verify("not base32!", "123456", now)
+		assert.False(t, ok)
+	})
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("Postery", "alice", "ABCDEF")
+
+	parsed, err := url.Parse(uri)
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", parsed.Scheme)
+	assert.Equal(t, "totp", parsed.Host)
+	assert.Equal(t, "/Postery:alice", parsed.Path)
+	assert.Equal(t, "ABCDEF", parsed.Query().Get("secret"))
+	assert.Equal(t, "Postery", parsed.Query().Get("issuer"))
+	assert.Equal(t, "6", parsed.Query().Get("digits"))
+}
+
+func TestCipher(t *testing.T) {
+	c, err := NewCipher([]byte("key"))
+	require.NoError(t, err)
+
+	encrypted, err := c.Encrypt("SECRET")
+	require.NoError(t, err)
+	assert.NotContains(t, encrypted, "SECRET")
+
+	t.Run("Round trip", func(t *testing.T) {
+		plaintext, err := c.Decrypt(encrypted)
+		require.NoError(t, err)
+		assert.Equal(t, "SECRET", plaintext)
+	})
+
+	t.Run("Wrong key", func(t *testing.T) {
+		other, err := NewCipher([]byte("other key"))
+		require.NoError(t, err)
+
+		_, err = other.Decrypt(encrypted)
+		assert.Error(t, err)
+	})
+
+	t.Run("Empty key", func(t *testing.T) {
+		_, err := NewCipher(nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes()
+	require.NoError(t, err)
+	require.Len(t, codes, RecoveryCodeCount)
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		assert.Len(t, code, 11)
+		assert.False(t, seen[code])
+		seen[code] = true
+	}
+
+	// регистр и дефис при вводе не важны
+	normalized := strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))
+	assert.Equal(t, HashRecoveryCode(codes[0]), HashRecoveryCode(normalized))
+}
+
+func TestChallenges(t *testing.T) {
+	now := time.Now()
+	c := NewChallenges()
+	c.now = func() time.Time { return now }
+
+	t.Run("Attempts limit", func(t *testing.T) {
+		id, err := c.Create("1")
+		require.NoError(t, err)
+
+		for i := 0; i < MaxChallengeAttempts; i++ {
+			userID, err := c.Attempt(id)
+			require.NoError(t, err)
+			assert.Equal(t, "1", userID)
+		}
+
+		_, err = c.Attempt(id)
+		assert.ErrorIs(t, err, ErrInvalidChallenge)
+	})
+
+	t.Run("Expires", func(t *testing.T) {
+		id, err := c.Create("1")
+		require.NoError(t, err)
+
+		now = now.Add(ChallengeTTL)
+		_, err = c.Attempt(id)
+		assert.ErrorIs(t, err, ErrInvalidChallenge)
+	})
+
+	t.Run("Completed challenge cannot be reused", func(t *testing.T) {
+		id, err := c.Create("1")
+		require.NoError(t, err)
+
+		c.Complete(id)
+		_, err = c.Attempt(id)
+		assert.ErrorIs(t, err, ErrInvalidChallenge)
+	})
+}
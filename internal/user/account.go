@@ -0,0 +1,9 @@
+package user
+
+// AccountStorage удаляет аккаунт вместе с данными пользователя
+type AccountStorage interface {
+	// DeleteAccount удаляет посты и комментарии пользователя или при anonymize передает их DeletedUserID, затем удаляет
+	// учетную запись, отношения, упоминания, вебхуки, сессии и персональные токены. Хранилище с транзакциями
+	// выполняет все это в одной транзакции: при ошибке аккаунт остается целым.
+	DeleteAccount(userID uint, anonymize bool) error
+}
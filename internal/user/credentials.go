@@ -0,0 +1,6 @@
+package user
+
+import "errors"
+
+// ErrInvalidCredentials - единственная ошибка неудачного входа: не раскрывает, существует ли пользователь
+var ErrInvalidCredentials = errors.New("invalid username or password")
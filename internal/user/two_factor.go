@@ -0,0 +1,22 @@
+package user
+
+import "errors"
+
+// TwoFactor - состояние TOTP пользователя в хранилище
+type TwoFactor struct {
+	// Secret - секрет TOTP, зашифрованный totp.Cipher (в открытом виде не хранится)
+	Secret string
+	// Enabled - 2FA подтверждена кодом и требуется при входе
+	Enabled bool
+	// RecoveryCodes - SHA-256 хэши неиспользованных кодов восстановления
+	RecoveryCodes []string
+	// LastStep - интервал последнего принятого кода, более ранние и тот же коды не принимаются
+	LastStep int64
+}
+
+var (
+	// ErrTotpCodeReused - код из этого интервала уже использован
+	ErrTotpCodeReused = errors.New("two-factor code has already been used")
+	// ErrRecoveryCodeInvalid - код восстановления не найден или уже использован
+	ErrRecoveryCodeInvalid = errors.New("recovery code is invalid or already used")
+)
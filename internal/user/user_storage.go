@@ -4,7 +4,46 @@ import (
 	"github.com/VitaminP8/postery/graph/model"
 )
 
+// Контент удаленного аккаунта, сохраненный в режиме анонимизации, переписывается на этого автора
+const (
+	DeletedUserID   = "0"
+	DeletedUsername = "deleted user"
+)
+
 type UserStorage interface {
 	RegisterUser(username, email, password string) (*model.User, error)
-	LoginUser(username, password string) (string, error) // JWT
+	// CreateAdmin создает аккаунт с ролью ADMIN при начальной настройке сервера (не через API);
+	// в отличие от RegisterUser допускает служебные имена (например, admin)
+	CreateAdmin(username, email, password string) (*model.User, error)
+	// VerifyCredentials проверяет пароль и возвращает пользователя без выдачи токена;
+	// при неудаче возвращает ErrInvalidCredentials
+	VerifyCredentials(username, password string) (*model.User, error)
+	GetUserByID(id string) (*model.User, error)
+	// GetUserRole - текущая роль пользователя (auth.RoleStorage для проверки токенов)
+	GetUserRole(userID uint) (string, error)
+	// GetUserByUsername ищет пользователя по имени без учета регистра: сначала по текущим именам,
+	// затем по прежним (последний владелец), чтобы ссылки на старое имя вели на переименованный аккаунт
+	GetUserByUsername(username string) (*model.User, error)
+	// ChangeUsername проверяет новое имя по правилам identity, интервал UsernameChangeCooldown и занятость
+	// (в том числе именами, закрепленными за другими на UsernameGracePeriod), меняет имя и сохраняет прежнее в истории
+	ChangeUsername(userID, username string) (*model.User, error)
+	// GetUsernameHistory возвращает прежние имена пользователя, начиная с последнего
+	GetUsernameHistory(userID string) ([]*UsernameChange, error)
+	SetUserRole(userID string, role model.Role) (*model.User, error)
+	CheckPassword(userID, password string) error
+	DeleteUser(userID string) error
+	// FindOrCreateByIdentity возвращает пользователя, связанного с внешней identity (issuer, subject);
+	// при первом входе создает аккаунт без пароля, занятое имя дополняется числовым суффиксом
+	FindOrCreateByIdentity(issuer, subject, username, email string) (*model.User, error)
+	// FindUserByIdentity возвращает пользователя, связанного с identity, или nil, если связи нет
+	FindUserByIdentity(issuer, subject string) (*model.User, error)
+
+	// GetTwoFactor возвращает состояние 2FA пользователя или nil, если 2FA не настраивалась
+	GetTwoFactor(userID string) (*TwoFactor, error)
+	SaveTwoFactor(userID string, state *TwoFactor) error
+	DeleteTwoFactor(userID string) error
+	// UseTotpStep атомарно запоминает интервал принятого кода; ErrTotpCodeReused, если он не новее последнего
+	UseTotpStep(userID string, step int64) error
+	// UseRecoveryCode атомарно удаляет код восстановления по хэшу; ErrRecoveryCodeInvalid, если его нет
+	UseRecoveryCode(userID, codeHash string) error
 }
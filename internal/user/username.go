@@ -0,0 +1,37 @@
+package user
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// UsernameChangeCooldown - минимальный интервал между сменами имени
+	UsernameChangeCooldown = 30 * 24 * time.Hour
+	// UsernameGracePeriod - сколько освобожденное имя остается за прежним владельцем:
+	// другие пользователи не могут его занять, а ссылки на старое имя ведут на его аккаунт
+	UsernameGracePeriod = 90 * 24 * time.Hour
+)
+
+var (
+	// ErrUsernameChangeTooSoon - имя менялось недавно, время следующей смены в тексте обернутой ошибки
+	ErrUsernameChangeTooSoon = errors.New("username was changed recently")
+	// ErrUsernameUnchanged - новое имя совпадает с текущим
+	ErrUsernameUnchanged = errors.New("new username is the same as the current one")
+)
+
+// UsernameChange - прежнее имя пользователя и время, когда оно было заменено
+type UsernameChange struct {
+	Username  string
+	ChangedAt time.Time
+}
+
+// HeldBy сообщает, закреплено ли освобожденное имя за прежним владельцем к моменту now
+func (c *UsernameChange) HeldBy(now time.Time) bool {
+	return now.Before(c.ChangedAt.Add(UsernameGracePeriod))
+}
+
+// NextChangeAt возвращает время, с которого разрешена следующая смена имени после lastChange
+func NextChangeAt(lastChange time.Time) time.Time {
+	return lastChange.Add(UsernameChangeCooldown)
+}
@@ -0,0 +1,386 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/VitaminP8/postery/internal/subscription"
+)
+
+const (
+	// DefaultRetryBase - задержка перед второй попыткой; дальше она удваивается
+	DefaultRetryBase = 30 * time.Second
+	// DefaultMaxRetryDelay ограничивает рост задержки
+	DefaultMaxRetryDelay = time.Hour
+	// DefaultMaxAttempts - после стольких неудачных попыток доставка получает StatusFailed
+	DefaultMaxAttempts = 8
+	// DefaultTimeout - сколько ждать ответа получателя
+	DefaultTimeout = 10 * time.Second
+	// DefaultPollInterval - как часто проверяются повторы и доставки, созданные другими экземплярами
+	DefaultPollInterval = 5 * time.Second
+	// DeliveryRetention - сколько хранятся завершенные доставки
+	DeliveryRetention = 7 * 24 * time.Hour
+
+	// claimLease - сколько доставка закреплена за отправителем; больше времени ожидания ответа
+	claimLease    = time.Minute
+	claimBatch    = 20
+	pruneInterval = time.Hour
+	// maxResponseBody - сколько тела ответа читается, чтобы соединение можно было переиспользовать
+	maxResponseBody = 64 << 10
+	// queueSize - сколько опубликованных событий ждут Run; при переполнении новые события отбрасываются
+	queueSize = 1024
+)
+
+// ErrPrivateAddress - адрес вебхука указывает во внутреннюю сеть сервера
+var ErrPrivateAddress = errors.New("webhook address is not public")
+
+// Dispatcher создает доставки для опубликованных событий и отправляет их. Повторы хранятся в WebhookStorage,
+// поэтому переживают перезапуск, а при нескольких экземплярах каждую доставку отправляет один из них.
+// Поля задаются до запуска Run.
+type Dispatcher struct {
+	store  WebhookStorage
+	client *http.Client
+
+	RetryBase     time.Duration
+	MaxRetryDelay time.Duration
+	MaxAttempts   int
+	PollInterval  time.Duration
+
+	wake   chan struct{}
+	events chan queuedEvent
+}
+
+type queuedEvent struct {
+	topic string
+	event subscription.Event
+}
+
+// NewDispatcher создает отправителя. Без allowPrivate запросы на loopback, частные и link-local адреса
+// запрещены: иначе пользователь мог бы через вебхук обращаться к внутренним сервисам. Адрес проверяется
+// при соединении, поэтому DNS не может подменить его после регистрации вебхука.
+func NewDispatcher(store WebhookStorage, allowPrivate bool) *Dispatcher {
+	dialer := &net.Dialer{Timeout: DefaultTimeout}
+	if !allowPrivate {
+		dialer.Control = denyPrivate
+	}
+
+	return &Dispatcher{
+		store: store,
+		client: &http.Client{
+			Timeout: DefaultTimeout,
+			// прокси из окружения не используется: соединение с ним обошло бы проверку адреса
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: DefaultTimeout,
+				MaxIdleConnsPerHost: 4,
+			},
+			// перенаправление считается неудачной доставкой
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		RetryBase:     DefaultRetryBase,
+		MaxRetryDelay: DefaultMaxRetryDelay,
+		MaxAttempts:   DefaultMaxAttempts,
+		PollInterval:  DefaultPollInterval,
+		wake:          make(chan struct{}, 1),
+		events:        make(chan queuedEvent, queueSize),
+	}
+}
+
+// Wrap возвращает менеджер подписок, который после публикации передает событие в Run, а тот создает доставки
+// вебхуков. Publish не ждет хранилище вебхуков. Оборачивать нужно менеджер, через который публикуют хранилища:
+// тогда при нескольких экземплярах событие ставится в очередь один раз - там, где оно произошло.
+func (d *Dispatcher) Wrap(m subscription.Manager) subscription.Manager {
+	return &publisher{Manager: m, d: d}
+}
+
+type publisher struct {
+	subscription.Manager
+	d *Dispatcher
+}
+
+func (p *publisher) Publish(topic string, event subscription.Event) {
+	p.Manager.Publish(topic, event)
+
+	select {
+	case p.d.events <- queuedEvent{topic: topic, event: event}:
+	default:
+		log.Printf("webhooks: queue is full, dropping %s event for %s", event.Type, topic)
+	}
+}
+
+// Enqueue создает доставки события для подписанных на него вебхуков; события без соответствия пропускаются
+func (d *Dispatcher) Enqueue(topic string, event subscription.Event) {
+	webhookEvent, data, ok := eventFor(topic, event)
+	if !ok {
+		return
+	}
+
+	hooks, err := d.store.GetWebhooksForEvent(webhookEvent)
+	if err != nil {
+		log.Printf("webhooks: could not get webhooks for %s: %v", webhookEvent, err)
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	now := time.Now()
+	body, err := json.Marshal(Payload{Event: webhookEvent, CreatedAt: now.UTC().Format(time.RFC3339), Data: data})
+	if err != nil {
+		log.Printf("webhooks: could not encode %s: %v", webhookEvent, err)
+		return
+	}
+
+	for _, hook := range hooks {
+		_, err = d.store.CreateDelivery(&Delivery{
+			WebhookID:     hook.ID,
+			Event:         webhookEvent,
+			Payload:       body,
+			NextAttemptAt: now,
+		})
+		if err != nil {
+			log.Printf("webhooks: could not create delivery for webhook %s: %v", hook.ID, err)
+		}
+	}
+	d.notify()
+}
+
+// Redeliver возвращает неудавшуюся доставку в очередь; ErrNotFailed, если она не в StatusFailed
+func (d *Dispatcher) Redeliver(id string) (*Delivery, error) {
+	delivery, err := d.store.RetryDelivery(id, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	d.notify()
+	return delivery, nil
+}
+
+// Run отправляет доставки, пока не отменен ctx: сразу после Enqueue и Redeliver, а также раз в PollInterval -
+// повторы и доставки, созданные другими экземплярами. Раз в час удаляет завершенные доставки старше DeliveryRetention.
+// События, опубликованные через Wrap, ставятся в очередь отдельной горутиной, чтобы медленный получатель
+// не задерживал создание доставок.
+func (d *Dispatcher) Run(ctx context.Context) {
+	go d.enqueuePublished(ctx)
+
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+
+	var lastPrune time.Time
+	for {
+		d.deliverDue(ctx)
+
+		if time.Since(lastPrune) > pruneInterval {
+			lastPrune = time.Now()
+			err := d.store.PruneDeliveries(lastPrune.Add(-DeliveryRetention))
+			if err != nil {
+				log.Printf("webhooks: could not prune deliveries: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Dispatcher) enqueuePublished(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case queued := <-d.events:
+			d.Enqueue(queued.topic, queued.event)
+		}
+	}
+}
+
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispatcher) deliverDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		deliveries, err := d.store.ClaimDueDeliveries(time.Now(), claimLease, claimBatch)
+		if err != nil {
+			log.Printf("webhooks: could not claim deliveries: %v", err)
+			return
+		}
+
+		var wg sync.WaitGroup
+		for _, delivery := range deliveries {
+			wg.Add(1)
+			go func(delivery *Delivery) {
+				defer wg.Done()
+				d.attempt(ctx, delivery)
+			}(delivery)
+		}
+		wg.Wait()
+
+		if len(deliveries) < claimBatch {
+			return
+		}
+	}
+}
+
+// attempt отправляет доставку и записывает результат: успех, следующую попытку или StatusFailed
+func (d *Dispatcher) attempt(ctx context.Context, delivery *Delivery) {
+	hook, err := d.store.GetWebhook(delivery.WebhookID)
+	if err != nil {
+		// вебхук удален вместе с доставками или хранилище недоступно - доставка вернется после claimLease
+		if !errors.Is(err, ErrWebhookNotFound) {
+			log.Printf("webhooks: could not get webhook %s: %v", delivery.WebhookID, err)
+		}
+		return
+	}
+
+	start := time.Now()
+	statusCode, err := d.send(ctx, hook, delivery)
+	if ctx.Err() != nil {
+		// сервер останавливается - попытка не засчитывается
+		return
+	}
+
+	attempt := Attempt{At: start, StatusCode: statusCode, Duration: time.Since(start)}
+	attempts := delivery.Attempts + 1
+	status := StatusSucceeded
+	var next time.Time
+	if err != nil {
+		attempt.Error = err.Error()
+		status = StatusFailed
+		if attempts < d.MaxAttempts {
+			status = StatusPending
+			next = time.Now().Add(d.backoff(attempts))
+		}
+	}
+
+	err = d.store.RecordAttempt(delivery.ID, attempt, status, attempts, next)
+	if err != nil && !errors.Is(err, ErrDeliveryNotFound) {
+		log.Printf("webhooks: could not record attempt of delivery %s: %v", delivery.ID, err)
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context, hook *Webhook, delivery *Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Postery-Webhook/1.0")
+	req.Header.Set(HeaderEvent, string(delivery.Event))
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff - задержка после attempts неудачных попыток: RetryBase, 2*RetryBase, 4*RetryBase... не больше MaxRetryDelay
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.RetryBase
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= d.MaxRetryDelay {
+			return d.MaxRetryDelay
+		}
+	}
+	return delay
+}
+
+// deniedNetworks - диапазоны специального назначения (RFC 6890 и реестры IANA): внутренние, служебные,
+// документационные, зарезервированные и групповые. Сюда же входят префиксы трансляции IPv4 в IPv6 (NAT64, 6to4,
+// Teredo), через которые можно попасть во внутреннюю сеть IPv4.
+var deniedNetworks = parseNetworks(
+	"0.0.0.0/8",       // "эта" сеть
+	"10.0.0.0/8",      // частная сеть
+	"100.64.0.0/10",   // CGNAT
+	"127.0.0.0/8",     // loopback
+	"169.254.0.0/16",  // link-local
+	"172.16.0.0/12",   // частная сеть
+	"192.0.0.0/24",    // служебные адреса IETF
+	"192.0.2.0/24",    // TEST-NET-1
+	"192.88.99.0/24",  // ретрансляция 6to4
+	"192.168.0.0/16",  // частная сеть
+	"198.18.0.0/15",   // тестирование производительности
+	"198.51.100.0/24", // TEST-NET-2
+	"203.0.113.0/24",  // TEST-NET-3
+	"224.0.0.0/4",     // multicast
+	"240.0.0.0/4",     // зарезервировано, включая broadcast
+	"::/128",          // неуказанный адрес
+	"::1/128",         // loopback
+	"64:ff9b::/96",    // NAT64
+	"64:ff9b:1::/48",  // локальный NAT64
+	"100::/64",        // discard
+	"2001::/23",       // служебные адреса IETF, включая Teredo
+	"2001:db8::/32",   // документация
+	"2002::/16",       // 6to4
+	"fc00::/7",        // unique local
+	"fe80::/10",       // link-local
+	"fec0::/10",       // site-local
+	"ff00::/8",        // multicast
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// denyPrivate запрещает соединение с адресом из deniedNetworks. Адреса IPv4, отображенные в IPv6 (::ffff:0:0/96),
+// проверяются как IPv4.
+func denyPrivate(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, network := range deniedNetworks {
+		if network.Contains(ip) {
+			return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+		}
+	}
+	return nil
+}
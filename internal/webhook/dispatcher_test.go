@@ -0,0 +1,174 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/storage/memory"
+	"github.com/VitaminP8/postery/internal/subscription"
+	"github.com/VitaminP8/postery/internal/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startDispatcher запускает отправителя с короткими задержками, которому разрешены локальные адреса httptest
+func startDispatcher(t *testing.T, store webhook.WebhookStorage, maxAttempts int) *webhook.Dispatcher {
+	d := webhook.NewDispatcher(store, true)
+	d.RetryBase = 10 * time.Millisecond
+	d.MaxRetryDelay = 20 * time.Millisecond
+	d.MaxAttempts = maxAttempts
+	d.PollInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go d.Run(ctx)
+	return d
+}
+
+func waitDeliveries(t *testing.T, store webhook.WebhookStorage, webhookID string, done func([]*webhook.Delivery) bool) []*webhook.Delivery {
+	var deliveries []*webhook.Delivery
+	require.Eventually(t, func() bool {
+		var err error
+		deliveries, err = store.GetDeliveries(webhookID, 10)
+		require.NoError(t, err)
+		return done(deliveries)
+	}, 5*time.Second, 10*time.Millisecond)
+	return deliveries
+}
+
+func TestDispatcher_Deliver(t *testing.T) {
+	store := memory.NewWebhookMemoryStorage()
+
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer server.Close()
+
+	hook, err := store.CreateWebhook(&webhook.Webhook{OwnerID: "1", URL: server.URL, Events: []webhook.Event{webhook.EventPostPublished}, Secret: "secret"})
+	require.NoError(t, err)
+	// вебхук без подходящих событий не получает доставок
+	other, err := store.CreateWebhook(&webhook.Webhook{OwnerID: "1", URL: server.URL, Events: []webhook.Event{webhook.EventPostDeleted}, Secret: "secret"})
+	require.NoError(t, err)
+
+	d := startDispatcher(t, store, 3)
+	manager := d.Wrap(subscription.NewSubscriptionManager())
+	manager.Publish(subscription.PostsTopic, subscription.Event{Type: subscription.EventPostCreated, Payload: &model.Post{ID: "7", Title: "Hello", AuthorID: "1"}})
+
+	var req *http.Request
+	select {
+	case req = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+	body := <-bodies
+
+	assert.Equal(t, string(webhook.EventPostPublished), req.Header.Get(webhook.HeaderEvent))
+	assert.NoError(t, webhook.Verify("secret", req.Header.Get(webhook.HeaderSignature), req.Header.Get(webhook.HeaderTimestamp), body, time.Minute, time.Now()))
+
+	var payload struct {
+		Event webhook.Event    `json:"event"`
+		Data  webhook.PostData `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(body, &payload))
+	assert.Equal(t, webhook.EventPostPublished, payload.Event)
+	assert.Equal(t, "7", payload.Data.ID)
+	assert.Equal(t, "Hello", payload.Data.Title)
+
+	deliveries := waitDeliveries(t, store, hook.ID, func(deliveries []*webhook.Delivery) bool {
+		return len(deliveries) == 1 && deliveries[0].Status == webhook.StatusSucceeded
+	})
+	assert.Equal(t, req.Header.Get(webhook.HeaderDelivery), deliveries[0].ID)
+	require.Len(t, deliveries[0].Log, 1)
+	assert.Equal(t, http.StatusOK, deliveries[0].Log[0].StatusCode)
+
+	otherDeliveries, err := store.GetDeliveries(other.ID, 10)
+	require.NoError(t, err)
+	assert.Empty(t, otherDeliveries)
+}
+
+func TestDispatcher_RetryAndRedeliver(t *testing.T) {
+	store := memory.NewWebhookMemoryStorage()
+
+	var healthy atomic.Bool
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	hook, err := store.CreateWebhook(&webhook.Webhook{OwnerID: "1", URL: server.URL, Events: []webhook.Event{webhook.EventPostDeleted}, Secret: "secret"})
+	require.NoError(t, err)
+
+	d := startDispatcher(t, store, 3)
+	d.Enqueue(subscription.PostTopic("7"), subscription.Event{Type: subscription.EventPostDeleted, Payload: "7"})
+
+	deliveries := waitDeliveries(t, store, hook.ID, func(deliveries []*webhook.Delivery) bool {
+		return len(deliveries) == 1 && deliveries[0].Status == webhook.StatusFailed
+	})
+	failed := deliveries[0]
+	assert.Equal(t, 3, failed.Attempts)
+	require.Len(t, failed.Log, 3)
+	for _, attempt := range failed.Log {
+		assert.Equal(t, http.StatusInternalServerError, attempt.StatusCode)
+		assert.Equal(t, "unexpected response status 500", attempt.Error)
+	}
+	assert.Equal(t, int32(3), calls.Load())
+
+	t.Run("Redeliver failed delivery", func(t *testing.T) {
+		healthy.Store(true)
+		retried, err := d.Redeliver(failed.ID)
+		require.NoError(t, err)
+		assert.Equal(t, webhook.StatusPending, retried.Status)
+
+		deliveries := waitDeliveries(t, store, hook.ID, func(deliveries []*webhook.Delivery) bool {
+			return deliveries[0].Status == webhook.StatusSucceeded
+		})
+		assert.Len(t, deliveries[0].Log, 4)
+		assert.Equal(t, http.StatusOK, deliveries[0].Log[3].StatusCode)
+
+		_, err = d.Redeliver(failed.ID)
+		assert.ErrorIs(t, err, webhook.ErrNotFailed)
+	})
+}
+
+func TestDispatcher_DenyPrivateAddress(t *testing.T) {
+	store := memory.NewWebhookMemoryStorage()
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer server.Close()
+
+	hook, err := store.CreateWebhook(&webhook.Webhook{OwnerID: "1", URL: server.URL, Events: []webhook.Event{webhook.EventPostDeleted}, Secret: "secret"})
+	require.NoError(t, err)
+
+	d := webhook.NewDispatcher(store, false)
+	d.MaxAttempts = 1
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+
+	d.Enqueue(subscription.PostTopic("7"), subscription.Event{Type: subscription.EventPostDeleted, Payload: "7"})
+
+	deliveries := waitDeliveries(t, store, hook.ID, func(deliveries []*webhook.Delivery) bool {
+		return len(deliveries) == 1 && deliveries[0].Status == webhook.StatusFailed
+	})
+	require.Len(t, deliveries[0].Log, 1)
+	assert.Contains(t, deliveries[0].Log[0].Error, webhook.ErrPrivateAddress.Error())
+	assert.Equal(t, int32(0), calls.Load())
+}
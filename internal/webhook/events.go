@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"github.com/VitaminP8/postery/graph/model"
+	"github.com/VitaminP8/postery/internal/subscription"
+)
+
+// Payload - тело запроса доставки
+type Payload struct {
+	Event Event `json:"event"`
+	// CreatedAt - время события в RFC 3339
+	CreatedAt string `json:"createdAt"`
+	// Data - PostData, CommentData или DeletedPostData
+	Data interface{} `json:"data"`
+}
+
+type PostData struct {
+	ID               string `json:"id"`
+	Title            string `json:"title"`
+	Content          string `json:"content"`
+	AuthorID         string `json:"authorID"`
+	CommentsDisabled bool   `json:"commentsDisabled"`
+}
+
+type CommentData struct {
+	ID       string `json:"id"`
+	PostID   string `json:"postID"`
+	ParentID string `json:"parentID,omitempty"`
+	AuthorID string `json:"authorID"`
+	Content  string `json:"content"`
+	// CreatedAt - время создания в формате хранилища, как в поле Comment.createdAt
+	CreatedAt string `json:"createdAt"`
+}
+
+// DeletedPostData - у удаленного поста известен только ID
+type DeletedPostData struct {
+	ID string `json:"id"`
+}
+
+// eventFor сопоставляет событие подписок событию вебхука. Одно действие публикуется в несколько тем (лента
+// подписчиков автора, ветки предков комментария) - вебхук создается только для основной темы действия.
+func eventFor(topic string, event subscription.Event) (Event, interface{}, bool) {
+	switch payload := event.Payload.(type) {
+	case *model.Comment:
+		if event.Type != subscription.EventCommentAdded || topic != subscription.CommentsTopic(payload.PostID) {
+			return "", nil, false
+		}
+		data := CommentData{
+			ID:        payload.ID,
+			PostID:    payload.PostID,
+			AuthorID:  payload.AuthorID,
+			Content:   payload.Content,
+			CreatedAt: payload.CreatedAt,
+		}
+		if payload.ParentID != nil {
+			data.ParentID = *payload.ParentID
+		}
+		return EventCommentCreated, data, true
+
+	case *model.Post:
+		data := PostData{
+			ID:               payload.ID,
+			Title:            payload.Title,
+			Content:          payload.Content,
+			AuthorID:         payload.AuthorID,
+			CommentsDisabled: payload.CommentsDisabled,
+		}
+		switch {
+		case event.Type == subscription.EventPostCreated && topic == subscription.PostsTopic:
+			return EventPostPublished, data, true
+		case event.Type == subscription.EventPostUpdated && topic == subscription.PostTopic(payload.ID):
+			return EventPostUpdated, data, true
+		case event.Type == subscription.EventCommentsToggled && topic == subscription.PostTopic(payload.ID):
+			return EventCommentsToggled, data, true
+		}
+
+	case string:
+		if event.Type == subscription.EventPostDeleted && topic == subscription.PostTopic(payload) {
+			return EventPostDeleted, DeletedPostData{ID: payload}, true
+		}
+	}
+	return "", nil, false
+}
@@ -0,0 +1,191 @@
+// Package webhook - исходящие вебхуки: события постов и комментариев отправляются POST запросом на адреса,
+// зарегистрированные пользователями, с HMAC подписью тела, повторами с экспоненциальной задержкой и журналом доставок
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event - тип события вебхука; передается в заголовке HeaderEvent и в поле event тела
+type Event string
+
+const (
+	EventCommentCreated  Event = "comment.created"
+	EventPostPublished   Event = "post.published"
+	EventPostUpdated     Event = "post.updated"
+	EventPostDeleted     Event = "post.deleted"
+	EventCommentsToggled Event = "post.comments_toggled"
+)
+
+// Status - состояние доставки
+type Status string
+
+const (
+	// StatusPending - доставка еще не удалась, следующая попытка - в NextAttemptAt
+	StatusPending Status = "pending"
+	// StatusSucceeded - получатель ответил 2xx
+	StatusSucceeded Status = "succeeded"
+	// StatusFailed - попытки исчерпаны; доставку можно повторить через Redeliver
+	StatusFailed Status = "failed"
+)
+
+// Заголовки запроса доставки
+const (
+	HeaderEvent     = "X-Postery-Event"
+	HeaderDelivery  = "X-Postery-Delivery"
+	HeaderTimestamp = "X-Postery-Timestamp"
+	// HeaderSignature - "sha256=" и HMAC-SHA256 секрета вебхука от "<timestamp>.<тело>" в hex
+	HeaderSignature = "X-Postery-Signature"
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	// ErrNotFailed - повторить можно только доставку, попытки которой исчерпаны
+	ErrNotFailed = errors.New("only failed deliveries can be redelivered")
+	// ErrInvalidSignature - подпись не совпадает или устарела
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+)
+
+// Webhook - адрес, на который отправляются события Events
+type Webhook struct {
+	ID      string
+	OwnerID string
+	URL     string
+	Events  []Event
+	// Secret - ключ подписи; хранится открыто, потому что нужен для каждой доставки
+	Secret    string
+	CreatedAt time.Time
+}
+
+// Accepts сообщает, подписан ли вебхук на событие
+func (w *Webhook) Accepts(event Event) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Attempt - одна попытка доставки
+type Attempt struct {
+	At time.Time
+	// StatusCode - код ответа получателя; 0, если ответа не было
+	StatusCode int
+	Error      string
+	Duration   time.Duration
+}
+
+// Delivery - событие для одного вебхука. Payload - тело запроса, оно не меняется между попытками.
+type Delivery struct {
+	ID        string
+	WebhookID string
+	Event     Event
+	Payload   []byte
+	Status    Status
+	// Attempts - попытки после создания или последнего Redeliver; от них считается задержка
+	Attempts      int
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	// Log - все попытки, начиная с первой
+	Log []Attempt
+}
+
+// WebhookStorage хранит вебхуки и журнал доставок
+type WebhookStorage interface {
+	// CreateWebhook сохраняет вебхук и заполняет ID и CreatedAt
+	CreateWebhook(hook *Webhook) (*Webhook, error)
+	// GetWebhook возвращает вебхук или ErrWebhookNotFound
+	GetWebhook(id string) (*Webhook, error)
+	// GetWebhooks возвращает вебхуки владельца (все вебхуки, если ownerID пуст), начиная с новых
+	GetWebhooks(ownerID string) ([]*Webhook, error)
+	// GetWebhooksForEvent возвращает вебхуки, подписанные на событие
+	GetWebhooksForEvent(event Event) ([]*Webhook, error)
+	// DeleteWebhook удаляет вебхук вместе с доставками; ErrWebhookNotFound, если его нет
+	DeleteWebhook(id string) error
+	// DeleteWebhooksByOwner удаляет вебхуки пользователя (при удалении аккаунта)
+	DeleteWebhooksByOwner(ownerID string) error
+
+	// CreateDelivery сохраняет доставку в состоянии StatusPending и заполняет ID и CreatedAt
+	CreateDelivery(delivery *Delivery) (*Delivery, error)
+	// GetDelivery возвращает доставку с журналом попыток или ErrDeliveryNotFound
+	GetDelivery(id string) (*Delivery, error)
+	// GetDeliveries возвращает не больше limit последних доставок вебхука с журналом попыток, начиная с новых
+	GetDeliveries(webhookID string, limit int) ([]*Delivery, error)
+	// ClaimDueDeliveries забирает не больше limit доставок StatusPending, у которых наступил NextAttemptAt,
+	// и переносит их NextAttemptAt на now+lease, чтобы другой экземпляр сервера не отправил их одновременно.
+	// Если отправитель упадет, доставка снова станет доступной после lease.
+	ClaimDueDeliveries(now time.Time, lease time.Duration, limit int) ([]*Delivery, error)
+	// RecordAttempt добавляет попытку в журнал и сохраняет новое состояние доставки
+	RecordAttempt(id string, attempt Attempt, status Status, attempts int, nextAttemptAt time.Time) error
+	// RetryDelivery возвращает доставку StatusFailed в очередь: StatusPending, Attempts = 0, NextAttemptAt = now.
+	// ErrNotFailed, если доставка в другом состоянии.
+	RetryDelivery(id string, now time.Time) (*Delivery, error)
+	// PruneDeliveries удаляет завершенные доставки, созданные раньше before
+	PruneDeliveries(before time.Time) error
+}
+
+// ValidateURL проверяет адрес вебхука: абсолютный http или https URL без учетных данных
+func ValidateURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", errors.New("webhook URL must use http or https")
+	}
+	if u.Hostname() == "" {
+		return "", errors.New("webhook URL must have a host")
+	}
+	if u.User != nil {
+		return "", errors.New("webhook URL must not contain credentials")
+	}
+	return u.String(), nil
+}
+
+// NewSecret генерирует секрет подписи
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("could not generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign возвращает значение HeaderSignature для тела, отправленного в момент timestamp (Unix секунды).
+// Время входит в подпись, чтобы перехваченный запрос нельзя было повторить позже.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify проверяет подпись запроса на стороне получателя: signature и timestamp - значения заголовков
+// HeaderSignature и HeaderTimestamp; запрос старше tolerance отклоняется
+func Verify(secret, signature, timestamp string, body []byte, tolerance time.Duration, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	age := now.Sub(time.Unix(ts, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(Sign(secret, ts, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -1,14 +1,23 @@
 package models
 
-import "github.com/jinzhu/gorm"
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
 
 type User struct {
 	gorm.Model
 	Username string `gorm:"unique"`
 	Email    string `gorm:"unique"`
-	Password string
-	Posts    []Post    `gorm:"foreignkey:UserID"`
-	Comments []Comment `gorm:"foreignkey:UserID"`
+	// ключи для уникальности без учета регистра (identity.UsernameKey/EmailKey);
+	// уникальные индексы создает postgres.MigrateUserKeys после заполнения старых записей
+	UsernameKey string
+	EmailKey    *string // NULL для аккаунтов без email
+	Password    string
+	Role        string    `gorm:"default:'USER'"`
+	Posts       []Post    `gorm:"foreignkey:UserID"`
+	Comments    []Comment `gorm:"foreignkey:UserID"`
 }
 
 type Post struct {
@@ -29,3 +38,147 @@ type Comment struct {
 	HasReplies bool      `gorm:"default:false"`
 	Children   []Comment `gorm:"foreignkey:ParentID"`
 }
+
+// TokenRevocation - момент, до которого (включительно) выданные пользователю токены недействительны
+type TokenRevocation struct {
+	UserID        uint `gorm:"primary_key;auto_increment:false"`
+	RevokedBefore time.Time
+}
+
+// UserIdentity связывает пользователя с учетной записью внешнего OIDC провайдера
+type UserIdentity struct {
+	ID        uint   `gorm:"primary_key"`
+	Issuer    string `gorm:"unique_index:idx_identity_issuer_subject"`
+	Subject   string `gorm:"unique_index:idx_identity_issuer_subject"`
+	UserID    uint   `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// AccessToken - персональный токен доступа, хранится только SHA-256 хэш
+type AccessToken struct {
+	ID         uint `gorm:"primary_key"`
+	UserID     uint `gorm:"index"`
+	Name       string
+	TokenHash  string `gorm:"unique_index"`
+	Scopes     string // через запятую
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+}
+
+// UserTwoFactor - настройки TOTP пользователя; секрет зашифрован, коды восстановления хранятся хэшами
+type UserTwoFactor struct {
+	UserID        uint `gorm:"primary_key;auto_increment:false"`
+	Secret        string
+	Enabled       bool
+	RecoveryCodes string // хэши через запятую
+	LastStep      int64
+	UpdatedAt     time.Time
+}
+
+// UserRelation - направленное отношение пользователя к другому пользователю (блокировка, скрытие)
+type UserRelation struct {
+	ID        uint   `gorm:"primary_key"`
+	UserID    uint   `gorm:"unique_index:idx_relation_user_target_kind"`
+	TargetID  uint   `gorm:"unique_index:idx_relation_user_target_kind;index"`
+	Kind      string `gorm:"unique_index:idx_relation_user_target_kind"`
+	CreatedAt time.Time
+}
+
+// Session - вход пользователя с устройства, ID записывается в JWT (claim "sid")
+type Session struct {
+	ID         string `gorm:"primary_key"`
+	UserID     uint   `gorm:"index"`
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time `gorm:"index"`
+	LastSeenAt time.Time
+}
+
+// UsernameChange - прежнее имя пользователя; по нему находится аккаунт, а в течение grace period имя не может занять другой
+type UsernameChange struct {
+	ID          uint `gorm:"primary_key"`
+	UserID      uint `gorm:"index"`
+	Username    string
+	UsernameKey string    `gorm:"index"`
+	ChangedAt   time.Time `gorm:"index"`
+}
+
+// Mention - пользователь, упомянутый в посте или комментарии
+type Mention struct {
+	ID        uint   `gorm:"primary_key"`
+	Kind      string `gorm:"unique_index:idx_mention_content_user"`
+	ContentID uint   `gorm:"unique_index:idx_mention_content_user"`
+	UserID    uint   `gorm:"unique_index:idx_mention_content_user;index"`
+}
+
+// Invite - приглашение для регистрации; код хранится только хэшем
+type Invite struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedBy uint
+	Email     string
+	CodeHash  string `gorm:"unique_index"`
+	MaxUses   int
+	Uses      int
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Revoked   bool
+}
+
+// InviteRedemption - пользователь, зарегистрированный по приглашению (кто кого пригласил)
+type InviteRedemption struct {
+	ID        uint `gorm:"primary_key"`
+	InviteID  uint `gorm:"index"`
+	UserID    uint `gorm:"unique_index"`
+	CreatedAt time.Time
+}
+
+// SubscriptionEvent - событие подписки, опубликованное через Postgres NOTIFY. Seq - номер события в теме
+// для повторной доставки после переподключения; события, которые не помещаются в уведомление (8000 байт),
+// получатели читают отсюда по ID.
+type SubscriptionEvent struct {
+	ID        uint      `gorm:"primary_key"`
+	Topic     string    `gorm:"index:idx_subscription_events_topic_seq;not null"`
+	Seq       uint64    `gorm:"index:idx_subscription_events_topic_seq"`
+	Data      string    `gorm:"type:text"`
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// SubscriptionTopic - счетчик номеров событий темы. Строки не удаляются вместе с событиями: иначе номера
+// начались бы заново, и клиент с прежним since пропустил бы новые события.
+type SubscriptionTopic struct {
+	Topic string `gorm:"primary_key"`
+	Seq   uint64 `gorm:"not null"`
+}
+
+// Webhook - адрес для исходящих событий; Events - типы событий через запятую
+type Webhook struct {
+	ID        uint `gorm:"primary_key"`
+	OwnerID   uint `gorm:"index"`
+	URL       string
+	Events    string
+	Secret    string
+	CreatedAt time.Time
+}
+
+// WebhookDelivery - событие для одного вебхука и состояние его отправки
+type WebhookDelivery struct {
+	ID            uint `gorm:"primary_key"`
+	WebhookID     uint `gorm:"index"`
+	Event         string
+	Payload       string `gorm:"type:text"`
+	Status        string `gorm:"index"`
+	Attempts      int
+	NextAttemptAt time.Time `gorm:"index"`
+	CreatedAt     time.Time
+}
+
+// WebhookAttempt - попытка доставки: код ответа или ошибка соединения
+type WebhookAttempt struct {
+	ID         uint `gorm:"primary_key"`
+	DeliveryID uint `gorm:"index"`
+	StatusCode int
+	Error      string `gorm:"type:text"`
+	DurationMs int64
+	CreatedAt  time.Time
+}